@@ -0,0 +1,29 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+)
+
+// APIKeyPrefix starts every API key, so that leaked keys are easy to find.
+const APIKeyPrefix = "bm_"
+
+// apiKeyPrefixLength is the number of characters of a key that are stored in
+// the clear, to tell keys apart.
+const apiKeyPrefixLength = len(APIKeyPrefix) + 8
+
+// NewAPIKey returns a random API key, the prefix to store with it and its
+// hash. Only the prefix and the hash are stored.
+func NewAPIKey() (key, prefix, hash string) {
+    key = APIKeyPrefix + NewID()
+    return key, key[:apiKeyPrefixLength], HashAPIKey(key)
+}
+
+// HashAPIKey returns the SHA-256 hash of key in hex. Unlike passwords, keys
+// are random enough that a fast hash can't be brute-forced, which allows
+// looking them up by their hash.
+func HashAPIKey(key string) string {
+    sum := sha256.Sum256([]byte(strings.TrimSpace(key)))
+    return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,31 @@
+package auth
+
+import (
+	"sync"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// HashPassword returns the bcrypt hash of password.
+func HashPassword(password string) (string, error) {
+    hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+    return string(hash), err
+}
+
+// CheckPassword reports whether password matches a hash returned by HashPassword.
+func CheckPassword(hash, password string) bool {
+    return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil
+}
+
+// dummyHash is compared against when a user doesn't exist, so that signing in
+// takes as long as for existing users.
+var dummyHash = sync.OnceValue(func() string {
+    hash, _ := HashPassword("not the password of any user")
+    return hash
+})
+
+// CheckNoPassword takes as long as CheckPassword and returns false.
+func CheckNoPassword(password string) bool {
+    CheckPassword(dummyHash(), password)
+    return false
+}
@@ -0,0 +1,108 @@
+// Package auth issues and checks the JWTs, password hashes and API keys used
+// to authenticate users and scripts.
+package auth
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Token types, stored in the typ claim so that a refresh token can't be used
+// as an access token and vice versa.
+const (
+    AccessToken  = "access"
+    RefreshToken = "refresh"
+)
+
+// MinSecretLength is the minimum length of the HMAC secret in bytes.
+const MinSecretLength = 32
+
+// ErrInvalidToken is returned by Parse for tokens that are malformed,
+// expired, of the wrong type or not signed with the secret.
+var ErrInvalidToken = errors.New("invalid or expired token")
+
+// Claims are the claims of access and refresh tokens. The subject is the
+// user ID and the ID identifies the token within its session.
+type Claims struct {
+    jwt.RegisteredClaims
+    Type      string `json:"typ"`
+    SessionID string `json:"sid"`
+}
+
+// UserID returns the ID of the user the token was issued to.
+func (c *Claims) UserID() uint {
+    id, _ := strconv.ParseUint(c.Subject, 10, 64)
+    return uint(id)
+}
+
+// Tokens issues and parses HMAC-SHA256 signed JWTs.
+type Tokens struct {
+    secret     []byte
+    AccessTTL  time.Duration
+    RefreshTTL time.Duration
+}
+
+// NewTokens returns Tokens signing with secret, which must have at least
+// MinSecretLength bytes.
+func NewTokens(secret []byte, accessTTL, refreshTTL time.Duration) (*Tokens, error) {
+    if len(secret) < MinSecretLength {
+        return nil, fmt.Errorf("the token secret needs at least %d bytes", MinSecretLength)
+    }
+    return &Tokens{secret: secret, AccessTTL: accessTTL, RefreshTTL: refreshTTL}, nil
+}
+
+// NewRandomTokens returns Tokens signing with a random secret, so that its
+// tokens become invalid when the process exits.
+func NewRandomTokens(accessTTL, refreshTTL time.Duration) *Tokens {
+    secret := make([]byte, MinSecretLength)
+    rand.Read(secret)
+    return &Tokens{secret: secret, AccessTTL: accessTTL, RefreshTTL: refreshTTL}
+}
+
+// NewID returns a random ID for sessions and tokens.
+func NewID() string {
+    b := make([]byte, 16)
+    rand.Read(b)
+    return hex.EncodeToString(b)
+}
+
+// Issue returns a signed token of the given type for a user's session,
+// identified by id and expiring after the TTL of the type.
+func (t *Tokens) Issue(tokenType string, userID uint, sessionID, id string) (string, time.Time, error) {
+    ttl := t.AccessTTL
+    if tokenType == RefreshToken {
+        ttl = t.RefreshTTL
+    }
+    now := time.Now()
+    expires := now.Add(ttl)
+    claims := Claims{
+        RegisteredClaims: jwt.RegisteredClaims{
+            Subject:   strconv.FormatUint(uint64(userID), 10),
+            ID:        id,
+            IssuedAt:  jwt.NewNumericDate(now),
+            ExpiresAt: jwt.NewNumericDate(expires),
+        },
+        Type:      tokenType,
+        SessionID: sessionID,
+    }
+    signed, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(t.secret)
+    return signed, expires, err
+}
+
+// Parse checks the signature, expiry and type of a token and returns its claims.
+func (t *Tokens) Parse(token, tokenType string) (*Claims, error) {
+    var claims Claims
+    _, err := jwt.ParseWithClaims(token, &claims, func(*jwt.Token) (interface{}, error) {
+        return t.secret, nil
+    }, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}), jwt.WithExpirationRequired())
+    if err != nil || claims.Type != tokenType || claims.SessionID == "" || claims.UserID() == 0 {
+        return nil, ErrInvalidToken
+    }
+    return &claims, nil
+}
@@ -0,0 +1,419 @@
+package config
+
+import (
+	"book-manager/ratelimit"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/netip"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// EnvPrefix is the prefix of the environment variables read by Load.
+const EnvPrefix = "BOOK_MANAGER_"
+
+// Config holds the server settings.
+//
+// Settings are read, from lowest to highest precedence, from the defaults,
+// an optional YAML or TOML file (--config or BOOK_MANAGER_CONFIG),
+// BOOK_MANAGER_* environment variables and command line flags.
+type Config struct {
+    Addr           string          `yaml:"addr" toml:"addr"`
+    DatabaseDSN    string          `yaml:"database_dsn" toml:"database_dsn"`
+    AllowedOrigins []string        `yaml:"allowed_origins" toml:"allowed_origins"`
+    LogLevel       string          `yaml:"log_level" toml:"log_level"`
+    ReadTimeout    time.Duration   `yaml:"read_timeout" toml:"read_timeout"`
+    WriteTimeout   time.Duration   `yaml:"write_timeout" toml:"write_timeout"`
+    IdleTimeout    time.Duration   `yaml:"idle_timeout" toml:"idle_timeout"`
+    TrashRetention time.Duration   `yaml:"trash_retention" toml:"trash_retention"`
+    CoverDir       string          `yaml:"cover_dir" toml:"cover_dir"`
+    MaxCoverSize   int64           `yaml:"max_cover_size" toml:"max_cover_size"`
+    JWTSecret      string          `yaml:"jwt_secret" toml:"jwt_secret"`
+    AccessTTL      time.Duration   `yaml:"access_token_ttl" toml:"access_token_ttl"`
+    RefreshTTL     time.Duration   `yaml:"refresh_token_ttl" toml:"refresh_token_ttl"`
+    RateLimitRead  ratelimit.Limit `yaml:"rate_limit_read" toml:"rate_limit_read"`
+    RateLimitWrite ratelimit.Limit `yaml:"rate_limit_write" toml:"rate_limit_write"`
+    RateLimitURLs  ratelimit.Limit `yaml:"rate_limit_urls" toml:"rate_limit_urls"`
+    RateLimitAuth  ratelimit.Limit `yaml:"rate_limit_auth" toml:"rate_limit_auth"`
+    TrustedProxies []string        `yaml:"trusted_proxies" toml:"trusted_proxies"`
+
+    ConfigFile  string `yaml:"-" toml:"-"`
+    PrintConfig bool   `yaml:"-" toml:"-"`
+}
+
+// LogLevels are the accepted values of Config.LogLevel.
+var LogLevels = []string{"debug", "info", "warn", "error"}
+
+// SlogLevel returns LogLevel as a log/slog level. Requests are logged at info
+// level, so "warn" only logs failures.
+func (c *Config) SlogLevel() slog.Level {
+    var level slog.Level
+    level.UnmarshalText([]byte(c.LogLevel)) // every one of LogLevels is a slog level
+    return level
+}
+
+// TrustedProxyPrefixes returns TrustedProxies as address ranges. A single
+// address is a range of one. Validate rejects entries that don't parse, which
+// are left out.
+func (c *Config) TrustedProxyPrefixes() []netip.Prefix {
+    var prefixes []netip.Prefix
+    for _, proxy := range c.TrustedProxies {
+        if prefix, err := parseProxy(proxy); err == nil {
+            prefixes = append(prefixes, prefix)
+        }
+    }
+    return prefixes
+}
+
+// parseProxy reads an address like 10.0.0.1 or a CIDR range like 10.0.0.0/8.
+func parseProxy(proxy string) (netip.Prefix, error) {
+    if strings.Contains(proxy, "/") {
+        prefix, err := netip.ParsePrefix(proxy)
+        return prefix.Masked(), err
+    }
+    addr, err := netip.ParseAddr(proxy)
+    if err != nil {
+        return netip.Prefix{}, err
+    }
+    addr = addr.Unmap()
+    return netip.PrefixFrom(addr, addr.BitLen()), nil
+}
+
+// Default returns the settings used when nothing else is configured.
+func Default() *Config {
+    return &Config{
+        Addr:           ":8000",
+        DatabaseDSN:    "books.db",
+        AllowedOrigins: []string{"http://localhost:3000"},
+        LogLevel:       "info",
+        ReadTimeout:    15 * time.Second,
+        WriteTimeout:   30 * time.Second,
+        IdleTimeout:    60 * time.Second,
+        TrashRetention: 30 * 24 * time.Hour,
+        CoverDir:       "covers",
+        MaxCoverSize:   5 << 20,
+        AccessTTL:      15 * time.Minute,
+        RefreshTTL:     30 * 24 * time.Hour,
+        RateLimitRead:  ratelimit.Limit{Requests: 600, Period: time.Minute},
+        RateLimitWrite: ratelimit.Limit{Requests: 60, Period: time.Minute},
+        RateLimitURLs:  ratelimit.Limit{Requests: 10, Period: time.Minute},
+        RateLimitAuth:  ratelimit.Limit{Requests: 10, Period: time.Minute},
+    }
+}
+
+// setting describes one configuration value and how to read it from a string.
+type setting struct {
+    name  string // flag name, the environment variable is derived from it
+    usage string
+    get   func(c *Config) string
+    set   func(c *Config, value string) error
+}
+
+var settings = []setting{
+    {
+        name:  "addr",
+        usage: "listen address",
+        get:   func(c *Config) string { return c.Addr },
+        set:   func(c *Config, v string) error { c.Addr = v; return nil },
+    },
+    {
+        name:  "db",
+        usage: "database DSN",
+        get:   func(c *Config) string { return c.DatabaseDSN },
+        set:   func(c *Config, v string) error { c.DatabaseDSN = v; return nil },
+    },
+    {
+        name:  "cors-origins",
+        usage: "comma separated list of allowed CORS origins, * allows any origin",
+        get:   func(c *Config) string { return strings.Join(c.AllowedOrigins, ",") },
+        set:   func(c *Config, v string) error { c.AllowedOrigins = splitList(v); return nil },
+    },
+    {
+        name:  "log-level",
+        usage: "log level (" + strings.Join(LogLevels, ", ") + ")",
+        get:   func(c *Config) string { return c.LogLevel },
+        set:   func(c *Config, v string) error { c.LogLevel = strings.ToLower(v); return nil },
+    },
+    durationSetting("read-timeout", "maximum duration for reading a request", func(c *Config) *time.Duration { return &c.ReadTimeout }),
+    durationSetting("write-timeout", "maximum duration before timing out writes of a response", func(c *Config) *time.Duration { return &c.WriteTimeout }),
+    durationSetting("idle-timeout", "maximum time to wait for the next request on keep-alive connections", func(c *Config) *time.Duration { return &c.IdleTimeout }),
+    durationSetting("trash-retention", "how long deleted books stay in the trash before they are purged (0 keeps them forever)", func(c *Config) *time.Duration { return &c.TrashRetention }),
+    {
+        name:  "cover-dir",
+        usage: "directory where cover images are stored",
+        get:   func(c *Config) string { return c.CoverDir },
+        set:   func(c *Config, v string) error { c.CoverDir = v; return nil },
+    },
+    {
+        name:  "max-cover-size",
+        usage: "maximum size of an uploaded cover image in bytes",
+        get:   func(c *Config) string { return strconv.FormatInt(c.MaxCoverSize, 10) },
+        set: func(c *Config, v string) error {
+            size, err := strconv.ParseInt(v, 10, 64)
+            if err != nil {
+                return err
+            }
+            c.MaxCoverSize = size
+            return nil
+        },
+    },
+    {
+        name:  "jwt-secret",
+        usage: "secret of at least 32 bytes signing the access and refresh tokens, random if empty",
+        get:   func(c *Config) string { return c.JWTSecret },
+        set:   func(c *Config, v string) error { c.JWTSecret = v; return nil },
+    },
+    durationSetting("access-token-ttl", "how long access tokens are valid", func(c *Config) *time.Duration { return &c.AccessTTL }),
+    durationSetting("refresh-token-ttl", "how long a sign-in lasts before the refresh token expires", func(c *Config) *time.Duration { return &c.RefreshTTL }),
+    limitSetting("rate-limit-read", "requests per client to routes that only read, like 600/1m, or off", func(c *Config) *ratelimit.Limit { return &c.RateLimitRead }),
+    limitSetting("rate-limit-write", "requests per client to routes that change something", func(c *Config) *ratelimit.Limit { return &c.RateLimitWrite }),
+    limitSetting("rate-limit-urls", "requests per client to POST /process-url", func(c *Config) *ratelimit.Limit { return &c.RateLimitURLs }),
+    limitSetting("rate-limit-auth", "requests per client IP to register, sign in and refresh tokens, and failed authentications per client IP", func(c *Config) *ratelimit.Limit { return &c.RateLimitAuth }),
+    {
+        name:  "trusted-proxies",
+        usage: "comma separated list of addresses or CIDR ranges of reverse proxies whose X-Forwarded-For and Forwarded headers name the client IP",
+        get:   func(c *Config) string { return strings.Join(c.TrustedProxies, ",") },
+        set:   func(c *Config, v string) error { c.TrustedProxies = splitList(v); return nil },
+    },
+}
+
+func durationSetting(name, usage string, field func(c *Config) *time.Duration) setting {
+    return setting{
+        name:  name,
+        usage: usage,
+        get:   func(c *Config) string { return field(c).String() },
+        set: func(c *Config, v string) error {
+            d, err := time.ParseDuration(v)
+            if err != nil {
+                return err
+            }
+            *field(c) = d
+            return nil
+        },
+    }
+}
+
+func limitSetting(name, usage string, field func(c *Config) *ratelimit.Limit) setting {
+    return setting{
+        name:  name,
+        usage: usage,
+        get:   func(c *Config) string { return field(c).String() },
+        set:   func(c *Config, v string) error { return field(c).UnmarshalText([]byte(v)) },
+    }
+}
+
+func envName(name string) string {
+    return EnvPrefix + strings.ToUpper(strings.ReplaceAll(name, "-", "_"))
+}
+
+func splitList(value string) []string {
+    var items []string
+    for _, item := range strings.Split(value, ",") {
+        if item = strings.TrimSpace(item); item != "" {
+            items = append(items, item)
+        }
+    }
+    return items
+}
+
+// Load builds the configuration from the command line arguments (without the
+// program name), the environment and the config file, and validates it.
+func Load(args []string) (*Config, error) {
+    cfg := Default()
+
+    fs := flag.NewFlagSet("book-manager", flag.ContinueOnError)
+    flagValues := map[string]*string{}
+    for _, s := range settings {
+        flagValues[s.name] = fs.String(s.name, s.get(cfg), s.usage+" (env "+envName(s.name)+")")
+    }
+    configFile := fs.String("config", os.Getenv(EnvPrefix+"CONFIG"), "path to a YAML or TOML config file (env "+EnvPrefix+"CONFIG)")
+    printConfig := fs.Bool("print-config", false, "print the effective configuration and exit")
+
+    if err := fs.Parse(args); err != nil {
+        return nil, err
+    }
+
+    cfg.ConfigFile = *configFile
+    cfg.PrintConfig = *printConfig
+
+    if cfg.ConfigFile != "" {
+        if err := cfg.loadFile(cfg.ConfigFile); err != nil {
+            return nil, err
+        }
+    }
+
+    for _, s := range settings {
+        if value, ok := os.LookupEnv(envName(s.name)); ok {
+            if err := s.set(cfg, value); err != nil {
+                return nil, fmt.Errorf("invalid %s: %v", envName(s.name), err)
+            }
+        }
+    }
+
+    var flagErr error
+    fs.Visit(func(f *flag.Flag) {
+        for _, s := range settings {
+            if s.name == f.Name && flagErr == nil {
+                if err := s.set(cfg, *flagValues[s.name]); err != nil {
+                    flagErr = fmt.Errorf("invalid -%s: %v", s.name, err)
+                }
+            }
+        }
+    })
+    if flagErr != nil {
+        return nil, flagErr
+    }
+
+    if err := cfg.Validate(); err != nil {
+        return nil, err
+    }
+    return cfg, nil
+}
+
+// loadFile reads settings from a YAML (.yaml, .yml) or TOML (.toml) file.
+// Settings missing from the file keep their current value.
+func (c *Config) loadFile(path string) error {
+    data, err := os.ReadFile(path)
+    if err != nil {
+        return fmt.Errorf("reading config file: %v", err)
+    }
+
+    file := *c
+    switch ext := strings.ToLower(filepath.Ext(path)); ext {
+    case ".yaml", ".yml":
+        err = yaml.Unmarshal(data, &file)
+    case ".toml":
+        _, err = toml.Decode(string(data), &file)
+    default:
+        return fmt.Errorf("unsupported config file type %q, use .yaml, .yml or .toml", ext)
+    }
+    if err != nil {
+        return fmt.Errorf("parsing config file %s: %v", path, err)
+    }
+
+    file.LogLevel = strings.ToLower(file.LogLevel)
+    *c = file
+    return nil
+}
+
+// Validate checks that the settings are usable.
+func (c *Config) Validate() error {
+    var problems []string
+
+    if _, _, err := net.SplitHostPort(c.Addr); err != nil {
+        problems = append(problems, fmt.Sprintf("addr %q is not a valid listen address", c.Addr))
+    }
+
+    if strings.TrimSpace(c.DatabaseDSN) == "" {
+        problems = append(problems, "database DSN is required")
+    }
+
+    if len(c.AllowedOrigins) == 0 {
+        problems = append(problems, "at least one allowed origin is required")
+    }
+    for _, origin := range c.AllowedOrigins {
+        if origin == "*" {
+            continue
+        }
+        if u, err := url.Parse(origin); err != nil || u.Scheme == "" || u.Host == "" || (u.Path != "" && u.Path != "/") {
+            problems = append(problems, fmt.Sprintf("allowed origin %q must be * or a scheme://host[:port] origin", origin))
+        }
+    }
+
+    validLevel := false
+    for _, level := range LogLevels {
+        validLevel = validLevel || c.LogLevel == level
+    }
+    if !validLevel {
+        problems = append(problems, fmt.Sprintf("log level %q must be one of %s", c.LogLevel, strings.Join(LogLevels, ", ")))
+    }
+
+    if c.ReadTimeout <= 0 || c.WriteTimeout <= 0 || c.IdleTimeout <= 0 {
+        problems = append(problems, "read, write and idle timeouts must be positive")
+    }
+
+    if c.TrashRetention < 0 {
+        problems = append(problems, "trash retention must not be negative")
+    }
+
+    if strings.TrimSpace(c.CoverDir) == "" {
+        problems = append(problems, "cover directory is required")
+    }
+
+    if c.MaxCoverSize <= 0 {
+        problems = append(problems, "maximum cover size must be positive")
+    }
+
+    if c.JWTSecret != "" && len(c.JWTSecret) < 32 {
+        problems = append(problems, "JWT secret must have at least 32 bytes")
+    }
+
+    if c.AccessTTL <= 0 || c.RefreshTTL < c.AccessTTL {
+        problems = append(problems, "access token TTL must be positive and not longer than the refresh token TTL")
+    }
+
+    for _, proxy := range c.TrustedProxies {
+        if _, err := parseProxy(proxy); err != nil {
+            problems = append(problems, fmt.Sprintf("trusted proxy %q must be an IP address or CIDR range", proxy))
+        }
+    }
+
+    if len(problems) > 0 {
+        return fmt.Errorf("invalid configuration: %s", strings.Join(problems, "; "))
+    }
+    return nil
+}
+
+// String renders the effective settings as YAML, for --print-config.
+func (c *Config) String() string {
+    printable := map[string]interface{}{
+        "addr":              c.Addr,
+        "database_dsn":      redactDSN(c.DatabaseDSN),
+        "allowed_origins":   c.AllowedOrigins,
+        "log_level":         c.LogLevel,
+        "read_timeout":      c.ReadTimeout.String(),
+        "write_timeout":     c.WriteTimeout.String(),
+        "idle_timeout":      c.IdleTimeout.String(),
+        "trash_retention":   c.TrashRetention.String(),
+        "cover_dir":         c.CoverDir,
+        "max_cover_size":    c.MaxCoverSize,
+        "jwt_secret":        redactSecret(c.JWTSecret),
+        "access_token_ttl":  c.AccessTTL.String(),
+        "refresh_token_ttl": c.RefreshTTL.String(),
+        "rate_limit_read":   c.RateLimitRead.String(),
+        "rate_limit_write":  c.RateLimitWrite.String(),
+        "rate_limit_urls":   c.RateLimitURLs.String(),
+        "rate_limit_auth":   c.RateLimitAuth.String(),
+        "trusted_proxies":   c.TrustedProxies,
+    }
+    data, _ := yaml.Marshal(printable)
+    return string(data)
+}
+
+// redactSecret hides a secret, showing only whether it is set.
+func redactSecret(secret string) string {
+    if secret == "" {
+        return ""
+    }
+    return "xxxxx"
+}
+
+// redactDSN hides the password of URL style DSNs.
+func redactDSN(dsn string) string {
+    if u, err := url.Parse(dsn); err == nil && u.User != nil {
+        if _, ok := u.User.Password(); ok {
+            u.User = url.UserPassword(u.User.Username(), "xxxxx")
+            return u.String()
+        }
+    }
+    return dsn
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"book-manager/auth"
+	"book-manager/config"
+	"book-manager/database"
+	"book-manager/models"
+	"book-manager/repository"
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+const createAdminUsage = "usage: book-manager create-admin <username> [flags]\n" +
+    "Creates an admin with the password in BOOK_MANAGER_ADMIN_PASSWORD or on standard input,\n" +
+    "or makes an existing user an admin."
+
+// runCreateAdmin implements the create-admin subcommand, which is how the
+// first admin is made. args are the arguments after "create-admin".
+func runCreateAdmin(args []string) error {
+    if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+        return fmt.Errorf(createAdminUsage)
+    }
+    username, err := models.NormalizeUsername(args[0])
+    if err != nil {
+        return err
+    }
+
+    cfg, err := config.Load(args[1:])
+    if err != nil {
+        return err
+    }
+    db, err := database.Open(cfg.DatabaseDSN, cfg.LogLevel)
+    if err != nil {
+        return fmt.Errorf("failed to open database: %v", err)
+    }
+    books := repository.NewGormBookRepository(db)
+    ctx := context.Background()
+
+    user, err := books.GetUserByName(ctx, username)
+    if err == nil {
+        if _, err := books.SetUserRole(ctx, user.ID, models.UserAdmin); err != nil {
+            return err
+        }
+        fmt.Printf("Made user %s (ID %d) an admin\n", user.Username, user.ID)
+        return nil
+    }
+    if !errors.Is(err, repository.ErrNotFound) {
+        return err
+    }
+
+    password, err := readAdminPassword()
+    if err != nil {
+        return err
+    }
+    if len(password) < models.MinPasswordLength || len(password) > models.MaxPasswordLength {
+        return fmt.Errorf("password must have %d to %d bytes", models.MinPasswordLength, models.MaxPasswordLength)
+    }
+    hash, err := auth.HashPassword(password)
+    if err != nil {
+        return err
+    }
+    user = &models.User{Username: username, PasswordHash: hash, Role: models.UserAdmin}
+    if err := books.CreateUser(ctx, user); err != nil {
+        return err
+    }
+    fmt.Printf("Created admin %s (ID %d)\n", user.Username, user.ID)
+    return nil
+}
+
+// readAdminPassword returns BOOK_MANAGER_ADMIN_PASSWORD if it is set, or else
+// the first line of standard input.
+func readAdminPassword() (string, error) {
+    if password, ok := os.LookupEnv("BOOK_MANAGER_ADMIN_PASSWORD"); ok {
+        return password, nil
+    }
+    fmt.Fprint(os.Stderr, "Password: ")
+    line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+    if err != nil && line == "" {
+        return "", fmt.Errorf("reading password: %v", err)
+    }
+    return strings.TrimRight(line, "\r\n"), nil
+}
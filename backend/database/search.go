@@ -0,0 +1,98 @@
+package database
+
+import (
+	"log/slog"
+
+	"gorm.io/gorm"
+)
+
+// PostgresSearchVector is the weighted tsvector of a book on PostgreSQL. The
+// search index is built on this exact expression, so queries must use it verbatim.
+const PostgresSearchVector = `(setweight(to_tsvector('simple', coalesce(title, '')), 'A') ||
+    setweight(to_tsvector('simple', coalesce(author, '')), 'B') ||
+    setweight(to_tsvector('simple', coalesce(publisher, '')), 'C') ||
+    setweight(to_tsvector('simple', coalesce(genre, '')), 'C') ||
+    setweight(to_tsvector('simple', coalesce(description, '')), 'D'))`
+
+// MySQLSearchColumns are the columns of the FULLTEXT index on MySQL. MATCH()
+// must name exactly these columns to use it.
+const MySQLSearchColumns = "title, author, description, publisher, genre"
+
+// setupSearch creates the full-text index of the books table for the database in use.
+func setupSearch(db *gorm.DB) {
+    switch db.Dialector.Name() {
+    case "sqlite":
+        setupSQLiteSearch(db)
+    case "postgres":
+        if err := db.Exec("CREATE INDEX IF NOT EXISTS books_search_idx ON books USING GIN (" + PostgresSearchVector + ")").Error; err != nil {
+            slog.Error("Error creating search index", "error", err)
+        }
+    case "mysql":
+        var existing int64
+        db.Raw(`SELECT count(*) FROM information_schema.statistics
+            WHERE table_schema = DATABASE() AND table_name = 'books' AND index_name = 'books_search_idx'`).Scan(&existing)
+        if existing == 0 {
+            if err := db.Exec("CREATE FULLTEXT INDEX books_search_idx ON books (" + MySQLSearchColumns + ")").Error; err != nil {
+                slog.Error("Error creating search index", "error", err)
+            }
+        }
+    }
+}
+
+// setupSQLiteSearch creates the books_fts virtual table and the triggers that
+// keep it in sync with the books table. Without FTS5 support (the default
+// unless built with -tags sqlite_fts5) the triggers are removed and searches
+// fall back to a LIKE based scan.
+func setupSQLiteSearch(db *gorm.DB) {
+    // The index is rebuilt whenever the triggers are (re)created, since books
+    // may have changed while they were missing.
+    var existing int64
+    db.Raw("SELECT count(*) FROM sqlite_master WHERE type = 'trigger' AND name = 'books_fts_insert'").Scan(&existing)
+
+    statements := []string{
+        `CREATE VIRTUAL TABLE IF NOT EXISTS books_fts USING fts5(
+            title, author, description, publisher, genre,
+            content='books', content_rowid='id', tokenize='unicode61 remove_diacritics 2'
+        )`,
+        `CREATE TRIGGER IF NOT EXISTS books_fts_insert AFTER INSERT ON books BEGIN
+            INSERT INTO books_fts(rowid, title, author, description, publisher, genre)
+            VALUES (new.id, new.title, new.author, new.description, new.publisher, new.genre);
+        END`,
+        `CREATE TRIGGER IF NOT EXISTS books_fts_delete AFTER DELETE ON books BEGIN
+            INSERT INTO books_fts(books_fts, rowid, title, author, description, publisher, genre)
+            VALUES ('delete', old.id, old.title, old.author, old.description, old.publisher, old.genre);
+        END`,
+        `CREATE TRIGGER IF NOT EXISTS books_fts_update AFTER UPDATE ON books BEGIN
+            INSERT INTO books_fts(books_fts, rowid, title, author, description, publisher, genre)
+            VALUES ('delete', old.id, old.title, old.author, old.description, old.publisher, old.genre);
+            INSERT INTO books_fts(rowid, title, author, description, publisher, genre)
+            VALUES (new.id, new.title, new.author, new.description, new.publisher, new.genre);
+        END`,
+    }
+
+    var fts5 bool
+    db.Raw("SELECT sqlite_compileoption_used('ENABLE_FTS5')").Scan(&fts5)
+    if !fts5 {
+        slog.Warn("SQLite was built without FTS5, falling back to LIKE search")
+        // Triggers left behind by an FTS5-enabled build would make every
+        // write to books fail with "no such module: fts5".
+        for _, trigger := range []string{"books_fts_insert", "books_fts_delete", "books_fts_update"} {
+            db.Exec("DROP TRIGGER IF EXISTS " + trigger)
+        }
+        return
+    }
+
+    for _, statement := range statements {
+        if err := db.Exec(statement).Error; err != nil {
+            slog.Error("Error creating search index", "error", err)
+            return
+        }
+    }
+
+    if existing == 0 {
+        if err := db.Exec("INSERT INTO books_fts(books_fts) VALUES ('rebuild')").Error; err != nil {
+            slog.Error("Error building search index", "error", err)
+            return
+        }
+    }
+}
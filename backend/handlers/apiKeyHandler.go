@@ -0,0 +1,250 @@
+package handlers
+
+import (
+	"book-manager/auth"
+	"book-manager/models"
+	"book-manager/repository"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+const maxAPIKeyNameLength = 100
+
+// APIKeyInput describes a new API key.
+type APIKeyInput struct {
+    Name      string     `json:"name"`                                               // What the key is used for, up to 100 characters
+    Scopes    []string   `json:"scopes" enums:"books:read,books:write,urls:process"` // At least one scope
+    ExpiresAt *time.Time `json:"expiresAt,omitempty" example:"2027-01-01T00:00:00Z"` // Never expires if not set
+}
+
+// NewAPIKeyResponse holds a created or rotated API key. Key is only ever
+// returned here, so it must be stored by the client right away.
+type NewAPIKeyResponse struct {
+    APIKey models.APIKey `json:"apiKey"`
+    Key    string        `json:"key"` // Send as X-API-Key: <key>
+}
+
+// validateAPIKey trims the name, sorts the scopes and checks every field.
+func validateAPIKey(input *APIKeyInput) *ValidationError {
+    var validationError ValidationError
+    input.Name = strings.TrimSpace(input.Name)
+    if input.Name == "" || len([]rune(input.Name)) > maxAPIKeyNameLength {
+        validationError.Fields = append(validationError.Fields, FieldError{
+            Field:   "name",
+            Rule:    "length",
+            Message: fmt.Sprintf("name must have 1 to %d characters", maxAPIKeyNameLength),
+        })
+    }
+
+    scopes := map[string]bool{}
+    for _, scope := range input.Scopes {
+        if !models.ValidScope(scope) {
+            validationError.Fields = append(validationError.Fields, FieldError{
+                Field:   "scopes",
+                Rule:    "oneof",
+                Message: fmt.Sprintf("unknown scope %q, scopes must be %s", scope, strings.Join(models.Scopes, ", ")),
+            })
+        }
+        scopes[scope] = true
+    }
+    if len(input.Scopes) == 0 {
+        validationError.Fields = append(validationError.Fields, FieldError{Field: "scopes", Rule: "required", Message: "scopes must not be empty"})
+    }
+    input.Scopes = input.Scopes[:0]
+    for scope := range scopes {
+        input.Scopes = append(input.Scopes, scope)
+    }
+    sort.Strings(input.Scopes)
+
+    if input.ExpiresAt != nil && !input.ExpiresAt.After(time.Now()) {
+        validationError.Fields = append(validationError.Fields, FieldError{Field: "expiresAt", Rule: "future", Message: "expiresAt must be in the future"})
+    }
+    if len(validationError.Fields) > 0 {
+        return &validationError
+    }
+    return nil
+}
+
+// writeAPIKeyError writes the response for an error returned for an API key.
+func writeAPIKeyError(w http.ResponseWriter, r *http.Request, message string, err error) {
+    if errors.Is(err, repository.ErrNotFound) {
+        writeError(w, r, http.StatusNotFound, CodeNotFound, "API key not found")
+        return
+    }
+    writeInternalError(w, r, message, err)
+}
+
+// CreateAPIKey godoc
+// @Summary Create an API key
+// @Description Create a key for a script to call the API without signing in, by sending it as X-API-Key. The key is
+// @Description only returned in this response; only its hash is stored. Keys act as editors limited to their scopes:
+// @Description books:read reads books, authors, publishers, genres and tags, books:write adds and changes them, and
+// @Description urls:process allows POST /process-url. Needs the admin role.
+// @Tags api-keys
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param apiKey body APIKeyInput true "Name, scopes and expiration"
+// @Success 201 {object} NewAPIKeyResponse
+// @Failure 400 {object} ErrorResponse "Invalid name, scopes or expiration"
+// @Failure 401 {object} ErrorResponse "Not signed in"
+// @Failure 403 {object} ErrorResponse "Not an admin"
+// @Failure 500 {object} ErrorResponse "Error creating API key"
+// @Router /api-keys [post]
+func (s *Server) CreateAPIKey(w http.ResponseWriter, r *http.Request) {
+    var input APIKeyInput
+    if !decodeJSON(w, r, &input) {
+        return
+    }
+    if validationError := validateAPIKey(&input); validationError != nil {
+        writeValidationError(w, r, validationError)
+        return
+    }
+
+    key, prefix, hash := auth.NewAPIKey()
+    apiKey := models.APIKey{
+        Name:      input.Name,
+        Prefix:    prefix,
+        Hash:      hash,
+        Scopes:    input.Scopes,
+        CreatedBy: CurrentUser(r).ID,
+        ExpiresAt: input.ExpiresAt,
+    }
+    if err := s.Books.CreateAPIKey(r.Context(), &apiKey); err != nil {
+        writeInternalError(w, r, "Error creating API key", err)
+        return
+    }
+
+    w.Header().Set("Content-Type", "application/json")
+    w.Header().Set("Cache-Control", "no-store")
+    w.Header().Set("Location", fmt.Sprintf("/api-keys/%d", apiKey.ID))
+    encodeResponse(w, r, http.StatusCreated, NewAPIKeyResponse{APIKey: apiKey, Key: key})
+    Logger(r).Info("API key created", "api_key_id", apiKey.ID, "prefix", apiKey.Prefix, "created_by", apiKey.CreatedBy, "scopes", apiKey.Scopes)
+}
+
+
+// GetAPIKeys godoc
+// @Summary List API keys
+// @Description List all API keys by ID, including expired and revoked ones. Needs the admin role.
+// @Tags api-keys
+// @Security BearerAuth
+// @Produce json
+// @Success 200 {array} models.APIKey
+// @Failure 401 {object} ErrorResponse "Not signed in"
+// @Failure 403 {object} ErrorResponse "Not an admin"
+// @Failure 500 {object} ErrorResponse "Error retrieving API keys"
+// @Router /api-keys [get]
+func (s *Server) GetAPIKeys(w http.ResponseWriter, r *http.Request) {
+    keys, err := s.Books.ListAPIKeys(r.Context())
+    if err != nil {
+        writeInternalError(w, r, "Error retrieving API keys", err)
+        return
+    }
+    w.Header().Set("Content-Type", "application/json")
+    encodeResponse(w, r, http.StatusOK, keys)
+}
+
+
+// GetAPIKey godoc
+// @Summary Get an API key
+// @Description Get an API key, including when it was last used. Needs the admin role.
+// @Tags api-keys
+// @Security BearerAuth
+// @Produce json
+// @Param id path int true "API key ID"
+// @Success 200 {object} models.APIKey
+// @Failure 400 {object} ErrorResponse "Invalid ID"
+// @Failure 401 {object} ErrorResponse "Not signed in"
+// @Failure 403 {object} ErrorResponse "Not an admin"
+// @Failure 404 {object} ErrorResponse "API key not found"
+// @Failure 500 {object} ErrorResponse "Error retrieving API key"
+// @Router /api-keys/{id} [get]
+func (s *Server) GetAPIKey(w http.ResponseWriter, r *http.Request) {
+    id, ok := pathID(w, r)
+    if !ok {
+        return
+    }
+    key, err := s.Books.GetAPIKey(r.Context(), id)
+    if err != nil {
+        writeAPIKeyError(w, r, "Error retrieving API key", err)
+        return
+    }
+    w.Header().Set("Content-Type", "application/json")
+    encodeResponse(w, r, http.StatusOK, key)
+}
+
+
+// RotateAPIKey godoc
+// @Summary Rotate an API key
+// @Description Replace the key with a new one with the same name, scopes and expiration. The old key stops working
+// @Description right away. The new key is only returned in this response. Needs the admin role.
+// @Tags api-keys
+// @Security BearerAuth
+// @Produce json
+// @Param id path int true "API key ID"
+// @Success 200 {object} NewAPIKeyResponse
+// @Failure 400 {object} ErrorResponse "Invalid ID"
+// @Failure 401 {object} ErrorResponse "Not signed in"
+// @Failure 403 {object} ErrorResponse "Not an admin"
+// @Failure 404 {object} ErrorResponse "API key not found"
+// @Failure 409 {object} ErrorResponse "The API key was revoked"
+// @Failure 500 {object} ErrorResponse "Error rotating API key"
+// @Router /api-keys/{id}/rotate [post]
+func (s *Server) RotateAPIKey(w http.ResponseWriter, r *http.Request) {
+    id, ok := pathID(w, r)
+    if !ok {
+        return
+    }
+    apiKey, err := s.Books.GetAPIKey(r.Context(), id)
+    if err != nil {
+        writeAPIKeyError(w, r, "Error rotating API key", err)
+        return
+    }
+    if apiKey.RevokedAt != nil {
+        writeError(w, r, http.StatusConflict, CodeRevoked, "Revoked API keys can't be rotated, create a new one")
+        return
+    }
+
+    key, prefix, hash := auth.NewAPIKey()
+    apiKey, err = s.Books.RotateAPIKey(r.Context(), id, prefix, hash)
+    if err != nil {
+        writeAPIKeyError(w, r, "Error rotating API key", err)
+        return
+    }
+
+    w.Header().Set("Content-Type", "application/json")
+    w.Header().Set("Cache-Control", "no-store")
+    encodeResponse(w, r, http.StatusOK, NewAPIKeyResponse{APIKey: *apiKey, Key: key})
+    Logger(r).Info("API key rotated", "api_key_id", apiKey.ID, "prefix", apiKey.Prefix, "rotated_by", CurrentUser(r).ID)
+}
+
+
+// RevokeAPIKey godoc
+// @Summary Revoke an API key
+// @Description The key stops working right away. It is still listed, with its revocation time. Needs the admin role.
+// @Tags api-keys
+// @Security BearerAuth
+// @Param id path int true "API key ID"
+// @Success 204 "API key revoked"
+// @Failure 400 {object} ErrorResponse "Invalid ID"
+// @Failure 401 {object} ErrorResponse "Not signed in"
+// @Failure 403 {object} ErrorResponse "Not an admin"
+// @Failure 404 {object} ErrorResponse "API key not found"
+// @Failure 500 {object} ErrorResponse "Error revoking API key"
+// @Router /api-keys/{id} [delete]
+func (s *Server) RevokeAPIKey(w http.ResponseWriter, r *http.Request) {
+    id, ok := pathID(w, r)
+    if !ok {
+        return
+    }
+    if err := s.Books.RevokeAPIKey(r.Context(), id); err != nil {
+        writeAPIKeyError(w, r, "Error revoking API key", err)
+        return
+    }
+    w.WriteHeader(http.StatusNoContent)
+    Logger(r).Info("API key revoked", "api_key_id", id, "revoked_by", CurrentUser(r).ID)
+}
@@ -0,0 +1,162 @@
+package handlers
+
+import (
+	"book-manager/models"
+	"book-manager/repository"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// The helpers below change a book in tx and record the change in the audit
+// log, so that both are committed or rolled back together. Callers run them
+// in a transaction.
+
+// createBook creates book and records it.
+func createBook(r *http.Request, tx repository.BookRepository, book *models.Book) error {
+    if err := tx.Create(r.Context(), book); err != nil {
+        return err
+    }
+    return recordChange(r, tx, models.AuditCreate, nil, book)
+}
+
+// updateBook saves book, which was before until now, and records the change.
+func updateBook(r *http.Request, tx repository.BookRepository, before, book *models.Book) error {
+    if err := tx.Update(r.Context(), book); err != nil {
+        return err
+    }
+    return recordChange(r, tx, models.AuditUpdate, before, book)
+}
+
+// revertBook saves book, which was before until now, like updateBook, but
+// records the change as a revert.
+func revertBook(r *http.Request, tx repository.BookRepository, before, book *models.Book) error {
+    if err := tx.Update(r.Context(), book); err != nil {
+        return err
+    }
+    return recordChange(r, tx, models.AuditRevert, before, book)
+}
+
+// deleteBook moves a live book to the trash, or purges a live or trashed book,
+// and records it. If version isn't 0, the book must be live and still have
+// it, otherwise repository.ErrVersionConflict is returned.
+func deleteBook(r *http.Request, tx repository.BookRepository, id, version uint, purge bool) error {
+    before, err := tx.GetIncludingTrash(r.Context(), id)
+    if err != nil {
+        return err
+    }
+    if purge {
+        if err := tx.Purge(r.Context(), id, version); err != nil {
+            return err
+        }
+        return recordChange(r, tx, models.AuditPurge, before, nil)
+    }
+
+    if err := tx.Delete(r.Context(), id, version); err != nil {
+        return err
+    }
+    after, err := tx.GetIncludingTrash(r.Context(), id)
+    if err != nil {
+        return err
+    }
+    return recordChange(r, tx, models.AuditDelete, before, after)
+}
+
+// restoreBook moves a book out of the trash, records it and returns the book.
+func restoreBook(r *http.Request, tx repository.BookRepository, id uint) (*models.Book, error) {
+    before, err := tx.GetIncludingTrash(r.Context(), id)
+    if err != nil {
+        return nil, err
+    }
+    book, err := tx.Restore(r.Context(), id)
+    if err != nil {
+        return nil, err
+    }
+    return book, recordChange(r, tx, models.AuditRestore, before, book)
+}
+
+// changeBooks runs change, which may update the books with the given IDs as a
+// side effect, e.g. by renaming their publisher, and records an update of every
+// one whose version it changed.
+func changeBooks(r *http.Request, tx repository.BookRepository, ids []uint, change func() error) error {
+    before := make([]*models.Book, 0, len(ids))
+    for _, id := range ids {
+        book, err := tx.GetIncludingTrash(r.Context(), id)
+        if errors.Is(err, repository.ErrNotFound) {
+            continue
+        }
+        if err != nil {
+            return err
+        }
+        before = append(before, book)
+    }
+
+    if err := change(); err != nil {
+        return err
+    }
+
+    for _, book := range before {
+        after, err := tx.GetIncludingTrash(r.Context(), book.ID)
+        if err != nil {
+            return err
+        }
+        if after.Version == book.Version {
+            continue
+        }
+        if err := recordChange(r, tx, models.AuditUpdate, book, after); err != nil {
+            return err
+        }
+    }
+    return nil
+}
+
+// changeReferencingBooks runs change, which renames or merges the record of
+// kind with the given ID, like changeBooks for the books that refer to it.
+func changeReferencingBooks(r *http.Request, tx repository.BookRepository, kind string, id uint, change func() error) error {
+    ids, err := tx.ReferencingBookIDs(r.Context(), kind, id)
+    if err != nil {
+        return err
+    }
+    return changeBooks(r, tx, ids, change)
+}
+
+// actor returns who made the request, as stored in AuditEntry.Actor, and
+// their name.
+func actor(r *http.Request) (string, string) {
+    if user := CurrentUser(r); user != nil {
+        return fmt.Sprintf("user:%d", user.ID), user.Username
+    }
+    if apiKey := CurrentAPIKey(r); apiKey != nil {
+        return fmt.Sprintf("api-key:%d", apiKey.ID), apiKey.Name
+    }
+    return "anonymous", ""
+}
+
+// recordChange stores the audit entry of a change of a book from before to
+// after. before is nil for created books and after for purged ones.
+func recordChange(r *http.Request, tx repository.BookRepository, action string, before, after *models.Book) error {
+    entry := models.AuditEntry{
+        Action:    action,
+        RequestID: RequestID(r),
+        Before:    snapshot(before),
+        After:     snapshot(after),
+        Changes:   models.DiffBooks(before, after),
+    }
+    entry.Actor, entry.ActorName = actor(r)
+    if after != nil {
+        entry.BookID, entry.Version = after.ID, after.Version
+    } else {
+        entry.BookID, entry.Version = before.ID, before.Version
+    }
+    return tx.CreateAuditEntry(r.Context(), &entry)
+}
+
+// snapshot returns a copy of book, so that later changes to it don't alter
+// the audit entry.
+func snapshot(book *models.Book) *models.Book {
+    if book == nil {
+        return nil
+    }
+    copy := *book
+    return &copy
+}
@@ -0,0 +1,144 @@
+package handlers
+
+import (
+	"book-manager/models"
+	"book-manager/repository"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+var actorPattern = regexp.MustCompile(`^(user|api-key):[1-9][0-9]*$`)
+
+// auditPage reads the limit and offset parameters of r into query.
+func auditPage(w http.ResponseWriter, r *http.Request, query *repository.AuditQuery) bool {
+    query.Limit = repository.DefaultPageSize
+    if raw := r.URL.Query().Get("limit"); raw != "" {
+        var err error
+        if query.Limit, err = strconv.Atoi(raw); err != nil || query.Limit < 1 {
+            writeError(w, r, http.StatusBadRequest, CodeInvalidRequest, "limit must be a positive integer")
+            return false
+        }
+        if query.Limit > repository.MaxPageSize {
+            query.Limit = repository.MaxPageSize
+        }
+    }
+    if raw := r.URL.Query().Get("offset"); raw != "" {
+        var err error
+        if query.Offset, err = strconv.Atoi(raw); err != nil || query.Offset < 0 {
+            writeError(w, r, http.StatusBadRequest, CodeInvalidRequest, "offset must be a non-negative integer")
+            return false
+        }
+    }
+    return true
+}
+
+// writeAuditEntries writes a page of audit entries and the total number of
+// entries matching the query.
+func writeAuditEntries(w http.ResponseWriter, r *http.Request, total int64, entries []models.AuditEntry) {
+    w.Header().Set("Content-Type", "application/json")
+    w.Header().Set("X-Total-Count", strconv.FormatInt(total, 10))
+    if err := json.NewEncoder(w).Encode(entries); err != nil {
+        Logger(r).Warn("Error encoding audit log", "error", err)
+    }
+}
+
+
+// GetBookHistory godoc
+// @Summary Get the history of a book
+// @Description Get the changes of a book, newest first, with who made them, the book before and after every change
+// @Description and the fields that changed. The history of purged books is kept. Needs a signed in user.
+// @Description The total number of changes is returned in X-Total-Count.
+// @Tags audit
+// @Security BearerAuth
+// @Produce json
+// @Param id path int true "Book ID"
+// @Param limit query int false "Page size (default 50, max 500)"
+// @Param offset query int false "Number of changes to skip"
+// @Success 200 {array} models.AuditEntry
+// @Header 200 {integer} X-Total-Count "Number of changes of the book"
+// @Failure 400 {object} ErrorResponse "Invalid ID or query parameters"
+// @Failure 401 {object} ErrorResponse "Not signed in"
+// @Failure 404 {object} ErrorResponse "Book not found"
+// @Failure 500 {object} ErrorResponse "Error retrieving audit log"
+// @Router /books/{id}/history [get]
+func (s *Server) GetBookHistory(w http.ResponseWriter, r *http.Request) {
+    id, ok := pathID(w, r)
+    if !ok {
+        return
+    }
+    query := repository.AuditQuery{BookID: id}
+    if !auditPage(w, r, &query) {
+        return
+    }
+
+    entries, total, err := s.Books.ListAuditEntries(r.Context(), &query)
+    if err != nil {
+        writeInternalError(w, r, "Error retrieving audit log", err)
+        return
+    }
+    // Books created before the audit log existed have no history yet, and
+    // unknown books have none at all.
+    if total == 0 {
+        if _, err := s.Books.GetIncludingTrash(r.Context(), id); errors.Is(err, repository.ErrNotFound) {
+            writeError(w, r, http.StatusNotFound, CodeNotFound, "Book not found")
+            return
+        } else if err != nil {
+            writeInternalError(w, r, "Error retrieving book", err)
+            return
+        }
+    }
+    writeAuditEntries(w, r, total, entries)
+}
+
+
+// GetAuditLog godoc
+// @Summary Get the audit log
+// @Description Get the changes of all books, newest first, optionally only those of one user or API key or within a
+// @Description time range. The total number of matching changes is returned in X-Total-Count. Needs the admin role.
+// @Tags audit
+// @Security BearerAuth
+// @Produce json
+// @Param actor query string false "Only changes by this actor, user:<id> or api-key:<id>"
+// @Param since query string false "Only changes at or after this time (RFC 3339)"
+// @Param until query string false "Only changes before this time (RFC 3339)"
+// @Param limit query int false "Page size (default 50, max 500)"
+// @Param offset query int false "Number of changes to skip"
+// @Success 200 {array} models.AuditEntry
+// @Header 200 {integer} X-Total-Count "Number of changes matching the filters"
+// @Failure 400 {object} ErrorResponse "Invalid query parameters"
+// @Failure 401 {object} ErrorResponse "Not signed in"
+// @Failure 403 {object} ErrorResponse "Not an admin"
+// @Failure 500 {object} ErrorResponse "Error retrieving audit log"
+// @Router /audit [get]
+func (s *Server) GetAuditLog(w http.ResponseWriter, r *http.Request) {
+    params := r.URL.Query()
+    query := repository.AuditQuery{Actor: params.Get("actor")}
+    if query.Actor != "" && !actorPattern.MatchString(query.Actor) {
+        writeError(w, r, http.StatusBadRequest, CodeInvalidRequest, "actor must be user:<id> or api-key:<id>")
+        return
+    }
+    for name, value := range map[string]*time.Time{"since": &query.Since, "until": &query.Until} {
+        if raw := params.Get(name); raw != "" {
+            t, err := time.Parse(time.RFC3339, raw)
+            if err != nil {
+                writeError(w, r, http.StatusBadRequest, CodeInvalidRequest, name+" must be an RFC 3339 time such as 2024-01-31T12:00:00Z")
+                return
+            }
+            *value = t
+        }
+    }
+    if !auditPage(w, r, &query) {
+        return
+    }
+
+    entries, total, err := s.Books.ListAuditEntries(r.Context(), &query)
+    if err != nil {
+        writeInternalError(w, r, "Error retrieving audit log", err)
+        return
+    }
+    writeAuditEntries(w, r, total, entries)
+}
@@ -0,0 +1,266 @@
+package handlers
+
+import (
+	"book-manager/auth"
+	"book-manager/models"
+	"book-manager/repository"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// Credentials are the username and password of a user.
+type Credentials struct {
+    Username string `json:"username"` // 3 to 50 letters, digits, '.', '-' or '_', case-insensitive
+    Password string `json:"password"` // 8 to 72 bytes
+}
+
+// RefreshRequest exchanges a refresh token for new tokens.
+type RefreshRequest struct {
+    RefreshToken string `json:"refreshToken"`
+}
+
+// TokenResponse holds the tokens of a session.
+type TokenResponse struct {
+    AccessToken  string `json:"accessToken"`  // Send as Authorization: Bearer <token>
+    RefreshToken string `json:"refreshToken"` // Can be used once to get new tokens
+    TokenType    string `json:"tokenType"`    // Always Bearer
+    ExpiresIn    int64  `json:"expiresIn"`    // Seconds until the access token expires
+}
+
+// validateCredentials normalizes the username and checks the password length.
+func validateCredentials(credentials *Credentials) *ValidationError {
+    var validationError ValidationError
+    username, err := models.NormalizeUsername(credentials.Username)
+    if err != nil {
+        validationError.Fields = append(validationError.Fields, FieldError{Field: "username", Rule: "username", Message: err.Error()})
+    }
+    credentials.Username = username
+    if len(credentials.Password) < models.MinPasswordLength || len(credentials.Password) > models.MaxPasswordLength {
+        validationError.Fields = append(validationError.Fields, FieldError{
+            Field:   "password",
+            Rule:    "length",
+            Message: fmt.Sprintf("password must have %d to %d bytes", models.MinPasswordLength, models.MaxPasswordLength),
+        })
+    }
+    if len(validationError.Fields) > 0 {
+        return &validationError
+    }
+    return nil
+}
+
+// writeTokens issues new access and refresh tokens for a session.
+func (s *Server) writeTokens(w http.ResponseWriter, r *http.Request, session *models.Session) {
+    access, expires, err := s.Tokens.Issue(auth.AccessToken, session.UserID, session.ID, auth.NewID())
+    if err != nil {
+        writeInternalError(w, r, "Error issuing tokens", err)
+        return
+    }
+    refresh, _, err := s.Tokens.Issue(auth.RefreshToken, session.UserID, session.ID, session.RefreshID)
+    if err != nil {
+        writeInternalError(w, r, "Error issuing tokens", err)
+        return
+    }
+    w.Header().Set("Content-Type", "application/json")
+    w.Header().Set("Cache-Control", "no-store")
+    encodeResponse(w, r, http.StatusOK, TokenResponse{
+        AccessToken:  access,
+        RefreshToken: refresh,
+        TokenType:    "Bearer",
+        ExpiresIn:    int64(time.Until(expires).Seconds()),
+    })
+}
+
+
+// Register godoc
+// @Summary Create a user account
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param credentials body Credentials true "Username and password"
+// @Success 201 {object} models.User
+// @Failure 400 {object} ErrorResponse "Invalid username or password"
+// @Failure 409 {object} ErrorResponse "The username is taken"
+// @Failure 500 {object} ErrorResponse "Error creating user"
+// @Router /auth/register [post]
+func (s *Server) Register(w http.ResponseWriter, r *http.Request) {
+    var credentials Credentials
+    if !decodeJSON(w, r, &credentials) {
+        return
+    }
+    if validationError := validateCredentials(&credentials); validationError != nil {
+        writeValidationError(w, r, validationError)
+        return
+    }
+
+    hash, err := auth.HashPassword(credentials.Password)
+    if err != nil {
+        writeInternalError(w, r, "Error creating user", err)
+        return
+    }
+    user := models.User{Username: credentials.Username, PasswordHash: hash}
+    if err := s.Books.CreateUser(r.Context(), &user); err != nil {
+        if errors.Is(err, repository.ErrUsernameTaken) {
+            writeError(w, r, http.StatusConflict, CodeUsernameTaken, "The username is already taken")
+        } else {
+            writeInternalError(w, r, "Error creating user", err)
+        }
+        return
+    }
+
+    w.Header().Set("Content-Type", "application/json")
+    encodeResponse(w, r, http.StatusCreated, user)
+    Logger(r).Info("User registered", "user_id", user.ID, "username", user.Username)
+}
+
+
+// Login godoc
+// @Summary Sign in
+// @Description Sign in with a username and password. Returns an access token, which authenticates requests that
+// @Description change the catalog, and a refresh token to get new tokens when the access token expires.
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param credentials body Credentials true "Username and password"
+// @Success 200 {object} TokenResponse
+// @Failure 400 {object} ErrorResponse "Invalid request body"
+// @Failure 401 {object} ErrorResponse "Wrong username or password"
+// @Failure 429 {object} ErrorResponse "Too many attempts or failed authentications from the client IP"
+// @Failure 500 {object} ErrorResponse "Error signing in"
+// @Router /auth/login [post]
+func (s *Server) Login(w http.ResponseWriter, r *http.Request) {
+    if s.authBlocked(w, r) {
+        return
+    }
+    var credentials Credentials
+    if !decodeJSON(w, r, &credentials) {
+        return
+    }
+
+    var user *models.User
+    username, err := models.NormalizeUsername(credentials.Username)
+    if err == nil {
+        user, err = s.Books.GetUserByName(r.Context(), username)
+    }
+    if err != nil && !errors.Is(err, repository.ErrNotFound) && !errors.Is(err, models.ErrInvalidUsername) {
+        writeInternalError(w, r, "Error signing in", err)
+        return
+    }
+    var valid bool
+    if user != nil {
+        valid = auth.CheckPassword(user.PasswordHash, credentials.Password)
+    } else {
+        valid = auth.CheckNoPassword(credentials.Password)
+    }
+    if !valid {
+        Logger(r).Warn("Failed sign-in", "username", username)
+        s.rejectCredentials(w, r, "", "Wrong username or password")
+        return
+    }
+
+    session := models.Session{
+        ID:        auth.NewID(),
+        UserID:    user.ID,
+        RefreshID: auth.NewID(),
+        ExpiresAt: time.Now().Add(s.Tokens.RefreshTTL),
+    }
+    if err := s.Books.CreateSession(r.Context(), &session); err != nil {
+        writeInternalError(w, r, "Error signing in", err)
+        return
+    }
+    s.writeTokens(w, r, &session)
+    Logger(r).Info("User signed in", "user_id", user.ID)
+}
+
+
+// Refresh godoc
+// @Summary Get new tokens
+// @Description Exchange a refresh token for a new access and refresh token. Every refresh token can be used once;
+// @Description using it again signs out the session, since the token was probably stolen.
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param refresh body RefreshRequest true "Refresh token"
+// @Success 200 {object} TokenResponse
+// @Failure 400 {object} ErrorResponse "Invalid request body"
+// @Failure 401 {object} ErrorResponse "The refresh token is invalid, expired or was used already"
+// @Failure 429 {object} ErrorResponse "Too many attempts or failed authentications from the client IP"
+// @Failure 500 {object} ErrorResponse "Error refreshing tokens"
+// @Router /auth/refresh [post]
+func (s *Server) Refresh(w http.ResponseWriter, r *http.Request) {
+    if s.authBlocked(w, r) {
+        return
+    }
+    var request RefreshRequest
+    if !decodeJSON(w, r, &request) {
+        return
+    }
+
+    claims, err := s.Tokens.Parse(request.RefreshToken, auth.RefreshToken)
+    if err != nil {
+        s.rejectCredentials(w, r, "invalid_token", "The refresh token is invalid or expired")
+        return
+    }
+    refreshID := auth.NewID()
+    err = s.Books.RotateSession(r.Context(), claims.SessionID, claims.ID, refreshID)
+    if errors.Is(err, repository.ErrInvalidSession) {
+        Logger(r).Warn("Refresh token rejected", "session_id", claims.SessionID)
+        s.rejectCredentials(w, r, "invalid_token", "The refresh token was revoked or used already")
+        return
+    }
+    if err != nil {
+        writeInternalError(w, r, "Error refreshing tokens", err)
+        return
+    }
+
+    session, err := s.Books.GetSession(r.Context(), claims.SessionID)
+    if err != nil {
+        writeInternalError(w, r, "Error refreshing tokens", err)
+        return
+    }
+    s.writeTokens(w, r, session)
+}
+
+
+// Logout godoc
+// @Summary Sign out
+// @Description Revoke the session of the access token, so that neither its access nor its refresh tokens can be used anymore.
+// @Tags auth
+// @Security BearerAuth
+// @Success 204 "Signed out"
+// @Failure 401 {object} ErrorResponse "Not signed in"
+// @Failure 500 {object} ErrorResponse "Error signing out"
+// @Router /auth/logout [post]
+func (s *Server) Logout(w http.ResponseWriter, r *http.Request) {
+    claims := Claims(r)
+    if claims == nil {
+        writeUnauthorized(w, r, "", "Not signed in")
+        return
+    }
+    if err := s.Books.RevokeSession(r.Context(), claims.SessionID); err != nil {
+        writeInternalError(w, r, "Error signing out", err)
+        return
+    }
+    w.WriteHeader(http.StatusNoContent)
+    Logger(r).Info("User signed out", "user_id", claims.UserID())
+}
+
+
+// GetCurrentUser godoc
+// @Summary Get the signed in user
+// @Tags auth
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} models.User
+// @Failure 401 {object} ErrorResponse "Not signed in"
+// @Router /auth/me [get]
+func (s *Server) GetCurrentUser(w http.ResponseWriter, r *http.Request) {
+    user := CurrentUser(r)
+    if user == nil {
+        writeUnauthorized(w, r, "", "Not signed in")
+        return
+    }
+    w.Header().Set("Content-Type", "application/json")
+    encodeResponse(w, r, http.StatusOK, user)
+}
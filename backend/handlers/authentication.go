@@ -0,0 +1,178 @@
+package handlers
+
+import (
+	"book-manager/auth"
+	"book-manager/models"
+	"book-manager/repository"
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+type claimsKey struct{}
+
+type apiKeyKey struct{}
+
+// apiKeyUsageInterval is how often the LastUsedAt of an API key is updated,
+// so that busy scripts don't write on every request.
+const apiKeyUsageInterval = time.Minute
+
+// publicRoutes can be called without signing in, whatever the method. Their
+// Authorization header is ignored, so that an expired access token doesn't
+// prevent signing in again.
+var publicRoutes = map[string]bool{
+    "/auth/register": true,
+    "/auth/login":    true,
+    "/auth/refresh":  true,
+}
+
+// readOnly reports whether the method doesn't change anything.
+func readOnly(method string) bool {
+    return method == http.MethodGet || method == http.MethodHead || method == http.MethodOptions
+}
+
+func publicRoute(r *http.Request) bool {
+    route := mux.CurrentRoute(r)
+    if route == nil {
+        return false
+    }
+    template, err := route.GetPathTemplate()
+    return err == nil && publicRoutes[template]
+}
+
+// authenticate checks the bearer token or API key of requests that send one
+// and rejects writes without either. Clients sending invalid credentials too
+// often are rejected with 429, see authBlocked. The claims of the token are available to
+// the handlers through Claims, and the API key through CurrentAPIKey.
+func (s *Server) authenticate(next http.Handler) http.Handler {
+    return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        if publicRoute(r) {
+            next.ServeHTTP(w, r)
+            return
+        }
+
+        header := r.Header.Get("Authorization")
+        key := r.Header.Get("X-API-Key")
+        if (header != "" || key != "") && s.authBlocked(w, r) {
+            return
+        }
+        if key != "" {
+            if header != "" {
+                s.rejectCredentials(w, r, "invalid_request", "Send either an access token or an API key, not both")
+                return
+            }
+            apiKey, err := s.checkAPIKey(r.Context(), key)
+            if errors.Is(err, auth.ErrInvalidToken) {
+                s.rejectCredentials(w, r, "invalid_token", "The API key is invalid, expired or revoked")
+                return
+            }
+            if err != nil {
+                writeInternalError(w, r, "Error checking API key", err)
+                return
+            }
+            next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), apiKeyKey{}, apiKey)))
+            return
+        }
+        if header == "" {
+            if readOnly(r.Method) {
+                next.ServeHTTP(w, r)
+                return
+            }
+            writeUnauthorized(w, r, "", "Sign in to change the catalog")
+            return
+        }
+
+        scheme, token, _ := strings.Cut(header, " ")
+        if !strings.EqualFold(scheme, "Bearer") {
+            s.rejectCredentials(w, r, "invalid_request", "Send the access token as Authorization: Bearer <token>")
+            return
+        }
+        claims, err := s.Tokens.Parse(strings.TrimSpace(token), auth.AccessToken)
+        if err == nil {
+            err = s.checkSession(r.Context(), claims.SessionID)
+        }
+        if errors.Is(err, auth.ErrInvalidToken) {
+            s.rejectCredentials(w, r, "invalid_token", "The access token is invalid, expired or revoked")
+            return
+        }
+        if err != nil {
+            writeInternalError(w, r, "Error checking access token", err)
+            return
+        }
+        next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), claimsKey{}, claims)))
+    })
+}
+
+// checkSession returns auth.ErrInvalidToken unless the session is active.
+func (s *Server) checkSession(ctx context.Context, id string) error {
+    session, err := s.Books.GetSession(ctx, id)
+    if errors.Is(err, repository.ErrNotFound) {
+        return auth.ErrInvalidToken
+    }
+    if err != nil {
+        return err
+    }
+    if !session.Active(time.Now()) {
+        return auth.ErrInvalidToken
+    }
+    return nil
+}
+
+// checkAPIKey returns the active API key matching key, or
+// auth.ErrInvalidToken, and records that it was used.
+func (s *Server) checkAPIKey(ctx context.Context, key string) (*models.APIKey, error) {
+    apiKey, err := s.Books.GetAPIKeyByHash(ctx, auth.HashAPIKey(key))
+    if errors.Is(err, repository.ErrNotFound) {
+        return nil, auth.ErrInvalidToken
+    }
+    if err != nil {
+        return nil, err
+    }
+    now := time.Now()
+    if !apiKey.Active(now) {
+        return nil, auth.ErrInvalidToken
+    }
+    if apiKey.LastUsedAt == nil || now.Sub(*apiKey.LastUsedAt) >= apiKeyUsageInterval {
+        if err := s.Books.TouchAPIKey(ctx, apiKey.ID, now); err != nil {
+            loggerFrom(ctx).Warn("Error recording use of API key", "api_key_id", apiKey.ID, "error", err)
+        }
+        apiKey.LastUsedAt = &now
+    }
+    return apiKey, nil
+}
+
+// Claims returns the claims of the access token of r, or nil if the request
+// isn't authenticated.
+func Claims(r *http.Request) *auth.Claims {
+    claims, _ := r.Context().Value(claimsKey{}).(*auth.Claims)
+    return claims
+}
+
+// CurrentAPIKey returns the API key of r, or nil if the request wasn't
+// authenticated with one.
+func CurrentAPIKey(r *http.Request) *models.APIKey {
+    apiKey, _ := r.Context().Value(apiKeyKey{}).(*models.APIKey)
+    return apiKey
+}
+
+// rejectCredentials rejects a request with invalid credentials and counts the
+// failure against its client IP, see authBlocked.
+func (s *Server) rejectCredentials(w http.ResponseWriter, r *http.Request, bearerError, message string) {
+    s.authFailed(r)
+    writeUnauthorized(w, r, bearerError, message)
+}
+
+// writeUnauthorized writes a 401 response with a WWW-Authenticate challenge,
+// including the RFC 6750 error code if there is one.
+func writeUnauthorized(w http.ResponseWriter, r *http.Request, bearerError, message string) {
+    challenge := `Bearer realm="book-manager"`
+    if bearerError != "" {
+        challenge += `, error="` + bearerError + `"`
+    }
+    w.Header().Set("WWW-Authenticate", challenge)
+    writeError(w, r, http.StatusUnauthorized, CodeUnauthorized, message)
+}
@@ -0,0 +1,423 @@
+package handlers
+
+import (
+	"book-manager/models"
+	"book-manager/repository"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// AuthorInput are the fields of an author that can be set.
+type AuthorInput struct {
+    Name string `json:"name"`
+    Bio  string `json:"bio"`
+}
+
+// CreditInput credits an author on a book.
+type CreditInput struct {
+    AuthorID uint   `json:"authorId"`
+    Role     string `json:"role"` // author, editor or translator
+}
+
+// AuthorBookResult is a book an author is credited on.
+type AuthorBookResult struct {
+    Role string      `json:"role"` // author, editor or translator
+    Book models.Book `json:"book"`
+}
+
+// writeAuthorError writes the response for an error returned by the author repository.
+func writeAuthorError(w http.ResponseWriter, r *http.Request, message string, err error) {
+    var duplicate *repository.DuplicateAuthorError
+    switch {
+    case errors.As(err, &duplicate):
+        Logger(r).Debug("Duplicate author", "error", err)
+        writeErrorResponse(w, r, ErrorResponse{
+            Code:       CodeDuplicateAuthor,
+            Status:     http.StatusConflict,
+            Message:    duplicate.Error(),
+            ExistingID: duplicate.ExistingID,
+        })
+    case errors.Is(err, repository.ErrNotFound):
+        writeError(w, r, http.StatusNotFound, CodeNotFound, "Author not found")
+    case errors.Is(err, repository.ErrInUse):
+        writeError(w, r, http.StatusConflict, CodeInUse, "The author is credited on books, remove the credits first")
+    default:
+        writeInternalError(w, r, message, err)
+    }
+}
+
+// pathID parses the id path parameter, writing a 400 response if it is invalid.
+func pathID(w http.ResponseWriter, r *http.Request) (uint, bool) {
+    id, err := strconv.Atoi(mux.Vars(r)["id"])
+    if err != nil || id < 1 {
+        Logger(r).Debug("Invalid ID", "id", mux.Vars(r)["id"])
+        writeError(w, r, http.StatusBadRequest, CodeInvalidRequest, "Invalid ID")
+        return 0, false
+    }
+    return uint(id), true
+}
+
+// decodeAuthor reads and validates the author in the request body.
+func decodeAuthor(w http.ResponseWriter, r *http.Request) (*models.Author, bool) {
+    var input AuthorInput
+    if !decodeJSON(w, r, &input) {
+        return nil, false
+    }
+
+    author := &models.Author{Name: input.Name, Bio: input.Bio}
+    author.Normalize()
+    if err := ValidateAuthor(*author); err != nil {
+        writeValidationError(w, r, err.(*ValidationError))
+        return nil, false
+    }
+    return author, true
+}
+
+
+// GetAuthors godoc
+// @Summary Get list of authors
+// @Description Get a page of authors sorted by name. The name filter ignores case, spaces and periods.
+// @Description The total number of matching authors is returned in X-Total-Count.
+// @Tags authors
+// @Accept  json
+// @Produce  json
+// @Param name query string false "Part of the name"
+// @Param limit query int false "Page size (default 50, max 500)"
+// @Param offset query int false "Number of authors to skip"
+// @Success 200 {array} models.Author
+// @Header 200 {integer} X-Total-Count "Number of authors matching the filter"
+// @Failure 400 {object} ErrorResponse "Invalid query parameters"
+// @Failure 500 {object} ErrorResponse "Error retrieving authors"
+// @Router /authors [get]
+func (s *Server) GetAuthors(w http.ResponseWriter, r *http.Request) {
+    query := r.URL.Query()
+    limit, offset := repository.DefaultPageSize, 0
+    if raw := query.Get("limit"); raw != "" {
+        var err error
+        if limit, err = strconv.Atoi(raw); err != nil || limit < 1 {
+            writeError(w, r, http.StatusBadRequest, CodeInvalidRequest, "limit must be a positive integer")
+            return
+        }
+        if limit > repository.MaxPageSize {
+            limit = repository.MaxPageSize
+        }
+    }
+    if raw := query.Get("offset"); raw != "" {
+        var err error
+        if offset, err = strconv.Atoi(raw); err != nil || offset < 0 {
+            writeError(w, r, http.StatusBadRequest, CodeInvalidRequest, "offset must be a non-negative integer")
+            return
+        }
+    }
+
+    authors, total, err := s.Books.ListAuthors(r.Context(), query.Get("name"), limit, offset)
+    if err != nil {
+        writeInternalError(w, r, "Error retrieving authors", err)
+        return
+    }
+
+    w.Header().Set("X-Total-Count", strconv.FormatInt(total, 10))
+    if err := json.NewEncoder(w).Encode(authors); err != nil {
+        Logger(r).Warn("Error encoding authors response", "error", err)
+    }
+}
+
+
+// AddAuthor godoc
+// @Summary Add a new author
+// @Description Add an author. Names are unique, ignoring case, spaces and periods.
+// @Tags authors
+// @Security BearerAuth
+// @Security APIKeyAuth
+// @Accept json
+// @Produce json
+// @Param author body AuthorInput true "Add Author"
+// @Success 201 {object} models.Author "Author successfully added"
+// @Failure 400 {object} ErrorResponse "Invalid request body"
+// @Failure 401 {object} ErrorResponse "Not signed in"
+// @Failure 403 {object} ErrorResponse "Not an editor"
+// @Failure 409 {object} ErrorResponse "An author with the same name already exists"
+// @Failure 500 {object} ErrorResponse "Error saving author"
+// @Router /authors [post]
+func (s *Server) AddAuthor(w http.ResponseWriter, r *http.Request) {
+    author, ok := decodeAuthor(w, r)
+    if !ok {
+        return
+    }
+    if err := s.Books.CreateAuthor(r.Context(), author); err != nil {
+        writeAuthorError(w, r, "Error saving author", err)
+        return
+    }
+
+    w.WriteHeader(http.StatusCreated)
+    if err := json.NewEncoder(w).Encode(author); err != nil {
+        Logger(r).Warn("Error encoding author response", "error", err)
+    }
+}
+
+
+// GetAuthor godoc
+// @Summary Get an author by ID
+// @Tags authors
+// @Accept json
+// @Produce json
+// @Param id path int true "Author ID"
+// @Success 200 {object} models.Author "Author found"
+// @Failure 400 {object} ErrorResponse "Invalid ID"
+// @Failure 404 {object} ErrorResponse "Author not found"
+// @Failure 500 {object} ErrorResponse "Error retrieving author"
+// @Router /authors/{id} [get]
+func (s *Server) GetAuthor(w http.ResponseWriter, r *http.Request) {
+    id, ok := pathID(w, r)
+    if !ok {
+        return
+    }
+
+    author, err := s.Books.GetAuthor(r.Context(), id)
+    if err != nil {
+        writeAuthorError(w, r, "Error retrieving author", err)
+        return
+    }
+    if err := json.NewEncoder(w).Encode(author); err != nil {
+        Logger(r).Warn("Error encoding author", "error", err)
+    }
+}
+
+
+// UpdateAuthor godoc
+// @Summary Update an author
+// @Description Update the name and bio of an author. A new name is also written to the author field
+// @Description of the books the author is credited on as an author.
+// @Tags authors
+// @Security BearerAuth
+// @Security APIKeyAuth
+// @Accept json
+// @Produce json
+// @Param id path int true "Author ID"
+// @Param author body AuthorInput true "New name and bio"
+// @Success 200 {object} models.Author "Author successfully updated"
+// @Failure 400 {object} ErrorResponse "Invalid request body or ID"
+// @Failure 401 {object} ErrorResponse "Not signed in"
+// @Failure 403 {object} ErrorResponse "Not an editor"
+// @Failure 404 {object} ErrorResponse "Author not found"
+// @Failure 409 {object} ErrorResponse "Another author has the same name"
+// @Failure 500 {object} ErrorResponse "Error saving author"
+// @Router /authors/{id} [put]
+func (s *Server) UpdateAuthor(w http.ResponseWriter, r *http.Request) {
+    id, ok := pathID(w, r)
+    if !ok {
+        return
+    }
+    author, ok := decodeAuthor(w, r)
+    if !ok {
+        return
+    }
+
+    author.ID = id
+    err := s.Books.Transaction(r.Context(), func(tx repository.BookRepository) error {
+        return changeReferencingBooks(r, tx, repository.RefAuthor, id, func() error {
+            return tx.UpdateAuthor(r.Context(), author)
+        })
+    })
+    if err != nil {
+        writeAuthorError(w, r, "Error saving author", err)
+        return
+    }
+    if err := json.NewEncoder(w).Encode(author); err != nil {
+        Logger(r).Warn("Error encoding author", "error", err)
+    }
+}
+
+
+// DeleteAuthor godoc
+// @Summary Delete an author
+// @Description Delete an author who isn't credited on any book, including books in the trash.
+// @Tags authors
+// @Security BearerAuth
+// @Param id path int true "Author ID"
+// @Success 204 "Author successfully deleted"
+// @Failure 400 {object} ErrorResponse "Invalid ID"
+// @Failure 401 {object} ErrorResponse "Not signed in"
+// @Failure 403 {object} ErrorResponse "Not an admin"
+// @Failure 404 {object} ErrorResponse "Author not found"
+// @Failure 409 {object} ErrorResponse "The author is still credited on books"
+// @Failure 500 {object} ErrorResponse "Error deleting author"
+// @Router /authors/{id} [delete]
+func (s *Server) DeleteAuthor(w http.ResponseWriter, r *http.Request) {
+    id, ok := pathID(w, r)
+    if !ok {
+        return
+    }
+
+    if err := s.Books.DeleteAuthor(r.Context(), id); err != nil {
+        writeAuthorError(w, r, "Error deleting author", err)
+        return
+    }
+    Logger(r).Info("Author deleted", "author_id", id)
+    w.WriteHeader(http.StatusNoContent)
+}
+
+
+// GetAuthorBooks godoc
+// @Summary Get the books of an author
+// @Description Get the books an author is credited on, with the role of each credit, oldest first.
+// @Description Books in the trash are left out.
+// @Tags authors
+// @Accept json
+// @Produce json
+// @Param id path int true "Author ID"
+// @Success 200 {array} AuthorBookResult
+// @Failure 400 {object} ErrorResponse "Invalid ID"
+// @Failure 404 {object} ErrorResponse "Author not found"
+// @Failure 500 {object} ErrorResponse "Error retrieving books"
+// @Router /authors/{id}/books [get]
+func (s *Server) GetAuthorBooks(w http.ResponseWriter, r *http.Request) {
+    id, ok := pathID(w, r)
+    if !ok {
+        return
+    }
+
+    books, err := s.Books.AuthorBooks(r.Context(), id)
+    if err != nil {
+        writeAuthorError(w, r, "Error retrieving books", err)
+        return
+    }
+
+    results := make([]AuthorBookResult, len(books))
+    for i, book := range books {
+        results[i] = AuthorBookResult{Role: book.Role, Book: book.Book}
+    }
+    if err := json.NewEncoder(w).Encode(results); err != nil {
+        Logger(r).Warn("Error encoding author books", "error", err)
+    }
+}
+
+
+// GetBookAuthors godoc
+// @Summary Get the credits of a book
+// @Description Get the authors, editors and translators of a book in order.
+// @Tags books
+// @Accept json
+// @Produce json
+// @Param id path int true "Book ID"
+// @Success 200 {array} models.Contributor
+// @Failure 400 {object} ErrorResponse "Invalid ID"
+// @Failure 404 {object} ErrorResponse "Book not found"
+// @Failure 500 {object} ErrorResponse "Error retrieving credits"
+// @Router /books/{id}/authors [get]
+func (s *Server) GetBookAuthors(w http.ResponseWriter, r *http.Request) {
+    id, ok := pathID(w, r)
+    if !ok {
+        return
+    }
+
+    contributors, err := s.Books.BookAuthors(r.Context(), id)
+    if errors.Is(err, repository.ErrNotFound) {
+        writeError(w, r, http.StatusNotFound, CodeNotFound, "Book not found")
+        return
+    }
+    if err != nil {
+        writeInternalError(w, r, "Error retrieving credits", err)
+        return
+    }
+    if err := json.NewEncoder(w).Encode(contributors); err != nil {
+        Logger(r).Warn("Error encoding credits", "error", err)
+    }
+}
+
+
+// SetBookAuthors godoc
+// @Summary Replace the credits of a book
+// @Description Replace the authors, editors and translators of a book, in the given order.
+// @Description If anyone is credited as an author, the author field of the book is set to their names.
+// @Tags books
+// @Security BearerAuth
+// @Security APIKeyAuth
+// @Accept json
+// @Produce json
+// @Param id path int true "Book ID"
+// @Param credits body []CreditInput true "New credits"
+// @Success 200 {array} models.Contributor
+// @Header 200 {string} ETag "Version of the book"
+// @Failure 400 {object} ErrorResponse "Invalid request body, ID, role or author"
+// @Failure 401 {object} ErrorResponse "Not signed in"
+// @Failure 403 {object} ErrorResponse "Not an editor"
+// @Failure 404 {object} ErrorResponse "Book not found"
+// @Failure 500 {object} ErrorResponse "Error saving credits"
+// @Router /books/{id}/authors [put]
+func (s *Server) SetBookAuthors(w http.ResponseWriter, r *http.Request) {
+    id, ok := pathID(w, r)
+    if !ok {
+        return
+    }
+
+    var inputs []CreditInput
+    if !decodeJSON(w, r, &inputs) {
+        return
+    }
+
+    var validationError ValidationError
+    credits := make([]models.BookAuthor, len(inputs))
+    for i, input := range inputs {
+        field := fmt.Sprintf("[%d]", i)
+        if input.AuthorID == 0 {
+            validationError.Fields = append(validationError.Fields, FieldError{Field: field + ".authorId", Rule: "required", Message: "authorId is required"})
+        }
+        if !validRole(input.Role) {
+            validationError.Fields = append(validationError.Fields, FieldError{
+                Field:   field + ".role",
+                Rule:    "oneof",
+                Message: "role must be one of " + strings.Join(models.Roles, ", "),
+            })
+        }
+        credits[i] = models.BookAuthor{AuthorID: input.AuthorID, Role: input.Role}
+    }
+    if len(validationError.Fields) > 0 {
+        writeValidationError(w, r, &validationError)
+        return
+    }
+
+    var book *models.Book
+    err := s.Books.Transaction(r.Context(), func(tx repository.BookRepository) error {
+        return changeBooks(r, tx, []uint{id}, func() (err error) {
+            book, err = tx.SetBookAuthors(r.Context(), id, credits)
+            return err
+        })
+    })
+    switch {
+    case errors.Is(err, repository.ErrUnknownAuthor):
+        writeValidationError(w, r, &ValidationError{Fields: []FieldError{{Field: "authorId", Rule: "exists", Message: err.Error()}}})
+        return
+    case errors.Is(err, repository.ErrNotFound):
+        writeError(w, r, http.StatusNotFound, CodeNotFound, "Book not found")
+        return
+    case err != nil:
+        writeInternalError(w, r, "Error saving credits", err)
+        return
+    }
+
+    contributors, err := s.Books.BookAuthors(r.Context(), id)
+    if err != nil {
+        writeInternalError(w, r, "Error retrieving credits", err)
+        return
+    }
+    w.Header().Set("ETag", bookETag(book))
+    if err := json.NewEncoder(w).Encode(contributors); err != nil {
+        Logger(r).Warn("Error encoding credits", "error", err)
+    }
+}
+
+func validRole(role string) bool {
+    for _, valid := range models.Roles {
+        if role == valid {
+            return true
+        }
+    }
+    return false
+}
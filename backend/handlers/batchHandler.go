@@ -0,0 +1,245 @@
+package handlers
+
+import (
+	"book-manager/models"
+	"book-manager/repository"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+const maxBatchOperations = 1000
+
+// Batch modes.
+const (
+    BatchAtomic     = "atomic"     // all operations succeed or none is applied
+    BatchBestEffort = "bestEffort" // every operation is applied on its own
+)
+
+// BatchRequest is a list of operations applied in one request.
+type BatchRequest struct {
+    Mode       string           `json:"mode" enums:"atomic,bestEffort"` // atomic (default) or bestEffort
+    Operations []BatchOperation `json:"operations"`
+}
+
+// BatchOperation creates, updates or deletes one book.
+type BatchOperation struct {
+    Op      string     `json:"op" enums:"create,update,delete"`
+    ID      uint       `json:"id,omitempty"`      // Book to update or delete
+    Version uint       `json:"version,omitempty"` // If set, the book must still have this version
+    Purge   bool       `json:"purge,omitempty"`   // Delete permanently instead of moving to the trash
+    Book    *BookInput `json:"book,omitempty"`    // All fields of the created or updated book
+}
+
+// BatchOperationResult is the outcome of one operation.
+type BatchOperationResult struct {
+    Index  int            `json:"index"`           // Position of the operation in the request
+    Op     string         `json:"op"`              // Operation
+    Status int            `json:"status"`          // HTTP status the single-item endpoint would have returned
+    ID     uint           `json:"id,omitempty"`    // ID of the book
+    Book   *models.Book   `json:"book,omitempty"`  // The created or updated book
+    Error  *ErrorResponse `json:"error,omitempty"` // Why the operation failed
+}
+
+// BatchResponse reports the outcome of a batch.
+type BatchResponse struct {
+    Mode      string                 `json:"mode"`
+    Committed bool                   `json:"committed"` // Whether the successful operations were saved
+    Results   []BatchOperationResult `json:"results"`   // In atomic mode, only up to the failed operation
+}
+
+// errBatchFailed rolls back an atomic batch after an operation failed.
+var errBatchFailed = errors.New("batch operation failed")
+
+// batchFailure turns the error of an operation into its status and error body.
+func batchFailure(r *http.Request, op *BatchOperation, err error) (int, *ErrorResponse) {
+    var validation *ValidationError
+    var duplicate *repository.DuplicateISBNError
+    var response ErrorResponse
+    switch {
+    case errors.As(err, &validation):
+        response = ErrorResponse{Code: CodeValidationFailed, Status: http.StatusBadRequest, Message: validation.Error(), Details: validation.Fields}
+    case errors.As(err, &duplicate):
+        response = ErrorResponse{Code: CodeDuplicateISBN, Status: http.StatusConflict, Message: duplicate.Error(), ExistingID: duplicate.ExistingID}
+    case errors.Is(err, repository.ErrNotFound):
+        response = ErrorResponse{Code: CodeNotFound, Status: http.StatusNotFound, Message: "Book not found"}
+    case errors.Is(err, repository.ErrVersionConflict) && op.Version != 0:
+        response = ErrorResponse{Code: CodePreconditionFailed, Status: http.StatusPreconditionFailed, Message: "The book no longer has the given version"}
+    case errors.Is(err, repository.ErrVersionConflict):
+        response = ErrorResponse{Code: CodeEditConflict, Status: http.StatusConflict, Message: "The book was modified concurrently"}
+    default:
+        Logger(r).Error("Error in batch operation", "op", op.Op, "error", err)
+        response = ErrorResponse{Code: CodeInternal, Status: http.StatusInternalServerError, Message: "Error applying operation"}
+    }
+    response.RequestID = RequestID(r)
+    return response.Status, &response
+}
+
+// applyBatchOperation applies op in the transaction tx and fills in result.
+func applyBatchOperation(r *http.Request, tx repository.BookRepository, op *BatchOperation, result *BatchOperationResult) error {
+    ctx := r.Context()
+    switch op.Op {
+    case "create":
+        book := op.Book.book()
+        if err := ValidateBook(book); err != nil {
+            return err
+        }
+        if err := createBook(r, tx, &book); err != nil {
+            return err
+        }
+        result.Status, result.ID, result.Book = http.StatusCreated, book.ID, &book
+    case "update":
+        book, err := tx.Get(ctx, op.ID)
+        if err != nil {
+            return err
+        }
+        if op.Version != 0 && op.Version != book.Version {
+            return repository.ErrVersionConflict
+        }
+        updated := op.Book.book()
+        updated.ID, updated.CreatedAt, updated.Version = book.ID, book.CreatedAt, book.Version
+        if err := ValidateBook(updated); err != nil {
+            return err
+        }
+        if err := updateBook(r, tx, book, &updated); err != nil {
+            return err
+        }
+        result.Status, result.ID, result.Book = http.StatusOK, updated.ID, &updated
+    case "delete":
+        if err := deleteBook(r, tx, op.ID, op.Version, op.Purge); err != nil {
+            return err
+        }
+        result.Status, result.ID = http.StatusNoContent, op.ID
+    }
+    return nil
+}
+
+// checkBatchOperation returns why op is malformed, or "" if it isn't.
+func checkBatchOperation(op *BatchOperation) string {
+    switch op.Op {
+    case "create":
+        if op.Book == nil {
+            return "create needs a book"
+        }
+    case "update":
+        if op.ID == 0 || op.Book == nil {
+            return "update needs an id and a book"
+        }
+    case "delete":
+        if op.ID == 0 {
+            return "delete needs an id"
+        }
+    default:
+        return fmt.Sprintf("op must be create, update or delete, not %q", op.Op)
+    }
+    return ""
+}
+
+// BatchBooks godoc
+// @Summary Create, update and delete books in one request
+// @Description Apply up to 1000 operations in one transaction. In atomic mode (the default) either all operations
+// @Description succeed or none is applied, and the response has the status of the failed operation. In bestEffort mode
+// @Description every operation is applied on its own and the response is always 200. Every result has the status the
+// @Description single-item endpoint would have returned. An update replaces all fields of the book, like PUT.
+// @Description Needs the editor role, or the admin role if any operation is a delete.
+// @Tags books
+// @Security BearerAuth
+// @Security APIKeyAuth
+// @Accept json
+// @Produce json
+// @Param batch body BatchRequest true "Operations"
+// @Success 200 {object} BatchResponse "Outcome of every operation"
+// @Failure 400 {object} ErrorResponse "Malformed request"
+// @Failure 401 {object} ErrorResponse "Not signed in"
+// @Failure 403 {object} ErrorResponse "Not an editor, or a delete operation by a user who isn't an admin"
+// @Failure 409 {object} BatchResponse "An atomic batch was rolled back, the status is that of the failed operation"
+// @Router /books/batch [post]
+func (s *Server) BatchBooks(w http.ResponseWriter, r *http.Request) {
+    var request BatchRequest
+    decoder := json.NewDecoder(r.Body)
+    decoder.DisallowUnknownFields()
+    if err := decoder.Decode(&request); err != nil {
+        Logger(r).Debug("Error decoding request body", "error", err)
+        writeError(w, r, http.StatusBadRequest, CodeInvalidRequest, "Invalid request body: "+err.Error())
+        return
+    }
+
+    if request.Mode == "" {
+        request.Mode = BatchAtomic
+    }
+    if request.Mode != BatchAtomic && request.Mode != BatchBestEffort {
+        writeError(w, r, http.StatusBadRequest, CodeInvalidRequest, "mode must be atomic or bestEffort")
+        return
+    }
+    if len(request.Operations) == 0 || len(request.Operations) > maxBatchOperations {
+        writeError(w, r, http.StatusBadRequest, CodeInvalidRequest, fmt.Sprintf("A batch needs 1 to %d operations", maxBatchOperations))
+        return
+    }
+    for i := range request.Operations {
+        if problem := checkBatchOperation(&request.Operations[i]); problem != "" {
+            writeError(w, r, http.StatusBadRequest, CodeInvalidRequest, fmt.Sprintf("Operation %d: %s", i, problem))
+            return
+        }
+        // Deleting a book needs an admin, like DELETE /books/{id}.
+        if request.Operations[i].Op == "delete" && !hasRole(r, models.UserAdmin) {
+            writeForbidden(w, r, models.UserAdmin)
+            return
+        }
+    }
+
+    response := BatchResponse{Mode: request.Mode, Results: []BatchOperationResult{}}
+    status := http.StatusOK
+    err := s.Books.Transaction(r.Context(), func(tx repository.BookRepository) error {
+        for i := range request.Operations {
+            op := &request.Operations[i]
+            result := BatchOperationResult{Index: i, Op: op.Op}
+
+            // Every operation runs in a nested transaction, so that a failed
+            // one leaves no partial changes in best-effort mode.
+            err := tx.Transaction(r.Context(), func(tx repository.BookRepository) error {
+                return applyBatchOperation(r, tx, op, &result)
+            })
+            if err != nil {
+                result.Status, result.Error = batchFailure(r, op, err)
+                result.ID, result.Book = op.ID, nil
+            }
+            response.Results = append(response.Results, result)
+
+            if err != nil && request.Mode == BatchAtomic {
+                status = result.Status
+                return errBatchFailed
+            }
+        }
+        return nil
+    })
+
+    switch {
+    case err == nil:
+        response.Committed = true
+        failed := 0
+        for _, result := range response.Results {
+            if result.Error != nil {
+                failed++
+            }
+        }
+        Logger(r).Info("Batch committed", "operations", len(response.Results), "failed", failed)
+        for _, op := range request.Operations {
+            if op.Purge {
+                s.deletePurgedCovers(r)
+                break
+            }
+        }
+    case errors.Is(err, errBatchFailed):
+        Logger(r).Info("Atomic batch rolled back", "operation", len(response.Results)-1)
+    default:
+        writeInternalError(w, r, "Error applying batch", err)
+        return
+    }
+
+    w.Header().Set("Content-Type", "application/json")
+    w.WriteHeader(status)
+    if err := json.NewEncoder(w).Encode(response); err != nil {
+        Logger(r).Warn("Error encoding batch response", "error", err)
+    }
+}
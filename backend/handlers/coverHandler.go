@@ -0,0 +1,361 @@
+package handlers
+
+import (
+	"book-manager/models"
+	"book-manager/repository"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"image"
+	"image/jpeg"
+	_ "image/png"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+)
+
+const (
+    defaultMaxCoverSize = 5 << 20
+    maxCoverPixels      = 16 << 20 // 4096×4096; decoded images take 4 bytes per pixel
+    thumbnailQuality    = 85
+)
+
+// coverTypes are the accepted image types, as detected from the content.
+var coverTypes = map[string]bool{"image/jpeg": true, "image/png": true, "image/webp": true}
+
+// CoverResult describes the cover of a book.
+type CoverResult struct {
+    models.BookCover
+    URLs map[string]string `json:"urls"` // URL of every size, which can be cached indefinitely
+}
+
+func coverResult(cover *models.BookCover) CoverResult {
+    urls := map[string]string{}
+    for _, size := range models.CoverSizes {
+        urls[size] = fmt.Sprintf("/books/%d/cover?size=%s&v=%s", cover.BookID, size, coverVersion(cover))
+    }
+    return CoverResult{BookCover: *cover, URLs: urls}
+}
+
+// coverVersion identifies the image of a cover in URLs and ETags.
+func coverVersion(cover *models.BookCover) string {
+    return cover.Checksum[:16]
+}
+
+// readCover reads the uploaded image, either the whole request body or the
+// "cover" part of a multipart/form-data request, and returns it with the type
+// the client declared for it. It writes an error response and returns false
+// if the upload is missing or too large.
+func (s *Server) readCover(w http.ResponseWriter, r *http.Request) ([]byte, string, bool) {
+    var body io.Reader = r.Body
+    declared := r.Header.Get("Content-Type")
+    if mediaType, _, _ := mime.ParseMediaType(declared); mediaType == "multipart/form-data" {
+        reader, err := r.MultipartReader()
+        if err != nil {
+            writeError(w, r, http.StatusBadRequest, CodeInvalidRequest, "Invalid multipart body: "+err.Error())
+            return nil, "", false
+        }
+        for {
+            part, err := reader.NextPart()
+            if err != nil {
+                writeError(w, r, http.StatusBadRequest, CodeInvalidRequest, "The form has no cover field")
+                return nil, "", false
+            }
+            if part.FormName() == "cover" {
+                body, declared = part, part.Header.Get("Content-Type")
+                break
+            }
+        }
+    }
+
+    data, err := io.ReadAll(io.LimitReader(body, s.MaxCoverSize+1))
+    if err != nil {
+        writeError(w, r, http.StatusBadRequest, CodeInvalidRequest, "Error reading upload: "+err.Error())
+        return nil, "", false
+    }
+    if int64(len(data)) > s.MaxCoverSize {
+        writeError(w, r, http.StatusRequestEntityTooLarge, CodeTooLarge, fmt.Sprintf("Cover images may have at most %d bytes", s.MaxCoverSize))
+        return nil, "", false
+    }
+    if len(data) == 0 {
+        writeError(w, r, http.StatusBadRequest, CodeInvalidRequest, "The cover image is empty")
+        return nil, "", false
+    }
+    mediaType, _, _ := mime.ParseMediaType(declared)
+    return data, mediaType, true
+}
+
+// thumbnail scales img down to fit into box. Transparent areas become white,
+// since thumbnails are JPEG images.
+func thumbnail(img image.Image, box image.Point) image.Image {
+    bounds := img.Bounds()
+    width, height := bounds.Dx(), bounds.Dy()
+    if width > box.X {
+        width, height = box.X, height*box.X/width
+    }
+    if height > box.Y {
+        width, height = width*box.Y/height, box.Y
+    }
+
+    scaled := image.NewRGBA(image.Rect(0, 0, max(width, 1), max(height, 1)))
+    draw.Draw(scaled, scaled.Bounds(), image.White, image.Point{}, draw.Src)
+    draw.CatmullRom.Scale(scaled, scaled.Bounds(), img, bounds, draw.Over, nil)
+    return scaled
+}
+
+// storeCoverImages stores the original and every thumbnail of cover. If one of
+// them fails, the images stored so far are discarded again.
+func (s *Server) storeCoverImages(ctx context.Context, cover *models.BookCover, original []byte, img image.Image) error {
+    images := map[string][]byte{models.CoverOriginal: original}
+    for size, box := range models.CoverThumbnails {
+        var encoded bytes.Buffer
+        if err := jpeg.Encode(&encoded, thumbnail(img, box), &jpeg.Options{Quality: thumbnailQuality}); err != nil {
+            return err
+        }
+        images[size] = encoded.Bytes()
+    }
+
+    for size, data := range images {
+        if err := s.Covers.Put(ctx, cover.Key(size), bytes.NewReader(data)); err != nil {
+            s.discardCoverImages(ctx, cover)
+            return err
+        }
+    }
+    return nil
+}
+
+// discardCoverImages deletes the images of a cover that couldn't be saved,
+// unless the book already has the same image as its cover.
+func (s *Server) discardCoverImages(ctx context.Context, cover *models.BookCover) {
+    current, err := s.Books.GetCover(ctx, cover.BookID)
+    if err == nil && current.Checksum == cover.Checksum {
+        return
+    }
+    repository.DeleteCoverImages(ctx, s.Covers, cover)
+}
+
+// deletePurgedCovers deletes the covers of books that were just purged.
+func (s *Server) deletePurgedCovers(r *http.Request) {
+    if err := repository.DeletePurgedCovers(r.Context(), s.Books, s.Covers); err != nil {
+        Logger(r).Error("Error deleting covers of purged books", "error", err)
+    }
+}
+
+
+// UploadCover godoc
+// @Summary Upload the cover image of a book
+// @Description Upload a JPEG, PNG or WebP image, either as the request body or as the "cover" field of a
+// @Description multipart/form-data form. The type is detected from the content. A medium and a thumb sized
+// @Description JPEG thumbnail are generated. An existing cover is replaced.
+// @Tags books
+// @Security BearerAuth
+// @Security APIKeyAuth
+// @Accept image/jpeg,image/png,image/webp,multipart/form-data
+// @Produce json
+// @Param id path int true "Book ID"
+// @Param cover formData file false "Cover image, for multipart/form-data uploads"
+// @Success 200 {object} CoverResult "The cover was replaced"
+// @Success 201 {object} CoverResult "The book got a cover"
+// @Failure 400 {object} ErrorResponse "Invalid ID or image"
+// @Failure 401 {object} ErrorResponse "Not signed in"
+// @Failure 403 {object} ErrorResponse "Not an editor"
+// @Failure 404 {object} ErrorResponse "Book not found"
+// @Failure 413 {object} ErrorResponse "The image is too large"
+// @Failure 415 {object} ErrorResponse "The upload is not a JPEG, PNG or WebP image"
+// @Failure 500 {object} ErrorResponse "Error saving cover"
+// @Router /books/{id}/cover [post]
+func (s *Server) UploadCover(w http.ResponseWriter, r *http.Request) {
+    id, ok := pathID(w, r)
+    if !ok {
+        return
+    }
+    if _, err := s.Books.Get(r.Context(), id); err != nil {
+        if errors.Is(err, repository.ErrNotFound) {
+            writeError(w, r, http.StatusNotFound, CodeNotFound, "Book not found")
+        } else {
+            writeInternalError(w, r, "Error retrieving book", err)
+        }
+        return
+    }
+
+    data, declared, ok := s.readCover(w, r)
+    if !ok {
+        return
+    }
+    contentType := http.DetectContentType(data)
+    if !coverTypes[contentType] || (declared != "" && declared != "application/octet-stream" && declared != contentType) {
+        Logger(r).Debug("Rejected cover upload", "declared", declared, "detected", contentType)
+        writeError(w, r, http.StatusUnsupportedMediaType, CodeUnsupportedMediaType, "Upload a JPEG, PNG or WebP image")
+        return
+    }
+
+    // The size is checked before decoding, so that a small file can't claim
+    // a huge image.
+    config, _, err := image.DecodeConfig(bytes.NewReader(data))
+    if err != nil {
+        writeError(w, r, http.StatusBadRequest, CodeInvalidRequest, "The cover is not a valid image: "+err.Error())
+        return
+    }
+    if config.Width*config.Height > maxCoverPixels {
+        writeError(w, r, http.StatusRequestEntityTooLarge, CodeTooLarge, fmt.Sprintf("Cover images may have at most %d pixels", maxCoverPixels))
+        return
+    }
+    img, _, err := image.Decode(bytes.NewReader(data))
+    if err != nil {
+        writeError(w, r, http.StatusBadRequest, CodeInvalidRequest, "The cover is not a valid image: "+err.Error())
+        return
+    }
+
+    checksum := sha256.Sum256(data)
+    cover := &models.BookCover{
+        BookID:      id,
+        ContentType: contentType,
+        Size:        int64(len(data)),
+        Width:       config.Width,
+        Height:      config.Height,
+        Checksum:    hex.EncodeToString(checksum[:]),
+    }
+    if err := s.storeCoverImages(r.Context(), cover, data, img); err != nil {
+        writeInternalError(w, r, "Error saving cover", err)
+        return
+    }
+
+    replaced, err := s.Books.SetCover(r.Context(), cover)
+    if err != nil {
+        s.discardCoverImages(r.Context(), cover)
+        if errors.Is(err, repository.ErrNotFound) {
+            writeError(w, r, http.StatusNotFound, CodeNotFound, "Book not found")
+        } else {
+            writeInternalError(w, r, "Error saving cover", err)
+        }
+        return
+    }
+    // An identical image has the same keys, so its images are still in use.
+    if replaced != nil && replaced.Checksum != cover.Checksum {
+        repository.DeleteCoverImages(r.Context(), s.Covers, replaced)
+    }
+
+    status := http.StatusCreated
+    if replaced != nil {
+        status = http.StatusOK
+    }
+    w.Header().Set("Content-Type", "application/json")
+    w.Header().Set("Location", fmt.Sprintf("/books/%d/cover", id))
+    encodeResponse(w, r, status, coverResult(cover))
+    Logger(r).Info("Cover saved", "book_id", id, "content_type", contentType, "width", cover.Width, "height", cover.Height)
+}
+
+
+// GetCover godoc
+// @Summary Get the cover image of a book
+// @Description Get the original cover image or one of its JPEG thumbnails. Responses carry an ETag and Last-Modified
+// @Description date for conditional requests. URLs with the v parameter of the current cover, as returned by the
+// @Description upload, may be cached indefinitely; other URLs must be revalidated.
+// @Tags books
+// @Produce image/jpeg,image/png,image/webp
+// @Param id path int true "Book ID"
+// @Param size query string false "Size of the image" Enums(original, medium, thumb) default(original)
+// @Param v query string false "Version of the cover, from the URLs of CoverResult"
+// @Success 200 {file} binary "The image"
+// @Success 304 "The image was not modified"
+// @Failure 400 {object} ErrorResponse "Invalid ID or size"
+// @Failure 404 {object} ErrorResponse "Book not found or without cover"
+// @Failure 500 {object} ErrorResponse "Error retrieving cover"
+// @Router /books/{id}/cover [get]
+func (s *Server) GetCover(w http.ResponseWriter, r *http.Request) {
+    id, ok := pathID(w, r)
+    if !ok {
+        return
+    }
+    size := r.URL.Query().Get("size")
+    if size == "" {
+        size = models.CoverOriginal
+    }
+    if _, thumbnail := models.CoverThumbnails[size]; !thumbnail && size != models.CoverOriginal {
+        writeError(w, r, http.StatusBadRequest, CodeInvalidRequest, "size must be one of "+strings.Join(models.CoverSizes, ", "))
+        return
+    }
+
+    cover, err := s.Books.GetCover(r.Context(), id)
+    if errors.Is(err, repository.ErrNotFound) {
+        writeError(w, r, http.StatusNotFound, CodeNotFound, "The book has no cover")
+        return
+    }
+    if err != nil {
+        writeInternalError(w, r, "Error retrieving cover", err)
+        return
+    }
+
+    blob, err := s.Covers.Open(r.Context(), cover.Key(size))
+    if err != nil {
+        writeInternalError(w, r, "Error retrieving cover", err)
+        return
+    }
+    defer blob.Close()
+    content, ok := blob.(io.ReadSeeker)
+    if !ok {
+        data, err := io.ReadAll(blob)
+        if err != nil {
+            writeInternalError(w, r, "Error retrieving cover", err)
+            return
+        }
+        content = bytes.NewReader(data)
+    }
+
+    contentType := "image/jpeg"
+    if size == models.CoverOriginal {
+        contentType = cover.ContentType
+    }
+    w.Header().Set("Content-Type", contentType)
+    w.Header().Set("X-Content-Type-Options", "nosniff")
+    w.Header().Set("ETag", fmt.Sprintf(`"%s-%s"`, coverVersion(cover), size))
+    if r.URL.Query().Get("v") == coverVersion(cover) {
+        w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+    } else {
+        w.Header().Set("Cache-Control", "public, no-cache")
+    }
+    // ServeContent answers conditional and range requests.
+    http.ServeContent(w, r, "", cover.UpdatedAt, content)
+}
+
+
+// DeleteCover godoc
+// @Summary Delete the cover image of a book
+// @Tags books
+// @Security BearerAuth
+// @Security APIKeyAuth
+// @Param id path int true "Book ID"
+// @Success 204 "Cover deleted"
+// @Failure 400 {object} ErrorResponse "Invalid ID"
+// @Failure 401 {object} ErrorResponse "Not signed in"
+// @Failure 403 {object} ErrorResponse "Not an editor"
+// @Failure 404 {object} ErrorResponse "Book not found or without cover"
+// @Failure 500 {object} ErrorResponse "Error deleting cover"
+// @Router /books/{id}/cover [delete]
+func (s *Server) DeleteCover(w http.ResponseWriter, r *http.Request) {
+    id, ok := pathID(w, r)
+    if !ok {
+        return
+    }
+
+    cover, err := s.Books.DeleteCover(r.Context(), id)
+    if errors.Is(err, repository.ErrNotFound) {
+        writeError(w, r, http.StatusNotFound, CodeNotFound, "The book has no cover")
+        return
+    }
+    if err != nil {
+        writeInternalError(w, r, "Error deleting cover", err)
+        return
+    }
+    repository.DeleteCoverImages(r.Context(), s.Covers, cover)
+
+    w.WriteHeader(http.StatusNoContent)
+    Logger(r).Info("Cover deleted", "book_id", id)
+}
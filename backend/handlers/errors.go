@@ -0,0 +1,141 @@
+package handlers
+
+import (
+	"book-manager/repository"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+)
+
+// Error codes returned in ErrorResponse.Code. Clients should rely on these
+// rather than on the message.
+const (
+    CodeInvalidRequest       = "invalid_request"        // malformed body, ID or query parameter
+    CodeValidationFailed     = "validation_failed"      // the body failed validation, see Details
+    CodeNotFound             = "not_found"              // no such book, other record or route
+    CodeMethodNotAllowed     = "method_not_allowed"     // the route doesn't support the method
+    CodeDuplicateISBN        = "duplicate_isbn"         // another book has the same ISBN, see ExistingID
+    CodeDuplicateAuthor      = "duplicate_author"       // another author has the same name, see ExistingID
+    CodeDuplicateName        = "duplicate_name"         // another publisher or genre has the same name, see ExistingID
+    CodeInUse                = "in_use"                 // the record can't be deleted while books refer to it
+    CodeUnsupportedMediaType = "unsupported_media_type" // the request body has an unsupported Content-Type
+    CodeTooLarge             = "too_large"              // the request body or uploaded image is too large
+    CodeUnauthorized         = "unauthorized"           // sign in or send a valid access token
+    CodeForbidden            = "forbidden"              // the role of the user doesn't allow the request
+    CodeUsernameTaken        = "username_taken"         // another user has the same username
+    CodeLastAdmin            = "last_admin"             // the only admin can't get another role
+    CodeRevoked              = "revoked"                // the API key was revoked and can't be rotated
+    CodePreconditionFailed   = "precondition_failed"    // If-Match doesn't match the current ETag
+    CodePreconditionRequired = "precondition_required"  // send the current ETag in If-Match
+    CodeEditConflict         = "edit_conflict"          // the book was changed concurrently, reload and retry
+    CodeRateLimited          = "rate_limited"           // too many requests, retry after the Retry-After header
+    CodeInternal             = "internal_error"         // something went wrong on the server
+)
+
+// ErrorResponse is the body of every error response.
+type ErrorResponse struct {
+    Code       string       `json:"code"`                 // Machine-readable error code
+    Status     int          `json:"status"`               // HTTP status code
+    Message    string       `json:"message"`              // Human-readable message
+    Details    []FieldError `json:"details,omitempty"`    // Per-field validation errors
+    RequestID  string       `json:"requestId,omitempty"`  // ID of the request, also sent in X-Request-ID
+    ExistingID uint         `json:"existingId,omitempty"` // ID of the conflicting record, for the duplicate_* codes
+}
+
+// FieldError describes why a single field is invalid.
+type FieldError struct {
+    Field   string `json:"field"`   // JSON name of the field
+    Rule    string `json:"rule"`    // Failed rule, e.g. required, min, isbn, oneof or type
+    Message string `json:"message"` // Human-readable message
+}
+
+// ValidationError is returned by ValidateBook and lists every invalid field.
+type ValidationError struct {
+    Fields []FieldError
+}
+
+func (e *ValidationError) Error() string {
+    messages := make([]string, len(e.Fields))
+    for i, f := range e.Fields {
+        messages[i] = f.Message
+    }
+    return strings.Join(messages, ", ")
+}
+
+// writeError writes an ErrorResponse with the given status and code.
+func writeError(w http.ResponseWriter, r *http.Request, status int, code, message string) {
+    writeErrorResponse(w, r, ErrorResponse{Code: code, Status: status, Message: message})
+}
+
+func writeErrorResponse(w http.ResponseWriter, r *http.Request, response ErrorResponse) {
+    response.RequestID = RequestID(r)
+    w.Header().Set("Content-Type", "application/json")
+    w.Header().Set("X-Content-Type-Options", "nosniff")
+    w.WriteHeader(response.Status)
+    if err := json.NewEncoder(w).Encode(response); err != nil {
+        Logger(r).Warn("Error encoding error response", "error", err)
+    }
+}
+
+// writeInternalError logs err and writes a 500 response with a generic
+// message, so that database errors never reach the client.
+func writeInternalError(w http.ResponseWriter, r *http.Request, message string, err error) {
+    Logger(r).Error(message, "error", err)
+    writeError(w, r, http.StatusInternalServerError, CodeInternal, message)
+}
+
+// writeValidationError writes a 400 response listing the invalid fields.
+func writeValidationError(w http.ResponseWriter, r *http.Request, err *ValidationError) {
+    Logger(r).Debug("Validation error", "error", err)
+    writeErrorResponse(w, r, ErrorResponse{
+        Code:    CodeValidationFailed,
+        Status:  http.StatusBadRequest,
+        Message: err.Error(),
+        Details: err.Fields,
+    })
+}
+
+// writeSaveError writes the response for an error returned when creating or updating a book.
+func writeSaveError(w http.ResponseWriter, r *http.Request, err error) {
+    var duplicate *repository.DuplicateISBNError
+    if errors.As(err, &duplicate) {
+        Logger(r).Debug("Duplicate ISBN", "error", err)
+        writeErrorResponse(w, r, ErrorResponse{
+            Code:       CodeDuplicateISBN,
+            Status:     http.StatusConflict,
+            Message:    duplicate.Error(),
+            ExistingID: duplicate.ExistingID,
+        })
+        return
+    }
+    if errors.Is(err, repository.ErrUnknownPublisher) {
+        writeValidationError(w, r, &ValidationError{Fields: []FieldError{{Field: "publisherId", Rule: "exists", Message: err.Error()}}})
+        return
+    }
+    if errors.Is(err, repository.ErrUnknownGenre) {
+        writeValidationError(w, r, &ValidationError{Fields: []FieldError{{Field: "genreId", Rule: "exists", Message: err.Error()}}})
+        return
+    }
+    if errors.Is(err, repository.ErrNotFound) {
+        writeError(w, r, http.StatusNotFound, CodeNotFound, "Book not found")
+        return
+    }
+    if errors.Is(err, repository.ErrVersionConflict) {
+        if r.Header.Get("If-Match") != "" {
+            writeError(w, r, http.StatusPreconditionFailed, CodePreconditionFailed, "The book was modified since it was read")
+        } else {
+            writeError(w, r, http.StatusConflict, CodeEditConflict, "The book was modified concurrently, reload it and try again")
+        }
+        return
+    }
+    writeInternalError(w, r, "Error saving book", err)
+}
+
+func notFound(w http.ResponseWriter, r *http.Request) {
+    writeError(w, r, http.StatusNotFound, CodeNotFound, "No route for "+r.Method+" "+r.URL.Path)
+}
+
+func methodNotAllowed(w http.ResponseWriter, r *http.Request) {
+    writeError(w, r, http.StatusMethodNotAllowed, CodeMethodNotAllowed, "Method "+r.Method+" is not allowed on "+r.URL.Path)
+}
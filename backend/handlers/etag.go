@@ -0,0 +1,53 @@
+package handlers
+
+import (
+	"book-manager/models"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// bookETag returns the strong ETag of a book, which changes with its version.
+func bookETag(book *models.Book) string {
+    return fmt.Sprintf(`"%d-%d"`, book.ID, book.Version)
+}
+
+// etagListMatches reports whether header, the value of an If-Match or
+// If-None-Match header, is "*" or lists etag. With weak set, W/ prefixes are
+// ignored as required for If-None-Match.
+func etagListMatches(header, etag string, weak bool) bool {
+    for _, candidate := range strings.Split(header, ",") {
+        candidate = strings.TrimSpace(candidate)
+        if weak {
+            candidate = strings.TrimPrefix(candidate, "W/")
+        }
+        if candidate == "*" || candidate == etag {
+            return true
+        }
+    }
+    return false
+}
+
+// checkIfMatch writes a 412 response and returns false if the request has an
+// If-Match header that doesn't match the current version of book.
+func checkIfMatch(w http.ResponseWriter, r *http.Request, book *models.Book) bool {
+    header := r.Header.Get("If-Match")
+    if header == "" || etagListMatches(header, bookETag(book), false) {
+        return true
+    }
+    w.Header().Set("ETag", bookETag(book))
+    writeError(w, r, http.StatusPreconditionFailed, CodePreconditionFailed, "The book was modified since it was read")
+    return false
+}
+
+// notModified writes a 304 response and returns true if the request has an
+// If-None-Match header matching the current version of book.
+func notModified(w http.ResponseWriter, r *http.Request, book *models.Book) bool {
+    header := r.Header.Get("If-None-Match")
+    if header == "" || !etagListMatches(header, bookETag(book), true) {
+        return false
+    }
+    w.Header().Set("ETag", bookETag(book))
+    w.WriteHeader(http.StatusNotModified)
+    return true
+}
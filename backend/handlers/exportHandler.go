@@ -0,0 +1,224 @@
+package handlers
+
+import (
+	"book-manager/models"
+	"book-manager/repository"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// exportColumns are the CSV columns of an export, in order.
+var exportColumns = []struct {
+    name  string
+    value func(book *models.Book) string
+}{
+    {"id", func(book *models.Book) string { return strconv.FormatUint(uint64(book.ID), 10) }},
+    {"title", func(book *models.Book) string { return book.Title }},
+    {"author", func(book *models.Book) string { return book.Author }},
+    {"year", func(book *models.Book) string { return strconv.Itoa(book.Year) }},
+    {"genre", func(book *models.Book) string { return book.Genre }},
+    {"isbn", func(book *models.Book) string { return book.ISBN }},
+    {"isbn13", func(book *models.Book) string {
+        if book.ISBN13 == nil {
+            return ""
+        }
+        return *book.ISBN13
+    }},
+    {"publisher", func(book *models.Book) string { return book.Publisher }},
+    {"description", func(book *models.Book) string { return book.Description }},
+    {"createdAt", func(book *models.Book) string { return book.CreatedAt.UTC().Format(time.RFC3339) }},
+    {"updatedAt", func(book *models.Book) string { return book.UpdatedAt.UTC().Format(time.RFC3339) }},
+}
+
+// bookWriter writes exported books in one format.
+type bookWriter interface {
+    Write(book *models.Book) error
+    Close() error
+}
+
+type csvBookWriter struct {
+    w    *csv.Writer
+    rows int
+}
+
+func newCSVBookWriter(w io.Writer) (*csvBookWriter, error) {
+    header := make([]string, len(exportColumns))
+    for i, column := range exportColumns {
+        header[i] = column.name
+    }
+    cw := csv.NewWriter(w)
+    return &csvBookWriter{w: cw}, cw.Write(header)
+}
+
+func (c *csvBookWriter) Write(book *models.Book) error {
+    record := make([]string, len(exportColumns))
+    for i, column := range exportColumns {
+        record[i] = column.value(book)
+    }
+    if err := c.w.Write(record); err != nil {
+        return err
+    }
+    c.rows++
+    if c.rows%100 == 0 {
+        c.w.Flush()
+    }
+    return c.w.Error()
+}
+
+func (c *csvBookWriter) Close() error {
+    c.w.Flush()
+    return c.w.Error()
+}
+
+type ndjsonBookWriter struct {
+    encoder *json.Encoder
+}
+
+func (n *ndjsonBookWriter) Write(book *models.Book) error {
+    return n.encoder.Encode(book)
+}
+
+func (n *ndjsonBookWriter) Close() error {
+    return nil
+}
+
+// jsonBookWriter writes a JSON array one element at a time.
+type jsonBookWriter struct {
+    w     io.Writer
+    count int
+}
+
+func (j *jsonBookWriter) Write(book *models.Book) error {
+    separator := ",\n"
+    if j.count == 0 {
+        separator = "[\n"
+    }
+    j.count++
+    data, err := json.Marshal(book)
+    if err != nil {
+        return err
+    }
+    if _, err := io.WriteString(j.w, separator); err != nil {
+        return err
+    }
+    _, err = j.w.Write(data)
+    return err
+}
+
+func (j *jsonBookWriter) Close() error {
+    end := "\n]\n"
+    if j.count == 0 {
+        end = "[]\n"
+    }
+    _, err := io.WriteString(j.w, end)
+    return err
+}
+
+// exportFormats maps the format parameter to the content type and file extension.
+var exportFormats = map[string]struct {
+    contentType string
+    extension   string
+}{
+    "csv":    {"text/csv; charset=utf-8", "csv"},
+    "ndjson": {"application/x-ndjson", "ndjson"},
+    "json":   {"application/json", "json"},
+}
+
+// ExportBooks godoc
+// @Summary Export books
+// @Description Download all books, or those selected by the same filter and sort parameters as GET /books,
+// @Description as CSV, NDJSON or a JSON array. Books are streamed from the database, pagination parameters are ignored.
+// @Tags books
+// @Produce text/csv
+// @Produce application/x-ndjson
+// @Produce json
+// @Param format query string false "csv (default), ndjson or json"
+// @Param sort query string false "Sort field (id, title, author, year, genre, isbn, publisher, createdAt, updatedAt)"
+// @Param order query string false "Sort direction (asc or desc)"
+// @Success 200 {file} file "The exported books"
+// @Header 200 {string} Content-Disposition "attachment; filename=books-<date>.<format>"
+// @Failure 400 {object} ErrorResponse "Invalid format or query parameters"
+// @Failure 500 {object} ErrorResponse "Error exporting books"
+// @Router /books/export [get]
+func (s *Server) ExportBooks(w http.ResponseWriter, r *http.Request) {
+    values := r.URL.Query()
+    format := strings.ToLower(values.Get("format"))
+    if format == "" {
+        format = "csv"
+    }
+    values.Del("format")
+    exportFormat, ok := exportFormats[format]
+    if !ok {
+        writeError(w, r, http.StatusBadRequest, CodeInvalidRequest, "format must be csv, ndjson or json")
+        return
+    }
+
+    query, err := repository.ParseBookQuery(values)
+    if err != nil {
+        Logger(r).Debug("Invalid book query", "error", err)
+        writeError(w, r, http.StatusBadRequest, CodeInvalidRequest, err.Error())
+        return
+    }
+
+    // Large exports may take longer than the server's write timeout.
+    http.NewResponseController(w).SetWriteDeadline(time.Time{})
+
+    // The headers are only sent with the first book, so that errors before
+    // it can still be reported properly.
+    var out bookWriter
+    start := func() error {
+        w.Header().Set("Content-Type", exportFormat.contentType)
+        w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="books-%s.%s"`, time.Now().Format("2006-01-02"), exportFormat.extension))
+        w.WriteHeader(http.StatusOK)
+        switch format {
+        case "csv":
+            csvWriter, err := newCSVBookWriter(w)
+            out = csvWriter
+            return err
+        case "ndjson":
+            out = &ndjsonBookWriter{encoder: json.NewEncoder(w)}
+        default:
+            out = &jsonBookWriter{w: w}
+        }
+        return nil
+    }
+
+    count := 0
+    err = s.Books.Export(r.Context(), query, func(book *models.Book) error {
+        if out == nil {
+            if err := start(); err != nil {
+                return err
+            }
+        }
+        count++
+        return out.Write(book)
+    })
+
+    if err != nil && out == nil {
+        writeInternalError(w, r, "Error exporting books", err)
+        return
+    }
+    if err != nil {
+        // The response has already started, the client gets a truncated file.
+        Logger(r).Error("Error exporting books", "exported", count, "error", err)
+        return
+    }
+
+    if out == nil {
+        if err := start(); err != nil {
+            Logger(r).Warn("Error writing export", "error", err)
+            return
+        }
+    }
+    if err := out.Close(); err != nil {
+        Logger(r).Warn("Error writing export", "error", err)
+        return
+    }
+    Logger(r).Info("Exported books", "count", count, "format", format)
+}
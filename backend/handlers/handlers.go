@@ -1,26 +1,44 @@
 package handlers
 
 import (
-	"book-manager/database"
 	"book-manager/models"
+	"book-manager/repository"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
 	"net/http"
+	"reflect"
 	"strconv"
 	"strings"
 
 	"github.com/go-playground/validator/v10"
 	"github.com/gorilla/mux"
-	"gorm.io/gorm"
 )
 
 
+// ValidateBook checks book against the rules in its validate tags. The
+// returned error is a *ValidationError naming fields by their JSON names.
 func ValidateBook(book models.Book) error {
+    return validateStruct(book)
+}
+
+// ValidateAuthor checks author like ValidateBook.
+func ValidateAuthor(author models.Author) error {
+    return validateStruct(author)
+}
+
+func validateStruct(v interface{}) error {
     validate := validator.New()
-    err := validate.Struct(book)
+    validate.RegisterTagNameFunc(func(field reflect.StructField) string {
+        return strings.SplitN(field.Tag.Get("json"), ",", 2)[0]
+    })
+    validate.RegisterValidation("isbn", func(fl validator.FieldLevel) bool {
+        _, err := models.NormalizeISBN(fl.Field().String())
+        return err == nil
+    })
+    err := validate.Struct(v)
     if err != nil {
-        var errorMessages []string
+        var validationError ValidationError
         for _, err := range err.(validator.ValidationErrors) {
             var errorMessage string
             switch err.Tag() {
@@ -28,95 +46,184 @@ func ValidateBook(book models.Book) error {
                 errorMessage = fmt.Sprintf("%s is required", err.Field())
             case "min":
                 errorMessage = fmt.Sprintf("%s must be at least %s characters long", err.Field(), err.Param())
+            case "excludes":
+                errorMessage = fmt.Sprintf("%s must not contain %q", err.Field(), err.Param())
+            case "isbn":
+                _, isbnErr := models.NormalizeISBN(err.Value().(string))
+                errorMessage = fmt.Sprintf("%s is not a valid ISBN-10 or ISBN-13: %v", err.Field(), isbnErr)
             default:
                 errorMessage = fmt.Sprintf("%s is not valid", err.Field())
             }
-            errorMessages = append(errorMessages, errorMessage)
+            validationError.Fields = append(validationError.Fields, FieldError{Field: err.Field(), Rule: err.Tag(), Message: errorMessage})
         }
-        errMsg := strings.Join(errorMessages, ", ")
-        log.Printf("Validation error: %s", errMsg)
-        return fmt.Errorf(errMsg)
+        return &validationError
     }
     return nil
 }
 
 
-
-
-type ErrorResponse struct {
-    Code    int    `json:"code"`    // HTTP status code
-    Message string `json:"message"` // Error message
-}
-
-
 // GetBooks godoc
 // @Summary Get list of books
-// @Description Get details of all books available
+// @Description Get a page of books. Supports limit/offset and cursor pagination, sorting by any book field
+// @Description and exact or range filters such as genre=Fantasy or year[gte]=1990&year[lte]=2000.
+// @Description tag=to-read,signed-copy selects books with both tags, or with either of them with tagMatch=any.
+// @Description The total number of matching books is returned in X-Total-Count and the cursor of the next page in X-Next-Cursor.
 // @Tags books
 // @Accept  json
 // @Produce  json
+// @Param limit query int false "Page size (default 50, max 500)"
+// @Param offset query int false "Number of books to skip"
+// @Param cursor query string false "Cursor returned in X-Next-Cursor"
+// @Param sort query string false "Sort field (id, title, author, year, genre, isbn, publisher, createdAt, updatedAt)"
+// @Param order query string false "Sort direction (asc or desc)"
+// @Param tag query []string false "Only books with these tags, repeated or comma-separated" collectionFormat(multi)
+// @Param tagMatch query string false "Whether books need all (default) or any of the tags"
 // @Success 200 {array} models.Book
+// @Header 200 {integer} X-Total-Count "Number of books matching the filters"
+// @Header 200 {string} X-Next-Cursor "Cursor of the next page, if any"
+// @Failure 400 {object} ErrorResponse "Invalid query parameters"
 // @Failure 500 {object} ErrorResponse "Error retrieving books"
 // @Router /books [get]
-func GetBooks(w http.ResponseWriter, r *http.Request) {
-    log.Printf("Received request for GetBooks: %s %s", r.Method, r.URL.Path)
-    var books []models.Book
-    if err := database.DB.Find(&books).Error; err != nil {
-        log.Printf("Error retrieving books: %v", err)
-        http.Error(w, "Error retrieving books", http.StatusInternalServerError)
+func (s *Server) GetBooks(w http.ResponseWriter, r *http.Request) {
+    s.listBooks(w, r, false)
+}
+
+// listBooks writes the page of live or trashed books selected by the request's query parameters.
+func (s *Server) listBooks(w http.ResponseWriter, r *http.Request, trashed bool) {
+    query, err := repository.ParseBookQuery(r.URL.Query())
+    if err != nil {
+        Logger(r).Debug("Invalid book query", "error", err)
+        writeError(w, r, http.StatusBadRequest, CodeInvalidRequest, err.Error())
+        return
+    }
+    query.Trashed = trashed
+
+    page, err := s.Books.List(r.Context(), query)
+    if err != nil {
+        writeInternalError(w, r, "Error retrieving books", err)
         return
     }
-    if err := json.NewEncoder(w).Encode(books); err != nil {
-        log.Printf("Error encoding books response: %v", err)
-        http.Error(w, "Error processing request", http.StatusInternalServerError)
+
+    w.Header().Set("X-Total-Count", strconv.FormatInt(page.Total, 10))
+    if page.NextCursor != "" {
+        w.Header().Set("X-Next-Cursor", page.NextCursor)
+    }
+
+    if err := json.NewEncoder(w).Encode(page.Books); err != nil {
+        Logger(r).Warn("Error encoding books response", "error", err)
+    }
+}
+
+
+// BookSearchResult is a book matching a search query together with its relevance
+type BookSearchResult struct {
+    Book       models.Book       `json:"book"`
+    Score      float64           `json:"score"`                // Relevance, higher is better
+    Highlights map[string]string `json:"highlights,omitempty"` // HTML-escaped matching fields with matches wrapped in <mark>
+}
+
+
+// SearchBooks godoc
+// @Summary Search books
+// @Description Full-text search across title, author, description, publisher and genre, best matches first.
+// @Description Words are combined with AND, "quoted phrases" match exactly and a trailing * makes a prefix query (e.g. tolk*).
+// @Tags books
+// @Accept  json
+// @Produce  json
+// @Param q query string true "Search query"
+// @Param limit query int false "Maximum number of results (default 50, max 500)"
+// @Success 200 {array} BookSearchResult
+// @Failure 400 {object} ErrorResponse "Missing or invalid query"
+// @Failure 500 {object} ErrorResponse "Error searching books"
+// @Router /books/search [get]
+func (s *Server) SearchBooks(w http.ResponseWriter, r *http.Request) {
+    q := strings.TrimSpace(r.URL.Query().Get("q"))
+    if q == "" {
+        writeError(w, r, http.StatusBadRequest, CodeInvalidRequest, "q is required")
+        return
+    }
+
+    limit := repository.DefaultPageSize
+    if raw := r.URL.Query().Get("limit"); raw != "" {
+        var err error
+        if limit, err = strconv.Atoi(raw); err != nil || limit < 1 {
+            writeError(w, r, http.StatusBadRequest, CodeInvalidRequest, "limit must be a positive integer")
+            return
+        }
+        if limit > repository.MaxPageSize {
+            limit = repository.MaxPageSize
+        }
+    }
+
+    hits, err := s.Books.Search(r.Context(), q, limit)
+    if err != nil {
+        writeInternalError(w, r, "Error searching books", err)
+        return
+    }
+
+    results := make([]BookSearchResult, len(hits))
+    for i, hit := range hits {
+        results[i] = BookSearchResult{Book: hit.Book, Score: hit.Score, Highlights: hit.Highlights}
+    }
+
+    if err := json.NewEncoder(w).Encode(results); err != nil {
+        Logger(r).Warn("Error encoding search response", "error", err)
     }
 }
 
 
 // AddBook adds a new book to the database
 // @Summary Add a new book
-// @Description Add a new book with title, author, year, genre, isbn, publisher, and description
+// @Description Add a new book with title, author, year, genre, isbn, publisher, and description.
+// @Description The publisher and genre can be given by name, creating them if needed, or by publisherId and genreId.
 // @Tags books
+// @Security BearerAuth
+// @Security APIKeyAuth
 // @Accept json
 // @Produce json
 // @Param book body models.Book true "Add Book"
 // @Success 201 {object} models.Book "Book successfully added"
-// @Failure 400 {string} string "Invalid request body"
-// @Failure 500 {string} string "Error saving book"
+// @Header 201 {string} ETag "Version of the new book"
+// @Failure 400 {object} ErrorResponse "Invalid request body"
+// @Failure 401 {object} ErrorResponse "Not signed in"
+// @Failure 403 {object} ErrorResponse "Not an editor"
+// @Failure 409 {object} ErrorResponse "A book with the same ISBN already exists"
+// @Failure 500 {object} ErrorResponse "Error saving book"
 // @Router /books [post]
-func AddBook(w http.ResponseWriter, r *http.Request) {
-    log.Printf("Received request for AddBook: %s %s", r.Method, r.URL.Path)
-
+func (s *Server) AddBook(w http.ResponseWriter, r *http.Request) {
     var tempMap map[string]interface{}
     if err := json.NewDecoder(r.Body).Decode(&tempMap); err != nil {
-        log.Printf("Error decoding request body: %v", err)
-        http.Error(w, "Invalid request body", http.StatusBadRequest)
+        Logger(r).Debug("Error decoding request body", "error", err)
+        writeError(w, r, http.StatusBadRequest, CodeInvalidRequest, "Invalid request body")
         return
     }
 
     var book models.Book
+    var typeErrors ValidationError
 
     if title, ok := tempMap["title"].(string); !ok {
-        http.Error(w, "title must be a string", http.StatusBadRequest)
-        return
+        typeErrors.Fields = append(typeErrors.Fields, FieldError{Field: "title", Rule: "type", Message: "title must be a string"})
     } else {
         book.Title = title
     }
 
     if author, ok := tempMap["author"].(string); !ok {
-        http.Error(w, "author must be a string", http.StatusBadRequest)
-        return
+        typeErrors.Fields = append(typeErrors.Fields, FieldError{Field: "author", Rule: "type", Message: "author must be a string"})
     } else {
         book.Author = author
     }
 
     if year, ok := tempMap["year"].(float64); !ok {
-        http.Error(w, "year must be a number", http.StatusBadRequest)
-        return
+        typeErrors.Fields = append(typeErrors.Fields, FieldError{Field: "year", Rule: "type", Message: "year must be a number"})
     } else {
         book.Year = int(year)
     }
 
+    if len(typeErrors.Fields) > 0 {
+        writeValidationError(w, r, &typeErrors)
+        return
+    }
+
     if genre, ok := tempMap["genre"].(string); ok {
         book.Genre = genre
     }
@@ -129,26 +236,38 @@ func AddBook(w http.ResponseWriter, r *http.Request) {
         book.Publisher = publisher
     }
 
+    if publisherID, ok := tempMap["publisherId"].(float64); ok {
+        id := uint(publisherID)
+        book.PublisherID = &id
+    }
+
+    if genreID, ok := tempMap["genreId"].(float64); ok {
+        id := uint(genreID)
+        book.GenreID = &id
+    }
+
     if description, ok := tempMap["description"].(string); ok {
         book.Description = description
     }
 
     if err := ValidateBook(book); err != nil {
-        http.Error(w, err.Error(), http.StatusBadRequest)
+        writeValidationError(w, r, err.(*ValidationError))
         return
     }
 
-    // Database insertion
-    if err := database.DB.Create(&book).Error; err != nil {
-        log.Printf("Error saving new book: %v", err)
-        http.Error(w, "Error saving book", http.StatusInternalServerError)
+    // Database insertion, together with the audit entry
+    err := s.Books.Transaction(r.Context(), func(tx repository.BookRepository) error {
+        return createBook(r, tx, &book)
+    })
+    if err != nil {
+        writeSaveError(w, r, err)
         return
     }
 
+    w.Header().Set("ETag", bookETag(&book))
     w.WriteHeader(http.StatusCreated)
     if err := json.NewEncoder(w).Encode(book); err != nil {
-        log.Printf("Error encoding book response: %v", err)
-        http.Error(w, "Error processing request", http.StatusInternalServerError)
+        Logger(r).Warn("Error encoding book response", "error", err)
     }
 }
 
@@ -160,36 +279,41 @@ func AddBook(w http.ResponseWriter, r *http.Request) {
 // @Accept json
 // @Produce json
 // @Param id path int true "Book ID"
+// @Param If-None-Match header string false "ETag of a cached copy, answered with 304 if it is still current"
 // @Success 200 {object} models.Book "Book found"
-// @Failure 400 {string} string "Invalid ID"
-// @Failure 404 {string} string "Book not found"
-// @Failure 500 {string} string "Database error"
+// @Header 200 {string} ETag "Current version of the book"
+// @Success 304 "The cached copy is current"
+// @Failure 400 {object} ErrorResponse "Invalid ID"
+// @Failure 404 {object} ErrorResponse "Book not found"
+// @Failure 500 {object} ErrorResponse "Error retrieving book"
 // @Router /books/{id} [get]
-func GetBook(w http.ResponseWriter, r *http.Request) {
-    log.Println("GetBook request received")
+func (s *Server) GetBook(w http.ResponseWriter, r *http.Request) {
     params := mux.Vars(r)
     id, err := strconv.Atoi(params["id"])
     if err != nil {
-        log.Printf("Invalid ID: %v", err)
-        http.Error(w, "Invalid ID", http.StatusBadRequest)
+        Logger(r).Debug("Invalid ID", "error", err)
+        writeError(w, r, http.StatusBadRequest, CodeInvalidRequest, "Invalid ID")
         return
     }
 
-    var book models.Book
-    result := database.DB.First(&book, id)
-    if result.Error != nil {
-        if result.Error == gorm.ErrRecordNotFound {
-            log.Printf("Book not found: %d", id)
-            http.Error(w, "Book not found", http.StatusNotFound)
+    book, err := s.Books.Get(r.Context(), uint(id))
+    if err != nil {
+        if errors.Is(err, repository.ErrNotFound) {
+            Logger(r).Debug("Book not found", "book_id", id)
+            writeError(w, r, http.StatusNotFound, CodeNotFound, "Book not found")
         } else {
-            log.Printf("Database error: %v", result.Error)
-            http.Error(w, result.Error.Error(), http.StatusInternalServerError)
+            writeInternalError(w, r, "Error retrieving book", err)
         }
         return
     }
 
+    if notModified(w, r, book) {
+        return
+    }
+
+    w.Header().Set("ETag", bookETag(book))
     if err := json.NewEncoder(w).Encode(book); err != nil {
-        log.Printf("Error encoding book: %v", err)
+        Logger(r).Warn("Error encoding book", "error", err)
     }
 }
 
@@ -200,58 +324,73 @@ func GetBook(w http.ResponseWriter, r *http.Request) {
 // @Summary Update a book
 // @Description Update the details of an existing book by ID
 // @Tags books
+// @Security BearerAuth
+// @Security APIKeyAuth
 // @Accept json
 // @Produce json
 // @Param id path int true "Book ID"
 // @Param book body models.Book true "Book object that needs to be updated"
+// @Param If-Match header string false "ETag the book must still have"
 // @Success 200 {object} models.Book "Book successfully updated"
-// @Failure 400 {string} string "Invalid request body or ID"
-// @Failure 404 {string} string "Book not found"
-// @Failure 500 {string} string "Database error"
+// @Header 200 {string} ETag "New version of the book"
+// @Failure 400 {object} ErrorResponse "Invalid request body or ID"
+// @Failure 401 {object} ErrorResponse "Not signed in"
+// @Failure 403 {object} ErrorResponse "Not an editor"
+// @Failure 404 {object} ErrorResponse "Book not found"
+// @Failure 409 {object} ErrorResponse "Another book has the same ISBN, or the book was changed concurrently"
+// @Failure 412 {object} ErrorResponse "The book no longer matches If-Match"
+// @Failure 500 {object} ErrorResponse "Error retrieving book"
 // @Router /books/{id} [put]
-func UpdateBook(w http.ResponseWriter, r *http.Request) {
-    log.Println("UpdateBook request received")
+func (s *Server) UpdateBook(w http.ResponseWriter, r *http.Request) {
     params := mux.Vars(r)
     id, err := strconv.Atoi(params["id"])
     if err != nil {
-        log.Printf("Invalid ID: %v", err)
-        http.Error(w, "Invalid ID", http.StatusBadRequest)
+        Logger(r).Debug("Invalid ID", "error", err)
+        writeError(w, r, http.StatusBadRequest, CodeInvalidRequest, "Invalid ID")
         return
     }
 
-    var book models.Book
-    result := database.DB.First(&book, id)
-    if result.Error != nil {
-        if result.Error == gorm.ErrRecordNotFound {
-            log.Printf("Book not found for update: %d", id)
-            http.Error(w, "Book not found", http.StatusNotFound)
+    book, err := s.Books.Get(r.Context(), uint(id))
+    if err != nil {
+        if errors.Is(err, repository.ErrNotFound) {
+            Logger(r).Debug("Book not found for update", "book_id", id)
+            writeError(w, r, http.StatusNotFound, CodeNotFound, "Book not found")
         } else {
-            log.Printf("Database error on update: %v", result.Error)
-            http.Error(w, result.Error.Error(), http.StatusInternalServerError)
+            writeInternalError(w, r, "Error retrieving book", err)
         }
         return
     }
 
-    if err := json.NewDecoder(r.Body).Decode(&book); err != nil {
-        log.Printf("Invalid request body: %v", err)
-        http.Error(w, "Invalid request body", http.StatusBadRequest)
+    if !checkIfMatch(w, r, book) {
         return
     }
 
-    if err := ValidateBook(book); err != nil {
-        log.Printf("Validation error: %v", err)
-        http.Error(w, fmt.Sprintf("%v", err), http.StatusBadRequest)
+    before := *book
+    createdAt, deletedAt, version := book.CreatedAt, book.DeletedAt, book.Version
+    if err := json.NewDecoder(r.Body).Decode(book); err != nil {
+        Logger(r).Debug("Invalid request body", "error", err)
+        writeError(w, r, http.StatusBadRequest, CodeInvalidRequest, "Invalid request body")
         return
     }
 
-    if err := database.DB.Save(&book).Error; err != nil {
-        log.Printf("Error saving book: %v", err)
-        http.Error(w, err.Error(), http.StatusInternalServerError)
+    // Only the book's own fields can be changed, not its ID or timestamps.
+    book.ID, book.CreatedAt, book.DeletedAt, book.Version = uint(id), createdAt, deletedAt, version
+    if err := ValidateBook(*book); err != nil {
+        writeValidationError(w, r, err.(*ValidationError))
+        return
+    }
+
+    err = s.Books.Transaction(r.Context(), func(tx repository.BookRepository) error {
+        return updateBook(r, tx, &before, book)
+    })
+    if err != nil {
+        writeSaveError(w, r, err)
         return
     }
 
+    w.Header().Set("ETag", bookETag(book))
     if err := json.NewEncoder(w).Encode(book); err != nil {
-        log.Printf("Error encoding updated book: %v", err)
+        Logger(r).Warn("Error encoding updated book", "error", err)
     }
 }
 
@@ -259,39 +398,81 @@ func UpdateBook(w http.ResponseWriter, r *http.Request) {
 
 // DeleteBook deletes a book by its ID
 // @Summary Delete a book
-// @Description Delete a book by its ID
+// @Description Move a book to the trash by its ID. Trashed books can be restored until they are purged.
+// @Description With purge=true the book is permanently deleted instead, whether it is in the trash or not.
 // @Tags books
+// @Security BearerAuth
 // @Accept json
 // @Produce json
 // @Param id path int true "Book ID"
+// @Param purge query bool false "Permanently delete the book"
+// @Param If-Match header string false "ETag the book must still have"
 // @Success 204 "Book successfully deleted"
-// @Failure 400 {string} string "Invalid ID"
-// @Failure 404 {string} string "No book found to delete"
-// @Failure 500 {string} string "Error deleting book"
+// @Failure 400 {object} ErrorResponse "Invalid ID"
+// @Failure 401 {object} ErrorResponse "Not signed in"
+// @Failure 403 {object} ErrorResponse "Not an admin"
+// @Failure 404 {object} ErrorResponse "No book found to delete"
+// @Failure 412 {object} ErrorResponse "The book no longer matches If-Match"
+// @Failure 500 {object} ErrorResponse "Error deleting book"
 // @Router /books/{id} [delete]
-func DeleteBook(w http.ResponseWriter, r *http.Request) {
-    log.Println("DeleteBook request received")
+func (s *Server) DeleteBook(w http.ResponseWriter, r *http.Request) {
     params := mux.Vars(r)
     id, err := strconv.Atoi(params["id"])
     if err != nil {
-        log.Printf("Invalid ID for delete: %v", err)
-        http.Error(w, "Invalid ID", http.StatusBadRequest)
+        Logger(r).Debug("Invalid ID for delete", "error", err)
+        writeError(w, r, http.StatusBadRequest, CodeInvalidRequest, "Invalid ID")
+        return
+    }
+
+    purge, _ := strconv.ParseBool(r.URL.Query().Get("purge"))
+
+    // A book in the trash has no current version, so If-Match never matches it.
+    // The delete only succeeds if the book still has the matched version.
+    var version uint
+    if r.Header.Get("If-Match") != "" {
+        book, err := s.Books.Get(r.Context(), uint(id))
+        if err != nil && !errors.Is(err, repository.ErrNotFound) {
+            writeInternalError(w, r, "Error retrieving book", err)
+            return
+        }
+        if err != nil {
+            writeError(w, r, http.StatusPreconditionFailed, CodePreconditionFailed, "The book has no current version to match")
+            return
+        }
+        if !checkIfMatch(w, r, book) {
+            return
+        }
+        version = book.Version
+    }
+
+    err = s.Books.Transaction(r.Context(), func(tx repository.BookRepository) error {
+        return deleteBook(r, tx, uint(id), version, purge)
+    })
+
+    if errors.Is(err, repository.ErrVersionConflict) {
+        writeError(w, r, http.StatusPreconditionFailed, CodePreconditionFailed, "The book was modified since it was read")
         return
     }
 
-    result := database.DB.Delete(&models.Book{}, id)
-    if result.Error != nil {
-        log.Printf("Error deleting book: %v", result.Error)
-        http.Error(w, result.Error.Error(), http.StatusInternalServerError)
+    if errors.Is(err, repository.ErrNotFound) {
+        Logger(r).Debug("Book not found for delete", "book_id", id)
+        writeError(w, r, http.StatusNotFound, CodeNotFound, "No book found to delete")
         return
     }
 
-    if result.RowsAffected == 0 {
-        log.Printf("No book found to delete with ID: %d", id)
-        http.Error(w, "No book found to delete", http.StatusNotFound)
+    if err != nil {
+        writeInternalError(w, r, "Error deleting book", err)
         return
     }
 
+    if purge {
+        s.deletePurgedCovers(r)
+    }
+
     w.WriteHeader(http.StatusNoContent)
-    log.Printf("Book deleted successfully: %d", id)
+    if purge {
+        Logger(r).Info("Book purged", "book_id", id)
+    } else {
+        Logger(r).Info("Book moved to trash", "book_id", id)
+    }
 }
@@ -0,0 +1,368 @@
+package handlers
+
+import (
+	"book-manager/models"
+	"book-manager/repository"
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const (
+    defaultImportBatchSize = 100
+    maxImportBatchSize     = 1000
+    maxImportSize          = 64 << 20
+)
+
+// Statuses of an imported row.
+const (
+    ImportCreated   = "created"
+    ImportDuplicate = "duplicate"
+    ImportFailed    = "failed"
+)
+
+// errDryRun rolls back the transactions of a dry run.
+var errDryRun = errors.New("dry run")
+
+// BookInput are the fields of a book that can be imported.
+type BookInput struct {
+    Title       string `json:"title"`
+    Author      string `json:"author"`
+    Year        int    `json:"year"`
+    Genre       string `json:"genre"`
+    ISBN        string `json:"isbn"`
+    Publisher   string `json:"publisher"`
+    Description string `json:"description"`
+}
+
+func (in *BookInput) book() models.Book {
+    return models.Book{
+        Title:       in.Title,
+        Author:      in.Author,
+        Year:        in.Year,
+        Genre:       in.Genre,
+        ISBN:        in.ISBN,
+        Publisher:   in.Publisher,
+        Description: in.Description,
+    }
+}
+
+// ImportRowResult is the outcome of importing one row.
+type ImportRowResult struct {
+    Line       int          `json:"line"`                 // Line of the row in the file
+    Status     string       `json:"status"`               // created, duplicate or failed
+    ID         uint         `json:"id,omitempty"`         // ID of the created book, not set in dry runs
+    ExistingID uint         `json:"existingId,omitempty"` // ID of the book with the same ISBN, for duplicates
+    Message    string       `json:"message,omitempty"`    // Why the row was skipped or failed
+    Details    []FieldError `json:"details,omitempty"`    // Per-field validation errors
+}
+
+// ImportReport lists the outcome of every row of an import.
+type ImportReport struct {
+    DryRun     bool              `json:"dryRun"`
+    Created    int               `json:"created"`
+    Duplicates int               `json:"duplicates"`
+    Failed     int               `json:"failed"`
+    Rows       []ImportRowResult `json:"rows"`
+}
+
+// importRow is a parsed row. err is set if the row couldn't be parsed.
+type importRow struct {
+    line  int
+    input BookInput
+    err   error
+}
+
+// rowReader returns the rows of an import file one at a time, and io.EOF after the last one.
+type rowReader func() (importRow, error)
+
+// csvRows reads CSV with a header row naming the book fields, in any order and case.
+func csvRows(r io.Reader) (rowReader, error) {
+    reader := csv.NewReader(r)
+    reader.FieldsPerRecord = -1
+    reader.TrimLeadingSpace = true
+
+    header, err := reader.Read()
+    if err != nil {
+        return nil, fmt.Errorf("reading CSV header: %v", err)
+    }
+
+    setters := map[string]func(in *BookInput, value string) error{
+        "title":       func(in *BookInput, value string) error { in.Title = value; return nil },
+        "author":      func(in *BookInput, value string) error { in.Author = value; return nil },
+        "genre":       func(in *BookInput, value string) error { in.Genre = value; return nil },
+        "isbn":        func(in *BookInput, value string) error { in.ISBN = value; return nil },
+        "publisher":   func(in *BookInput, value string) error { in.Publisher = value; return nil },
+        "description": func(in *BookInput, value string) error { in.Description = value; return nil },
+        "year": func(in *BookInput, value string) error {
+            if value == "" {
+                return nil
+            }
+            year, err := strconv.Atoi(value)
+            if err != nil {
+                return fmt.Errorf("year must be a number")
+            }
+            in.Year = year
+            return nil
+        },
+    }
+
+    columns := make([]func(in *BookInput, value string) error, len(header))
+    for i, name := range header {
+        name = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))
+        setter, ok := setters[name]
+        if !ok {
+            return nil, fmt.Errorf("unknown CSV column %q, expected title, author, year, genre, isbn, publisher or description", name)
+        }
+        columns[i] = setter
+    }
+
+    return func() (importRow, error) {
+        record, err := reader.Read()
+        if err == io.EOF {
+            return importRow{}, io.EOF
+        }
+        line, _ := reader.FieldPos(0)
+        row := importRow{line: line}
+        if err != nil {
+            var parseErr *csv.ParseError
+            if !errors.As(err, &parseErr) {
+                return row, err
+            }
+            row.line, row.err = parseErr.StartLine, err
+            return row, nil
+        }
+        if len(record) != len(columns) {
+            row.err = fmt.Errorf("expected %d fields, got %d", len(columns), len(record))
+            return row, nil
+        }
+        for i, value := range record {
+            if err := columns[i](&row.input, strings.TrimSpace(value)); err != nil {
+                row.err = err
+                break
+            }
+        }
+        return row, nil
+    }, nil
+}
+
+// ndjsonRows reads one JSON object per line. Blank lines are skipped.
+func ndjsonRows(r io.Reader) rowReader {
+    scanner := bufio.NewScanner(r)
+    scanner.Buffer(make([]byte, 64*1024), 1<<20)
+    line := 0
+
+    return func() (importRow, error) {
+        for scanner.Scan() {
+            line++
+            data := bytes.TrimSpace(scanner.Bytes())
+            if len(data) == 0 {
+                continue
+            }
+            row := importRow{line: line}
+            decoder := json.NewDecoder(bytes.NewReader(data))
+            decoder.DisallowUnknownFields()
+            if err := decoder.Decode(&row.input); err != nil {
+                row.err = fmt.Errorf("invalid JSON: %v", err)
+            }
+            return row, nil
+        }
+        if err := scanner.Err(); err != nil {
+            return importRow{}, err
+        }
+        return importRow{}, io.EOF
+    }
+}
+
+// importBatch creates the books of a batch in one transaction. Every row runs
+// in a nested transaction, so that a duplicate only skips its own row.
+//
+// A dry run rolls every batch back, so the books of earlier batches aren't there
+// to collide with. seen maps the ISBN-13 of every book a dry run would have
+// created so far to its line, and the batch adds its own books to it.
+func (s *Server) importBatch(r *http.Request, rows []importRow, dryRun bool, seen map[string]int) []ImportRowResult {
+    ctx := r.Context()
+    results := make([]ImportRowResult, len(rows))
+    created := map[string]int{}
+    err := s.Books.Transaction(ctx, func(tx repository.BookRepository) error {
+        for i, row := range rows {
+            result := &results[i]
+            result.Line = row.line
+            if row.err != nil {
+                result.Status, result.Message = ImportFailed, row.err.Error()
+                continue
+            }
+
+            book := row.input.book()
+            if err := ValidateBook(book); err != nil {
+                result.Status, result.Message = ImportFailed, err.Error()
+                result.Details = err.(*ValidationError).Fields
+                continue
+            }
+
+            isbn13, _ := models.NormalizeISBN(book.ISBN)
+            if line, ok := seen[isbn13]; ok && dryRun && isbn13 != "" {
+                result.Status, result.Message = ImportDuplicate, fmt.Sprintf("a book with ISBN %s would already be created by line %d", isbn13, line)
+                continue
+            }
+
+            err := tx.Transaction(ctx, func(tx repository.BookRepository) error {
+                return createBook(r, tx, &book)
+            })
+            var duplicate *repository.DuplicateISBNError
+            switch {
+            case errors.As(err, &duplicate):
+                result.Status, result.Message, result.ExistingID = ImportDuplicate, duplicate.Error(), duplicate.ExistingID
+            case err != nil:
+                return err
+            default:
+                result.Status = ImportCreated
+                if !dryRun {
+                    result.ID = book.ID
+                } else if isbn13 != "" {
+                    created[isbn13] = row.line
+                }
+            }
+        }
+        if dryRun {
+            return errDryRun
+        }
+        return nil
+    })
+
+    if err == errDryRun {
+        for isbn13, line := range created {
+            seen[isbn13] = line
+        }
+    } else if err != nil {
+        Logger(r).Error("Error importing batch", "error", err)
+        for i := range results {
+            results[i].Line = rows[i].line
+            if results[i].Status != ImportFailed {
+                results[i] = ImportRowResult{Line: rows[i].line, Status: ImportFailed, Message: "Error saving batch, no book of it was created"}
+            }
+        }
+    }
+    return results
+}
+
+// ImportBooks godoc
+// @Summary Import books
+// @Description Create books from a CSV file with a header row (columns title, author, year, genre, isbn, publisher
+// @Description and description, in any order) or from NDJSON with one book object per line. The format is taken
+// @Description from the format parameter or the Content-Type (text/csv or application/x-ndjson).
+// @Description Every row is validated like a new book. Rows are inserted in transactional batches; books with the ISBN
+// @Description of an existing book are skipped as duplicates. With dryRun=true nothing is saved, but the report is the
+// @Description same as for a real import, including duplicates between rows of different batches.
+// @Tags books
+// @Security BearerAuth
+// @Security APIKeyAuth
+// @Accept text/csv
+// @Accept application/x-ndjson
+// @Produce json
+// @Param format query string false "csv or ndjson, overrides the Content-Type"
+// @Param dryRun query bool false "Validate and check for duplicates without saving"
+// @Param batchSize query int false "Rows per transaction (default 100, max 1000)"
+// @Param file body string true "CSV or NDJSON"
+// @Success 200 {object} ImportReport "Outcome of every row"
+// @Failure 400 {object} ErrorResponse "Invalid parameters or CSV header"
+// @Failure 401 {object} ErrorResponse "Not signed in"
+// @Failure 403 {object} ErrorResponse "Not an editor"
+// @Failure 415 {object} ErrorResponse "Unsupported format"
+// @Router /books/import [post]
+func (s *Server) ImportBooks(w http.ResponseWriter, r *http.Request) {
+    query := r.URL.Query()
+
+    format := strings.ToLower(query.Get("format"))
+    if format == "" {
+        contentType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+        switch contentType {
+        case "text/csv":
+            format = "csv"
+        case "application/x-ndjson", "application/jsonl", "application/jsonlines":
+            format = "ndjson"
+        }
+    }
+
+    dryRun, err := strconv.ParseBool(query.Get("dryRun"))
+    if err != nil && query.Get("dryRun") != "" {
+        writeError(w, r, http.StatusBadRequest, CodeInvalidRequest, "dryRun must be true or false")
+        return
+    }
+
+    batchSize := defaultImportBatchSize
+    if raw := query.Get("batchSize"); raw != "" {
+        if batchSize, err = strconv.Atoi(raw); err != nil || batchSize < 1 || batchSize > maxImportBatchSize {
+            writeError(w, r, http.StatusBadRequest, CodeInvalidRequest, fmt.Sprintf("batchSize must be between 1 and %d", maxImportBatchSize))
+            return
+        }
+    }
+
+    body := http.MaxBytesReader(w, r.Body, maxImportSize)
+    var next rowReader
+    switch format {
+    case "csv":
+        if next, err = csvRows(body); err != nil {
+            writeError(w, r, http.StatusBadRequest, CodeInvalidRequest, err.Error())
+            return
+        }
+    case "ndjson":
+        next = ndjsonRows(body)
+    default:
+        writeError(w, r, http.StatusUnsupportedMediaType, CodeUnsupportedMediaType,
+            "Send text/csv or application/x-ndjson, or set format to csv or ndjson")
+        return
+    }
+
+    report := ImportReport{DryRun: dryRun, Rows: []ImportRowResult{}}
+    var batch []importRow
+    seen := map[string]int{}
+    flush := func() {
+        if len(batch) > 0 {
+            report.Rows = append(report.Rows, s.importBatch(r, batch, dryRun, seen)...)
+            batch = batch[:0]
+        }
+    }
+    for {
+        row, err := next()
+        if err == io.EOF {
+            break
+        }
+        if err != nil {
+            flush()
+            Logger(r).Debug("Error reading import", "error", err)
+            report.Rows = append(report.Rows, ImportRowResult{Line: row.line, Status: ImportFailed, Message: "Error reading the rest of the file: " + err.Error()})
+            break
+        }
+        batch = append(batch, row)
+        if len(batch) == batchSize {
+            flush()
+        }
+    }
+    flush()
+
+    for _, row := range report.Rows {
+        switch row.Status {
+        case ImportCreated:
+            report.Created++
+        case ImportDuplicate:
+            report.Duplicates++
+        default:
+            report.Failed++
+        }
+    }
+
+    Logger(r).Info("Imported books", "created", report.Created, "duplicates", report.Duplicates, "failed", report.Failed, "dry_run", dryRun)
+    w.Header().Set("Content-Type", "application/json")
+    if err := json.NewEncoder(w).Encode(report); err != nil {
+        Logger(r).Warn("Error encoding import report", "error", err)
+    }
+}
@@ -0,0 +1,204 @@
+package handlers
+
+import (
+	"book-manager/models"
+	"book-manager/repository"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"reflect"
+	"strconv"
+
+	jsonpatch "github.com/evanphx/json-patch/v5"
+	"github.com/gorilla/mux"
+)
+
+const (
+    mergePatchType = "application/merge-patch+json"
+    jsonPatchType  = "application/json-patch+json"
+)
+
+// readOnlyFields are the JSON fields of a book that patches must leave unchanged.
+var readOnlyFields = []string{"id", "createdAt", "updatedAt", "deletedAt", "version", "isbn13"}
+
+// bookDocument returns book as a JSON object in which every field is present,
+// so that JSON Patch operations can replace fields that are empty.
+func bookDocument(book *models.Book) ([]byte, error) {
+    data, err := json.Marshal(book)
+    if err != nil {
+        return nil, err
+    }
+    var doc map[string]interface{}
+    if err := json.Unmarshal(data, &doc); err != nil {
+        return nil, err
+    }
+    for _, field := range []string{"genre", "isbn", "publisher", "description"} {
+        if _, ok := doc[field]; !ok {
+            doc[field] = ""
+        }
+    }
+    for _, field := range []string{"genreId", "publisherId"} {
+        if _, ok := doc[field]; !ok {
+            doc[field] = nil
+        }
+    }
+    return json.Marshal(doc)
+}
+
+// applyPatch applies a merge patch or JSON Patch, depending on contentType, to doc.
+func applyPatch(doc, patch []byte, contentType string) ([]byte, error) {
+    if contentType == jsonPatchType {
+        operations, err := jsonpatch.DecodePatch(patch)
+        if err != nil {
+            return nil, err
+        }
+        return operations.Apply(doc)
+    }
+    return jsonpatch.MergePatch(doc, patch)
+}
+
+// changedReadOnlyFields returns an error for every read-only field that
+// differs between the original and the patched document.
+func changedReadOnlyFields(original, patched []byte) (*ValidationError, error) {
+    var before, after map[string]interface{}
+    if err := json.Unmarshal(original, &before); err != nil {
+        return nil, err
+    }
+    if err := json.Unmarshal(patched, &after); err != nil {
+        return nil, err
+    }
+
+    var changed ValidationError
+    for _, field := range readOnlyFields {
+        if !reflect.DeepEqual(before[field], after[field]) {
+            changed.Fields = append(changed.Fields, FieldError{Field: field, Rule: "readonly", Message: field + " can't be changed"})
+        }
+    }
+    if len(changed.Fields) == 0 {
+        return nil, nil
+    }
+    return &changed, nil
+}
+
+// PatchBook applies a partial update to a book
+// @Summary Partially update a book
+// @Description Update some fields of a book with an RFC 7396 JSON Merge Patch (application/merge-patch+json,
+// @Description also accepted as application/json) or an RFC 6902 JSON Patch (application/json-patch+json).
+// @Description The patched book is validated like a new one. id, createdAt, updatedAt, deletedAt, version and isbn13 are read-only.
+// @Tags books
+// @Security BearerAuth
+// @Security APIKeyAuth
+// @Accept json
+// @Accept application/merge-patch+json
+// @Accept application/json-patch+json
+// @Produce json
+// @Param id path int true "Book ID"
+// @Param If-Match header string false "ETag the book must still have"
+// @Param patch body object true "Merge patch, e.g. {\"genre\": \"Fantasy\"}, or JSON Patch, e.g. [{\"op\": \"replace\", \"path\": \"/year\", \"value\": 1990}]"
+// @Success 200 {object} models.Book "Book successfully updated"
+// @Header 200 {string} ETag "New version of the book"
+// @Failure 400 {object} ErrorResponse "Invalid patch, ID or resulting book"
+// @Failure 401 {object} ErrorResponse "Not signed in"
+// @Failure 403 {object} ErrorResponse "Not an editor"
+// @Failure 404 {object} ErrorResponse "Book not found"
+// @Failure 409 {object} ErrorResponse "Another book has the same ISBN, or the book was changed concurrently"
+// @Failure 412 {object} ErrorResponse "The book no longer matches If-Match"
+// @Failure 415 {object} ErrorResponse "Unsupported patch format"
+// @Failure 500 {object} ErrorResponse "Error saving book"
+// @Router /books/{id} [patch]
+func (s *Server) PatchBook(w http.ResponseWriter, r *http.Request) {
+    params := mux.Vars(r)
+    id, err := strconv.Atoi(params["id"])
+    if err != nil {
+        Logger(r).Debug("Invalid ID", "error", err)
+        writeError(w, r, http.StatusBadRequest, CodeInvalidRequest, "Invalid ID")
+        return
+    }
+
+    contentType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+    if contentType != mergePatchType && contentType != jsonPatchType && contentType != "application/json" {
+        writeError(w, r, http.StatusUnsupportedMediaType, CodeUnsupportedMediaType,
+            "Content-Type must be "+mergePatchType+" or "+jsonPatchType)
+        return
+    }
+
+    patch, err := io.ReadAll(r.Body)
+    if err != nil {
+        Logger(r).Debug("Error reading request body", "error", err)
+        writeError(w, r, http.StatusBadRequest, CodeInvalidRequest, "Invalid request body")
+        return
+    }
+
+    book, err := s.Books.Get(r.Context(), uint(id))
+    if err != nil {
+        if errors.Is(err, repository.ErrNotFound) {
+            Logger(r).Debug("Book not found for patch", "book_id", id)
+            writeError(w, r, http.StatusNotFound, CodeNotFound, "Book not found")
+        } else {
+            writeInternalError(w, r, "Error retrieving book", err)
+        }
+        return
+    }
+
+    if !checkIfMatch(w, r, book) {
+        return
+    }
+
+    original, err := bookDocument(book)
+    if err != nil {
+        writeInternalError(w, r, "Error encoding book", err)
+        return
+    }
+
+    patched, err := applyPatch(original, patch, contentType)
+    if err != nil {
+        Logger(r).Debug("Invalid patch", "error", err)
+        writeError(w, r, http.StatusBadRequest, CodeInvalidRequest, "Invalid patch: "+err.Error())
+        return
+    }
+
+    changed, err := changedReadOnlyFields(original, patched)
+    if err != nil {
+        Logger(r).Debug("Invalid patch result", "error", err)
+        writeError(w, r, http.StatusBadRequest, CodeInvalidRequest, "The patch must result in a JSON object")
+        return
+    }
+    if changed != nil {
+        writeValidationError(w, r, changed)
+        return
+    }
+
+    // The patched document is decoded into a fresh book, so that fields
+    // removed by the patch end up empty. Fields a book doesn't have are rejected.
+    var updated models.Book
+    decoder := json.NewDecoder(bytes.NewReader(patched))
+    decoder.DisallowUnknownFields()
+    if err := decoder.Decode(&updated); err != nil {
+        Logger(r).Debug("Invalid patch result", "error", err)
+        writeError(w, r, http.StatusBadRequest, CodeInvalidRequest, "Invalid patch result: "+err.Error())
+        return
+    }
+    updated.ID, updated.CreatedAt, updated.UpdatedAt, updated.DeletedAt, updated.Version = book.ID, book.CreatedAt, book.UpdatedAt, book.DeletedAt, book.Version
+
+    if err := ValidateBook(updated); err != nil {
+        writeValidationError(w, r, err.(*ValidationError))
+        return
+    }
+
+    err = s.Books.Transaction(r.Context(), func(tx repository.BookRepository) error {
+        return updateBook(r, tx, book, &updated)
+    })
+    if err != nil {
+        writeSaveError(w, r, err)
+        return
+    }
+
+    Logger(r).Info("Book patched", "book_id", id)
+    w.Header().Set("ETag", bookETag(&updated))
+    if err := json.NewEncoder(w).Encode(updated); err != nil {
+        Logger(r).Warn("Error encoding patched book", "error", err)
+    }
+}
@@ -0,0 +1,201 @@
+package handlers
+
+import (
+	"book-manager/models"
+	"book-manager/repository"
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/gorilla/mux"
+)
+
+// Anyone may call routes with this permission, signed in or not.
+const Anyone = ""
+
+// Permissions maps routes, as "METHOD /path/template", to the role needed to
+// call them, see models.RoleAllows. models.UserViewer is any signed in user.
+// Routes that aren't listed are open to anyone if they only read, and need
+// an admin otherwise, so that new routes are safe until they are added here.
+var Permissions = map[string]string{
+    "POST /auth/register": Anyone,
+    "POST /auth/login":    Anyone,
+    "POST /auth/refresh":  Anyone,
+    "POST /auth/logout":   models.UserViewer,
+    "GET /auth/me":        models.UserViewer,
+
+    "POST /books":                             models.UserEditor,
+    "POST /books/batch":                       models.UserEditor, // delete operations need an admin, see BatchBooks
+    "POST /books/import":                      models.UserEditor,
+    "PUT /books/{id}":                         models.UserEditor,
+    "PATCH /books/{id}":                       models.UserEditor,
+    "DELETE /books/{id}":                      models.UserAdmin,
+    "GET /books/trash":                        models.UserEditor,
+    "POST /books/{id}/restore":                models.UserAdmin,
+    "GET /books/{id}/history":                 models.UserViewer,
+    "POST /books/{id}/revisions/{rev}/revert": models.UserEditor,
+    "PUT /books/{id}/authors":                 models.UserEditor,
+    "POST /books/{id}/tags":                   models.UserEditor,
+    "DELETE /books/{id}/tags":                 models.UserEditor,
+    "POST /books/{id}/cover":                  models.UserEditor,
+    "DELETE /books/{id}/cover":                models.UserEditor,
+    "POST /authors":                           models.UserEditor,
+    "PUT /authors/{id}":                       models.UserEditor,
+    "DELETE /authors/{id}":                    models.UserAdmin,
+    "POST /publishers":                        models.UserEditor,
+    "PUT /publishers/{id}":                    models.UserEditor,
+    "DELETE /publishers/{id}":                 models.UserAdmin,
+    "POST /publishers/{id}/merge":             models.UserAdmin,
+    "POST /genres":                            models.UserEditor,
+    "PUT /genres/{id}":                        models.UserEditor,
+    "DELETE /genres/{id}":                     models.UserAdmin,
+    "POST /genres/{id}/merge":                 models.UserAdmin,
+    "POST /process-url":                       models.UserViewer,
+
+    "GET /users":           models.UserAdmin,
+    "PUT /users/{id}/role": models.UserAdmin,
+    "GET /audit":           models.UserAdmin,
+
+    "GET /api-keys":              models.UserAdmin,
+    "POST /api-keys":             models.UserAdmin,
+    "GET /api-keys/{id}":         models.UserAdmin,
+    "DELETE /api-keys/{id}":      models.UserAdmin,
+    "POST /api-keys/{id}/rotate": models.UserAdmin,
+}
+
+// apiKeyRole is the role API keys act with. Their scopes restrict them
+// further, so at most they can do what editors can.
+const apiKeyRole = models.UserEditor
+
+// APIKeyScopes maps the routes API keys may call, as in Permissions, to the
+// scope needed to call them. Routes that aren't listed can't be called with
+// an API key, whatever its scopes.
+var APIKeyScopes = map[string]string{
+    "GET /books":              models.ScopeBooksRead,
+    "GET /books/export":       models.ScopeBooksRead,
+    "GET /books/search":       models.ScopeBooksRead,
+    "GET /books/trash":        models.ScopeBooksRead,
+    "GET /books/{id}":         models.ScopeBooksRead,
+    "GET /books/{id}/authors": models.ScopeBooksRead,
+    "GET /books/{id}/tags":    models.ScopeBooksRead,
+    "GET /books/{id}/cover":   models.ScopeBooksRead,
+    "GET /tags":               models.ScopeBooksRead,
+    "GET /authors":            models.ScopeBooksRead,
+    "GET /authors/{id}":       models.ScopeBooksRead,
+    "GET /authors/{id}/books": models.ScopeBooksRead,
+    "GET /publishers":         models.ScopeBooksRead,
+    "GET /publishers/{id}":    models.ScopeBooksRead,
+    "GET /genres":             models.ScopeBooksRead,
+    "GET /genres/{id}":        models.ScopeBooksRead,
+
+    "POST /books":                             models.ScopeBooksWrite,
+    "POST /books/batch":                       models.ScopeBooksWrite,
+    "POST /books/import":                      models.ScopeBooksWrite,
+    "PUT /books/{id}":                         models.ScopeBooksWrite,
+    "PATCH /books/{id}":                       models.ScopeBooksWrite,
+    "POST /books/{id}/revisions/{rev}/revert": models.ScopeBooksWrite,
+    "PUT /books/{id}/authors":                 models.ScopeBooksWrite,
+    "POST /books/{id}/tags":                   models.ScopeBooksWrite,
+    "DELETE /books/{id}/tags":                 models.ScopeBooksWrite,
+    "POST /books/{id}/cover":                  models.ScopeBooksWrite,
+    "DELETE /books/{id}/cover":                models.ScopeBooksWrite,
+    "POST /authors":                           models.ScopeBooksWrite,
+    "PUT /authors/{id}":                       models.ScopeBooksWrite,
+    "POST /publishers":                        models.ScopeBooksWrite,
+    "PUT /publishers/{id}":                    models.ScopeBooksWrite,
+    "POST /genres":                            models.ScopeBooksWrite,
+    "PUT /genres/{id}":                        models.ScopeBooksWrite,
+
+    "POST /process-url": models.ScopeURLsProcess,
+}
+
+type userKey struct{}
+
+// routeKey returns the key of the route of r in Permissions and APIKeyScopes.
+func routeKey(r *http.Request) string {
+    if route := mux.CurrentRoute(r); route != nil {
+        if template, err := route.GetPathTemplate(); err == nil {
+            return r.Method + " " + template
+        }
+    }
+    return ""
+}
+
+// requiredRole returns the role needed for the route of r, and whether
+// anyone may call it.
+func requiredRole(r *http.Request) (string, bool) {
+    if role, ok := Permissions[routeKey(r)]; ok {
+        return role, role == Anyone
+    }
+    if readOnly(r.Method) {
+        return Anyone, true
+    }
+    return models.UserAdmin, false
+}
+
+// authorize checks the role of the signed in user against Permissions, or the
+// scopes of the API key against APIKeyScopes. It runs after authenticate. The
+// user is available to the handlers through CurrentUser.
+func (s *Server) authorize(next http.Handler) http.Handler {
+    return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        required, open := requiredRole(r)
+        if apiKey := CurrentAPIKey(r); apiKey != nil {
+            scope, ok := APIKeyScopes[routeKey(r)]
+            switch {
+            case !ok || !models.RoleAllows(apiKeyRole, required):
+                writeError(w, r, http.StatusForbidden, CodeForbidden, "API keys can't be used for "+r.Method+" "+r.URL.Path)
+            case !apiKey.HasScope(scope):
+                writeError(w, r, http.StatusForbidden, CodeForbidden, "This requires an API key with the "+scope+" scope")
+            default:
+                next.ServeHTTP(w, r)
+            }
+            return
+        }
+
+        claims := Claims(r)
+        if claims == nil {
+            if open {
+                next.ServeHTTP(w, r)
+            } else {
+                writeUnauthorized(w, r, "", "Sign in to change the catalog")
+            }
+            return
+        }
+
+        user, err := s.Books.GetUser(r.Context(), claims.UserID())
+        if errors.Is(err, repository.ErrNotFound) {
+            writeUnauthorized(w, r, "invalid_token", "The user of the access token no longer exists")
+            return
+        }
+        if err != nil {
+            writeInternalError(w, r, "Error checking permissions", err)
+            return
+        }
+        if !open && !models.RoleAllows(user.Role, required) {
+            writeForbidden(w, r, required)
+            return
+        }
+        next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), userKey{}, user)))
+    })
+}
+
+// CurrentUser returns the signed in user of r, or nil if the request isn't
+// authenticated.
+func CurrentUser(r *http.Request) *models.User {
+    user, _ := r.Context().Value(userKey{}).(*models.User)
+    return user
+}
+
+// hasRole reports whether the signed in user or the API key of r has the
+// permissions of role.
+func hasRole(r *http.Request, role string) bool {
+    if user := CurrentUser(r); user != nil {
+        return models.RoleAllows(user.Role, role)
+    }
+    return CurrentAPIKey(r) != nil && models.RoleAllows(apiKeyRole, role)
+}
+
+// writeForbidden writes a 403 response for a user lacking the required role.
+func writeForbidden(w http.ResponseWriter, r *http.Request, required string) {
+    writeError(w, r, http.StatusForbidden, CodeForbidden, "This requires the "+required+" role")
+}
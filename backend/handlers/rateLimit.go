@@ -0,0 +1,223 @@
+package handlers
+
+import (
+	"book-manager/ratelimit"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Rate limit groups, see Server.RateLimits.
+const (
+    RateLimitAuth  = "auth"  // registering, signing in and refreshing tokens
+    RateLimitURLs  = "urls"  // POST /process-url, which fetches other sites
+    RateLimitWrite = "write" // every other request that changes something
+    RateLimitRead  = "read"  // every other request
+)
+
+// rateLimitGroups maps routes, as in Permissions, to their rate limit group.
+// Routes that aren't listed are in RateLimitRead if they only read and in
+// RateLimitWrite otherwise.
+var rateLimitGroups = map[string]string{
+    "POST /auth/register": RateLimitAuth,
+    "POST /auth/login":    RateLimitAuth,
+    "POST /auth/refresh":  RateLimitAuth,
+    "POST /process-url":   RateLimitURLs,
+}
+
+// rateLimitGroup returns the rate limit group of the route of r.
+func rateLimitGroup(r *http.Request) string {
+    if group, ok := rateLimitGroups[routeKey(r)]; ok {
+        return group
+    }
+    if readOnly(r.Method) {
+        return RateLimitRead
+    }
+    return RateLimitWrite
+}
+
+// rateLimitClient identifies who sent r: the API key, the signed in user or,
+// for anonymous requests, the client IP.
+func (s *Server) rateLimitClient(r *http.Request) string {
+    if apiKey := CurrentAPIKey(r); apiKey != nil {
+        return fmt.Sprintf("api-key:%d", apiKey.ID)
+    }
+    if claims := Claims(r); claims != nil {
+        return fmt.Sprintf("user:%d", claims.UserID())
+    }
+    return s.clientIP(r)
+}
+
+// clientIP identifies the client IP of r. That is the peer that sent r unless
+// the peer is one of the TrustedProxies. Then the client is the address that
+// the Forwarded header, or else X-Forwarded-For, names last before the
+// trusted proxies, so that clients can't pose as others by sending the
+// headers themselves.
+func (s *Server) clientIP(r *http.Request) string {
+    host, _, err := net.SplitHostPort(r.RemoteAddr)
+    if err != nil {
+        host = r.RemoteAddr
+    }
+    peer, err := netip.ParseAddr(host)
+    if err != nil || !s.trustedProxy(peer) {
+        return "ip:" + host
+    }
+
+    client := peer
+    hops := forwardedFor(r.Header)
+    for i := len(hops) - 1; i >= 0; i-- {
+        hop, err := netip.ParseAddr(hops[i])
+        if err != nil {
+            break
+        }
+        client = hop.Unmap()
+        if !s.trustedProxy(client) {
+            break
+        }
+    }
+    return "ip:" + client.String()
+}
+
+// trustedProxy reports whether addr is one of the TrustedProxies.
+func (s *Server) trustedProxy(addr netip.Addr) bool {
+    addr = addr.Unmap()
+    for _, prefix := range s.TrustedProxies {
+        if prefix.Contains(addr) {
+            return true
+        }
+    }
+    return false
+}
+
+// forwardedFor returns the addresses that the proxies of a request added to
+// its Forwarded header, or if there is none, to X-Forwarded-For, from the
+// client to the last proxy. Obfuscated identifiers like "unknown" are kept,
+// so that they stop the search for the client.
+func forwardedFor(header http.Header) []string {
+    var hops []string
+    for _, value := range header.Values("Forwarded") {
+        for _, element := range strings.Split(value, ",") {
+            for _, pair := range strings.Split(element, ";") {
+                name, node, ok := strings.Cut(strings.TrimSpace(pair), "=")
+                if ok && strings.EqualFold(name, "for") {
+                    hops = append(hops, forwardedNode(node))
+                }
+            }
+        }
+    }
+    if len(hops) > 0 {
+        return hops
+    }
+    for _, value := range header.Values("X-Forwarded-For") {
+        for _, hop := range strings.Split(value, ",") {
+            hops = append(hops, strings.TrimSpace(hop))
+        }
+    }
+    return hops
+}
+
+// forwardedNode returns the address of a node of the Forwarded header, like
+// 192.0.2.60, "192.0.2.60:4711" or "[2001:db8::17]:4711", without the port.
+func forwardedNode(node string) string {
+    node = strings.Trim(node, `"`)
+    if host, _, err := net.SplitHostPort(node); err == nil {
+        return host
+    }
+    return strings.Trim(node, "[]")
+}
+
+// failedAuthKey is the bucket counting the failed authentications of the
+// client IP of r. It holds as many tokens as the RateLimitAuth limit.
+func (s *Server) failedAuthKey(r *http.Request) string {
+    return "failed-auth:" + s.clientIP(r)
+}
+
+// authBlocked rejects r with 429 and returns true if its client IP has used
+// up its failed authentications. authenticate, Login and Refresh call it
+// before checking the credentials, so that a client that is guessing learns
+// nothing until the bucket has refilled, not even whether a guess was right.
+func (s *Server) authBlocked(w http.ResponseWriter, r *http.Request) bool {
+    limit := s.RateLimits[RateLimitAuth]
+    if !limit.Enabled() || s.RateLimitStore == nil {
+        return false
+    }
+    result, err := s.RateLimitStore.Peek(r.Context(), s.failedAuthKey(r), limit, time.Now())
+    if err != nil {
+        Logger(r).Error("Error checking rate limit", "error", err)
+        return false
+    }
+    if !result.Allowed {
+        Logger(r).Warn("Too many failed authentications", "client", s.clientIP(r))
+        writeRateLimited(w, r, limit, result)
+        return true
+    }
+    return false
+}
+
+// authFailed counts a failed authentication against the client IP of r.
+func (s *Server) authFailed(r *http.Request) {
+    limit := s.RateLimits[RateLimitAuth]
+    if !limit.Enabled() || s.RateLimitStore == nil {
+        return
+    }
+    if _, err := s.RateLimitStore.Take(r.Context(), s.failedAuthKey(r), limit, time.Now()); err != nil {
+        Logger(r).Error("Error counting failed authentication", "error", err)
+    }
+}
+
+// rateLimit takes a token from the bucket of the client in the group of the
+// route, see Server.RateLimits, and rejects the request with 429 if there is
+// none left. It runs after authenticate, so that API keys and users are
+// limited on their own rather than by IP. Failed authentications don't get
+// here; authenticate counts them against the client IP, see authBlocked.
+// Responses carry the RateLimit-* headers of the IETF draft. If the store fails, requests are let through.
+func (s *Server) rateLimit(next http.Handler) http.Handler {
+    return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        group := rateLimitGroup(r)
+        limit := s.RateLimits[group]
+        if !limit.Enabled() || s.RateLimitStore == nil {
+            next.ServeHTTP(w, r)
+            return
+        }
+
+        result, err := s.RateLimitStore.Take(r.Context(), group+":"+s.rateLimitClient(r), limit, time.Now())
+        if err != nil {
+            Logger(r).Error("Error checking rate limit", "error", err)
+            next.ServeHTTP(w, r)
+            return
+        }
+
+        if !result.Allowed {
+            writeRateLimited(w, r, limit, result)
+            return
+        }
+        setRateLimitHeaders(w, limit, result)
+        next.ServeHTTP(w, r)
+    })
+}
+
+// setRateLimitHeaders sets the RateLimit-* headers for the bucket of a request.
+func setRateLimitHeaders(w http.ResponseWriter, limit ratelimit.Limit, result ratelimit.Result) {
+    header := w.Header()
+    header.Set("RateLimit-Limit", strconv.Itoa(limit.Requests))
+    header.Set("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+    header.Set("RateLimit-Reset", strconv.Itoa(seconds(result.Reset)))
+    header.Set("RateLimit-Policy", fmt.Sprintf("%d;w=%d", limit.Requests, seconds(limit.Period)))
+}
+
+// writeRateLimited rejects a request whose bucket is empty with 429.
+func writeRateLimited(w http.ResponseWriter, r *http.Request, limit ratelimit.Limit, result ratelimit.Result) {
+    setRateLimitHeaders(w, limit, result)
+    retryAfter := seconds(result.RetryAfter)
+    w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+    writeError(w, r, http.StatusTooManyRequests, CodeRateLimited, fmt.Sprintf("Too many requests, retry in %d seconds", retryAfter))
+}
+
+// seconds rounds d up to whole seconds, at least 1 if d is positive.
+func seconds(d time.Duration) int {
+    return int((d + time.Second - 1) / time.Second)
+}
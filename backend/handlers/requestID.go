@@ -0,0 +1,124 @@
+package handlers
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// RequestIDHeader carries the ID of a request. A valid ID sent by the client
+// is kept, otherwise a new one is generated. Either way it is echoed in the response.
+const RequestIDHeader = "X-Request-ID"
+
+type requestIDKey struct{}
+
+type loggerKey struct{}
+
+// withRequestID assigns every request an ID, which is returned in error
+// responses and the X-Request-ID header. Handlers get a logger adding the ID
+// to every record through Logger, and every request is logged once it is
+// answered, with its status, size and latency. Failed requests are logged as
+// errors, the others at info level.
+func (s *Server) withRequestID(next http.Handler) http.Handler {
+    return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        start := time.Now()
+        id := r.Header.Get(RequestIDHeader)
+        if !validRequestID(id) {
+            id = newRequestID()
+        }
+        w.Header().Set(RequestIDHeader, id)
+        logger := s.Logger.With("request_id", id)
+        ctx := context.WithValue(context.WithValue(r.Context(), requestIDKey{}, id), loggerKey{}, logger)
+
+        recorder := &responseRecorder{ResponseWriter: w}
+        next.ServeHTTP(recorder, r.WithContext(ctx))
+
+        if recorder.status == 0 {
+            recorder.status = http.StatusOK
+        }
+        level := slog.LevelInfo
+        if recorder.status >= http.StatusInternalServerError {
+            level = slog.LevelError
+        }
+        logger.LogAttrs(ctx, level, "Request",
+            slog.String("method", r.Method),
+            slog.String("path", r.URL.Path),
+            slog.String("route", routeKey(r)),
+            slog.Int("status", recorder.status),
+            slog.Int64("bytes", recorder.bytes),
+            slog.Float64("latency_ms", float64(time.Since(start).Microseconds())/1000),
+            slog.String("remote_addr", r.RemoteAddr),
+        )
+    })
+}
+
+// RequestID returns the ID assigned to r by withRequestID, or "" if there is none.
+func RequestID(r *http.Request) string {
+    id, _ := r.Context().Value(requestIDKey{}).(string)
+    return id
+}
+
+// Logger returns the logger of r, which adds the request ID to every record,
+// or the default logger if r didn't pass withRequestID.
+func Logger(r *http.Request) *slog.Logger {
+    return loggerFrom(r.Context())
+}
+
+func loggerFrom(ctx context.Context) *slog.Logger {
+    if logger, ok := ctx.Value(loggerKey{}).(*slog.Logger); ok {
+        return logger
+    }
+    return slog.Default()
+}
+
+// responseRecorder remembers the status and size of a response for the
+// request log.
+type responseRecorder struct {
+    http.ResponseWriter
+    status int
+    bytes  int64
+}
+
+func (w *responseRecorder) WriteHeader(status int) {
+    if w.status == 0 {
+        w.status = status
+    }
+    w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *responseRecorder) Write(b []byte) (int, error) {
+    if w.status == 0 {
+        w.status = http.StatusOK
+    }
+    n, err := w.ResponseWriter.Write(b)
+    w.bytes += int64(n)
+    return n, err
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (w *responseRecorder) Unwrap() http.ResponseWriter {
+    return w.ResponseWriter
+}
+
+func newRequestID() string {
+    b := make([]byte, 16)
+    rand.Read(b)
+    return hex.EncodeToString(b)
+}
+
+// validRequestID accepts IDs of up to 128 letters, digits, '-' and '_', so
+// that client input can be logged and echoed safely.
+func validRequestID(id string) bool {
+    if id == "" || len(id) > 128 {
+        return false
+    }
+    for _, c := range id {
+        if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_') {
+            return false
+        }
+    }
+    return true
+}
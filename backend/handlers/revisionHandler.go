@@ -0,0 +1,155 @@
+package handlers
+
+import (
+	"book-manager/models"
+	"book-manager/repository"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+)
+
+// maxRevisionEntries bounds the audit entries searched for the state of a
+// revision. Several entries share a version when a book was trashed and
+// restored.
+const maxRevisionEntries = 10
+
+// findRevision returns the state of book id at version rev, as recorded in the
+// audit log, or ErrNotFound.
+func (s *Server) findRevision(r *http.Request, id, rev uint) (*models.Book, error) {
+    entries, _, err := s.Books.ListAuditEntries(r.Context(), &repository.AuditQuery{BookID: id, Version: rev, Limit: maxRevisionEntries})
+    if err != nil {
+        return nil, err
+    }
+    for _, entry := range entries {
+        if entry.After != nil {
+            return entry.After, nil
+        }
+    }
+    return nil, repository.ErrNotFound
+}
+
+
+// relinkTaxonomies points book at the publisher and genre of revision if they
+// still exist, under their current names, so that reverting across a rename
+// doesn't create them again. Otherwise book keeps the names of the revision.
+func relinkTaxonomies(r *http.Request, tx repository.BookRepository, revision, book *models.Book) error {
+    if revision.PublisherID != nil {
+        publisher, err := tx.GetPublisher(r.Context(), *revision.PublisherID)
+        switch {
+        case err == nil:
+            book.Publisher, book.PublisherID = publisher.Name, &publisher.ID
+        case !errors.Is(err, repository.ErrNotFound):
+            return err
+        }
+    }
+    if revision.GenreID != nil {
+        genre, err := tx.GetGenre(r.Context(), *revision.GenreID)
+        switch {
+        case err == nil:
+            book.Genre, book.GenreID = genre.Name, &genre.ID
+        case !errors.Is(err, repository.ErrNotFound):
+            return err
+        }
+    }
+    return nil
+}
+
+// RevertBook godoc
+// @Summary Revert a book to an earlier revision
+// @Description Restore the title, author, year, genre, ISBN, publisher and description a book had at an earlier
+// @Description revision, its version at the time, as listed in its history. The revert is saved as a new revision.
+// @Description The publisher and genre of the revision are restored under their current names if they still exist,
+// @Description or else by the names they had, so they are created again if they were deleted since.
+// @Description If-Match with the current ETag is required, so that a revert doesn't undo changes made after the
+// @Description revision was looked at.
+// @Tags books
+// @Security BearerAuth
+// @Security APIKeyAuth
+// @Produce json
+// @Param id path int true "Book ID"
+// @Param rev path int true "Revision to revert to"
+// @Param If-Match header string true "Current ETag of the book"
+// @Success 200 {object} models.Book "Book reverted"
+// @Header 200 {string} ETag "New version of the book"
+// @Failure 400 {object} ErrorResponse "Invalid ID or revision"
+// @Failure 401 {object} ErrorResponse "Not signed in"
+// @Failure 403 {object} ErrorResponse "Not an editor"
+// @Failure 404 {object} ErrorResponse "Book or revision not found"
+// @Failure 409 {object} ErrorResponse "Another book has the ISBN of the revision, or the book was changed concurrently"
+// @Failure 412 {object} ErrorResponse "The book no longer matches If-Match"
+// @Failure 428 {object} ErrorResponse "If-Match is missing"
+// @Failure 500 {object} ErrorResponse "Error reverting book"
+// @Router /books/{id}/revisions/{rev}/revert [post]
+func (s *Server) RevertBook(w http.ResponseWriter, r *http.Request) {
+    id, ok := pathID(w, r)
+    if !ok {
+        return
+    }
+    rev, err := strconv.ParseUint(mux.Vars(r)["rev"], 10, 0)
+    if err != nil || rev < 1 {
+        writeError(w, r, http.StatusBadRequest, CodeInvalidRequest, "Invalid revision")
+        return
+    }
+    if r.Header.Get("If-Match") == "" {
+        writeError(w, r, http.StatusPreconditionRequired, CodePreconditionRequired, "Send the current ETag of the book in If-Match")
+        return
+    }
+
+    book, err := s.Books.Get(r.Context(), id)
+    if errors.Is(err, repository.ErrNotFound) {
+        writeError(w, r, http.StatusNotFound, CodeNotFound, "Book not found")
+        return
+    }
+    if err != nil {
+        writeInternalError(w, r, "Error retrieving book", err)
+        return
+    }
+    if !checkIfMatch(w, r, book) {
+        return
+    }
+    if uint(rev) >= book.Version {
+        writeError(w, r, http.StatusBadRequest, CodeInvalidRequest, "The revision must be older than the current version "+strconv.FormatUint(uint64(book.Version), 10))
+        return
+    }
+
+    revision, err := s.findRevision(r, id, uint(rev))
+    if errors.Is(err, repository.ErrNotFound) {
+        writeError(w, r, http.StatusNotFound, CodeNotFound, "The book has no recorded revision "+strconv.FormatUint(rev, 10))
+        return
+    }
+    if err != nil {
+        writeInternalError(w, r, "Error retrieving revision", err)
+        return
+    }
+
+    reverted := *book
+    reverted.Title, reverted.Author, reverted.Year = revision.Title, revision.Author, revision.Year
+    reverted.ISBN, reverted.Description = revision.ISBN, revision.Description
+    reverted.Publisher, reverted.PublisherID = revision.Publisher, nil
+    reverted.Genre, reverted.GenreID = revision.Genre, nil
+    if err := ValidateBook(reverted); err != nil {
+        writeValidationError(w, r, err.(*ValidationError))
+        return
+    }
+
+    err = s.Books.Transaction(r.Context(), func(tx repository.BookRepository) error {
+        if err := relinkTaxonomies(r, tx, revision, &reverted); err != nil {
+            return err
+        }
+        return revertBook(r, tx, book, &reverted)
+    })
+    if err != nil {
+        writeSaveError(w, r, err)
+        return
+    }
+
+    Logger(r).Info("Book reverted", "book_id", id, "revision", rev, "version", reverted.Version)
+    w.Header().Set("Content-Type", "application/json")
+    w.Header().Set("ETag", bookETag(&reverted))
+    if err := json.NewEncoder(w).Encode(reverted); err != nil {
+        Logger(r).Warn("Error encoding reverted book", "error", err)
+    }
+}
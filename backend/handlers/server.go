@@ -0,0 +1,126 @@
+package handlers
+
+import (
+	"book-manager/auth"
+	"book-manager/ratelimit"
+	"book-manager/repository"
+	"book-manager/storage"
+	"log/slog"
+	"net/http"
+	"net/netip"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+    defaultAccessTTL  = 15 * time.Minute
+    defaultRefreshTTL = 30 * 24 * time.Hour
+)
+
+// Server holds the dependencies of the HTTP handlers.
+type Server struct {
+    Books        repository.BookRepository
+    Covers       storage.BlobStore // cover images, see models.BookCover
+    MaxCoverSize int64             // largest accepted cover upload in bytes
+    Tokens       *auth.Tokens      // signs the access and refresh tokens of users
+    Logger       *slog.Logger      // logs every request, see Logger for the logger of a request
+
+    // RateLimits limits how often every client may call the routes of a
+    // group, see RateLimitRead and the other groups. Groups without a limit
+    // aren't limited.
+    RateLimits     map[string]ratelimit.Limit
+    RateLimitStore ratelimit.Store // keeps the token buckets of the clients
+
+    // TrustedProxies are the reverse proxies whose X-Forwarded-For and
+    // Forwarded headers name the client IP of a request, see clientIP.
+    // Without them, the client IP is the address of the peer.
+    TrustedProxies []netip.Prefix
+}
+
+// NewServer returns a Server storing books in the given repository. Cover
+// images are kept in memory until Covers is set to another store, and tokens
+// are signed with a random secret until Tokens is set. Nothing is rate limited
+// until RateLimits is set, and logs go to the default logger until Logger is
+// set.
+func NewServer(books repository.BookRepository) *Server {
+    return &Server{
+        Books:        books,
+        Covers:       storage.NewMemoryStore(),
+        MaxCoverSize: defaultMaxCoverSize,
+        Tokens:       auth.NewRandomTokens(defaultAccessTTL, defaultRefreshTTL),
+        Logger:       slog.Default(),
+
+        RateLimitStore: ratelimit.NewMemoryStore(),
+    }
+}
+
+// Routes returns a router with all API routes registered. Every request is
+// assigned a request ID and logged, requests that change anything must be
+// authenticated by a user whose role allows them, see Permissions, or by an
+// API key with the scope they need, see APIKeyScopes, clients are rate
+// limited, see RateLimits, and unknown routes get JSON error responses.
+func (s *Server) Routes() *mux.Router {
+    r := mux.NewRouter()
+    r.Use(s.withRequestID, s.authenticate, s.rateLimit, s.authorize)
+    r.NotFoundHandler = s.withRequestID(http.HandlerFunc(notFound))
+    r.MethodNotAllowedHandler = s.withRequestID(http.HandlerFunc(methodNotAllowed))
+
+    r.HandleFunc("/auth/register", s.Register).Methods("POST")
+    r.HandleFunc("/auth/login", s.Login).Methods("POST")
+    r.HandleFunc("/auth/refresh", s.Refresh).Methods("POST")
+    r.HandleFunc("/auth/logout", s.Logout).Methods("POST")
+    r.HandleFunc("/auth/me", s.GetCurrentUser).Methods("GET")
+    r.HandleFunc("/books", s.GetBooks).Methods("GET")
+    r.HandleFunc("/books", s.AddBook).Methods("POST")
+    r.HandleFunc("/books/batch", s.BatchBooks).Methods("POST")
+    r.HandleFunc("/books/import", s.ImportBooks).Methods("POST")
+    r.HandleFunc("/books/export", s.ExportBooks).Methods("GET")
+    r.HandleFunc("/books/search", s.SearchBooks).Methods("GET")
+    r.HandleFunc("/books/trash", s.GetTrash).Methods("GET")
+    r.HandleFunc("/books/{id}", s.GetBook).Methods("GET")
+    r.HandleFunc("/books/{id}", s.UpdateBook).Methods("PUT")
+    r.HandleFunc("/books/{id}", s.PatchBook).Methods("PATCH")
+    r.HandleFunc("/books/{id}", s.DeleteBook).Methods("DELETE")
+    r.HandleFunc("/books/{id}/restore", s.RestoreBook).Methods("POST")
+    r.HandleFunc("/books/{id}/history", s.GetBookHistory).Methods("GET")
+    r.HandleFunc("/books/{id}/revisions/{rev}/revert", s.RevertBook).Methods("POST")
+    r.HandleFunc("/books/{id}/authors", s.GetBookAuthors).Methods("GET")
+    r.HandleFunc("/books/{id}/authors", s.SetBookAuthors).Methods("PUT")
+    r.HandleFunc("/books/{id}/tags", s.GetBookTags).Methods("GET")
+    r.HandleFunc("/books/{id}/tags", s.AddBookTags).Methods("POST")
+    r.HandleFunc("/books/{id}/tags", s.RemoveBookTags).Methods("DELETE")
+    r.HandleFunc("/books/{id}/cover", s.GetCover).Methods("GET")
+    r.HandleFunc("/books/{id}/cover", s.UploadCover).Methods("POST")
+    r.HandleFunc("/books/{id}/cover", s.DeleteCover).Methods("DELETE")
+    r.HandleFunc("/tags", s.GetTags).Methods("GET")
+    r.HandleFunc("/authors", s.GetAuthors).Methods("GET")
+    r.HandleFunc("/authors", s.AddAuthor).Methods("POST")
+    r.HandleFunc("/authors/{id}", s.GetAuthor).Methods("GET")
+    r.HandleFunc("/authors/{id}", s.UpdateAuthor).Methods("PUT")
+    r.HandleFunc("/authors/{id}", s.DeleteAuthor).Methods("DELETE")
+    r.HandleFunc("/authors/{id}/books", s.GetAuthorBooks).Methods("GET")
+    r.HandleFunc("/publishers", s.GetPublishers).Methods("GET")
+    r.HandleFunc("/publishers", s.AddPublisher).Methods("POST")
+    r.HandleFunc("/publishers/{id}", s.GetPublisher).Methods("GET")
+    r.HandleFunc("/publishers/{id}", s.UpdatePublisher).Methods("PUT")
+    r.HandleFunc("/publishers/{id}", s.DeletePublisher).Methods("DELETE")
+    r.HandleFunc("/publishers/{id}/merge", s.MergePublisher).Methods("POST")
+    r.HandleFunc("/genres", s.GetGenres).Methods("GET")
+    r.HandleFunc("/genres", s.AddGenre).Methods("POST")
+    r.HandleFunc("/genres/{id}", s.GetGenre).Methods("GET")
+    r.HandleFunc("/genres/{id}", s.UpdateGenre).Methods("PUT")
+    r.HandleFunc("/genres/{id}", s.DeleteGenre).Methods("DELETE")
+    r.HandleFunc("/genres/{id}/merge", s.MergeGenre).Methods("POST")
+    r.HandleFunc("/process-url", UrlHandler).Methods("POST")
+    r.HandleFunc("/users", s.GetUsers).Methods("GET")
+    r.HandleFunc("/users/{id}/role", s.SetUserRole).Methods("PUT")
+    r.HandleFunc("/audit", s.GetAuditLog).Methods("GET")
+    r.HandleFunc("/api-keys", s.GetAPIKeys).Methods("GET")
+    r.HandleFunc("/api-keys", s.CreateAPIKey).Methods("POST")
+    r.HandleFunc("/api-keys/{id}", s.GetAPIKey).Methods("GET")
+    r.HandleFunc("/api-keys/{id}", s.RevokeAPIKey).Methods("DELETE")
+    r.HandleFunc("/api-keys/{id}/rotate", s.RotateAPIKey).Methods("POST")
+
+    return r
+}
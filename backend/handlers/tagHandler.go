@@ -0,0 +1,184 @@
+package handlers
+
+import (
+	"book-manager/models"
+	"book-manager/repository"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// TagsRequest lists tags to add to a book.
+type TagsRequest struct {
+    Tags []string `json:"tags"` // Tags such as to-read or signed-copy, normalized to lower case
+}
+
+// TagResult is a tag with the number of live books that have it.
+type TagResult struct {
+    Tag       string `json:"tag"`
+    BookCount int64  `json:"bookCount"`
+}
+
+// normalizeTags normalizes and deduplicates tags. The returned error lists
+// every invalid tag.
+func normalizeTags(tags []string) ([]string, *ValidationError) {
+    var normalized []string
+    var validationError ValidationError
+    seen := map[string]bool{}
+    for i, tag := range tags {
+        t, err := models.NormalizeTag(tag)
+        if err != nil {
+            validationError.Fields = append(validationError.Fields, FieldError{
+                Field:   fmt.Sprintf("tags[%d]", i),
+                Rule:    "tag",
+                Message: fmt.Sprintf("%q is not a valid tag: %v", tag, err),
+            })
+            continue
+        }
+        if !seen[t] {
+            seen[t] = true
+            normalized = append(normalized, t)
+        }
+    }
+    if len(validationError.Fields) > 0 {
+        return nil, &validationError
+    }
+    return normalized, nil
+}
+
+// writeTags writes the tags of a book, or the response for err.
+func writeTags(w http.ResponseWriter, r *http.Request, tags []string, err error) {
+    if errors.Is(err, repository.ErrNotFound) {
+        writeError(w, r, http.StatusNotFound, CodeNotFound, "Book not found")
+        return
+    }
+    if err != nil {
+        writeInternalError(w, r, "Error saving tags", err)
+        return
+    }
+    encodeResponse(w, r, http.StatusOK, tags)
+}
+
+
+// GetBookTags godoc
+// @Summary Get the tags of a book
+// @Tags books
+// @Produce json
+// @Param id path int true "Book ID"
+// @Success 200 {array} string
+// @Failure 400 {object} ErrorResponse "Invalid ID"
+// @Failure 404 {object} ErrorResponse "Book not found"
+// @Failure 500 {object} ErrorResponse "Error retrieving tags"
+// @Router /books/{id}/tags [get]
+func (s *Server) GetBookTags(w http.ResponseWriter, r *http.Request) {
+    id, ok := pathID(w, r)
+    if !ok {
+        return
+    }
+
+    tags, err := s.Books.BookTags(r.Context(), id)
+    writeTags(w, r, tags, err)
+}
+
+
+// AddBookTags godoc
+// @Summary Add tags to a book
+// @Description Add tags to a book. Tags are normalized to lower case with spaces replaced by '-';
+// @Description tags the book already has are ignored. Returns all tags of the book.
+// @Tags books
+// @Security BearerAuth
+// @Security APIKeyAuth
+// @Accept json
+// @Produce json
+// @Param id path int true "Book ID"
+// @Param tags body TagsRequest true "Tags to add"
+// @Success 200 {array} string
+// @Failure 400 {object} ErrorResponse "Invalid request body, ID or tag"
+// @Failure 401 {object} ErrorResponse "Not signed in"
+// @Failure 403 {object} ErrorResponse "Not an editor"
+// @Failure 404 {object} ErrorResponse "Book not found"
+// @Failure 500 {object} ErrorResponse "Error saving tags"
+// @Router /books/{id}/tags [post]
+func (s *Server) AddBookTags(w http.ResponseWriter, r *http.Request) {
+    id, ok := pathID(w, r)
+    if !ok {
+        return
+    }
+    var request TagsRequest
+    if !decodeJSON(w, r, &request) {
+        return
+    }
+    tags, validationError := normalizeTags(request.Tags)
+    if validationError != nil {
+        writeValidationError(w, r, validationError)
+        return
+    }
+
+    tags, err := s.Books.AddTags(r.Context(), id, tags)
+    writeTags(w, r, tags, err)
+}
+
+
+// RemoveBookTags godoc
+// @Summary Remove tags from a book
+// @Description Remove the given tags from a book, ignoring tags it doesn't have. Returns the remaining tags.
+// @Tags books
+// @Security BearerAuth
+// @Security APIKeyAuth
+// @Produce json
+// @Param id path int true "Book ID"
+// @Param tag query []string true "Tags to remove, repeated or comma-separated" collectionFormat(multi)
+// @Success 200 {array} string
+// @Failure 400 {object} ErrorResponse "Invalid ID or tag"
+// @Failure 401 {object} ErrorResponse "Not signed in"
+// @Failure 403 {object} ErrorResponse "Not an editor"
+// @Failure 404 {object} ErrorResponse "Book not found"
+// @Failure 500 {object} ErrorResponse "Error saving tags"
+// @Router /books/{id}/tags [delete]
+func (s *Server) RemoveBookTags(w http.ResponseWriter, r *http.Request) {
+    id, ok := pathID(w, r)
+    if !ok {
+        return
+    }
+    var raw []string
+    for _, value := range r.URL.Query()["tag"] {
+        raw = append(raw, strings.Split(value, ",")...)
+    }
+    if len(raw) == 0 {
+        writeError(w, r, http.StatusBadRequest, CodeInvalidRequest, "tag is required")
+        return
+    }
+    tags, validationError := normalizeTags(raw)
+    if validationError != nil {
+        writeValidationError(w, r, validationError)
+        return
+    }
+
+    tags, err := s.Books.RemoveTags(r.Context(), id, tags)
+    writeTags(w, r, tags, err)
+}
+
+
+// GetTags godoc
+// @Summary Get list of tags
+// @Description Get the tags of live books with the number of books that have each, most used first.
+// @Tags tags
+// @Produce json
+// @Param prefix query string false "Only tags starting with this prefix, e.g. for autocompletion"
+// @Success 200 {array} TagResult
+// @Failure 500 {object} ErrorResponse "Error retrieving tags"
+// @Router /tags [get]
+func (s *Server) GetTags(w http.ResponseWriter, r *http.Request) {
+    prefix := strings.ToLower(strings.TrimSpace(r.URL.Query().Get("prefix")))
+    counts, err := s.Books.ListTags(r.Context(), prefix)
+    if err != nil {
+        writeInternalError(w, r, "Error retrieving tags", err)
+        return
+    }
+    results := make([]TagResult, len(counts))
+    for i, count := range counts {
+        results[i] = TagResult{Tag: count.Tag, BookCount: count.Books}
+    }
+    encodeResponse(w, r, http.StatusOK, results)
+}
@@ -0,0 +1,522 @@
+package handlers
+
+import (
+	"book-manager/models"
+	"book-manager/repository"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+)
+
+// PublisherInput are the fields of a publisher that can be set.
+type PublisherInput struct {
+    Name string `json:"name"`
+}
+
+// GenreInput are the fields of a genre that can be set.
+type GenreInput struct {
+    Name     string `json:"name"`
+    ParentID *uint  `json:"parentId"` // Parent genre, or null for a top-level genre
+}
+
+// MergeRequest names the publisher or genre that another one is merged into.
+type MergeRequest struct {
+    TargetID uint `json:"targetId"`
+}
+
+// MergeResult is the outcome of a merge.
+type MergeResult struct {
+    TargetID   uint  `json:"targetId"`   // The publisher or genre that remains
+    MovedBooks int64 `json:"movedBooks"` // Number of books moved to it, including books in the trash
+}
+
+// PublisherResult is a publisher with the number of books it published.
+type PublisherResult struct {
+    models.Publisher
+    BookCount int64 `json:"bookCount"` // Live books of the publisher
+}
+
+// GenreResult is a genre with its path and book counts.
+type GenreResult struct {
+    models.Genre
+    Path           string `json:"path"`           // Names from the top-level genre down, e.g. Fiction > Fantasy > Epic
+    BookCount      int64  `json:"bookCount"`      // Live books directly in the genre
+    TotalBookCount int64  `json:"totalBookCount"` // Live books in the genre and its subgenres
+}
+
+// writeTaxonomyError writes the response for an error returned by the
+// publisher and genre methods of the repository. field names the request
+// field that refers to another genre or publisher.
+func writeTaxonomyError(w http.ResponseWriter, r *http.Request, kind, field, message string, err error) {
+    var duplicate *repository.DuplicateNameError
+    switch {
+    case errors.As(err, &duplicate):
+        Logger(r).Debug("Duplicate name", "kind", kind, "error", err)
+        writeErrorResponse(w, r, ErrorResponse{
+            Code:       CodeDuplicateName,
+            Status:     http.StatusConflict,
+            Message:    duplicate.Error(),
+            ExistingID: duplicate.ExistingID,
+        })
+    case errors.Is(err, repository.ErrUnknownPublisher), errors.Is(err, repository.ErrUnknownGenre):
+        writeValidationError(w, r, &ValidationError{Fields: []FieldError{{Field: field, Rule: "exists", Message: err.Error()}}})
+    case errors.Is(err, repository.ErrGenreCycle):
+        writeValidationError(w, r, &ValidationError{Fields: []FieldError{{Field: field, Rule: "acyclic", Message: err.Error()}}})
+    case errors.Is(err, repository.ErrNotFound):
+        writeError(w, r, http.StatusNotFound, CodeNotFound, strings.ToUpper(kind[:1])+kind[1:]+" not found")
+    case errors.Is(err, repository.ErrInUse):
+        writeError(w, r, http.StatusConflict, CodeInUse, "The "+kind+" is still in use, merge it into another "+kind+" instead")
+    default:
+        writeInternalError(w, r, message, err)
+    }
+}
+
+// decodeJSON decodes the request body into v, rejecting unknown fields. It
+// writes a 400 response if the body is invalid.
+func decodeJSON(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+    decoder := json.NewDecoder(r.Body)
+    decoder.DisallowUnknownFields()
+    if err := decoder.Decode(v); err != nil {
+        Logger(r).Debug("Error decoding request body", "error", err)
+        writeError(w, r, http.StatusBadRequest, CodeInvalidRequest, "Invalid request body")
+        return false
+    }
+    return true
+}
+
+// decodeMerge reads the merge request of the source with the given ID.
+func decodeMerge(w http.ResponseWriter, r *http.Request, sourceID uint) (uint, bool) {
+    var merge MergeRequest
+    if !decodeJSON(w, r, &merge) {
+        return 0, false
+    }
+    if merge.TargetID == 0 || merge.TargetID == sourceID {
+        writeValidationError(w, r, &ValidationError{Fields: []FieldError{{
+            Field:   "targetId",
+            Rule:    "required",
+            Message: "targetId is required and must differ from the merged ID",
+        }}})
+        return 0, false
+    }
+    return merge.TargetID, true
+}
+
+func encodeResponse(w http.ResponseWriter, r *http.Request, status int, v interface{}) {
+    if status != http.StatusOK {
+        w.WriteHeader(status)
+    }
+    if err := json.NewEncoder(w).Encode(v); err != nil {
+        Logger(r).Warn("Error encoding response", "error", err)
+    }
+}
+
+
+// GetPublishers godoc
+// @Summary Get list of publishers
+// @Description Get all publishers sorted by name, with the number of live books of each.
+// @Tags publishers
+// @Produce  json
+// @Success 200 {array} PublisherResult
+// @Failure 500 {object} ErrorResponse "Error retrieving publishers"
+// @Router /publishers [get]
+func (s *Server) GetPublishers(w http.ResponseWriter, r *http.Request) {
+    counts, err := s.Books.ListPublishers(r.Context())
+    if err != nil {
+        writeInternalError(w, r, "Error retrieving publishers", err)
+        return
+    }
+    results := make([]PublisherResult, len(counts))
+    for i, count := range counts {
+        results[i] = PublisherResult{Publisher: count.Publisher, BookCount: count.Books}
+    }
+    encodeResponse(w, r, http.StatusOK, results)
+}
+
+
+// AddPublisher godoc
+// @Summary Add a new publisher
+// @Description Add a publisher. Names are unique, ignoring case and whitespace.
+// @Tags publishers
+// @Security BearerAuth
+// @Security APIKeyAuth
+// @Accept json
+// @Produce json
+// @Param publisher body PublisherInput true "Add Publisher"
+// @Success 201 {object} models.Publisher "Publisher successfully added"
+// @Failure 400 {object} ErrorResponse "Invalid request body"
+// @Failure 401 {object} ErrorResponse "Not signed in"
+// @Failure 403 {object} ErrorResponse "Not an editor"
+// @Failure 409 {object} ErrorResponse "A publisher with the same name already exists"
+// @Failure 500 {object} ErrorResponse "Error saving publisher"
+// @Router /publishers [post]
+func (s *Server) AddPublisher(w http.ResponseWriter, r *http.Request) {
+    var input PublisherInput
+    if !decodeJSON(w, r, &input) {
+        return
+    }
+    publisher := models.Publisher{Name: input.Name}
+    publisher.Normalize()
+    if err := validateStruct(publisher); err != nil {
+        writeValidationError(w, r, err.(*ValidationError))
+        return
+    }
+
+    if err := s.Books.CreatePublisher(r.Context(), &publisher); err != nil {
+        writeTaxonomyError(w, r, "publisher", "", "Error saving publisher", err)
+        return
+    }
+    encodeResponse(w, r, http.StatusCreated, publisher)
+}
+
+
+// GetPublisher godoc
+// @Summary Get a publisher by ID
+// @Tags publishers
+// @Produce json
+// @Param id path int true "Publisher ID"
+// @Success 200 {object} models.Publisher "Publisher found"
+// @Failure 400 {object} ErrorResponse "Invalid ID"
+// @Failure 404 {object} ErrorResponse "Publisher not found"
+// @Failure 500 {object} ErrorResponse "Error retrieving publisher"
+// @Router /publishers/{id} [get]
+func (s *Server) GetPublisher(w http.ResponseWriter, r *http.Request) {
+    id, ok := pathID(w, r)
+    if !ok {
+        return
+    }
+
+    publisher, err := s.Books.GetPublisher(r.Context(), id)
+    if err != nil {
+        writeTaxonomyError(w, r, "publisher", "", "Error retrieving publisher", err)
+        return
+    }
+    encodeResponse(w, r, http.StatusOK, publisher)
+}
+
+
+// UpdatePublisher godoc
+// @Summary Rename a publisher
+// @Description Rename a publisher. The new name is also written to the publisher field of its books.
+// @Tags publishers
+// @Security BearerAuth
+// @Security APIKeyAuth
+// @Accept json
+// @Produce json
+// @Param id path int true "Publisher ID"
+// @Param publisher body PublisherInput true "New name"
+// @Success 200 {object} models.Publisher "Publisher successfully updated"
+// @Failure 400 {object} ErrorResponse "Invalid request body or ID"
+// @Failure 401 {object} ErrorResponse "Not signed in"
+// @Failure 403 {object} ErrorResponse "Not an editor"
+// @Failure 404 {object} ErrorResponse "Publisher not found"
+// @Failure 409 {object} ErrorResponse "Another publisher has the same name"
+// @Failure 500 {object} ErrorResponse "Error saving publisher"
+// @Router /publishers/{id} [put]
+func (s *Server) UpdatePublisher(w http.ResponseWriter, r *http.Request) {
+    id, ok := pathID(w, r)
+    if !ok {
+        return
+    }
+    var input PublisherInput
+    if !decodeJSON(w, r, &input) {
+        return
+    }
+    publisher := models.Publisher{ID: id, Name: input.Name}
+    publisher.Normalize()
+    if err := validateStruct(publisher); err != nil {
+        writeValidationError(w, r, err.(*ValidationError))
+        return
+    }
+
+    err := s.Books.Transaction(r.Context(), func(tx repository.BookRepository) error {
+        return changeReferencingBooks(r, tx, repository.RefPublisher, id, func() error {
+            return tx.UpdatePublisher(r.Context(), &publisher)
+        })
+    })
+    if err != nil {
+        writeTaxonomyError(w, r, "publisher", "", "Error saving publisher", err)
+        return
+    }
+    encodeResponse(w, r, http.StatusOK, publisher)
+}
+
+
+// DeletePublisher godoc
+// @Summary Delete a publisher
+// @Description Delete a publisher no book refers to, including books in the trash.
+// @Tags publishers
+// @Security BearerAuth
+// @Param id path int true "Publisher ID"
+// @Success 204 "Publisher successfully deleted"
+// @Failure 400 {object} ErrorResponse "Invalid ID"
+// @Failure 401 {object} ErrorResponse "Not signed in"
+// @Failure 403 {object} ErrorResponse "Not an admin"
+// @Failure 404 {object} ErrorResponse "Publisher not found"
+// @Failure 409 {object} ErrorResponse "Books still refer to the publisher"
+// @Failure 500 {object} ErrorResponse "Error deleting publisher"
+// @Router /publishers/{id} [delete]
+func (s *Server) DeletePublisher(w http.ResponseWriter, r *http.Request) {
+    id, ok := pathID(w, r)
+    if !ok {
+        return
+    }
+
+    if err := s.Books.DeletePublisher(r.Context(), id); err != nil {
+        writeTaxonomyError(w, r, "publisher", "", "Error deleting publisher", err)
+        return
+    }
+    Logger(r).Info("Publisher deleted", "publisher_id", id)
+    w.WriteHeader(http.StatusNoContent)
+}
+
+
+// MergePublisher godoc
+// @Summary Merge a publisher into another
+// @Description Move all books, including books in the trash, from this publisher to the target publisher
+// @Description and delete this publisher, e.g. to merge "Penguin" into "Penguin Books".
+// @Tags publishers
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param id path int true "ID of the publisher to merge and delete"
+// @Param merge body MergeRequest true "Publisher to merge into"
+// @Success 200 {object} MergeResult
+// @Failure 400 {object} ErrorResponse "Invalid request body, ID or target"
+// @Failure 401 {object} ErrorResponse "Not signed in"
+// @Failure 403 {object} ErrorResponse "Not an admin"
+// @Failure 404 {object} ErrorResponse "Publisher not found"
+// @Failure 500 {object} ErrorResponse "Error merging publishers"
+// @Router /publishers/{id}/merge [post]
+func (s *Server) MergePublisher(w http.ResponseWriter, r *http.Request) {
+    id, ok := pathID(w, r)
+    if !ok {
+        return
+    }
+    targetID, ok := decodeMerge(w, r, id)
+    if !ok {
+        return
+    }
+
+    var moved int64
+    err := s.Books.Transaction(r.Context(), func(tx repository.BookRepository) error {
+        return changeReferencingBooks(r, tx, repository.RefPublisher, id, func() (err error) {
+            moved, err = tx.MergePublishers(r.Context(), id, targetID)
+            return err
+        })
+    })
+    if err != nil {
+        writeTaxonomyError(w, r, "publisher", "targetId", "Error merging publishers", err)
+        return
+    }
+    Logger(r).Info("Publisher merged", "publisher_id", id, "target_id", targetID, "books_moved", moved)
+    encodeResponse(w, r, http.StatusOK, MergeResult{TargetID: targetID, MovedBooks: moved})
+}
+
+
+// GetGenres godoc
+// @Summary Get list of genres
+// @Description Get all genres in tree order, each with its path, parentId and the number of live books
+// @Description directly in it and in its subgenres.
+// @Tags genres
+// @Produce  json
+// @Success 200 {array} GenreResult
+// @Failure 500 {object} ErrorResponse "Error retrieving genres"
+// @Router /genres [get]
+func (s *Server) GetGenres(w http.ResponseWriter, r *http.Request) {
+    counts, err := s.Books.ListGenres(r.Context())
+    if err != nil {
+        writeInternalError(w, r, "Error retrieving genres", err)
+        return
+    }
+    results := make([]GenreResult, len(counts))
+    for i, count := range counts {
+        results[i] = GenreResult{
+            Genre:          count.Genre,
+            Path:           strings.Join(count.Path, " "+models.GenrePathSeparator+" "),
+            BookCount:      count.Books,
+            TotalBookCount: count.TotalBooks,
+        }
+    }
+    encodeResponse(w, r, http.StatusOK, results)
+}
+
+
+// AddGenre godoc
+// @Summary Add a new genre
+// @Description Add a genre, below parentId if given. Names are unique in the whole tree, ignoring case and whitespace.
+// @Tags genres
+// @Security BearerAuth
+// @Security APIKeyAuth
+// @Accept json
+// @Produce json
+// @Param genre body GenreInput true "Add Genre"
+// @Success 201 {object} models.Genre "Genre successfully added"
+// @Failure 400 {object} ErrorResponse "Invalid request body or parent"
+// @Failure 401 {object} ErrorResponse "Not signed in"
+// @Failure 403 {object} ErrorResponse "Not an editor"
+// @Failure 409 {object} ErrorResponse "A genre with the same name already exists"
+// @Failure 500 {object} ErrorResponse "Error saving genre"
+// @Router /genres [post]
+func (s *Server) AddGenre(w http.ResponseWriter, r *http.Request) {
+    var input GenreInput
+    if !decodeJSON(w, r, &input) {
+        return
+    }
+    genre := models.Genre{Name: input.Name, ParentID: input.ParentID}
+    genre.Normalize()
+    if err := validateStruct(genre); err != nil {
+        writeValidationError(w, r, err.(*ValidationError))
+        return
+    }
+
+    if err := s.Books.CreateGenre(r.Context(), &genre); err != nil {
+        writeTaxonomyError(w, r, "genre", "parentId", "Error saving genre", err)
+        return
+    }
+    encodeResponse(w, r, http.StatusCreated, genre)
+}
+
+
+// GetGenre godoc
+// @Summary Get a genre by ID
+// @Tags genres
+// @Produce json
+// @Param id path int true "Genre ID"
+// @Success 200 {object} models.Genre "Genre found"
+// @Failure 400 {object} ErrorResponse "Invalid ID"
+// @Failure 404 {object} ErrorResponse "Genre not found"
+// @Failure 500 {object} ErrorResponse "Error retrieving genre"
+// @Router /genres/{id} [get]
+func (s *Server) GetGenre(w http.ResponseWriter, r *http.Request) {
+    id, ok := pathID(w, r)
+    if !ok {
+        return
+    }
+
+    genre, err := s.Books.GetGenre(r.Context(), id)
+    if err != nil {
+        writeTaxonomyError(w, r, "genre", "", "Error retrieving genre", err)
+        return
+    }
+    encodeResponse(w, r, http.StatusOK, genre)
+}
+
+
+// UpdateGenre godoc
+// @Summary Rename or move a genre
+// @Description Rename a genre or move it below another parent. A new name is also written to the genre field of its books.
+// @Tags genres
+// @Security BearerAuth
+// @Security APIKeyAuth
+// @Accept json
+// @Produce json
+// @Param id path int true "Genre ID"
+// @Param genre body GenreInput true "New name and parent"
+// @Success 200 {object} models.Genre "Genre successfully updated"
+// @Failure 400 {object} ErrorResponse "Invalid request body, ID or parent"
+// @Failure 401 {object} ErrorResponse "Not signed in"
+// @Failure 403 {object} ErrorResponse "Not an editor"
+// @Failure 404 {object} ErrorResponse "Genre not found"
+// @Failure 409 {object} ErrorResponse "Another genre has the same name"
+// @Failure 500 {object} ErrorResponse "Error saving genre"
+// @Router /genres/{id} [put]
+func (s *Server) UpdateGenre(w http.ResponseWriter, r *http.Request) {
+    id, ok := pathID(w, r)
+    if !ok {
+        return
+    }
+    var input GenreInput
+    if !decodeJSON(w, r, &input) {
+        return
+    }
+    genre := models.Genre{ID: id, Name: input.Name, ParentID: input.ParentID}
+    genre.Normalize()
+    if err := validateStruct(genre); err != nil {
+        writeValidationError(w, r, err.(*ValidationError))
+        return
+    }
+
+    err := s.Books.Transaction(r.Context(), func(tx repository.BookRepository) error {
+        return changeReferencingBooks(r, tx, repository.RefGenre, id, func() error {
+            return tx.UpdateGenre(r.Context(), &genre)
+        })
+    })
+    if err != nil {
+        writeTaxonomyError(w, r, "genre", "parentId", "Error saving genre", err)
+        return
+    }
+    encodeResponse(w, r, http.StatusOK, genre)
+}
+
+
+// DeleteGenre godoc
+// @Summary Delete a genre
+// @Description Delete a genre without subgenres that no book refers to, including books in the trash.
+// @Tags genres
+// @Security BearerAuth
+// @Param id path int true "Genre ID"
+// @Success 204 "Genre successfully deleted"
+// @Failure 400 {object} ErrorResponse "Invalid ID"
+// @Failure 401 {object} ErrorResponse "Not signed in"
+// @Failure 403 {object} ErrorResponse "Not an admin"
+// @Failure 404 {object} ErrorResponse "Genre not found"
+// @Failure 409 {object} ErrorResponse "The genre has subgenres or books"
+// @Failure 500 {object} ErrorResponse "Error deleting genre"
+// @Router /genres/{id} [delete]
+func (s *Server) DeleteGenre(w http.ResponseWriter, r *http.Request) {
+    id, ok := pathID(w, r)
+    if !ok {
+        return
+    }
+
+    if err := s.Books.DeleteGenre(r.Context(), id); err != nil {
+        writeTaxonomyError(w, r, "genre", "", "Error deleting genre", err)
+        return
+    }
+    Logger(r).Info("Genre deleted", "genre_id", id)
+    w.WriteHeader(http.StatusNoContent)
+}
+
+
+// MergeGenre godoc
+// @Summary Merge a genre into another
+// @Description Move all books, including books in the trash, and all subgenres from this genre to the target genre
+// @Description and delete this genre. The target can't be one of the subgenres.
+// @Tags genres
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param id path int true "ID of the genre to merge and delete"
+// @Param merge body MergeRequest true "Genre to merge into"
+// @Success 200 {object} MergeResult
+// @Failure 400 {object} ErrorResponse "Invalid request body, ID or target"
+// @Failure 401 {object} ErrorResponse "Not signed in"
+// @Failure 403 {object} ErrorResponse "Not an admin"
+// @Failure 404 {object} ErrorResponse "Genre not found"
+// @Failure 500 {object} ErrorResponse "Error merging genres"
+// @Router /genres/{id}/merge [post]
+func (s *Server) MergeGenre(w http.ResponseWriter, r *http.Request) {
+    id, ok := pathID(w, r)
+    if !ok {
+        return
+    }
+    targetID, ok := decodeMerge(w, r, id)
+    if !ok {
+        return
+    }
+
+    var moved int64
+    err := s.Books.Transaction(r.Context(), func(tx repository.BookRepository) error {
+        return changeReferencingBooks(r, tx, repository.RefGenre, id, func() (err error) {
+            moved, err = tx.MergeGenres(r.Context(), id, targetID)
+            return err
+        })
+    })
+    if err != nil {
+        writeTaxonomyError(w, r, "genre", "targetId", "Error merging genres", err)
+        return
+    }
+    Logger(r).Info("Genre merged", "genre_id", id, "target_id", targetID, "books_moved", moved)
+    encodeResponse(w, r, http.StatusOK, MergeResult{TargetID: targetID, MovedBooks: moved})
+}
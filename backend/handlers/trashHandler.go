@@ -0,0 +1,88 @@
+package handlers
+
+import (
+	"book-manager/models"
+	"book-manager/repository"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+)
+
+// GetTrash godoc
+// @Summary Get list of trashed books
+// @Description Get a page of books that were deleted but not purged yet. Supports the same
+// @Description pagination, sorting and filter parameters as GET /books, e.g. sort=deletedAt&order=desc.
+// @Description Needs the editor role.
+// @Tags books
+// @Security BearerAuth
+// @Security APIKeyAuth
+// @Accept  json
+// @Produce  json
+// @Param limit query int false "Page size (default 50, max 500)"
+// @Param offset query int false "Number of books to skip"
+// @Param cursor query string false "Cursor returned in X-Next-Cursor"
+// @Param sort query string false "Sort field (id, title, author, year, genre, isbn, publisher, createdAt, updatedAt, deletedAt)"
+// @Param order query string false "Sort direction (asc or desc)"
+// @Success 200 {array} models.Book
+// @Header 200 {integer} X-Total-Count "Number of trashed books matching the filters"
+// @Header 200 {string} X-Next-Cursor "Cursor of the next page, if any"
+// @Failure 400 {object} ErrorResponse "Invalid query parameters"
+// @Failure 401 {object} ErrorResponse "Not signed in"
+// @Failure 403 {object} ErrorResponse "Not an editor"
+// @Failure 500 {object} ErrorResponse "Error retrieving books"
+// @Router /books/trash [get]
+func (s *Server) GetTrash(w http.ResponseWriter, r *http.Request) {
+    s.listBooks(w, r, true)
+}
+
+
+// RestoreBook godoc
+// @Summary Restore a trashed book
+// @Description Move a book out of the trash by its ID
+// @Tags books
+// @Security BearerAuth
+// @Accept  json
+// @Produce  json
+// @Param id path int true "Book ID"
+// @Success 200 {object} models.Book "Book successfully restored"
+// @Header 200 {string} ETag "Version of the restored book"
+// @Failure 400 {object} ErrorResponse "Invalid ID"
+// @Failure 401 {object} ErrorResponse "Not signed in"
+// @Failure 403 {object} ErrorResponse "Not an admin"
+// @Failure 404 {object} ErrorResponse "Book not found in trash"
+// @Failure 500 {object} ErrorResponse "Error restoring book"
+// @Router /books/{id}/restore [post]
+func (s *Server) RestoreBook(w http.ResponseWriter, r *http.Request) {
+    params := mux.Vars(r)
+    id, err := strconv.Atoi(params["id"])
+    if err != nil {
+        Logger(r).Debug("Invalid ID for restore", "error", err)
+        writeError(w, r, http.StatusBadRequest, CodeInvalidRequest, "Invalid ID")
+        return
+    }
+
+    var book *models.Book
+    err = s.Books.Transaction(r.Context(), func(tx repository.BookRepository) error {
+        book, err = restoreBook(r, tx, uint(id))
+        return err
+    })
+    if errors.Is(err, repository.ErrNotFound) {
+        Logger(r).Debug("Book not found in trash", "book_id", id)
+        writeError(w, r, http.StatusNotFound, CodeNotFound, "Book not found in trash")
+        return
+    }
+
+    if err != nil {
+        writeInternalError(w, r, "Error restoring book", err)
+        return
+    }
+
+    Logger(r).Info("Book restored", "book_id", id)
+    w.Header().Set("ETag", bookETag(book))
+    if err := json.NewEncoder(w).Encode(book); err != nil {
+        Logger(r).Warn("Error encoding restored book", "error", err)
+    }
+}
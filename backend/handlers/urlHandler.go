@@ -2,7 +2,6 @@ package handlers
 
 import (
 	"encoding/json"
-	"log"
 	"net/http"
 	"net/url"
 	"strings"
@@ -18,7 +17,6 @@ type URLResponse struct {
 }
 
 func processURL(url, operation string) string {
-    log.Printf("Processing URL: %s with operation: %s", url, operation) 
     switch operation {
     case "canonical":
         return canonicalURL(url)
@@ -44,7 +42,6 @@ func redirectionURL(inputURL string) string {
 
     parsedURL, err := url.Parse(inputURL)
     if err != nil {
-        log.Printf("Error parsing URL: %v", err) 
         return ""
     }
 
@@ -53,9 +50,7 @@ func redirectionURL(inputURL string) string {
     parsedURL.RawQuery = ""
     parsedURL.Fragment = ""
 
-    resultURL := parsedURL.String()
-    log.Printf("Redirection URL result: %s", resultURL)
-    return resultURL
+    return parsedURL.String()
 }
 
 
@@ -64,25 +59,26 @@ func redirectionURL(inputURL string) string {
 // @Summary Process a URL
 // @Description Processes a URL based on the operation specified in the request
 // @Tags URL Processing
+// @Security BearerAuth
+// @Security APIKeyAuth
 // @Accept json
 // @Produce json
 // @Param request body URLRequest true "URL Request"
 // @Success 200 {object} URLResponse "URL successfully processed"
-// @Failure 400 {string} string "Invalid request"
-// @Failure 405 {string} string "Only POST method is allowed"
+// @Failure 400 {object} ErrorResponse "Invalid request"
+// @Failure 401 {object} ErrorResponse "Not signed in"
+// @Failure 405 {object} ErrorResponse "Only POST method is allowed"
 // @Router /process-url [post]
 func UrlHandler(w http.ResponseWriter, r *http.Request) {
-    log.Printf("Received request: %s", r.URL.Path) 
     if r.Method != "POST" {
-        log.Printf("Invalid request method: %s", r.Method) 
-        http.Error(w, "Only POST method is allowed", http.StatusMethodNotAllowed)
+        writeError(w, r, http.StatusMethodNotAllowed, CodeMethodNotAllowed, "Only POST method is allowed")
         return
     }
 
     var request URLRequest
     if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
-        log.Printf("Error decoding request: %v", err) 
-        http.Error(w, "Invalid request", http.StatusBadRequest)
+        Logger(r).Debug("Error decoding request", "error", err)
+        writeError(w, r, http.StatusBadRequest, CodeInvalidRequest, "Invalid request")
         return
     }
 
@@ -92,5 +88,5 @@ func UrlHandler(w http.ResponseWriter, r *http.Request) {
     w.Header().Set("Content-Type", "application/json")
     json.NewEncoder(w).Encode(response)
 
-    log.Printf("Processed and responded with URL: %s", processedURL) // Log the response
+    Logger(r).Debug("Processed URL", "url", request.URL, "operation", request.Operation, "result", processedURL)
 }
\ No newline at end of file
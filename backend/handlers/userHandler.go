@@ -0,0 +1,91 @@
+package handlers
+
+import (
+	"book-manager/models"
+	"book-manager/repository"
+	"errors"
+	"net/http"
+	"strings"
+)
+
+// RoleInput is the new role of a user.
+type RoleInput struct {
+    Role string `json:"role" enums:"viewer,editor,admin"`
+}
+
+// GetUsers godoc
+// @Summary List users
+// @Description List all users and their roles, sorted by username. Needs the admin role.
+// @Tags users
+// @Security BearerAuth
+// @Produce json
+// @Success 200 {array} models.User
+// @Failure 401 {object} ErrorResponse "Not signed in"
+// @Failure 403 {object} ErrorResponse "Not an admin"
+// @Failure 500 {object} ErrorResponse "Error retrieving users"
+// @Router /users [get]
+func (s *Server) GetUsers(w http.ResponseWriter, r *http.Request) {
+    users, err := s.Books.ListUsers(r.Context())
+    if err != nil {
+        writeInternalError(w, r, "Error retrieving users", err)
+        return
+    }
+    w.Header().Set("Content-Type", "application/json")
+    encodeResponse(w, r, http.StatusOK, users)
+}
+
+
+// SetUserRole godoc
+// @Summary Change the role of a user
+// @Description Viewers can read the catalog, editors can also add and change books, authors, publishers and genres,
+// @Description and admins can also delete them and manage users. Needs the admin role. There is always at least one admin.
+// @Tags users
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param id path int true "User ID"
+// @Param role body RoleInput true "New role"
+// @Success 200 {object} models.User
+// @Failure 400 {object} ErrorResponse "Invalid ID or role"
+// @Failure 401 {object} ErrorResponse "Not signed in"
+// @Failure 403 {object} ErrorResponse "Not an admin"
+// @Failure 404 {object} ErrorResponse "User not found"
+// @Failure 409 {object} ErrorResponse "The user is the last admin"
+// @Failure 500 {object} ErrorResponse "Error changing role"
+// @Router /users/{id}/role [put]
+func (s *Server) SetUserRole(w http.ResponseWriter, r *http.Request) {
+    id, ok := pathID(w, r)
+    if !ok {
+        return
+    }
+    var input RoleInput
+    if !decodeJSON(w, r, &input) {
+        return
+    }
+    role := strings.ToLower(strings.TrimSpace(input.Role))
+    if !models.RoleAllows(role, models.UserViewer) {
+        writeValidationError(w, r, &ValidationError{Fields: []FieldError{{
+            Field:   "role",
+            Rule:    "oneof",
+            Message: "role must be one of " + strings.Join(models.UserRoles, ", "),
+        }}})
+        return
+    }
+
+    user, err := s.Books.SetUserRole(r.Context(), id, role)
+    switch {
+    case errors.Is(err, repository.ErrNotFound):
+        writeError(w, r, http.StatusNotFound, CodeNotFound, "User not found")
+        return
+    case errors.Is(err, repository.ErrLastAdmin):
+        writeError(w, r, http.StatusConflict, CodeLastAdmin, "The last admin can't get another role")
+        return
+    case err != nil:
+        writeInternalError(w, r, "Error changing role", err)
+        return
+    }
+
+    w.Header().Set("Content-Type", "application/json")
+    encodeResponse(w, r, http.StatusOK, user)
+    Logger(r).Info("User role changed", "user_id", user.ID, "role", user.Role, "changed_by", CurrentUser(r).ID)
+}
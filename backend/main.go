@@ -1,40 +1,120 @@
 package main
 
 import (
+	"book-manager/auth"
+	"book-manager/config"
+	"book-manager/database"
 	"book-manager/handlers"
+	"book-manager/ratelimit"
+	"book-manager/repository"
+	"book-manager/storage"
+	"context"
+	"flag"
+	"fmt"
 	"log"
+	"log/slog"
 	"net/http"
+	"os"
+	"time"
 
 	gorillaHandlers "github.com/gorilla/handlers"
-	"github.com/gorilla/mux"
 
 	_ "book-manager/docs"
 
 	httpSwagger "github.com/swaggo/http-swagger"
 )
 
+// @title Book Manager API
+// @description Manage a catalog of books. Reading is open to everyone; requests that change anything need the
+// @description access token of a signed in user, see POST /auth/login, or an API key, see POST /api-keys.
+// @description Clients are rate limited; requests over the limit get 429 with a Retry-After header.
+// @securityDefinitions.apikey BearerAuth
+// @in header
+// @name Authorization
+// @description Send the access token as "Bearer <token>".
+// @securityDefinitions.apikey APIKeyAuth
+// @in header
+// @name X-API-Key
+// @description Send an API key with the scope the route needs.
 func main() {
-    r := mux.NewRouter()
+    if len(os.Args) > 1 && os.Args[1] == "migrate" {
+        if err := runMigrate(os.Args[2:]); err != nil && err != flag.ErrHelp {
+            log.Fatal(err)
+        }
+        return
+    }
+    if len(os.Args) > 1 && os.Args[1] == "create-admin" {
+        if err := runCreateAdmin(os.Args[2:]); err != nil && err != flag.ErrHelp {
+            log.Fatal(err)
+        }
+        return
+    }
 
-    r.HandleFunc("/books", handlers.GetBooks).Methods("GET")
-    r.HandleFunc("/books", handlers.AddBook).Methods("POST")
-    r.HandleFunc("/books/{id}", handlers.GetBook).Methods("GET")
-    r.HandleFunc("/books/{id}", handlers.UpdateBook).Methods("PUT")
-    r.HandleFunc("/books/{id}", handlers.DeleteBook).Methods("DELETE")
-    r.HandleFunc("/process-url", handlers.UrlHandler).Methods("POST")
+    cfg, err := config.Load(os.Args[1:])
+    if err == flag.ErrHelp {
+        return
+    }
+    if err != nil {
+        log.Fatal(err)
+    }
 
-   
-    r.PathPrefix("/swagger/").Handler(httpSwagger.WrapHandler)
+    if cfg.PrintConfig {
+        fmt.Print(cfg)
+        return
+    }
+
+    logger := slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: cfg.SlogLevel()}))
+    slog.SetDefault(logger)
+
+    db, err := database.Open(cfg.DatabaseDSN, cfg.LogLevel)
+    if err != nil {
+        log.Fatal("Failed to open database: ", err)
+    }
 
-    log.Println("Server running on port 8000")
+    covers, err := storage.NewLocalStore(cfg.CoverDir)
+    if err != nil {
+        log.Fatal("Failed to open cover directory: ", err)
+    }
 
+    books := repository.NewGormBookRepository(db)
+    repository.StartTrashPurger(context.Background(), books, covers, cfg.TrashRetention, time.Hour)
+
+    s := handlers.NewServer(books)
+    s.Covers, s.MaxCoverSize, s.Logger = covers, cfg.MaxCoverSize, logger
+    if cfg.JWTSecret != "" {
+        if s.Tokens, err = auth.NewTokens([]byte(cfg.JWTSecret), cfg.AccessTTL, cfg.RefreshTTL); err != nil {
+            log.Fatal(err)
+        }
+    } else {
+        slog.Warn("No JWT secret configured, users are signed out when the server restarts")
+        s.Tokens = auth.NewRandomTokens(cfg.AccessTTL, cfg.RefreshTTL)
+    }
+    s.RateLimits = map[string]ratelimit.Limit{
+        handlers.RateLimitRead:  cfg.RateLimitRead,
+        handlers.RateLimitWrite: cfg.RateLimitWrite,
+        handlers.RateLimitURLs:  cfg.RateLimitURLs,
+        handlers.RateLimitAuth:  cfg.RateLimitAuth,
+    }
+    s.TrustedProxies = cfg.TrustedProxyPrefixes()
+    r := s.Routes()
+    r.PathPrefix("/swagger/").Handler(httpSwagger.WrapHandler)
 
     corsHandler := gorillaHandlers.CORS(
-        gorillaHandlers.AllowedOrigins([]string{"*"}),
-        gorillaHandlers.AllowedMethods([]string{"GET", "POST", "PUT", "DELETE", "OPTIONS"}),
-        gorillaHandlers.AllowedHeaders([]string{"Content-Type", "Authorization"}),
+        gorillaHandlers.AllowedOrigins(cfg.AllowedOrigins),
+        gorillaHandlers.AllowedMethods([]string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"}),
+        gorillaHandlers.AllowedHeaders([]string{"Content-Type", "Authorization", "If-Match", "If-None-Match", handlers.RequestIDHeader}),
+        gorillaHandlers.ExposedHeaders([]string{"ETag", "X-Total-Count", "X-Next-Cursor", handlers.RequestIDHeader,
+            "Retry-After", "RateLimit-Limit", "RateLimit-Remaining", "RateLimit-Reset", "RateLimit-Policy"}),
     )(r)
 
+    server := &http.Server{
+        Addr:         cfg.Addr,
+        Handler:      corsHandler,
+        ReadTimeout:  cfg.ReadTimeout,
+        WriteTimeout: cfg.WriteTimeout,
+        IdleTimeout:  cfg.IdleTimeout,
+    }
 
-     log.Fatal(http.ListenAndServe(":8000", corsHandler))
+    slog.Info("Server running", "addr", cfg.Addr)
+    log.Fatal(server.ListenAndServe())
 }
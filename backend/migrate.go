@@ -0,0 +1,77 @@
+package main
+
+import (
+	"book-manager/config"
+	"book-manager/database"
+	"book-manager/migrations"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+)
+
+const migrateUsage = "usage: book-manager migrate up|down|status [flags]"
+
+// runMigrate implements the migrate subcommand. args are the arguments after "migrate".
+func runMigrate(args []string) error {
+    if len(args) == 0 {
+        return fmt.Errorf(migrateUsage)
+    }
+    action := args[0]
+    if action != "up" && action != "down" && action != "status" {
+        return fmt.Errorf("unknown migrate command %q\n%s", action, migrateUsage)
+    }
+
+    cfg, err := config.Load(args[1:])
+    if err != nil {
+        return err
+    }
+
+    db, err := database.Connect(cfg.DatabaseDSN, cfg.LogLevel)
+    if err != nil {
+        return fmt.Errorf("failed to connect to database: %v", err)
+    }
+
+    switch action {
+    case "up":
+        applied, err := migrations.Up(db)
+        for _, m := range applied {
+            fmt.Printf("Applied migration %d (%s)\n", m.Version, m.Name)
+        }
+        if err != nil {
+            return err
+        }
+        if len(applied) == 0 {
+            fmt.Println("Database is up to date")
+        }
+    case "down":
+        m, err := migrations.Down(db)
+        if err != nil {
+            return err
+        }
+        if m == nil {
+            fmt.Println("No migrations to roll back")
+        } else {
+            fmt.Printf("Rolled back migration %d (%s)\n", m.Version, m.Name)
+        }
+    case "status":
+        statuses, err := migrations.List(db)
+        if err != nil {
+            return err
+        }
+        w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+        fmt.Fprintln(w, "VERSION\tNAME\tSTATUS\tAPPLIED AT")
+        for _, s := range statuses {
+            status, appliedAt := "pending", ""
+            if s.Applied {
+                status, appliedAt = "applied", s.AppliedAt.Format(time.RFC3339)
+            }
+            if s.Unknown {
+                status = "unknown to this build"
+            }
+            fmt.Fprintf(w, "%d\t%s\t%s\t%s\n", s.Version, s.Name, status, appliedAt)
+        }
+        return w.Flush()
+    }
+    return nil
+}
@@ -0,0 +1,42 @@
+package migrations
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// bookV1 is the books table as first created. Migrations use their own
+// snapshot of a model, since models.Book keeps changing.
+type bookV1 struct {
+    ID          uint `gorm:"primarykey"`
+    CreatedAt   time.Time
+    UpdatedAt   time.Time
+    DeletedAt   gorm.DeletedAt `gorm:"index"`
+    Title       string
+    Author      string
+    Year        int
+    Genre       string
+    ISBN        string
+    Publisher   string
+    Description string
+}
+
+func (bookV1) TableName() string {
+    return "books"
+}
+
+func init() {
+    register(Migration{
+        Version: 1,
+        Name:    "create_books",
+        Up: func(tx *gorm.DB) error {
+            // Databases created before versioned migrations already have the
+            // table, which AutoMigrate brings up to this version.
+            return tx.AutoMigrate(&bookV1{})
+        },
+        Down: func(tx *gorm.DB) error {
+            return tx.Migrator().DropTable(&bookV1{})
+        },
+    })
+}
@@ -0,0 +1,58 @@
+package migrations
+
+import (
+	"book-manager/models"
+	"log/slog"
+
+	"gorm.io/gorm"
+)
+
+// bookV2 adds the normalized ISBN-13, which is unique among all books,
+// including those in the trash. NULL (no or an invalid ISBN) never conflicts.
+type bookV2 struct {
+    bookV1
+    ISBN13 *string `gorm:"column:isbn13;size:13;uniqueIndex:idx_books_isbn13"`
+}
+
+func init() {
+    register(Migration{
+        Version: 2,
+        Name:    "isbn13",
+        Up: func(tx *gorm.DB) error {
+            if err := tx.Migrator().AddColumn(&bookV2{}, "ISBN13"); err != nil {
+                return err
+            }
+
+            var books []bookV1
+            if err := tx.Unscoped().Where("isbn <> ''").Order("id").Find(&books).Error; err != nil {
+                return err
+            }
+            // The oldest book keeps a duplicated ISBN, later copies are left
+            // without ISBN13 so that the unique index can be created.
+            seen := map[string]uint{}
+            for _, book := range books {
+                isbn13, err := models.NormalizeISBN(book.ISBN)
+                if err != nil {
+                    slog.Warn("Book has an invalid ISBN", "book_id", book.ID, "isbn", book.ISBN, "error", err)
+                    continue
+                }
+                if id, ok := seen[isbn13]; ok {
+                    slog.Warn("Book has the same ISBN as another book", "book_id", book.ID, "other_id", id)
+                    continue
+                }
+                seen[isbn13] = book.ID
+                if err := tx.Table("books").Where("id = ?", book.ID).Update("isbn13", isbn13).Error; err != nil {
+                    return err
+                }
+            }
+
+            return tx.Migrator().CreateIndex(&bookV2{}, "idx_books_isbn13")
+        },
+        Down: func(tx *gorm.DB) error {
+            if err := tx.Migrator().DropIndex(&bookV2{}, "idx_books_isbn13"); err != nil {
+                return err
+            }
+            return dropColumn(tx, "books", "isbn13")
+        },
+    })
+}
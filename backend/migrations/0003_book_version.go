@@ -0,0 +1,25 @@
+package migrations
+
+import (
+	"gorm.io/gorm"
+)
+
+// bookV3 adds a version that is incremented on every update, for ETags and
+// optimistic locking.
+type bookV3 struct {
+    bookV2
+    Version uint `gorm:"not null;default:1"`
+}
+
+func init() {
+    register(Migration{
+        Version: 3,
+        Name:    "book_version",
+        Up: func(tx *gorm.DB) error {
+            return tx.Migrator().AddColumn(&bookV3{}, "Version")
+        },
+        Down: func(tx *gorm.DB) error {
+            return dropColumn(tx, "books", "version")
+        },
+    })
+}
@@ -0,0 +1,107 @@
+package migrations
+
+import (
+	"regexp"
+	"strings"
+	"time"
+	"unicode"
+
+	"gorm.io/gorm"
+)
+
+type authorV1 struct {
+    ID        uint `gorm:"primaryKey"`
+    CreatedAt time.Time
+    UpdatedAt time.Time
+    Name      string `gorm:"size:255;not null"`
+    NameKey   string `gorm:"size:255;not null;uniqueIndex:idx_authors_name_key"`
+    Bio       string
+}
+
+func (authorV1) TableName() string {
+    return "authors"
+}
+
+type bookAuthorV1 struct {
+    BookID   uint   `gorm:"primaryKey;autoIncrement:false"`
+    AuthorID uint   `gorm:"primaryKey;autoIncrement:false;index:idx_book_authors_author_id"`
+    Role     string `gorm:"primaryKey;size:20"`
+    Position int
+}
+
+func (bookAuthorV1) TableName() string {
+    return "book_authors"
+}
+
+// The author names are split and keyed as models.SplitAuthorNames and
+// models.AuthorNameKey did when this migration was written, so that later
+// changes to them don't change what it does.
+var (
+    spacesV1         = regexp.MustCompile(`\s+`)
+    nameSeparatorsV1 = regexp.MustCompile(`\s*(?:;|&|\band\b)\s*`)
+)
+
+func authorNameKeyV1(name string) string {
+    return strings.Map(func(r rune) rune {
+        if r == '.' || unicode.IsSpace(r) {
+            return -1
+        }
+        return unicode.ToLower(r)
+    }, name)
+}
+
+func splitAuthorNamesV1(authors string) []string {
+    var names []string
+    seen := map[string]bool{}
+    for _, name := range nameSeparatorsV1.Split(authors, -1) {
+        name = strings.TrimSpace(spacesV1.ReplaceAllString(name, " "))
+        key := authorNameKeyV1(name)
+        if key == "" || seen[key] {
+            continue
+        }
+        seen[key] = true
+        names = append(names, name)
+    }
+    return names
+}
+
+func init() {
+    register(Migration{
+        Version: 4,
+        Name:    "authors",
+        Up: func(tx *gorm.DB) error {
+            if err := tx.Migrator().CreateTable(&authorV1{}, &bookAuthorV1{}); err != nil {
+                return err
+            }
+
+            // Every name in the author strings of the existing books becomes
+            // an author, deduplicated by authorNameKeyV1.
+            var books []bookV1
+            if err := tx.Unscoped().Select("id", "author").Order("id").Find(&books).Error; err != nil {
+                return err
+            }
+            authors := map[string]uint{}
+            for _, book := range books {
+                for position, name := range splitAuthorNamesV1(book.Author) {
+                    key := authorNameKeyV1(name)
+                    id, ok := authors[key]
+                    if !ok {
+                        author := authorV1{Name: name, NameKey: key}
+                        if err := tx.Create(&author).Error; err != nil {
+                            return err
+                        }
+                        id, authors[key] = author.ID, author.ID
+                    }
+                    credit := bookAuthorV1{BookID: book.ID, AuthorID: id, Role: "author", Position: position}
+                    if err := tx.Create(&credit).Error; err != nil {
+                        return err
+                    }
+                }
+            }
+            return nil
+        },
+        Down: func(tx *gorm.DB) error {
+            return tx.Migrator().DropTable(&bookAuthorV1{}, &authorV1{})
+        },
+    })
+}
@@ -0,0 +1,130 @@
+package migrations
+
+import (
+	"book-manager/models"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type publisherV1 struct {
+    ID        uint `gorm:"primaryKey"`
+    CreatedAt time.Time
+    UpdatedAt time.Time
+    Name      string `gorm:"size:255;not null"`
+    NameKey   string `gorm:"size:255;not null;uniqueIndex:idx_publishers_name_key"`
+}
+
+func (publisherV1) TableName() string {
+    return "publishers"
+}
+
+type genreV1 struct {
+    ID        uint `gorm:"primaryKey"`
+    CreatedAt time.Time
+    UpdatedAt time.Time
+    Name      string `gorm:"size:255;not null"`
+    NameKey   string `gorm:"size:255;not null;uniqueIndex:idx_genres_name_key"`
+    ParentID  *uint  `gorm:"index:idx_genres_parent_id"`
+}
+
+func (genreV1) TableName() string {
+    return "genres"
+}
+
+// bookV4 refers to the publisher and genre by ID. The names are kept in the
+// publisher and genre columns, so that filtering and search keep working.
+type bookV4 struct {
+    bookV3
+    GenreID     *uint `gorm:"index:idx_books_genre_id"`
+    PublisherID *uint `gorm:"index:idx_books_publisher_id"`
+}
+
+func init() {
+    register(Migration{
+        Version: 5,
+        Name:    "taxonomies",
+        Up: func(tx *gorm.DB) error {
+            if err := tx.Migrator().CreateTable(&publisherV1{}, &genreV1{}); err != nil {
+                return err
+            }
+            for _, field := range []string{"GenreID", "PublisherID"} {
+                if err := tx.Migrator().AddColumn(&bookV4{}, field); err != nil {
+                    return err
+                }
+            }
+            for _, index := range []string{"idx_books_genre_id", "idx_books_publisher_id"} {
+                if err := tx.Migrator().CreateIndex(&bookV4{}, index); err != nil {
+                    return err
+                }
+            }
+
+            // Names that only differ in case or whitespace become one publisher
+            // or genre, named like on the oldest book.
+            var books []bookV1
+            if err := tx.Unscoped().Select("id", "genre", "publisher").Order("id").Find(&books).Error; err != nil {
+                return err
+            }
+            publishers, genres := map[string]uint{}, map[string]uint{}
+            for _, book := range books {
+                updates := map[string]interface{}{}
+                normalized := models.Publisher{Name: book.Publisher}
+                if normalized.Normalize(); normalized.NameKey != "" {
+                    publisher := publisherV1{Name: normalized.Name, NameKey: normalized.NameKey}
+                    if id, ok := publishers[publisher.NameKey]; ok {
+                        publisher.ID = id
+                    } else if err := tx.Create(&publisher).Error; err != nil {
+                        return err
+                    }
+                    publishers[publisher.NameKey] = publisher.ID
+                    updates["publisher_id"] = publisher.ID
+                }
+
+                var parentID *uint
+                for _, name := range models.SplitGenrePath(book.Genre) {
+                    genre := genreV1{Name: name, NameKey: models.TermKey(name), ParentID: parentID}
+                    if id, ok := genres[genre.NameKey]; ok {
+                        genre.ID = id
+                    } else if err := tx.Create(&genre).Error; err != nil {
+                        return err
+                    }
+                    genres[genre.NameKey] = genre.ID
+                    parentID = &genre.ID
+                    updates["genre_id"] = genre.ID
+                }
+
+                if len(updates) == 0 {
+                    continue
+                }
+                if err := tx.Table("books").Where("id = ?", book.ID).Updates(updates).Error; err != nil {
+                    return err
+                }
+            }
+
+            // Books keep their names, but use the spelling of the publisher or genre.
+            for table, column := range map[string]string{"publishers": "publisher", "genres": "genre"} {
+                name := fmt.Sprintf("(SELECT name FROM %s WHERE %s.id = books.%s_id)", table, table, column)
+                err := tx.Exec(fmt.Sprintf("UPDATE books SET %s = %s, version = version + 1 WHERE %s_id IS NOT NULL AND %s <> %s",
+                    column, name, column, column, name)).Error
+                if err != nil {
+                    return err
+                }
+            }
+            return nil
+        },
+        Down: func(tx *gorm.DB) error {
+            for _, index := range []string{"idx_books_genre_id", "idx_books_publisher_id"} {
+                if err := tx.Migrator().DropIndex(&bookV4{}, index); err != nil {
+                    return err
+                }
+            }
+            for _, column := range []string{"genre_id", "publisher_id"} {
+                if err := dropColumn(tx, "books", column); err != nil {
+                    return err
+                }
+            }
+            return tx.Migrator().DropTable(&publisherV1{}, &genreV1{})
+        },
+    })
+}
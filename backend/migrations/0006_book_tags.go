@@ -0,0 +1,27 @@
+package migrations
+
+import (
+	"gorm.io/gorm"
+)
+
+type bookTagV1 struct {
+    BookID uint   `gorm:"primaryKey;autoIncrement:false"`
+    Tag    string `gorm:"primaryKey;size:50;index:idx_book_tags_tag"`
+}
+
+func (bookTagV1) TableName() string {
+    return "book_tags"
+}
+
+func init() {
+    register(Migration{
+        Version: 6,
+        Name:    "book_tags",
+        Up: func(tx *gorm.DB) error {
+            return tx.Migrator().CreateTable(&bookTagV1{})
+        },
+        Down: func(tx *gorm.DB) error {
+            return tx.Migrator().DropTable(&bookTagV1{})
+        },
+    })
+}
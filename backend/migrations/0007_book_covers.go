@@ -0,0 +1,34 @@
+package migrations
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type bookCoverV1 struct {
+    BookID      uint   `gorm:"primaryKey;autoIncrement:false"`
+    ContentType string `gorm:"size:50;not null"`
+    Size        int64
+    Width       int
+    Height      int
+    Checksum    string `gorm:"size:64;not null"`
+    UpdatedAt   time.Time
+}
+
+func (bookCoverV1) TableName() string {
+    return "book_covers"
+}
+
+func init() {
+    register(Migration{
+        Version: 7,
+        Name:    "book_covers",
+        Up: func(tx *gorm.DB) error {
+            return tx.Migrator().CreateTable(&bookCoverV1{})
+        },
+        Down: func(tx *gorm.DB) error {
+            return tx.Migrator().DropTable(&bookCoverV1{})
+        },
+    })
+}
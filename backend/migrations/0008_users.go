@@ -0,0 +1,45 @@
+package migrations
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type userV1 struct {
+    ID           uint `gorm:"primaryKey"`
+    CreatedAt    time.Time
+    UpdatedAt    time.Time
+    Username     string `gorm:"size:50;not null;uniqueIndex:idx_users_username"`
+    PasswordHash string `gorm:"size:60;not null"`
+}
+
+func (userV1) TableName() string {
+    return "users"
+}
+
+type sessionV1 struct {
+    ID        string `gorm:"primaryKey;size:32"`
+    UserID    uint   `gorm:"not null;index:idx_sessions_user_id"`
+    RefreshID string `gorm:"size:32;not null"`
+    CreatedAt time.Time
+    ExpiresAt time.Time
+    RevokedAt *time.Time
+}
+
+func (sessionV1) TableName() string {
+    return "sessions"
+}
+
+func init() {
+    register(Migration{
+        Version: 8,
+        Name:    "users",
+        Up: func(tx *gorm.DB) error {
+            return tx.Migrator().CreateTable(&userV1{}, &sessionV1{})
+        },
+        Down: func(tx *gorm.DB) error {
+            return tx.Migrator().DropTable(&sessionV1{}, &userV1{})
+        },
+    })
+}
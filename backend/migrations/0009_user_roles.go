@@ -0,0 +1,37 @@
+package migrations
+
+import (
+	"gorm.io/gorm"
+)
+
+type userV2 struct {
+    userV1
+    Role string `gorm:"size:20;not null;default:viewer"`
+}
+
+func (userV2) TableName() string {
+    return "users"
+}
+
+func init() {
+    register(Migration{
+        Version: 9,
+        Name:    "user_roles",
+        Up: func(tx *gorm.DB) error {
+            if err := tx.Migrator().AddColumn(&userV2{}, "Role"); err != nil {
+                return err
+            }
+
+            // The first user becomes an admin, so that someone can assign roles.
+            var first userV1
+            err := tx.Order("id").Limit(1).Find(&first).Error
+            if err != nil || first.ID == 0 {
+                return err
+            }
+            return tx.Model(&userV2{}).Where("id = ?", first.ID).Update("role", "admin").Error
+        },
+        Down: func(tx *gorm.DB) error {
+            return dropColumn(tx, "users", "role")
+        },
+    })
+}
@@ -0,0 +1,38 @@
+package migrations
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type apiKeyV1 struct {
+    ID         uint `gorm:"primaryKey"`
+    CreatedAt  time.Time
+    Name       string `gorm:"size:100;not null"`
+    Prefix     string `gorm:"size:16;not null"`
+    Hash       string `gorm:"size:64;not null;uniqueIndex:idx_api_keys_hash"`
+    Scopes     string `gorm:"size:255;not null"` // JSON array
+    CreatedBy  uint   `gorm:"not null"`
+    ExpiresAt  *time.Time
+    LastUsedAt *time.Time
+    RotatedAt  *time.Time
+    RevokedAt  *time.Time
+}
+
+func (apiKeyV1) TableName() string {
+    return "api_keys"
+}
+
+func init() {
+    register(Migration{
+        Version: 10,
+        Name:    "api_keys",
+        Up: func(tx *gorm.DB) error {
+            return tx.Migrator().CreateTable(&apiKeyV1{})
+        },
+        Down: func(tx *gorm.DB) error {
+            return tx.Migrator().DropTable(&apiKeyV1{})
+        },
+    })
+}
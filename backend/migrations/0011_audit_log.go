@@ -0,0 +1,38 @@
+package migrations
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type auditEntryV1 struct {
+    ID        uint      `gorm:"primaryKey"`
+    CreatedAt time.Time `gorm:"index:idx_audit_entries_created_at"`
+    BookID    uint      `gorm:"not null;index:idx_audit_entries_book_id"`
+    Version   uint      `gorm:"not null"`
+    Action    string    `gorm:"size:20;not null"`
+    Actor     string    `gorm:"size:50;not null;index:idx_audit_entries_actor"`
+    ActorName string    `gorm:"size:100;not null"`
+    RequestID string    `gorm:"size:100"`
+    Before    string    `gorm:"type:text"` // JSON of the book
+    After     string    `gorm:"type:text"`
+    Changes   string    `gorm:"type:text"`
+}
+
+func (auditEntryV1) TableName() string {
+    return "audit_entries"
+}
+
+func init() {
+    register(Migration{
+        Version: 11,
+        Name:    "audit_log",
+        Up: func(tx *gorm.DB) error {
+            return tx.Migrator().CreateTable(&auditEntryV1{})
+        },
+        Down: func(tx *gorm.DB) error {
+            return tx.Migrator().DropTable(&auditEntryV1{})
+        },
+    })
+}
@@ -0,0 +1,205 @@
+package migrations
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ErrSchemaAhead is returned when the database has migrations applied that
+// this build doesn't know about, i.e. it was migrated by a newer version.
+var ErrSchemaAhead = errors.New("database schema is newer than this build")
+
+// Migration is a numbered, reversible schema change. Up and Down run inside a
+// transaction together with the bookkeeping in schema_migrations. Note that
+// MySQL commits DDL statements implicitly.
+type Migration struct {
+    Version int
+    Name    string
+    Up      func(tx *gorm.DB) error
+    Down    func(tx *gorm.DB) error
+}
+
+// appliedMigration is a row of the schema_migrations table.
+type appliedMigration struct {
+    Version   int       `gorm:"primaryKey;autoIncrement:false"`
+    Name      string    `gorm:"size:255"`
+    AppliedAt time.Time
+}
+
+func (appliedMigration) TableName() string {
+    return "schema_migrations"
+}
+
+// Status describes a migration known to the build or recorded in the database.
+type Status struct {
+    Version   int
+    Name      string
+    Applied   bool
+    AppliedAt time.Time
+    Unknown   bool // recorded in the database but not part of this build
+}
+
+var registry []Migration
+
+// register adds a migration. It is called from the init functions of the
+// numbered migration files.
+func register(m Migration) {
+    for _, existing := range registry {
+        if existing.Version == m.Version {
+            panic(fmt.Sprintf("migration %d registered twice", m.Version))
+        }
+    }
+    registry = append(registry, m)
+    sort.Slice(registry, func(i, j int) bool { return registry[i].Version < registry[j].Version })
+}
+
+// All returns the migrations of this build in order.
+func All() []Migration {
+    return append([]Migration(nil), registry...)
+}
+
+// Latest returns the version of the newest migration of this build.
+func Latest() int {
+    if len(registry) == 0 {
+        return 0
+    }
+    return registry[len(registry)-1].Version
+}
+
+func applied(db *gorm.DB) (map[int]appliedMigration, error) {
+    if err := db.AutoMigrate(&appliedMigration{}); err != nil {
+        return nil, err
+    }
+    var rows []appliedMigration
+    if err := db.Find(&rows).Error; err != nil {
+        return nil, err
+    }
+    versions := map[int]appliedMigration{}
+    for _, row := range rows {
+        versions[row.Version] = row
+    }
+    return versions, nil
+}
+
+// dropColumn drops a column with ALTER TABLE, which PostgreSQL, MySQL and
+// SQLite 3.35+ support. The SQLite migrator of GORM instead recreates the
+// table, losing its indexes and triggers.
+func dropColumn(tx *gorm.DB, table, column string) error {
+    return tx.Exec("ALTER TABLE ? DROP COLUMN ?", clause.Table{Name: table}, clause.Column{Name: column}).Error
+}
+
+// Check returns ErrSchemaAhead if the database has migrations applied that are
+// unknown to this build.
+func Check(db *gorm.DB) error {
+    versions, err := applied(db)
+    if err != nil {
+        return err
+    }
+    for version := range versions {
+        if !known(version) {
+            return fmt.Errorf("%w: migration %d is applied but this build only knows migrations up to %d", ErrSchemaAhead, version, Latest())
+        }
+    }
+    return nil
+}
+
+func known(version int) bool {
+    for _, m := range registry {
+        if m.Version == version {
+            return true
+        }
+    }
+    return false
+}
+
+// Up applies all pending migrations in order and returns them.
+func Up(db *gorm.DB) ([]Migration, error) {
+    if err := Check(db); err != nil {
+        return nil, err
+    }
+    versions, err := applied(db)
+    if err != nil {
+        return nil, err
+    }
+
+    var done []Migration
+    for _, m := range registry {
+        if _, ok := versions[m.Version]; ok {
+            continue
+        }
+        err := db.Transaction(func(tx *gorm.DB) error {
+            if err := m.Up(tx); err != nil {
+                return err
+            }
+            return tx.Create(&appliedMigration{Version: m.Version, Name: m.Name, AppliedAt: time.Now()}).Error
+        })
+        if err != nil {
+            return done, fmt.Errorf("migration %d (%s) failed: %w", m.Version, m.Name, err)
+        }
+        done = append(done, m)
+    }
+    return done, nil
+}
+
+// Down rolls back the most recently applied migration and returns it, or nil
+// if no migration is applied.
+func Down(db *gorm.DB) (*Migration, error) {
+    if err := Check(db); err != nil {
+        return nil, err
+    }
+    versions, err := applied(db)
+    if err != nil {
+        return nil, err
+    }
+
+    for i := len(registry) - 1; i >= 0; i-- {
+        m := registry[i]
+        if _, ok := versions[m.Version]; !ok {
+            continue
+        }
+        err := db.Transaction(func(tx *gorm.DB) error {
+            if err := m.Down(tx); err != nil {
+                return err
+            }
+            return tx.Delete(&appliedMigration{}, m.Version).Error
+        })
+        if err != nil {
+            return nil, fmt.Errorf("rolling back migration %d (%s) failed: %w", m.Version, m.Name, err)
+        }
+        return &m, nil
+    }
+    return nil, nil
+}
+
+// List returns the status of every migration of this build, followed by
+// migrations recorded in the database that this build doesn't know.
+func List(db *gorm.DB) ([]Status, error) {
+    versions, err := applied(db)
+    if err != nil {
+        return nil, err
+    }
+
+    var statuses []Status
+    for _, m := range registry {
+        status := Status{Version: m.Version, Name: m.Name}
+        if row, ok := versions[m.Version]; ok {
+            status.Applied, status.AppliedAt = true, row.AppliedAt
+        }
+        statuses = append(statuses, status)
+    }
+
+    var unknown []Status
+    for version, row := range versions {
+        if !known(version) {
+            unknown = append(unknown, Status{Version: version, Name: row.Name, Applied: true, AppliedAt: row.AppliedAt, Unknown: true})
+        }
+    }
+    sort.Slice(unknown, func(i, j int) bool { return unknown[i].Version < unknown[j].Version })
+
+    return append(statuses, unknown...), nil
+}
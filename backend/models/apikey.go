@@ -0,0 +1,57 @@
+package models
+
+import (
+	"time"
+)
+
+// API key scopes, each allowing a group of routes, see handlers.APIKeyScopes.
+const (
+    ScopeBooksRead   = "books:read"   // reads books and the records they refer to
+    ScopeBooksWrite  = "books:write"  // adds and changes them, like an editor
+    ScopeURLsProcess = "urls:process" // cleans up URLs
+)
+
+// Scopes are the valid scopes of API keys.
+var Scopes = []string{ScopeBooksRead, ScopeBooksWrite, ScopeURLsProcess}
+
+// APIKey lets a script call the API without signing in. Only the hash of the
+// key is stored; the key itself is shown once when it is created or rotated.
+// @Description An API key. The key itself is only returned when it is created or rotated.
+type APIKey struct {
+    ID         uint       `gorm:"primaryKey" json:"id"`
+    CreatedAt  time.Time  `json:"createdAt"`
+    Name       string     `gorm:"size:100;not null" json:"name"`
+    Prefix     string     `gorm:"size:16;not null" json:"prefix"` // First characters of the key, to tell keys apart
+    Hash       string     `gorm:"size:64;not null;uniqueIndex" json:"-"`
+    Scopes     []string   `gorm:"serializer:json;size:255;not null" json:"scopes"`
+    CreatedBy  uint       `gorm:"not null" json:"createdBy"` // ID of the admin who created the key
+    ExpiresAt  *time.Time `json:"expiresAt,omitempty"`       // The key never expires if not set
+    LastUsedAt *time.Time `json:"lastUsedAt,omitempty"`      // Updated at most once a minute
+    RotatedAt  *time.Time `json:"rotatedAt,omitempty"`
+    RevokedAt  *time.Time `json:"revokedAt,omitempty"`
+}
+
+// Active reports whether the key can be used at now.
+func (k *APIKey) Active(now time.Time) bool {
+    return k.RevokedAt == nil && (k.ExpiresAt == nil || now.Before(*k.ExpiresAt))
+}
+
+// HasScope reports whether the key was granted scope.
+func (k *APIKey) HasScope(scope string) bool {
+    for _, s := range k.Scopes {
+        if s == scope {
+            return true
+        }
+    }
+    return false
+}
+
+// ValidScope reports whether scope is one of Scopes.
+func ValidScope(scope string) bool {
+    for _, s := range Scopes {
+        if s == scope {
+            return true
+        }
+    }
+    return false
+}
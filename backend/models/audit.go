@@ -0,0 +1,80 @@
+package models
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// Audited actions on books.
+const (
+    AuditCreate  = "create"
+    AuditUpdate  = "update"
+    AuditDelete  = "delete"  // moved to the trash
+    AuditRestore = "restore" // moved out of the trash
+    AuditPurge   = "purge"   // deleted permanently
+    AuditRevert  = "revert"  // updated to the state of an earlier version
+)
+
+// AuditEntry records a change of a book: who made it, in which request, and
+// the book before and after it.
+// @Description A change of a book. Before is null for created books and After for purged ones.
+type AuditEntry struct {
+    ID        uint          `gorm:"primaryKey" json:"id"`
+    CreatedAt time.Time     `gorm:"index" json:"createdAt"`
+    BookID    uint          `gorm:"not null;index" json:"bookId"`
+    Version   uint          `gorm:"not null" json:"version"` // Version of the book after the change, or before it was purged
+    Action    string        `gorm:"size:20;not null" json:"action" enums:"create,update,delete,restore,purge,revert"`
+    Actor     string        `gorm:"size:50;not null;index" json:"actor"` // user:<id> or api-key:<id>
+    ActorName string        `gorm:"size:100;not null" json:"actorName"`  // Username or name of the API key
+    RequestID string        `gorm:"size:100" json:"requestId"`
+    Before    *Book         `gorm:"serializer:json;type:text" json:"before"`
+    After     *Book         `gorm:"serializer:json;type:text" json:"after"`
+    Changes   []FieldChange `gorm:"serializer:json;type:text" json:"changes"`
+}
+
+// FieldChange is the old and new value of a field of a book, by its JSON
+// name. A value is null if the field was empty or the book didn't exist.
+type FieldChange struct {
+    Field  string      `json:"field"`
+    Before interface{} `json:"before"`
+    After  interface{} `json:"after"`
+}
+
+// unaudited fields change on every save, so they aren't listed in Changes.
+var unaudited = map[string]bool{"updatedAt": true, "version": true}
+
+// DiffBooks returns the fields that differ between before and after, either
+// of which may be nil, in the order they are declared in Book.
+func DiffBooks(before, after *Book) []FieldChange {
+    beforeFields, afterFields := bookFields(before), bookFields(after)
+    changes := []FieldChange{}
+    bookType := reflect.TypeOf(Book{})
+    for i := 0; i < bookType.NumField(); i++ {
+        name := strings.SplitN(bookType.Field(i).Tag.Get("json"), ",", 2)[0]
+        if unaudited[name] {
+            continue
+        }
+        if !reflect.DeepEqual(beforeFields[name], afterFields[name]) {
+            changes = append(changes, FieldChange{Field: name, Before: beforeFields[name], After: afterFields[name]})
+        }
+    }
+    return changes
+}
+
+// bookFields returns the JSON fields of book. Empty fields are left out.
+func bookFields(book *Book) map[string]interface{} {
+    fields := map[string]interface{}{}
+    if book == nil {
+        return fields
+    }
+    data, _ := json.Marshal(book)
+    json.Unmarshal(data, &fields)
+    for name, value := range fields {
+        if value == nil {
+            delete(fields, name)
+        }
+    }
+    return fields
+}
@@ -0,0 +1,91 @@
+package models
+
+import (
+	"regexp"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Author is a person credited on books
+// @Description An author, editor or translator of books
+type Author struct {
+    ID        uint      `gorm:"primaryKey" json:"id"`
+    CreatedAt time.Time `json:"createdAt"`
+    UpdatedAt time.Time `json:"updatedAt"`
+    Name      string    `gorm:"size:255;not null" json:"name" validate:"required,min=2"`
+    NameKey   string    `gorm:"size:255;not null;uniqueIndex" json:"-"`
+    Bio       string    `json:"bio,omitempty"`
+}
+
+// Roles in which an author can be credited on a book.
+const (
+    RoleAuthor     = "author"
+    RoleEditor     = "editor"
+    RoleTranslator = "translator"
+)
+
+// Roles are the valid values of BookAuthor.Role.
+var Roles = []string{RoleAuthor, RoleEditor, RoleTranslator}
+
+// BookAuthor credits an author on a book in a role. Position orders the
+// credits of a book.
+type BookAuthor struct {
+    BookID   uint   `gorm:"primaryKey;autoIncrement:false" json:"bookId"`
+    AuthorID uint   `gorm:"primaryKey;autoIncrement:false;index" json:"authorId"`
+    Role     string `gorm:"primaryKey;size:20" json:"role"`
+    Position int    `json:"position"`
+}
+
+// Contributor is a credit of a book together with the author's name.
+type Contributor struct {
+    AuthorID uint   `json:"authorId"`
+    Name     string `json:"name"`
+    Role     string `json:"role"`
+}
+
+var (
+    spaces         = regexp.MustCompile(`\s+`)
+    nameSeparators = regexp.MustCompile(`\s*(?:;|&|\band\b)\s*`)
+)
+
+// AuthorNameKey returns the key under which author names are deduplicated:
+// the name in lower case without whitespace and periods, so that
+// "J. R. R. Tolkien" and "jrr tolkien" are the same author.
+func AuthorNameKey(name string) string {
+    return strings.Map(func(r rune) rune {
+        if r == '.' || unicode.IsSpace(r) {
+            return -1
+        }
+        return unicode.ToLower(r)
+    }, name)
+}
+
+// Normalize collapses whitespace in the name and derives NameKey from it.
+func (a *Author) Normalize() {
+    a.Name = strings.TrimSpace(spaces.ReplaceAllString(a.Name, " "))
+    a.NameKey = AuthorNameKey(a.Name)
+}
+
+// SplitAuthorNames splits the author string of a book, e.g. "Terry Pratchett &
+// Neil Gaiman", into names. Commas are kept, since they are used in
+// "Last, First" names.
+func SplitAuthorNames(authors string) []string {
+    var names []string
+    seen := map[string]bool{}
+    for _, name := range nameSeparators.Split(authors, -1) {
+        name = strings.TrimSpace(spaces.ReplaceAllString(name, " "))
+        key := AuthorNameKey(name)
+        if key == "" || seen[key] {
+            continue
+        }
+        seen[key] = true
+        names = append(names, name)
+    }
+    return names
+}
+
+// JoinAuthorNames is the inverse of SplitAuthorNames.
+func JoinAuthorNames(names []string) string {
+    return strings.Join(names, " & ")
+}
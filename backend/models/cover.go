@@ -0,0 +1,43 @@
+package models
+
+import (
+	"fmt"
+	"image"
+	"time"
+)
+
+// Cover sizes. The original is stored as uploaded, the other sizes are JPEG
+// thumbnails generated from it.
+const (
+    CoverOriginal = "original"
+    CoverMedium   = "medium"
+    CoverThumb    = "thumb"
+)
+
+// CoverThumbnails are the boxes the thumbnails of each size fit into,
+// keeping the aspect ratio of the original. Smaller images aren't enlarged.
+var CoverThumbnails = map[string]image.Point{
+    CoverMedium: {X: 400, Y: 600},
+    CoverThumb:  {X: 160, Y: 240},
+}
+
+// CoverSizes lists every size of a cover, the original first.
+var CoverSizes = []string{CoverOriginal, CoverMedium, CoverThumb}
+
+// BookCover describes the cover image of a book. The images are kept in a
+// blob store under the keys returned by Key.
+type BookCover struct {
+    BookID      uint      `gorm:"primaryKey;autoIncrement:false" json:"bookId"`
+    ContentType string    `gorm:"size:50;not null" json:"contentType"` // of the original
+    Size        int64     `json:"size"`                                // of the original in bytes
+    Width       int       `json:"width"`
+    Height      int       `json:"height"`
+    Checksum    string    `gorm:"size:64;not null" json:"checksum"` // SHA-256 of the original
+    UpdatedAt   time.Time `json:"updatedAt"`
+}
+
+// Key returns the blob key of the image of the given size. Keys include the
+// checksum, so that a new cover never overwrites the images of the old one.
+func (c *BookCover) Key(size string) string {
+    return fmt.Sprintf("covers/%d/%s/%s", c.BookID, c.Checksum, size)
+}
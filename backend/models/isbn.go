@@ -0,0 +1,86 @@
+package models
+
+import (
+	"errors"
+	"strings"
+)
+
+var (
+    ErrISBNLength   = errors.New("ISBN must have 10 or 13 digits")
+    ErrISBNChecksum = errors.New("ISBN check digit is wrong")
+    ErrISBNPrefix   = errors.New("ISBN-13 must start with 978 or 979")
+)
+
+// NormalizeISBN checks an ISBN-10 or ISBN-13 and returns it as the 13 digits
+// of the ISBN-13. Hyphens and spaces are ignored, and an ISBN-10 may end in X.
+func NormalizeISBN(isbn string) (string, error) {
+    digits := strings.Map(func(r rune) rune {
+        if r == '-' || r == ' ' {
+            return -1
+        }
+        if r == 'x' {
+            return 'X'
+        }
+        return r
+    }, isbn)
+
+    switch len(digits) {
+    case 10:
+        sum := 0
+        for i, r := range digits {
+            var d int
+            switch {
+            case r >= '0' && r <= '9':
+                d = int(r - '0')
+            case r == 'X' && i == 9:
+                d = 10
+            default:
+                return "", ErrISBNLength
+            }
+            sum += (10 - i) * d
+        }
+        if sum%11 != 0 {
+            return "", ErrISBNChecksum
+        }
+        isbn13 := "978" + digits[:9]
+        return isbn13 + isbn13CheckDigit(isbn13), nil
+    case 13:
+        for _, r := range digits {
+            if r < '0' || r > '9' {
+                return "", ErrISBNLength
+            }
+        }
+        if !strings.HasPrefix(digits, "978") && !strings.HasPrefix(digits, "979") {
+            return "", ErrISBNPrefix
+        }
+        if isbn13CheckDigit(digits[:12]) != digits[12:] {
+            return "", ErrISBNChecksum
+        }
+        return digits, nil
+    default:
+        return "", ErrISBNLength
+    }
+}
+
+// isbn13CheckDigit returns the check digit for the first 12 digits of an ISBN-13.
+func isbn13CheckDigit(digits string) string {
+    sum := 0
+    for i, r := range digits[:12] {
+        weight := 1
+        if i%2 == 1 {
+            weight = 3
+        }
+        sum += weight * int(r-'0')
+    }
+    return string(rune('0' + (10-sum%10)%10))
+}
+
+// Normalize trims the ISBN, which is kept in the form it was entered in, and
+// derives ISBN13 from it. ISBN13 is nil for a missing or invalid ISBN.
+func (b *Book) Normalize() {
+    b.ISBN = strings.TrimSpace(b.ISBN)
+    b.ISBN13 = nil
+    if isbn13, err := NormalizeISBN(b.ISBN); err == nil {
+        b.ISBN13 = &isbn13
+    }
+}
@@ -1,30 +1,42 @@
 package models
 
-import "time"
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
 
 // Book represents a book with metadata
 // @Description Book object which includes basic book information along with metadata from gorm Model
 // @Property id int "The unique identifier of the book"
 // @Property createdAt string "The time at which the book record was created"
 // @Property updatedAt string "The time at which the book record was last updated"
-// @Property deletedAt string "The time at which the book record was deleted, if applicable"
+// @Property version int "Incremented on every change, the ETag of the book is derived from it"
+// @Property deletedAt string "The time at which the book record was moved to the trash, if applicable"
 // @Property title string "The title of the book, required, minimum 2 characters"
 // @Property author string "The author of the book, required, minimum 2 characters"
 // @Property year int "The publication year of the book, required"
-// @Property genre string "The genre of the book"
-// @Property isbn string "The International Standard Book Number of the book"
-// @Property publisher string "The publisher of the book"
+// @Property genre string "The name of the genre of the book. A path such as Fiction > Fantasy > Epic creates missing genres"
+// @Property genreId int "The ID of the genre of the book"
+// @Property isbn string "The International Standard Book Number of the book as entered, ISBN-10 or ISBN-13"
+// @Property isbn13 string "The ISBN normalized to ISBN-13, derived from isbn and unique among all books"
+// @Property publisher string "The name of the publisher of the book. Unknown publishers are created"
+// @Property publisherId int "The ID of the publisher of the book"
 // @Property description string "A brief description of the book"
 type Book struct {
-    ID          uint      `gorm:"primaryKey" json:"id"`
-    CreatedAt   time.Time `json:"createdAt"`
-    UpdatedAt   time.Time `json:"updatedAt"`
-    DeletedAt   *time.Time `gorm:"index" json:"deletedAt,omitempty"`
-    Title       string    `json:"title" validate:"required,min=2"`
-    Author      string    `json:"author" validate:"required,min=2"`
-    Year        int       `json:"year" validate:"required"`
-    Genre       string    `json:"genre,omitempty"`
-    ISBN        string    `json:"isbn,omitempty"`
-    Publisher   string    `json:"publisher,omitempty"`
-    Description string    `json:"description,omitempty"`
-}
\ No newline at end of file
+    ID          uint           `gorm:"primaryKey" json:"id"`
+    CreatedAt   time.Time      `json:"createdAt"`
+    UpdatedAt   time.Time      `json:"updatedAt"`
+    DeletedAt   gorm.DeletedAt `gorm:"index" json:"deletedAt" swaggertype:"string" format:"date-time"`
+    Version     uint           `gorm:"not null;default:1" json:"version" readonly:"true"`
+    Title       string         `json:"title" validate:"required,min=2"`
+    Author      string         `json:"author" validate:"required,min=2"`
+    Year        int            `json:"year" validate:"required"`
+    Genre       string         `json:"genre,omitempty"`
+    GenreID     *uint          `gorm:"index" json:"genreId,omitempty"`
+    ISBN        string         `json:"isbn,omitempty" validate:"omitempty,isbn"`
+    ISBN13      *string        `gorm:"column:isbn13;uniqueIndex" json:"isbn13,omitempty" readonly:"true"`
+    Publisher   string         `json:"publisher,omitempty"`
+    PublisherID *uint          `gorm:"index" json:"publisherId,omitempty"`
+    Description string         `json:"description,omitempty"`
+}
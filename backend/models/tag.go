@@ -0,0 +1,32 @@
+package models
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+)
+
+// MaxTagLength is the maximum length of a tag in characters.
+const MaxTagLength = 50
+
+// ErrInvalidTag is returned by NormalizeTag for tags that are empty, too long
+// or contain characters other than letters, digits, '-', '_' and ':'.
+var ErrInvalidTag = errors.New("tags must be 1 to 50 letters, digits, '-', '_' or ':', starting with a letter or digit")
+
+var tagPattern = regexp.MustCompile(`^[\p{L}\p{N}][\p{L}\p{N}_:-]*$`)
+
+// BookTag attaches a tag to a book.
+type BookTag struct {
+    BookID uint   `gorm:"primaryKey;autoIncrement:false"`
+    Tag    string `gorm:"primaryKey;size:50;index"`
+}
+
+// NormalizeTag returns tag in lower case with surrounding whitespace removed
+// and inner whitespace replaced by '-', so that "To Read" becomes "to-read".
+func NormalizeTag(tag string) (string, error) {
+    tag = strings.ToLower(spaces.ReplaceAllString(strings.TrimSpace(tag), "-"))
+    if !tagPattern.MatchString(tag) || len([]rune(tag)) > MaxTagLength {
+        return "", ErrInvalidTag
+    }
+    return tag, nil
+}
@@ -0,0 +1,62 @@
+package models
+
+import (
+	"strings"
+	"time"
+)
+
+// GenrePathSeparator separates the levels of a genre path such as
+// "Fiction > Fantasy > Epic".
+const GenrePathSeparator = ">"
+
+// Publisher is a publisher of books
+// @Description A publisher books refer to by ID
+type Publisher struct {
+    ID        uint      `gorm:"primaryKey" json:"id"`
+    CreatedAt time.Time `json:"createdAt"`
+    UpdatedAt time.Time `json:"updatedAt"`
+    Name      string    `gorm:"size:255;not null" json:"name" validate:"required,min=2"`
+    NameKey   string    `gorm:"size:255;not null;uniqueIndex" json:"-"`
+}
+
+// Genre is a node in the genre hierarchy
+// @Description A genre books refer to by ID. Genres form a tree through parentId.
+type Genre struct {
+    ID        uint      `gorm:"primaryKey" json:"id"`
+    CreatedAt time.Time `json:"createdAt"`
+    UpdatedAt time.Time `json:"updatedAt"`
+    Name      string    `gorm:"size:255;not null" json:"name" validate:"required,min=2,excludes=>"`
+    NameKey   string    `gorm:"size:255;not null;uniqueIndex" json:"-"`
+    ParentID  *uint     `gorm:"index" json:"parentId,omitempty"`
+}
+
+// TermKey returns the key under which publisher and genre names are
+// deduplicated: the name in lower case with whitespace collapsed, so that
+// "Penguin" and "penguin" are the same publisher.
+func TermKey(name string) string {
+    return strings.ToLower(spaces.ReplaceAllString(strings.TrimSpace(name), " "))
+}
+
+// Normalize collapses whitespace in the name and derives NameKey from it.
+func (p *Publisher) Normalize() {
+    p.Name = strings.TrimSpace(spaces.ReplaceAllString(p.Name, " "))
+    p.NameKey = TermKey(p.Name)
+}
+
+// Normalize collapses whitespace in the name and derives NameKey from it.
+func (g *Genre) Normalize() {
+    g.Name = strings.TrimSpace(spaces.ReplaceAllString(g.Name, " "))
+    g.NameKey = TermKey(g.Name)
+}
+
+// SplitGenrePath splits a genre path such as "Fiction > Fantasy > Epic" into
+// its names, root first. A plain genre name is a path of one.
+func SplitGenrePath(path string) []string {
+    var names []string
+    for _, name := range strings.Split(path, GenrePathSeparator) {
+        if name = strings.TrimSpace(spaces.ReplaceAllString(name, " ")); name != "" {
+            names = append(names, name)
+        }
+    }
+    return names
+}
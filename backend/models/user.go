@@ -0,0 +1,83 @@
+package models
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Password length limits. bcrypt ignores everything after 72 bytes.
+const (
+    MinPasswordLength = 8
+    MaxPasswordLength = 72
+)
+
+// ErrInvalidUsername is returned by NormalizeUsername for usernames that are
+// too short, too long or contain other characters than letters, digits, '.',
+// '-' and '_'.
+var ErrInvalidUsername = errors.New("usernames must be 3 to 50 letters, digits, '.', '-' or '_'")
+
+var usernamePattern = regexp.MustCompile(`^[a-z0-9._-]{3,50}$`)
+
+// User roles, each allowed to do everything the previous one can.
+const (
+    UserViewer = "viewer" // reads the catalog
+    UserEditor = "editor" // adds and changes books and the records they refer to
+    UserAdmin  = "admin"  // deletes and purges books and manages users
+)
+
+// UserRoles are the valid values of User.Role, from least to most privileged.
+var UserRoles = []string{UserViewer, UserEditor, UserAdmin}
+
+// RoleAllows reports whether role includes the permissions of required.
+// Unknown roles allow nothing.
+func RoleAllows(role, required string) bool {
+    rank := func(role string) int {
+        for i, r := range UserRoles {
+            if r == role {
+                return i
+            }
+        }
+        return -1
+    }
+    return rank(role) >= 0 && rank(role) >= rank(required)
+}
+
+// User is an account that can sign in to change the catalog
+// @Description A user account with its role. The password hash is never returned.
+type User struct {
+    ID           uint      `gorm:"primaryKey" json:"id"`
+    CreatedAt    time.Time `json:"createdAt"`
+    UpdatedAt    time.Time `json:"updatedAt"`
+    Username     string    `gorm:"size:50;not null;uniqueIndex" json:"username"`
+    PasswordHash string    `gorm:"size:60;not null" json:"-"`
+    Role         string    `gorm:"size:20;not null;default:viewer" json:"role" enums:"viewer,editor,admin"`
+}
+
+// Session is a sign-in of a user. Its tokens are valid until it expires or is
+// revoked. RefreshID identifies the only refresh token of the session that
+// can still be used.
+type Session struct {
+    ID        string     `gorm:"primaryKey;size:32"`
+    UserID    uint       `gorm:"not null;index"`
+    RefreshID string     `gorm:"size:32;not null"`
+    CreatedAt time.Time
+    ExpiresAt time.Time
+    RevokedAt *time.Time
+}
+
+// Active reports whether the tokens of the session can be used at now.
+func (s *Session) Active(now time.Time) bool {
+    return s.RevokedAt == nil && now.Before(s.ExpiresAt)
+}
+
+// NormalizeUsername returns username trimmed and in lower case, so that
+// usernames are unique regardless of case.
+func NormalizeUsername(username string) (string, error) {
+    username = strings.ToLower(strings.TrimSpace(username))
+    if !usernamePattern.MatchString(username) {
+        return "", ErrInvalidUsername
+    }
+    return username, nil
+}
@@ -0,0 +1,107 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// sweepInterval is how often MemoryStore drops the buckets of clients that
+// have been idle long enough for them to be full again.
+const sweepInterval = time.Minute
+
+type bucket struct {
+    tokens  float64   // tokens at updated
+    updated time.Time // last time a token was taken
+    full    time.Time // when the bucket is full again, after which it can be dropped
+}
+
+// MemoryStore is a Store keeping the buckets in memory.
+type MemoryStore struct {
+    mu        sync.Mutex
+    buckets   map[string]*bucket
+    lastSweep time.Time
+}
+
+// NewMemoryStore returns a store without buckets.
+func NewMemoryStore() *MemoryStore {
+    return &MemoryStore{buckets: map[string]*bucket{}}
+}
+
+func (s *MemoryStore) Take(ctx context.Context, key string, limit Limit, now time.Time) (Result, error) {
+    return s.check(key, limit, now, true), nil
+}
+
+func (s *MemoryStore) Peek(ctx context.Context, key string, limit Limit, now time.Time) (Result, error) {
+    return s.check(key, limit, now, false), nil
+}
+
+// check refills the bucket under key up to now and, if take is set, takes a
+// token from it.
+func (s *MemoryStore) check(key string, limit Limit, now time.Time, take bool) Result {
+    if !limit.Enabled() {
+        return Result{Allowed: true}
+    }
+    interval := limit.interval()
+    capacity := float64(limit.Requests)
+
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    s.sweep(now)
+
+    b, ok := s.buckets[key]
+    if !ok {
+        if !take {
+            return Result{Allowed: true, Remaining: limit.Requests}
+        }
+        b = &bucket{tokens: capacity, updated: now}
+        s.buckets[key] = b
+    }
+    tokens := b.tokens
+    if elapsed := now.Sub(b.updated); elapsed > 0 {
+        tokens += float64(elapsed) / float64(interval)
+        if tokens > capacity {
+            tokens = capacity
+        }
+    }
+
+    var result Result
+    if tokens >= 1 {
+        result.Allowed = true
+        if take {
+            tokens--
+        }
+    } else {
+        result.RetryAfter = time.Duration((1 - tokens) * float64(interval))
+    }
+    result.Remaining = int(tokens)
+    result.Reset = time.Duration((capacity - tokens) * float64(interval))
+    if take {
+        b.tokens, b.full = tokens, now.Add(result.Reset)
+        if now.After(b.updated) {
+            b.updated = now
+        }
+    }
+    return result
+}
+
+// sweep drops full buckets, at most once per sweepInterval. They behave
+// like missing ones.
+func (s *MemoryStore) sweep(now time.Time) {
+    if now.Sub(s.lastSweep) < sweepInterval {
+        return
+    }
+    s.lastSweep = now
+    for key, b := range s.buckets {
+        if !now.Before(b.full) {
+            delete(s.buckets, key)
+        }
+    }
+}
+
+// Len returns the number of buckets kept.
+func (s *MemoryStore) Len() int {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    return len(s.buckets)
+}
@@ -0,0 +1,105 @@
+// Package ratelimit limits how often clients may call the API, with a token
+// bucket per client.
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Limit allows Requests requests per Period. A client that was idle may send
+// up to Requests at once, after that the bucket refills evenly over Period.
+type Limit struct {
+    Requests int
+    Period   time.Duration
+}
+
+// Enabled reports whether the limit restricts anything. The zero Limit
+// doesn't.
+func (l Limit) Enabled() bool {
+    return l.Requests > 0 && l.Period > 0
+}
+
+// interval is the time it takes to refill one token.
+func (l Limit) interval() time.Duration {
+    return l.Period / time.Duration(l.Requests)
+}
+
+// String formats the limit as read by ParseLimit.
+func (l Limit) String() string {
+    if !l.Enabled() {
+        return "off"
+    }
+    period := l.Period.String()
+    if strings.HasSuffix(period, "m0s") {
+        period = strings.TrimSuffix(period, "0s")
+    }
+    if strings.HasSuffix(period, "h0m") {
+        period = strings.TrimSuffix(period, "0m")
+    }
+    return strconv.Itoa(l.Requests) + "/" + period
+}
+
+// ParseLimit reads a limit like "60/1m", 60 requests per minute. The period
+// defaults to a second, so "5" is 5 requests per second. "off", "0" and ""
+// disable the limit.
+func ParseLimit(s string) (Limit, error) {
+    s = strings.TrimSpace(s)
+    if s == "" || s == "off" || s == "0" {
+        return Limit{}, nil
+    }
+    requests, period, hasPeriod := strings.Cut(s, "/")
+    n, err := strconv.Atoi(strings.TrimSpace(requests))
+    if err != nil || n <= 0 {
+        return Limit{}, fmt.Errorf("limit %q must start with a positive number of requests", s)
+    }
+    limit := Limit{Requests: n, Period: time.Second}
+    if hasPeriod {
+        if limit.Period, err = time.ParseDuration(strings.TrimSpace(period)); err != nil || limit.Period <= 0 {
+            return Limit{}, fmt.Errorf("limit %q must end with a positive period like 1m", s)
+        }
+    }
+    if limit.Period < time.Duration(n) {
+        return Limit{}, fmt.Errorf("limit %q allows more than one request per nanosecond", s)
+    }
+    return limit, nil
+}
+
+// Result is the outcome of taking a token from a bucket.
+type Result struct {
+    Allowed    bool          // whether the request may proceed
+    Remaining  int           // tokens left in the bucket
+    RetryAfter time.Duration // until the next token, if the request isn't allowed
+    Reset      time.Duration // until the bucket is full again
+}
+
+// Store keeps the token buckets of the clients. The in-memory store limits
+// every server on its own; a store shared by several servers, say in Redis,
+// makes the limits apply to all of them together.
+type Store interface {
+    // Take takes a token from the bucket under key, which holds up to
+    // limit.Requests tokens, at the time now.
+    Take(ctx context.Context, key string, limit Limit, now time.Time) (Result, error)
+    // Peek reports whether Take would allow a request at the time now,
+    // without taking a token.
+    Peek(ctx context.Context, key string, limit Limit, now time.Time) (Result, error)
+}
+
+// UnmarshalText parses the limit with ParseLimit, so that config files can
+// set it as a string.
+func (l *Limit) UnmarshalText(text []byte) error {
+    limit, err := ParseLimit(string(text))
+    if err != nil {
+        return err
+    }
+    *l = limit
+    return nil
+}
+
+// MarshalText formats the limit with String.
+func (l Limit) MarshalText() ([]byte, error) {
+    return []byte(l.String()), nil
+}
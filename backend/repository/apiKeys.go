@@ -0,0 +1,28 @@
+package repository
+
+import (
+	"book-manager/models"
+	"context"
+	"time"
+)
+
+// APIKeyRepository stores the API keys of scripts. Keys are looked up by the
+// hash of the key, see auth.HashAPIKey.
+type APIKeyRepository interface {
+    // CreateAPIKey stores a new key and sets its ID and CreatedAt.
+    CreateAPIKey(ctx context.Context, key *models.APIKey) error
+    // ListAPIKeys returns all keys, including revoked and expired ones, by ID.
+    ListAPIKeys(ctx context.Context) ([]models.APIKey, error)
+    // GetAPIKey returns a key by ID.
+    GetAPIKey(ctx context.Context, id uint) (*models.APIKey, error)
+    // GetAPIKeyByHash returns the key with the given hash, whether it is
+    // active or not.
+    GetAPIKeyByHash(ctx context.Context, hash string) (*models.APIKey, error)
+    // RotateAPIKey replaces the prefix and hash of a key, so that the old key
+    // stops working, sets its RotatedAt and returns it.
+    RotateAPIKey(ctx context.Context, id uint, prefix, hash string) (*models.APIKey, error)
+    // RevokeAPIKey ends a key. Revoking it again is not an error.
+    RevokeAPIKey(ctx context.Context, id uint) error
+    // TouchAPIKey sets the LastUsedAt of a key.
+    TouchAPIKey(ctx context.Context, id uint, usedAt time.Time) error
+}
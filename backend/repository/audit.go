@@ -0,0 +1,29 @@
+package repository
+
+import (
+	"book-manager/models"
+	"context"
+	"time"
+)
+
+// AuditQuery selects audit entries. Zero fields don't filter.
+type AuditQuery struct {
+    BookID  uint
+    Version uint      // entries that left the book at this version
+    Actor   string    // user:<id> or api-key:<id>
+    Since   time.Time // entries created at or after
+    Until   time.Time // entries created before
+    Limit   int
+    Offset  int
+}
+
+// AuditRepository stores the audit log of changes to books.
+type AuditRepository interface {
+    // CreateAuditEntry stores an entry and sets its ID and CreatedAt. It is
+    // called in the transaction of the change, so that no change goes
+    // unrecorded.
+    CreateAuditEntry(ctx context.Context, entry *models.AuditEntry) error
+    // ListAuditEntries returns the page of entries selected by query, newest
+    // first, and the number of entries matching its filters.
+    ListAuditEntries(ctx context.Context, query *AuditQuery) ([]models.AuditEntry, int64, error)
+}
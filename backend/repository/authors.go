@@ -0,0 +1,54 @@
+package repository
+
+import (
+	"book-manager/models"
+	"context"
+	"errors"
+	"fmt"
+)
+
+// ErrUnknownAuthor is returned when a book is credited to an author that doesn't exist.
+var ErrUnknownAuthor = errors.New("unknown author")
+
+// DuplicateAuthorError is returned when an author is saved with the name of
+// another author, as compared by models.AuthorNameKey.
+type DuplicateAuthorError struct {
+    Name       string
+    ExistingID uint
+}
+
+func (e *DuplicateAuthorError) Error() string {
+    return fmt.Sprintf("an author named %q already exists (ID %d)", e.Name, e.ExistingID)
+}
+
+// AuthorBook is a book an author is credited on, and the role of the credit.
+type AuthorBook struct {
+    Role string
+    Book models.Book
+}
+
+// AuthorRepository stores authors and their credits on books.
+type AuthorRepository interface {
+    // ListAuthors returns the authors whose name contains name, ignoring case
+    // and punctuation, sorted by name, and how many there are in total.
+    ListAuthors(ctx context.Context, name string, limit, offset int) ([]models.Author, int64, error)
+    // GetAuthor returns an author by ID.
+    GetAuthor(ctx context.Context, id uint) (*models.Author, error)
+    // CreateAuthor stores a new author. It returns a *DuplicateAuthorError if
+    // an author with the same name exists.
+    CreateAuthor(ctx context.Context, author *models.Author) error
+    // UpdateAuthor saves an existing author, like CreateAuthor, and updates
+    // the Author string of the books the author is credited on.
+    UpdateAuthor(ctx context.Context, author *models.Author) error
+    // DeleteAuthor deletes an author, or returns ErrInUse if the author is
+    // credited on a book, including books in the trash.
+    DeleteAuthor(ctx context.Context, id uint) error
+    // BookAuthors returns the credits of a live book in order.
+    BookAuthors(ctx context.Context, bookID uint) ([]models.Contributor, error)
+    // SetBookAuthors replaces the credits of a live book and returns the book.
+    // If anyone is credited in the author role, the Author string of the book
+    // is set to their names. Unknown authors cause an ErrUnknownAuthor.
+    SetBookAuthors(ctx context.Context, bookID uint, credits []models.BookAuthor) (*models.Book, error)
+    // AuthorBooks returns the live books an author is credited on, by year.
+    AuthorBooks(ctx context.Context, authorID uint) ([]AuthorBook, error)
+}
@@ -0,0 +1,48 @@
+package repository
+
+import (
+	"book-manager/models"
+	"book-manager/storage"
+	"context"
+	"log/slog"
+)
+
+// CoverRepository stores which cover image each book has. The images
+// themselves are kept in a storage.BlobStore under the keys of the cover.
+type CoverRepository interface {
+    // GetCover returns the cover of a live book, or ErrNotFound if the book
+    // doesn't exist, is in the trash or has no cover.
+    GetCover(ctx context.Context, bookID uint) (*models.BookCover, error)
+    // SetCover saves the cover of a live book and sets its UpdatedAt. It
+    // returns the cover it replaced, or nil if the book had none.
+    SetCover(ctx context.Context, cover *models.BookCover) (*models.BookCover, error)
+    // DeleteCover removes and returns the cover of a live book.
+    DeleteCover(ctx context.Context, bookID uint) (*models.BookCover, error)
+    // PurgeCovers removes and returns the covers of books that were purged.
+    // Purge and PurgeTrash leave them behind, so that their images can be
+    // deleted from the blob store afterwards.
+    PurgeCovers(ctx context.Context) ([]models.BookCover, error)
+}
+
+// DeleteCoverImages deletes every size of cover from store. Failures are
+// logged, since the cover itself is already gone.
+func DeleteCoverImages(ctx context.Context, store storage.BlobStore, cover *models.BookCover) {
+    for _, size := range models.CoverSizes {
+        if err := store.Delete(ctx, cover.Key(size)); err != nil {
+            slog.ErrorContext(ctx, "Error deleting cover image", "key", cover.Key(size), "error", err)
+        }
+    }
+}
+
+// DeletePurgedCovers removes the covers of purged books together with their
+// images.
+func DeletePurgedCovers(ctx context.Context, books BookRepository, store storage.BlobStore) error {
+    covers, err := books.PurgeCovers(ctx)
+    if err != nil {
+        return err
+    }
+    for i := range covers {
+        DeleteCoverImages(ctx, store, &covers[i])
+    }
+    return nil
+}
@@ -0,0 +1,314 @@
+package repository
+
+import (
+	"book-manager/models"
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// GormBookRepository is a BookRepository backed by a GORM database. SQLite,
+// PostgreSQL and MySQL are supported.
+type GormBookRepository struct {
+    db     *gorm.DB
+    search searchMethod
+}
+
+// NewGormBookRepository returns a repository using db, which must already be
+// opened with database.Open.
+func NewGormBookRepository(db *gorm.DB) *GormBookRepository {
+    return &GormBookRepository{db: db, search: detectSearchMethod(db)}
+}
+
+// SearchMethod returns how Search runs full-text queries: "fts5", "postgres",
+// "mysql", or "like" when the database has no full-text index.
+func (r *GormBookRepository) SearchMethod() string {
+    return string(r.search)
+}
+
+// filter applies the query filters to db. It is shared by the listing and the count query.
+func (r *GormBookRepository) filter(db *gorm.DB, q *BookQuery) *gorm.DB {
+    if q.Trashed {
+        db = db.Unscoped().Where("deleted_at IS NOT NULL")
+    }
+    for _, f := range q.filters {
+        db = db.Where(fmt.Sprintf("%s %s ?", bookColumns[f.field].name, f.operator), f.value)
+    }
+    if len(q.tags) > 0 {
+        tagged := r.db.Model(&models.BookTag{}).Select("book_id").Where("tag IN ?", q.tags)
+        if !q.anyTag {
+            tagged = tagged.Group("book_id").Having("COUNT(*) = ?", len(q.tags))
+        }
+        db = db.Where("id IN (?)", tagged)
+    }
+    return db
+}
+
+func (r *GormBookRepository) List(ctx context.Context, q *BookQuery) (*BookPage, error) {
+    db := r.db.WithContext(ctx)
+    page := &BookPage{Books: []models.Book{}}
+
+    if err := r.filter(db.Model(&models.Book{}), q).Count(&page.Total).Error; err != nil {
+        return nil, err
+    }
+
+    column := bookColumns[q.Sort].name
+    comparison := ">"
+    if q.Desc {
+        comparison = "<"
+    }
+
+    query := r.filter(db, q)
+    if q.Cursor != nil {
+        // deleted_at is NULL for every live book, and comparisons with NULL
+        // are never true, so live books sorted by it are paged by ID alone.
+        if column == "id" || column == "deleted_at" && !q.Trashed {
+            query = query.Where(fmt.Sprintf("id %s ?", comparison), q.Cursor.ID)
+        } else {
+            query = query.Where(
+                fmt.Sprintf("(%s %s ?) OR (%s = ? AND id %s ?)", column, comparison, column, comparison),
+                q.Cursor.Value, q.Cursor.Value, q.Cursor.ID,
+            )
+        }
+    }
+
+    // One extra row tells whether another page exists.
+    if err := r.order(query, q).Offset(q.Offset).Limit(q.Limit + 1).Find(&page.Books).Error; err != nil {
+        return nil, err
+    }
+
+    if len(page.Books) > q.Limit {
+        page.Books = page.Books[:q.Limit]
+        page.NextCursor = q.nextCursor(&page.Books[len(page.Books)-1])
+    }
+    return page, nil
+}
+
+// order sorts db by the sort field of q, with the ID breaking ties.
+func (r *GormBookRepository) order(db *gorm.DB, q *BookQuery) *gorm.DB {
+    column := bookColumns[q.Sort].name
+    direction := "ASC"
+    if q.Desc {
+        direction = "DESC"
+    }
+    db = db.Order(fmt.Sprintf("%s %s", column, direction))
+    if column != "id" {
+        db = db.Order(fmt.Sprintf("id %s", direction))
+    }
+    return db
+}
+
+func (r *GormBookRepository) Export(ctx context.Context, q *BookQuery, fn func(book *models.Book) error) error {
+    db := r.db.WithContext(ctx)
+    rows, err := r.order(r.filter(db.Model(&models.Book{}), q), q).Rows()
+    if err != nil {
+        return err
+    }
+    defer rows.Close()
+
+    for rows.Next() {
+        var book models.Book
+        if err := db.ScanRows(rows, &book); err != nil {
+            return err
+        }
+        if err := fn(&book); err != nil {
+            return err
+        }
+    }
+    return rows.Err()
+}
+
+func (r *GormBookRepository) Get(ctx context.Context, id uint) (*models.Book, error) {
+    var book models.Book
+    if err := r.db.WithContext(ctx).First(&book, id).Error; err != nil {
+        if errors.Is(err, gorm.ErrRecordNotFound) {
+            return nil, ErrNotFound
+        }
+        return nil, err
+    }
+    return &book, nil
+}
+
+func (r *GormBookRepository) GetIncludingTrash(ctx context.Context, id uint) (*models.Book, error) {
+    var book models.Book
+    if err := first(r.db.WithContext(ctx).Unscoped(), &book, id); err != nil {
+        return nil, err
+    }
+    return &book, nil
+}
+
+func (r *GormBookRepository) ReferencingBookIDs(ctx context.Context, kind string, id uint) ([]uint, error) {
+    db := r.db.WithContext(ctx)
+    query := db.Unscoped().Model(&models.Book{}).Order("id")
+    switch kind {
+    case RefPublisher:
+        query = query.Where("publisher_id = ?", id)
+    case RefGenre:
+        query = query.Where("genre_id = ?", id)
+    case RefAuthor:
+        query = query.Where("id IN (?)", db.Model(&models.BookAuthor{}).Select("book_id").Where("author_id = ?", id))
+    default:
+        return nil, fmt.Errorf("unknown reference %q", kind)
+    }
+    ids := []uint{}
+    return ids, query.Pluck("id", &ids).Error
+}
+
+func (r *GormBookRepository) Create(ctx context.Context, book *models.Book) error {
+    book.Normalize()
+    book.Version = 1
+    db := r.db.WithContext(ctx)
+    // The duplicate is looked up after the transaction, since the failed
+    // statement aborts it on PostgreSQL.
+    err := db.Transaction(func(tx *gorm.DB) error {
+        if err := linkTaxonomies(tx, book, &models.Book{}); err != nil {
+            return err
+        }
+        if err := tx.Create(book).Error; err != nil {
+            return err
+        }
+        return linkAuthorNames(tx, book.ID, book.Author)
+    })
+    return r.duplicateISBN(db, book, err)
+}
+
+func (r *GormBookRepository) Update(ctx context.Context, book *models.Book) error {
+    book.Normalize()
+    db := r.db.WithContext(ctx)
+    expected := book.Version
+    err := db.Transaction(func(tx *gorm.DB) error {
+        var previous models.Book
+        if err := tx.Select("id", "author", "publisher_id", "genre_id", "version").First(&previous, book.ID).Error; err != nil {
+            if errors.Is(err, gorm.ErrRecordNotFound) {
+                return ErrNotFound
+            }
+            return err
+        }
+        if err := linkTaxonomies(tx, book, &previous); err != nil {
+            return err
+        }
+
+        book.Version = expected + 1
+        result := tx.Model(book).Where("version = ?", expected).Select("*").Updates(book)
+        if result.Error != nil {
+            return result.Error
+        }
+        if result.RowsAffected == 0 {
+            return ErrVersionConflict
+        }
+        if previous.Author == book.Author {
+            return nil
+        }
+        return linkAuthorNames(tx, book.ID, book.Author)
+    })
+    if err != nil {
+        book.Version = expected
+        return r.duplicateISBN(db, book, err)
+    }
+    return nil
+}
+
+// duplicateISBN turns a unique constraint violation caused by the ISBN of
+// book into a *DuplicateISBNError. Other errors are returned unchanged.
+func (r *GormBookRepository) duplicateISBN(db *gorm.DB, book *models.Book, err error) error {
+    if !errors.Is(err, gorm.ErrDuplicatedKey) || book.ISBN13 == nil {
+        return err
+    }
+    var existing models.Book
+    if db.Unscoped().Select("id").Where("isbn13 = ? AND id <> ?", *book.ISBN13, book.ID).First(&existing).Error != nil {
+        return err
+    }
+    return &DuplicateISBNError{ISBN13: *book.ISBN13, ExistingID: existing.ID}
+}
+
+func (r *GormBookRepository) Delete(ctx context.Context, id, version uint) error {
+    return r.delete(r.db.WithContext(ctx), id, version)
+}
+
+func (r *GormBookRepository) Purge(ctx context.Context, id, version uint) error {
+    return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+        db := tx.Unscoped()
+        if version != 0 {
+            db = db.Where("deleted_at IS NULL")
+        }
+        if err := r.delete(db, id, version); err != nil {
+            return err
+        }
+        if err := tx.Where("book_id = ?", id).Delete(&models.BookAuthor{}).Error; err != nil {
+            return err
+        }
+        return tx.Where("book_id = ?", id).Delete(&models.BookTag{}).Error
+    })
+}
+
+// delete deletes the book with the given ID, soft or not depending on db, and
+// only at the given version unless it is 0. If nothing is deleted, it tells
+// a missing book from one that doesn't match.
+func (r *GormBookRepository) delete(db *gorm.DB, id, version uint) error {
+    if version != 0 {
+        db = db.Where("version = ?", version)
+    }
+    result := db.Delete(&models.Book{}, id)
+    if result.Error != nil {
+        return result.Error
+    }
+    if result.RowsAffected > 0 {
+        return nil
+    }
+    if version == 0 {
+        return ErrNotFound
+    }
+    var count int64
+    if err := db.Session(&gorm.Session{NewDB: true}).Unscoped().Model(&models.Book{}).Where("id = ?", id).Count(&count).Error; err != nil {
+        return err
+    }
+    if count == 0 {
+        return ErrNotFound
+    }
+    return ErrVersionConflict
+}
+
+func (r *GormBookRepository) Restore(ctx context.Context, id uint) (*models.Book, error) {
+    db := r.db.WithContext(ctx)
+    result := db.Unscoped().Model(&models.Book{}).
+        Where("id = ? AND deleted_at IS NOT NULL", id).
+        Updates(map[string]interface{}{"deleted_at": nil, "version": gorm.Expr("version + 1")})
+    if result.Error != nil {
+        return nil, result.Error
+    }
+    if result.RowsAffected == 0 {
+        return nil, ErrNotFound
+    }
+    return r.Get(ctx, id)
+}
+
+func (r *GormBookRepository) PurgeTrash(ctx context.Context, before time.Time) (int64, error) {
+    var purged int64
+    err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+        result := tx.Unscoped().
+            Where("deleted_at IS NOT NULL AND deleted_at < ?", before).
+            Delete(&models.Book{})
+        if result.Error != nil {
+            return result.Error
+        }
+        purged = result.RowsAffected
+        for _, model := range []interface{}{&models.BookAuthor{}, &models.BookTag{}} {
+            err := tx.Where("book_id NOT IN (?)", tx.Unscoped().Model(&models.Book{}).Select("id")).Delete(model).Error
+            if err != nil {
+                return err
+            }
+        }
+        return nil
+    })
+    return purged, err
+}
+
+func (r *GormBookRepository) Transaction(ctx context.Context, fn func(tx BookRepository) error) error {
+    // Within a transaction GORM uses savepoints for nested transactions.
+    return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+        return fn(&GormBookRepository{db: tx, search: r.search})
+    })
+}
@@ -0,0 +1,66 @@
+package repository
+
+import (
+	"book-manager/models"
+	"context"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+func (r *GormBookRepository) CreateAPIKey(ctx context.Context, key *models.APIKey) error {
+    return r.db.WithContext(ctx).Create(key).Error
+}
+
+func (r *GormBookRepository) ListAPIKeys(ctx context.Context) ([]models.APIKey, error) {
+    keys := []models.APIKey{}
+    err := r.db.WithContext(ctx).Order("id").Find(&keys).Error
+    return keys, err
+}
+
+func (r *GormBookRepository) GetAPIKey(ctx context.Context, id uint) (*models.APIKey, error) {
+    var key models.APIKey
+    if err := first(r.db.WithContext(ctx), &key, id); err != nil {
+        return nil, err
+    }
+    return &key, nil
+}
+
+func (r *GormBookRepository) GetAPIKeyByHash(ctx context.Context, hash string) (*models.APIKey, error) {
+    var key models.APIKey
+    if err := first(r.db.WithContext(ctx), &key, "hash = ?", hash); err != nil {
+        return nil, err
+    }
+    return &key, nil
+}
+
+func (r *GormBookRepository) RotateAPIKey(ctx context.Context, id uint, prefix, hash string) (*models.APIKey, error) {
+    var key models.APIKey
+    err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+        if err := first(tx, &key, id); err != nil {
+            return err
+        }
+        now := time.Now()
+        key.Prefix, key.Hash, key.RotatedAt = prefix, hash, &now
+        return tx.Model(&key).Select("Prefix", "Hash", "RotatedAt").Updates(&key).Error
+    })
+    if err != nil {
+        return nil, err
+    }
+    return &key, nil
+}
+
+func (r *GormBookRepository) RevokeAPIKey(ctx context.Context, id uint) error {
+    db := r.db.WithContext(ctx)
+    var key models.APIKey
+    if err := first(db, &key, id); err != nil {
+        return err
+    }
+    return db.Model(&models.APIKey{}).
+        Where("id = ? AND revoked_at IS NULL", id).
+        Update("revoked_at", time.Now()).Error
+}
+
+func (r *GormBookRepository) TouchAPIKey(ctx context.Context, id uint, usedAt time.Time) error {
+    return r.db.WithContext(ctx).Model(&models.APIKey{}).Where("id = ?", id).Update("last_used_at", usedAt).Error
+}
@@ -0,0 +1,37 @@
+package repository
+
+import (
+	"book-manager/models"
+	"context"
+)
+
+func (r *GormBookRepository) CreateAuditEntry(ctx context.Context, entry *models.AuditEntry) error {
+    return r.db.WithContext(ctx).Create(entry).Error
+}
+
+func (r *GormBookRepository) ListAuditEntries(ctx context.Context, q *AuditQuery) ([]models.AuditEntry, int64, error) {
+    query := r.db.WithContext(ctx).Model(&models.AuditEntry{})
+    if q.BookID != 0 {
+        query = query.Where("book_id = ?", q.BookID)
+    }
+    if q.Version != 0 {
+        query = query.Where("version = ?", q.Version)
+    }
+    if q.Actor != "" {
+        query = query.Where("actor = ?", q.Actor)
+    }
+    if !q.Since.IsZero() {
+        query = query.Where("created_at >= ?", q.Since)
+    }
+    if !q.Until.IsZero() {
+        query = query.Where("created_at < ?", q.Until)
+    }
+
+    var total int64
+    if err := query.Count(&total).Error; err != nil {
+        return nil, 0, err
+    }
+    entries := []models.AuditEntry{}
+    err := query.Order("id DESC").Offset(q.Offset).Limit(q.Limit).Find(&entries).Error
+    return entries, total, err
+}
@@ -0,0 +1,236 @@
+package repository
+
+import (
+	"book-manager/models"
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+func (r *GormBookRepository) ListAuthors(ctx context.Context, name string, limit, offset int) ([]models.Author, int64, error) {
+    query := r.db.WithContext(ctx).Model(&models.Author{})
+    if key := models.AuthorNameKey(name); key != "" {
+        query = query.Where("name_key LIKE ?", "%"+key+"%")
+    }
+
+    var total int64
+    if err := query.Count(&total).Error; err != nil {
+        return nil, 0, err
+    }
+    authors := []models.Author{}
+    err := query.Order("name_key").Order("id").Offset(offset).Limit(limit).Find(&authors).Error
+    return authors, total, err
+}
+
+func (r *GormBookRepository) GetAuthor(ctx context.Context, id uint) (*models.Author, error) {
+    var author models.Author
+    if err := r.db.WithContext(ctx).First(&author, id).Error; err != nil {
+        if errors.Is(err, gorm.ErrRecordNotFound) {
+            return nil, ErrNotFound
+        }
+        return nil, err
+    }
+    return &author, nil
+}
+
+func (r *GormBookRepository) CreateAuthor(ctx context.Context, author *models.Author) error {
+    author.Normalize()
+    db := r.db.WithContext(ctx)
+    return r.duplicateAuthor(db, author, db.Create(author).Error)
+}
+
+func (r *GormBookRepository) UpdateAuthor(ctx context.Context, author *models.Author) error {
+    author.Normalize()
+    db := r.db.WithContext(ctx)
+    err := db.Transaction(func(tx *gorm.DB) error {
+        result := tx.Model(author).Select("*").Omit("created_at").Updates(author)
+        if result.Error != nil {
+            return result.Error
+        }
+        if result.RowsAffected == 0 {
+            return ErrNotFound
+        }
+        if err := tx.First(author, author.ID).Error; err != nil {
+            return err
+        }
+
+        var bookIDs []uint
+        if err := tx.Model(&models.BookAuthor{}).Where("author_id = ? AND role = ?", author.ID, models.RoleAuthor).
+            Distinct().Pluck("book_id", &bookIDs).Error; err != nil {
+            return err
+        }
+        for _, bookID := range bookIDs {
+            if err := syncAuthorString(tx, bookID); err != nil {
+                return err
+            }
+        }
+        return nil
+    })
+    return r.duplicateAuthor(db, author, err)
+}
+
+// duplicateAuthor turns a unique constraint violation caused by the name of
+// author into a *DuplicateAuthorError. Other errors are returned unchanged.
+func (r *GormBookRepository) duplicateAuthor(db *gorm.DB, author *models.Author, err error) error {
+    if !errors.Is(err, gorm.ErrDuplicatedKey) {
+        return err
+    }
+    var existing models.Author
+    if db.Select("id").Where("name_key = ? AND id <> ?", author.NameKey, author.ID).First(&existing).Error != nil {
+        return err
+    }
+    return &DuplicateAuthorError{Name: author.Name, ExistingID: existing.ID}
+}
+
+func (r *GormBookRepository) DeleteAuthor(ctx context.Context, id uint) error {
+    return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+        var credits int64
+        if err := tx.Model(&models.BookAuthor{}).Where("author_id = ?", id).Count(&credits).Error; err != nil {
+            return err
+        }
+        if credits > 0 {
+            return ErrInUse
+        }
+        result := tx.Delete(&models.Author{}, id)
+        if result.Error != nil {
+            return result.Error
+        }
+        if result.RowsAffected == 0 {
+            return ErrNotFound
+        }
+        return nil
+    })
+}
+
+func (r *GormBookRepository) BookAuthors(ctx context.Context, bookID uint) ([]models.Contributor, error) {
+    db := r.db.WithContext(ctx)
+    if _, err := r.Get(ctx, bookID); err != nil {
+        return nil, err
+    }
+    return bookContributors(db, bookID)
+}
+
+func bookContributors(db *gorm.DB, bookID uint) ([]models.Contributor, error) {
+    contributors := []models.Contributor{}
+    err := db.Table("book_authors").
+        Select("book_authors.author_id, authors.name, book_authors.role").
+        Joins("JOIN authors ON authors.id = book_authors.author_id").
+        Where("book_authors.book_id = ?", bookID).
+        Order("book_authors.position").Order("book_authors.author_id").
+        Scan(&contributors).Error
+    return contributors, err
+}
+
+func (r *GormBookRepository) SetBookAuthors(ctx context.Context, bookID uint, credits []models.BookAuthor) (*models.Book, error) {
+    err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+        var book models.Book
+        if err := tx.Select("id").First(&book, bookID).Error; err != nil {
+            if errors.Is(err, gorm.ErrRecordNotFound) {
+                return ErrNotFound
+            }
+            return err
+        }
+
+        if err := tx.Where("book_id = ?", bookID).Delete(&models.BookAuthor{}).Error; err != nil {
+            return err
+        }
+        for i, credit := range credits {
+            var authors int64
+            if err := tx.Model(&models.Author{}).Where("id = ?", credit.AuthorID).Count(&authors).Error; err != nil {
+                return err
+            }
+            if authors == 0 {
+                return fmt.Errorf("%w: %d", ErrUnknownAuthor, credit.AuthorID)
+            }
+            credit.BookID, credit.Position = bookID, i
+            if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&credit).Error; err != nil {
+                return err
+            }
+        }
+        return syncAuthorString(tx, bookID)
+    })
+    if err != nil {
+        return nil, err
+    }
+    return r.Get(ctx, bookID)
+}
+
+func (r *GormBookRepository) AuthorBooks(ctx context.Context, authorID uint) ([]AuthorBook, error) {
+    if _, err := r.GetAuthor(ctx, authorID); err != nil {
+        return nil, err
+    }
+
+    var rows []struct {
+        models.Book
+        Role string
+    }
+    err := r.db.WithContext(ctx).Model(&models.Book{}).
+        Select("books.*, book_authors.role").
+        Joins("JOIN book_authors ON book_authors.book_id = books.id").
+        Where("book_authors.author_id = ?", authorID).
+        Order("books.year").Order("books.id").Order("book_authors.role").
+        Scan(&rows).Error
+    if err != nil {
+        return nil, err
+    }
+
+    books := make([]AuthorBook, len(rows))
+    for i, row := range rows {
+        books[i] = AuthorBook{Role: row.Role, Book: row.Book}
+    }
+    return books, nil
+}
+
+// linkAuthorNames credits the names in the author string of a book in the
+// author role, replacing the previous author credits. Missing authors are created.
+func linkAuthorNames(tx *gorm.DB, bookID uint, authors string) error {
+    if err := tx.Where("book_id = ? AND role = ?", bookID, models.RoleAuthor).Delete(&models.BookAuthor{}).Error; err != nil {
+        return err
+    }
+    for position, name := range models.SplitAuthorNames(authors) {
+        author := models.Author{Name: name}
+        author.Normalize()
+        // Concurrent requests may create the same author, so conflicts are ignored
+        // and the author is read back.
+        if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&author).Error; err != nil {
+            return err
+        }
+        if err := tx.Where("name_key = ?", author.NameKey).First(&author).Error; err != nil {
+            return err
+        }
+        credit := models.BookAuthor{BookID: bookID, AuthorID: author.ID, Role: models.RoleAuthor, Position: position}
+        if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&credit).Error; err != nil {
+            return err
+        }
+    }
+    return nil
+}
+
+// syncAuthorString sets the Author string of a book to the names of the
+// authors credited in the author role, if there are any.
+func syncAuthorString(tx *gorm.DB, bookID uint) error {
+    contributors, err := bookContributors(tx, bookID)
+    if err != nil {
+        return err
+    }
+    var names []string
+    for _, contributor := range contributors {
+        if contributor.Role == models.RoleAuthor {
+            names = append(names, contributor.Name)
+        }
+    }
+    if len(names) == 0 {
+        return nil
+    }
+    return tx.Unscoped().Model(&models.Book{}).
+        Where("id = ? AND author <> ?", bookID, models.JoinAuthorNames(names)).
+        Updates(map[string]interface{}{
+            "author":     models.JoinAuthorNames(names),
+            "version":    gorm.Expr("version + 1"),
+            "updated_at": time.Now(),
+        }).Error
+}
@@ -0,0 +1,100 @@
+package repository
+
+import (
+	"book-manager/models"
+	"context"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+func (r *GormBookRepository) GetCover(ctx context.Context, bookID uint) (*models.BookCover, error) {
+    if _, err := r.Get(ctx, bookID); err != nil {
+        return nil, err
+    }
+    return bookCover(r.db.WithContext(ctx), bookID)
+}
+
+// bookCover returns the cover of a book, or ErrNotFound if it has none.
+func bookCover(db *gorm.DB, bookID uint) (*models.BookCover, error) {
+    var cover models.BookCover
+    if err := db.Where("book_id = ?", bookID).First(&cover).Error; err != nil {
+        if errors.Is(err, gorm.ErrRecordNotFound) {
+            return nil, ErrNotFound
+        }
+        return nil, err
+    }
+    return &cover, nil
+}
+
+// changeCover runs change with the current cover of a live book, or nil if
+// it has none, in a transaction.
+func (r *GormBookRepository) changeCover(ctx context.Context, bookID uint, change func(tx *gorm.DB, previous *models.BookCover) error) error {
+    return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+        if err := tx.Select("id").First(&models.Book{}, bookID).Error; err != nil {
+            if errors.Is(err, gorm.ErrRecordNotFound) {
+                return ErrNotFound
+            }
+            return err
+        }
+        previous, err := bookCover(tx, bookID)
+        if errors.Is(err, ErrNotFound) {
+            return change(tx, nil)
+        }
+        if err != nil {
+            return err
+        }
+        return change(tx, previous)
+    })
+}
+
+func (r *GormBookRepository) SetCover(ctx context.Context, cover *models.BookCover) (*models.BookCover, error) {
+    var replaced *models.BookCover
+    err := r.changeCover(ctx, cover.BookID, func(tx *gorm.DB, previous *models.BookCover) error {
+        replaced = previous
+        cover.UpdatedAt = time.Now()
+        if previous == nil {
+            return tx.Create(cover).Error
+        }
+        return tx.Save(cover).Error
+    })
+    if err != nil {
+        return nil, err
+    }
+    return replaced, nil
+}
+
+func (r *GormBookRepository) DeleteCover(ctx context.Context, bookID uint) (*models.BookCover, error) {
+    var deleted *models.BookCover
+    err := r.changeCover(ctx, bookID, func(tx *gorm.DB, previous *models.BookCover) error {
+        if previous == nil {
+            return ErrNotFound
+        }
+        deleted = previous
+        return tx.Delete(previous).Error
+    })
+    if err != nil {
+        return nil, err
+    }
+    return deleted, nil
+}
+
+func (r *GormBookRepository) PurgeCovers(ctx context.Context) ([]models.BookCover, error) {
+    var covers []models.BookCover
+    err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+        orphaned := tx.Where("book_id NOT IN (?)", tx.Unscoped().Model(&models.Book{}).Select("id"))
+        if err := orphaned.Find(&covers).Error; err != nil || len(covers) == 0 {
+            return err
+        }
+        ids := make([]uint, len(covers))
+        for i, cover := range covers {
+            ids[i] = cover.BookID
+        }
+        return tx.Where("book_id IN ?", ids).Delete(&models.BookCover{}).Error
+    })
+    if err != nil {
+        return nil, err
+    }
+    return covers, nil
+}
@@ -0,0 +1,253 @@
+package repository
+
+import (
+	"book-manager/database"
+	"book-manager/models"
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// searchMethod is how GormBookRepository runs full-text queries.
+type searchMethod string
+
+const (
+    searchFTS5     searchMethod = "fts5"     // SQLite FTS5 virtual table
+    searchPostgres searchMethod = "postgres" // tsvector with a GIN index
+    searchMySQL    searchMethod = "mysql"    // FULLTEXT index
+    searchLike     searchMethod = "like"     // LIKE scan, scored in Go
+)
+
+// detectSearchMethod picks the best search method the database supports.
+func detectSearchMethod(db *gorm.DB) searchMethod {
+    switch db.Dialector.Name() {
+    case "sqlite":
+        var triggers int64
+        db.Raw("SELECT count(*) FROM sqlite_master WHERE type = 'trigger' AND name = 'books_fts_insert'").Scan(&triggers)
+        if triggers > 0 {
+            return searchFTS5
+        }
+    case "postgres":
+        return searchPostgres
+    case "mysql":
+        var indexes int64
+        db.Raw(`SELECT count(*) FROM information_schema.statistics
+            WHERE table_schema = DATABASE() AND table_name = 'books' AND index_name = 'books_search_idx'`).Scan(&indexes)
+        if indexes > 0 {
+            return searchMySQL
+        }
+    }
+    return searchLike
+}
+
+// highlightedBook is a search result row with the highlighted fields.
+type highlightedBook struct {
+    models.Book
+    HlTitle       string
+    HlAuthor      string
+    HlDescription string
+    HlPublisher   string
+    HlGenre       string
+    Score         float64
+}
+
+func (b *highlightedBook) hit() SearchHit {
+    highlights := map[string]string{}
+    for name, value := range map[string]string{
+        "title":       b.HlTitle,
+        "author":      b.HlAuthor,
+        "description": b.HlDescription,
+        "publisher":   b.HlPublisher,
+        "genre":       b.HlGenre,
+    } {
+        if strings.Contains(value, markStart) {
+            highlights[name] = markHighlights(value)
+        }
+    }
+    return SearchHit{Book: b.Book, Score: b.Score, Highlights: highlights}
+}
+
+func (r *GormBookRepository) Search(ctx context.Context, q string, limit int) ([]SearchHit, error) {
+    terms := parseSearchQuery(q)
+    if len(terms) == 0 {
+        return []SearchHit{}, nil
+    }
+
+    db := r.db.WithContext(ctx)
+    switch r.search {
+    case searchFTS5:
+        return r.fts5Search(db, terms, limit)
+    case searchPostgres:
+        return r.postgresSearch(db, terms, limit)
+    case searchMySQL:
+        return r.mysqlSearch(db, terms, limit)
+    default:
+        return r.likeSearch(db, terms, limit)
+    }
+}
+
+func (r *GormBookRepository) scanHits(db *gorm.DB, sql string, values ...interface{}) ([]SearchHit, error) {
+    var rows []highlightedBook
+    if err := db.Raw(sql, values...).Scan(&rows).Error; err != nil {
+        return nil, err
+    }
+    hits := make([]SearchHit, len(rows))
+    for i := range rows {
+        hits[i] = rows[i].hit()
+    }
+    return hits, nil
+}
+
+func (r *GormBookRepository) fts5Search(db *gorm.DB, terms []searchTerm, limit int) ([]SearchHit, error) {
+    weights := make([]string, len(searchColumns))
+    selects := []string{"books.*"}
+    for i, column := range searchColumns {
+        weights[i] = fmt.Sprint(column.weight)
+        if column.name == "description" {
+            selects = append(selects, fmt.Sprintf("snippet(books_fts, %d, '%s', '%s', '…', 16) AS hl_%s", i, markStart, markEnd, column.name))
+        } else {
+            selects = append(selects, fmt.Sprintf("highlight(books_fts, %d, '%s', '%s') AS hl_%s", i, markStart, markEnd, column.name))
+        }
+    }
+    selects = append(selects, fmt.Sprintf("-bm25(books_fts, %s) AS score", strings.Join(weights, ", ")))
+
+    return r.scanHits(db,
+        fmt.Sprintf(`SELECT %s FROM books_fts JOIN books ON books.id = books_fts.rowid
+            WHERE books_fts MATCH ? AND books.deleted_at IS NULL
+            ORDER BY score DESC LIMIT ?`, strings.Join(selects, ", ")),
+        ftsQuery(terms), limit,
+    )
+}
+
+var wordPattern = regexp.MustCompile(`[\p{L}\p{N}]+`)
+
+// tsQuery builds a to_tsquery expression. Words are reduced to letters and
+// digits so that user input can't inject tsquery syntax.
+func tsQuery(terms []searchTerm) string {
+    var parts []string
+    for _, term := range terms {
+        words := wordPattern.FindAllString(strings.ToLower(term.text), -1)
+        if len(words) == 0 {
+            continue
+        }
+        for i, word := range words {
+            words[i] = "'" + word + "'"
+        }
+        if term.prefix {
+            words[len(words)-1] += ":*"
+        }
+        parts = append(parts, "("+strings.Join(words, " <-> ")+")")
+    }
+    return strings.Join(parts, " & ")
+}
+
+func (r *GormBookRepository) postgresSearch(db *gorm.DB, terms []searchTerm, limit int) ([]SearchHit, error) {
+    query := tsQuery(terms)
+    if query == "" {
+        return []SearchHit{}, nil
+    }
+
+    headline := func(column, options string) string {
+        return fmt.Sprintf("ts_headline('simple', coalesce(%s, ''), query, 'StartSel=%s, StopSel=%s, %s') AS hl_%s", column, markStart, markEnd, options, column)
+    }
+    selects := []string{
+        "books.*",
+        headline("title", "HighlightAll=true"),
+        headline("author", "HighlightAll=true"),
+        headline("description", "MaxWords=16, MinWords=8"),
+        headline("publisher", "HighlightAll=true"),
+        headline("genre", "HighlightAll=true"),
+        // Weights for D (description), C (publisher, genre), B (author) and A (title).
+        "ts_rank('{0.1, 0.2, 0.5, 1.0}'::float4[], " + database.PostgresSearchVector + ", query) AS score",
+    }
+
+    return r.scanHits(db,
+        fmt.Sprintf(`SELECT %s FROM books, to_tsquery('simple', ?) AS query
+            WHERE %s @@ query AND books.deleted_at IS NULL
+            ORDER BY score DESC LIMIT ?`, strings.Join(selects, ", "), database.PostgresSearchVector),
+        query, limit,
+    )
+}
+
+// booleanQuery builds a MySQL boolean mode query in which every term is
+// required. Phrases can't be prefix queries in MySQL, so the '*' of a phrase is dropped.
+func booleanQuery(terms []searchTerm) string {
+    var parts []string
+    for _, term := range terms {
+        words := wordPattern.FindAllString(term.text, -1)
+        switch {
+        case len(words) == 0:
+            continue
+        case len(words) > 1:
+            parts = append(parts, `+"`+strings.Join(words, " ")+`"`)
+        case term.prefix:
+            parts = append(parts, "+"+words[0]+"*")
+        default:
+            parts = append(parts, "+"+words[0])
+        }
+    }
+    return strings.Join(parts, " ")
+}
+
+func (r *GormBookRepository) mysqlSearch(db *gorm.DB, terms []searchTerm, limit int) ([]SearchHit, error) {
+    query := booleanQuery(terms)
+    if query == "" {
+        return []SearchHit{}, nil
+    }
+
+    match := "MATCH(" + database.MySQLSearchColumns + ") AGAINST (? IN BOOLEAN MODE)"
+    var rows []highlightedBook
+    err := db.Raw(
+        fmt.Sprintf(`SELECT books.*, %s AS score FROM books
+            WHERE %s AND books.deleted_at IS NULL
+            ORDER BY score DESC LIMIT ?`, match, match),
+        query, query, limit,
+    ).Scan(&rows).Error
+    if err != nil {
+        return nil, err
+    }
+
+    // MySQL has no highlighting, so it is done the same way as for LIKE searches.
+    hits := make([]SearchHit, len(rows))
+    for i, row := range rows {
+        hits[i] = SearchHit{Book: row.Book, Score: row.Score, Highlights: map[string]string{}}
+        for name, value := range searchValues(&row.Book) {
+            if highlighted, matches := highlightTerms(value, terms); matches > 0 {
+                hits[i].Highlights[name] = highlighted
+            }
+        }
+    }
+    return hits, nil
+}
+
+// likeSearch is the fallback used without a full-text index. The database
+// narrows the candidates down with LIKE, scoring happens in scoreBook.
+func (r *GormBookRepository) likeSearch(db *gorm.DB, terms []searchTerm, limit int) ([]SearchHit, error) {
+    query := db.Model(&models.Book{})
+    for _, term := range terms {
+        pattern := "%" + strings.ToLower(term.text) + "%"
+        var conditions []string
+        var args []interface{}
+        for _, column := range searchColumns {
+            conditions = append(conditions, fmt.Sprintf("LOWER(%s) LIKE ?", column.name))
+            args = append(args, pattern)
+        }
+        query = query.Where(strings.Join(conditions, " OR "), args...)
+    }
+
+    var books []models.Book
+    if err := query.Find(&books).Error; err != nil {
+        return nil, err
+    }
+
+    hits := make([]SearchHit, 0, len(books))
+    for _, book := range books {
+        if hit, ok := scoreBook(book, terms); ok {
+            hits = append(hits, hit)
+        }
+    }
+    return rankHits(hits, limit), nil
+}
@@ -0,0 +1,83 @@
+package repository
+
+import (
+	"book-manager/models"
+	"context"
+	"errors"
+	"strings"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+func (r *GormBookRepository) BookTags(ctx context.Context, bookID uint) ([]string, error) {
+    if _, err := r.Get(ctx, bookID); err != nil {
+        return nil, err
+    }
+    return bookTags(r.db.WithContext(ctx), bookID)
+}
+
+func bookTags(db *gorm.DB, bookID uint) ([]string, error) {
+    tags := []string{}
+    err := db.Model(&models.BookTag{}).Where("book_id = ?", bookID).Order("tag").Pluck("tag", &tags).Error
+    return tags, err
+}
+
+// changeTags runs change on the tags of a live book in a transaction and
+// returns the tags afterwards.
+func (r *GormBookRepository) changeTags(ctx context.Context, bookID uint, change func(tx *gorm.DB) error) ([]string, error) {
+    var tags []string
+    err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+        if err := tx.Select("id").First(&models.Book{}, bookID).Error; err != nil {
+            if errors.Is(err, gorm.ErrRecordNotFound) {
+                return ErrNotFound
+            }
+            return err
+        }
+        if err := change(tx); err != nil {
+            return err
+        }
+        var err error
+        tags, err = bookTags(tx, bookID)
+        return err
+    })
+    return tags, err
+}
+
+func (r *GormBookRepository) AddTags(ctx context.Context, bookID uint, tags []string) ([]string, error) {
+    return r.changeTags(ctx, bookID, func(tx *gorm.DB) error {
+        if len(tags) == 0 {
+            return nil
+        }
+        bookTags := make([]models.BookTag, len(tags))
+        for i, tag := range tags {
+            bookTags[i] = models.BookTag{BookID: bookID, Tag: tag}
+        }
+        return tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&bookTags).Error
+    })
+}
+
+func (r *GormBookRepository) RemoveTags(ctx context.Context, bookID uint, tags []string) ([]string, error) {
+    return r.changeTags(ctx, bookID, func(tx *gorm.DB) error {
+        if len(tags) == 0 {
+            return nil
+        }
+        return tx.Where("book_id = ? AND tag IN ?", bookID, tags).Delete(&models.BookTag{}).Error
+    })
+}
+
+func (r *GormBookRepository) ListTags(ctx context.Context, prefix string) ([]TagCount, error) {
+    counts := []TagCount{}
+    query := r.db.WithContext(ctx).Model(&models.BookTag{}).
+        Select("book_tags.tag, count(*) AS books").
+        Joins("JOIN books ON books.id = book_tags.book_id AND books.deleted_at IS NULL")
+    if prefix != "" {
+        // The prefix is escaped so that % and _ match literally. '!' is used
+        // as escape character, since backslashes are treated differently by
+        // MySQL and PostgreSQL.
+        escaped := strings.NewReplacer("!", "!!", "%", "!%", "_", "!_").Replace(prefix)
+        query = query.Where("book_tags.tag LIKE ? ESCAPE '!'", escaped+"%")
+    }
+    err := query.Group("book_tags.tag").Order("books DESC").Order("book_tags.tag").Scan(&counts).Error
+    return counts, err
+}
@@ -0,0 +1,390 @@
+package repository
+
+import (
+	"book-manager/models"
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// bookCounts returns the number of live books per value of column, e.g. publisher_id.
+func bookCounts(db *gorm.DB, column string) (map[uint]int64, error) {
+    var rows []struct {
+        ID    uint
+        Books int64
+    }
+    err := db.Model(&models.Book{}).
+        Select(fmt.Sprintf("%s AS id, count(*) AS books", column)).
+        Where(fmt.Sprintf("%s IS NOT NULL", column)).
+        Group(column).
+        Scan(&rows).Error
+    if err != nil {
+        return nil, err
+    }
+    counts := make(map[uint]int64, len(rows))
+    for _, row := range rows {
+        counts[row.ID] = row.Books
+    }
+    return counts, nil
+}
+
+// renameBooks sets the name column of the books, trashed or not, that refer
+// to id in the ID column next to it, e.g. publisher and publisher_id.
+func renameBooks(tx *gorm.DB, column string, id uint, name string) error {
+    return tx.Unscoped().Model(&models.Book{}).
+        Where(fmt.Sprintf("%s_id = ? AND %s <> ?", column, column), id, name).
+        Updates(map[string]interface{}{
+            column:       name,
+            "version":    gorm.Expr("version + 1"),
+            "updated_at": time.Now(),
+        }).Error
+}
+
+// moveBooks points the books that refer to sourceID in the ID column to
+// targetID and name, and returns how many there were.
+func moveBooks(tx *gorm.DB, column string, sourceID, targetID uint, name string) (int64, error) {
+    result := tx.Unscoped().Model(&models.Book{}).
+        Where(fmt.Sprintf("%s_id = ?", column), sourceID).
+        Updates(map[string]interface{}{
+            column + "_id": targetID,
+            column:         name,
+            "version":      gorm.Expr("version + 1"),
+            "updated_at":   time.Now(),
+        })
+    return result.RowsAffected, result.Error
+}
+
+// referencingBooks returns the number of books, trashed or not, that refer to id in the ID column.
+func referencingBooks(tx *gorm.DB, column string, id uint) (int64, error) {
+    var books int64
+    err := tx.Unscoped().Model(&models.Book{}).Where(fmt.Sprintf("%s_id = ?", column), id).Count(&books).Error
+    return books, err
+}
+
+// duplicateName turns a unique constraint violation caused by the name key
+// of a publisher or genre into a *DuplicateNameError.
+func duplicateName(db *gorm.DB, model interface{}, kind, name, key string, id uint, err error) error {
+    if !errors.Is(err, gorm.ErrDuplicatedKey) {
+        return err
+    }
+    var existing struct{ ID uint }
+    if db.Model(model).Select("id").Where("name_key = ? AND id <> ?", key, id).Take(&existing).Error != nil {
+        return err
+    }
+    return &DuplicateNameError{Kind: kind, Name: name, ExistingID: existing.ID}
+}
+
+func sameID(a, b *uint) bool {
+    return (a == nil && b == nil) || (a != nil && b != nil && *a == *b)
+}
+
+// linkTaxonomies sets the publisher and genre of book. A PublisherID or
+// GenreID that differs from the previous version of the book wins; otherwise
+// the ID follows the name, and missing publishers and genres are created.
+func linkTaxonomies(tx *gorm.DB, book, previous *models.Book) error {
+    if err := linkPublisher(tx, book, previous); err != nil {
+        return err
+    }
+    return linkGenre(tx, book, previous)
+}
+
+func linkPublisher(tx *gorm.DB, book, previous *models.Book) error {
+    var publisher models.Publisher
+    if book.PublisherID != nil && !sameID(book.PublisherID, previous.PublisherID) {
+        if err := tx.First(&publisher, *book.PublisherID).Error; err != nil {
+            if errors.Is(err, gorm.ErrRecordNotFound) {
+                return fmt.Errorf("%w: %d", ErrUnknownPublisher, *book.PublisherID)
+            }
+            return err
+        }
+        book.Publisher = publisher.Name
+        return nil
+    }
+
+    publisher.Name = book.Publisher
+    if publisher.Normalize(); publisher.NameKey == "" {
+        book.Publisher, book.PublisherID = "", nil
+        return nil
+    }
+    if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&publisher).Error; err != nil {
+        return err
+    }
+    if err := tx.Where("name_key = ?", publisher.NameKey).First(&publisher).Error; err != nil {
+        return err
+    }
+    book.Publisher, book.PublisherID = publisher.Name, &publisher.ID
+    return nil
+}
+
+func linkGenre(tx *gorm.DB, book, previous *models.Book) error {
+    var genre models.Genre
+    if book.GenreID != nil && !sameID(book.GenreID, previous.GenreID) {
+        if err := tx.First(&genre, *book.GenreID).Error; err != nil {
+            if errors.Is(err, gorm.ErrRecordNotFound) {
+                return fmt.Errorf("%w: %d", ErrUnknownGenre, *book.GenreID)
+            }
+            return err
+        }
+        book.Genre = genre.Name
+        return nil
+    }
+
+    names := models.SplitGenrePath(book.Genre)
+    book.Genre, book.GenreID = "", nil
+    var parentID *uint
+    // Genres that exist keep their place in the tree; missing ones are
+    // created below the previous name of the path.
+    for _, name := range names {
+        genre := models.Genre{Name: name, ParentID: parentID}
+        genre.Normalize()
+        if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&genre).Error; err != nil {
+            return err
+        }
+        if err := tx.Where("name_key = ?", genre.NameKey).First(&genre).Error; err != nil {
+            return err
+        }
+        parentID = &genre.ID
+        book.Genre, book.GenreID = genre.Name, &genre.ID
+    }
+    return nil
+}
+
+func (r *GormBookRepository) ListPublishers(ctx context.Context) ([]PublisherCount, error) {
+    db := r.db.WithContext(ctx)
+    var publishers []models.Publisher
+    if err := db.Order("name_key").Find(&publishers).Error; err != nil {
+        return nil, err
+    }
+    books, err := bookCounts(db, "publisher_id")
+    if err != nil {
+        return nil, err
+    }
+
+    counts := make([]PublisherCount, len(publishers))
+    for i, publisher := range publishers {
+        counts[i] = PublisherCount{Publisher: publisher, Books: books[publisher.ID]}
+    }
+    return counts, nil
+}
+
+func (r *GormBookRepository) GetPublisher(ctx context.Context, id uint) (*models.Publisher, error) {
+    var publisher models.Publisher
+    if err := r.db.WithContext(ctx).First(&publisher, id).Error; err != nil {
+        if errors.Is(err, gorm.ErrRecordNotFound) {
+            return nil, ErrNotFound
+        }
+        return nil, err
+    }
+    return &publisher, nil
+}
+
+func (r *GormBookRepository) CreatePublisher(ctx context.Context, publisher *models.Publisher) error {
+    publisher.Normalize()
+    db := r.db.WithContext(ctx)
+    err := db.Create(publisher).Error
+    return duplicateName(db, &models.Publisher{}, "publisher", publisher.Name, publisher.NameKey, publisher.ID, err)
+}
+
+func (r *GormBookRepository) UpdatePublisher(ctx context.Context, publisher *models.Publisher) error {
+    publisher.Normalize()
+    db := r.db.WithContext(ctx)
+    err := db.Transaction(func(tx *gorm.DB) error {
+        result := tx.Model(publisher).Select("*").Omit("created_at").Updates(publisher)
+        if result.Error != nil {
+            return result.Error
+        }
+        if result.RowsAffected == 0 {
+            return ErrNotFound
+        }
+        if err := tx.First(publisher, publisher.ID).Error; err != nil {
+            return err
+        }
+        return renameBooks(tx, "publisher", publisher.ID, publisher.Name)
+    })
+    return duplicateName(db, &models.Publisher{}, "publisher", publisher.Name, publisher.NameKey, publisher.ID, err)
+}
+
+func (r *GormBookRepository) DeletePublisher(ctx context.Context, id uint) error {
+    return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+        books, err := referencingBooks(tx, "publisher", id)
+        if err != nil {
+            return err
+        }
+        if books > 0 {
+            return ErrInUse
+        }
+        return deleteRecord(tx, &models.Publisher{}, id)
+    })
+}
+
+func (r *GormBookRepository) MergePublishers(ctx context.Context, sourceID, targetID uint) (int64, error) {
+    var moved int64
+    err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+        var target models.Publisher
+        if err := tx.First(&target, targetID).Error; err != nil {
+            if errors.Is(err, gorm.ErrRecordNotFound) {
+                return fmt.Errorf("%w: %d", ErrUnknownPublisher, targetID)
+            }
+            return err
+        }
+        if err := tx.First(&models.Publisher{}, sourceID).Error; err != nil {
+            if errors.Is(err, gorm.ErrRecordNotFound) {
+                return ErrNotFound
+            }
+            return err
+        }
+
+        var err error
+        if moved, err = moveBooks(tx, "publisher", sourceID, targetID, target.Name); err != nil {
+            return err
+        }
+        return deleteRecord(tx, &models.Publisher{}, sourceID)
+    })
+    return moved, err
+}
+
+func (r *GormBookRepository) ListGenres(ctx context.Context) ([]GenreCount, error) {
+    db := r.db.WithContext(ctx)
+    var genres []models.Genre
+    if err := db.Find(&genres).Error; err != nil {
+        return nil, err
+    }
+    books, err := bookCounts(db, "genre_id")
+    if err != nil {
+        return nil, err
+    }
+    return countGenres(genres, books), nil
+}
+
+func (r *GormBookRepository) GetGenre(ctx context.Context, id uint) (*models.Genre, error) {
+    var genre models.Genre
+    if err := r.db.WithContext(ctx).First(&genre, id).Error; err != nil {
+        if errors.Is(err, gorm.ErrRecordNotFound) {
+            return nil, ErrNotFound
+        }
+        return nil, err
+    }
+    return &genre, nil
+}
+
+// checkGenreParent returns ErrUnknownGenre if the parent of genre doesn't
+// exist, and ErrGenreCycle if genre is the parent or one of its ancestors.
+func checkGenreParent(tx *gorm.DB, genre *models.Genre) error {
+    for parentID := genre.ParentID; parentID != nil; {
+        if *parentID == genre.ID {
+            return ErrGenreCycle
+        }
+        var parent models.Genre
+        if err := tx.Select("id", "parent_id").First(&parent, *parentID).Error; err != nil {
+            if errors.Is(err, gorm.ErrRecordNotFound) {
+                return fmt.Errorf("%w: %d", ErrUnknownGenre, *parentID)
+            }
+            return err
+        }
+        parentID = parent.ParentID
+    }
+    return nil
+}
+
+func (r *GormBookRepository) CreateGenre(ctx context.Context, genre *models.Genre) error {
+    genre.Normalize()
+    db := r.db.WithContext(ctx)
+    err := db.Transaction(func(tx *gorm.DB) error {
+        if err := checkGenreParent(tx, genre); err != nil {
+            return err
+        }
+        return tx.Create(genre).Error
+    })
+    return duplicateName(db, &models.Genre{}, "genre", genre.Name, genre.NameKey, genre.ID, err)
+}
+
+func (r *GormBookRepository) UpdateGenre(ctx context.Context, genre *models.Genre) error {
+    genre.Normalize()
+    db := r.db.WithContext(ctx)
+    err := db.Transaction(func(tx *gorm.DB) error {
+        if err := tx.Select("id").First(&models.Genre{}, genre.ID).Error; err != nil {
+            if errors.Is(err, gorm.ErrRecordNotFound) {
+                return ErrNotFound
+            }
+            return err
+        }
+        if err := checkGenreParent(tx, genre); err != nil {
+            return err
+        }
+        if err := tx.Model(genre).Select("*").Omit("created_at").Updates(genre).Error; err != nil {
+            return err
+        }
+        if err := tx.First(genre, genre.ID).Error; err != nil {
+            return err
+        }
+        return renameBooks(tx, "genre", genre.ID, genre.Name)
+    })
+    return duplicateName(db, &models.Genre{}, "genre", genre.Name, genre.NameKey, genre.ID, err)
+}
+
+func (r *GormBookRepository) DeleteGenre(ctx context.Context, id uint) error {
+    return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+        books, err := referencingBooks(tx, "genre", id)
+        if err != nil {
+            return err
+        }
+        var subgenres int64
+        if err := tx.Model(&models.Genre{}).Where("parent_id = ?", id).Count(&subgenres).Error; err != nil {
+            return err
+        }
+        if books > 0 || subgenres > 0 {
+            return ErrInUse
+        }
+        return deleteRecord(tx, &models.Genre{}, id)
+    })
+}
+
+func (r *GormBookRepository) MergeGenres(ctx context.Context, sourceID, targetID uint) (int64, error) {
+    var moved int64
+    err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+        var target models.Genre
+        if err := tx.First(&target, targetID).Error; err != nil {
+            if errors.Is(err, gorm.ErrRecordNotFound) {
+                return fmt.Errorf("%w: %d", ErrUnknownGenre, targetID)
+            }
+            return err
+        }
+        if err := tx.First(&models.Genre{}, sourceID).Error; err != nil {
+            if errors.Is(err, gorm.ErrRecordNotFound) {
+                return ErrNotFound
+            }
+            return err
+        }
+        // The target must not be the source or below it, since the subgenres
+        // of the source move to the target.
+        if err := checkGenreParent(tx, &models.Genre{ID: sourceID, ParentID: &targetID}); err != nil {
+            return err
+        }
+
+        if err := tx.Model(&models.Genre{}).Where("parent_id = ?", sourceID).Update("parent_id", targetID).Error; err != nil {
+            return err
+        }
+        var err error
+        if moved, err = moveBooks(tx, "genre", sourceID, targetID, target.Name); err != nil {
+            return err
+        }
+        return deleteRecord(tx, &models.Genre{}, sourceID)
+    })
+    return moved, err
+}
+
+// deleteRecord deletes the record of model with the given ID, or returns ErrNotFound.
+func deleteRecord(tx *gorm.DB, model interface{}, id uint) error {
+    result := tx.Delete(model, id)
+    if result.Error != nil {
+        return result.Error
+    }
+    if result.RowsAffected == 0 {
+        return ErrNotFound
+    }
+    return nil
+}
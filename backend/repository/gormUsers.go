@@ -0,0 +1,113 @@
+package repository
+
+import (
+	"book-manager/models"
+	"context"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+func (r *GormBookRepository) CreateUser(ctx context.Context, user *models.User) error {
+    if user.Role == "" {
+        user.Role = models.UserViewer
+    }
+    err := r.db.WithContext(ctx).Create(user).Error
+    if errors.Is(err, gorm.ErrDuplicatedKey) {
+        return ErrUsernameTaken
+    }
+    return err
+}
+
+func (r *GormBookRepository) ListUsers(ctx context.Context) ([]models.User, error) {
+    users := []models.User{}
+    err := r.db.WithContext(ctx).Order("username").Find(&users).Error
+    return users, err
+}
+
+func (r *GormBookRepository) SetUserRole(ctx context.Context, id uint, role string) (*models.User, error) {
+    var user models.User
+    err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+        if err := first(tx, &user, id); err != nil {
+            return err
+        }
+        if user.Role == models.UserAdmin && role != models.UserAdmin {
+            var admins int64
+            if err := tx.Model(&models.User{}).Where("role = ?", models.UserAdmin).Count(&admins).Error; err != nil {
+                return err
+            }
+            if admins == 1 {
+                return ErrLastAdmin
+            }
+        }
+        user.Role = role
+        return tx.Model(&user).Update("role", role).Error
+    })
+    if err != nil {
+        return nil, err
+    }
+    return &user, nil
+}
+
+// first loads the record matching the conditions into dest, or returns ErrNotFound.
+func first(db *gorm.DB, dest interface{}, conditions ...interface{}) error {
+    if err := db.First(dest, conditions...).Error; err != nil {
+        if errors.Is(err, gorm.ErrRecordNotFound) {
+            return ErrNotFound
+        }
+        return err
+    }
+    return nil
+}
+
+func (r *GormBookRepository) GetUser(ctx context.Context, id uint) (*models.User, error) {
+    var user models.User
+    if err := first(r.db.WithContext(ctx), &user, id); err != nil {
+        return nil, err
+    }
+    return &user, nil
+}
+
+func (r *GormBookRepository) GetUserByName(ctx context.Context, username string) (*models.User, error) {
+    var user models.User
+    if err := first(r.db.WithContext(ctx), &user, "username = ?", username); err != nil {
+        return nil, err
+    }
+    return &user, nil
+}
+
+func (r *GormBookRepository) CreateSession(ctx context.Context, session *models.Session) error {
+    return r.db.WithContext(ctx).Create(session).Error
+}
+
+func (r *GormBookRepository) GetSession(ctx context.Context, id string) (*models.Session, error) {
+    var session models.Session
+    if err := first(r.db.WithContext(ctx), &session, "id = ?", id); err != nil {
+        return nil, err
+    }
+    return &session, nil
+}
+
+func (r *GormBookRepository) RotateSession(ctx context.Context, id, refreshID, newRefreshID string) error {
+    db := r.db.WithContext(ctx)
+    result := db.Model(&models.Session{}).
+        Where("id = ? AND refresh_id = ? AND revoked_at IS NULL AND expires_at > ?", id, refreshID, time.Now()).
+        Update("refresh_id", newRefreshID)
+    if result.Error != nil {
+        return result.Error
+    }
+    if result.RowsAffected == 0 {
+        if err := r.RevokeSession(ctx, id); err != nil {
+            return err
+        }
+        return ErrInvalidSession
+    }
+    return nil
+}
+
+func (r *GormBookRepository) RevokeSession(ctx context.Context, id string) error {
+    return r.db.WithContext(ctx).Model(&models.Session{}).
+        Where("id = ? AND revoked_at IS NULL", id).
+        Update("revoked_at", time.Now()).Error
+}
@@ -0,0 +1,375 @@
+package repository
+
+import (
+	"book-manager/models"
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// MemoryBookRepository is a BookRepository that keeps books in memory. It is
+// meant for tests and local experiments.
+type MemoryBookRepository struct {
+    mu              sync.RWMutex
+    books           map[uint]models.Book
+    nextID          uint
+    authors         map[uint]models.Author
+    nextAuthorID    uint
+    credits         []models.BookAuthor
+    publishers      map[uint]models.Publisher
+    nextPublisherID uint
+    genres          map[uint]models.Genre
+    nextGenreID     uint
+    tags            []models.BookTag
+    covers          map[uint]models.BookCover
+    users           map[uint]models.User
+    nextUserID      uint
+    sessions        map[string]models.Session
+    apiKeys         map[uint]models.APIKey
+    nextAPIKeyID    uint
+    audit           []models.AuditEntry
+}
+
+// NewMemoryBookRepository returns an empty in-memory repository.
+func NewMemoryBookRepository() *MemoryBookRepository {
+    return &MemoryBookRepository{
+        books:           map[uint]models.Book{},
+        nextID:          1,
+        authors:         map[uint]models.Author{},
+        nextAuthorID:    1,
+        publishers:      map[uint]models.Publisher{},
+        nextPublisherID: 1,
+        genres:          map[uint]models.Genre{},
+        nextGenreID:     1,
+        covers:          map[uint]models.BookCover{},
+        users:           map[uint]models.User{},
+        nextUserID:      1,
+        sessions:        map[string]models.Session{},
+        apiKeys:         map[uint]models.APIKey{},
+        nextAPIKeyID:    1,
+    }
+}
+
+func (r *MemoryBookRepository) List(ctx context.Context, q *BookQuery) (*BookPage, error) {
+    r.mu.RLock()
+    defer r.mu.RUnlock()
+
+    var matching []models.Book
+    tags := r.tagSets()
+    for _, book := range r.books {
+        if book.DeletedAt.Valid == q.Trashed && q.matches(&book) && q.matchesTags(tags[book.ID]) {
+            matching = append(matching, book)
+        }
+    }
+    sort.Slice(matching, func(i, j int) bool { return q.less(&matching[i], &matching[j]) })
+
+    page := &BookPage{Books: []models.Book{}, Total: int64(len(matching))}
+    skipped := 0
+    for i := range matching {
+        if !q.afterCursor(&matching[i]) {
+            continue
+        }
+        if skipped < q.Offset {
+            skipped++
+            continue
+        }
+        if len(page.Books) == q.Limit {
+            page.NextCursor = q.nextCursor(&page.Books[len(page.Books)-1])
+            break
+        }
+        page.Books = append(page.Books, matching[i])
+    }
+    return page, nil
+}
+
+func (r *MemoryBookRepository) Export(ctx context.Context, q *BookQuery, fn func(book *models.Book) error) error {
+    // The books are copied so that fn runs without holding the lock.
+    r.mu.RLock()
+    var matching []models.Book
+    tags := r.tagSets()
+    for _, book := range r.books {
+        if book.DeletedAt.Valid == q.Trashed && q.matches(&book) && q.matchesTags(tags[book.ID]) {
+            matching = append(matching, book)
+        }
+    }
+    r.mu.RUnlock()
+
+    sort.Slice(matching, func(i, j int) bool { return q.less(&matching[i], &matching[j]) })
+    for i := range matching {
+        if err := fn(&matching[i]); err != nil {
+            return err
+        }
+    }
+    return nil
+}
+
+func (r *MemoryBookRepository) Get(ctx context.Context, id uint) (*models.Book, error) {
+    r.mu.RLock()
+    defer r.mu.RUnlock()
+
+    book, ok := r.books[id]
+    if !ok || book.DeletedAt.Valid {
+        return nil, ErrNotFound
+    }
+    return &book, nil
+}
+
+func (r *MemoryBookRepository) GetIncludingTrash(ctx context.Context, id uint) (*models.Book, error) {
+    r.mu.RLock()
+    defer r.mu.RUnlock()
+
+    book, ok := r.books[id]
+    if !ok {
+        return nil, ErrNotFound
+    }
+    return &book, nil
+}
+
+func (r *MemoryBookRepository) ReferencingBookIDs(ctx context.Context, kind string, id uint) ([]uint, error) {
+    r.mu.RLock()
+    defer r.mu.RUnlock()
+
+    ids := []uint{}
+    switch kind {
+    case RefPublisher, RefGenre:
+        ref := bookPublisherID
+        if kind == RefGenre {
+            ref = bookGenreID
+        }
+        for bookID, book := range r.books {
+            if sameID(ref(&book), &id) {
+                ids = append(ids, bookID)
+            }
+        }
+    case RefAuthor:
+        credited := map[uint]bool{}
+        for _, credit := range r.credits {
+            if credit.AuthorID == id && !credited[credit.BookID] {
+                credited[credit.BookID] = true
+                ids = append(ids, credit.BookID)
+            }
+        }
+    default:
+        return nil, fmt.Errorf("unknown reference %q", kind)
+    }
+    sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+    return ids, nil
+}
+
+func (r *MemoryBookRepository) Create(ctx context.Context, book *models.Book) error {
+    r.mu.Lock()
+    defer r.mu.Unlock()
+
+    book.Normalize()
+    if err := r.duplicateISBN(book); err != nil {
+        return err
+    }
+    if err := r.linkTaxonomies(book, &models.Book{}); err != nil {
+        return err
+    }
+    now := time.Now()
+    book.ID, book.Version = r.nextID, 1
+    book.CreatedAt, book.UpdatedAt = now, now
+    r.nextID++
+    r.books[book.ID] = *book
+    r.linkAuthorNames(book.ID, book.Author)
+    return nil
+}
+
+func (r *MemoryBookRepository) Update(ctx context.Context, book *models.Book) error {
+    r.mu.Lock()
+    defer r.mu.Unlock()
+
+    existing, ok := r.books[book.ID]
+    if !ok || existing.DeletedAt.Valid {
+        return ErrNotFound
+    }
+    if existing.Version != book.Version {
+        return ErrVersionConflict
+    }
+    book.Normalize()
+    if err := r.duplicateISBN(book); err != nil {
+        return err
+    }
+    if err := r.linkTaxonomies(book, &existing); err != nil {
+        return err
+    }
+    book.UpdatedAt = time.Now()
+    book.Version++
+    r.books[book.ID] = *book
+    if existing.Author != book.Author {
+        r.linkAuthorNames(book.ID, book.Author)
+    }
+    return nil
+}
+
+// duplicateISBN returns a *DuplicateISBNError if another book, trashed or not,
+// has the ISBN of book. The caller must hold the lock.
+func (r *MemoryBookRepository) duplicateISBN(book *models.Book) error {
+    if book.ISBN13 == nil {
+        return nil
+    }
+    for id, other := range r.books {
+        if id != book.ID && other.ISBN13 != nil && *other.ISBN13 == *book.ISBN13 {
+            return &DuplicateISBNError{ISBN13: *book.ISBN13, ExistingID: id}
+        }
+    }
+    return nil
+}
+
+func (r *MemoryBookRepository) Delete(ctx context.Context, id, version uint) error {
+    r.mu.Lock()
+    defer r.mu.Unlock()
+
+    book, ok := r.books[id]
+    if ok && version != 0 && (book.DeletedAt.Valid || book.Version != version) {
+        return ErrVersionConflict
+    }
+    if !ok || book.DeletedAt.Valid {
+        return ErrNotFound
+    }
+    book.DeletedAt = gorm.DeletedAt{Time: time.Now(), Valid: true}
+    r.books[id] = book
+    return nil
+}
+
+func (r *MemoryBookRepository) Restore(ctx context.Context, id uint) (*models.Book, error) {
+    r.mu.Lock()
+    defer r.mu.Unlock()
+
+    book, ok := r.books[id]
+    if !ok || !book.DeletedAt.Valid {
+        return nil, ErrNotFound
+    }
+    book.DeletedAt = gorm.DeletedAt{}
+    book.Version++
+    r.books[id] = book
+    return &book, nil
+}
+
+func (r *MemoryBookRepository) Purge(ctx context.Context, id, version uint) error {
+    r.mu.Lock()
+    defer r.mu.Unlock()
+
+    book, ok := r.books[id]
+    if !ok {
+        return ErrNotFound
+    }
+    if version != 0 && (book.DeletedAt.Valid || book.Version != version) {
+        return ErrVersionConflict
+    }
+    delete(r.books, id)
+    r.removeCredits(func(c *models.BookAuthor) bool { return c.BookID == id })
+    r.removeTags(func(t *models.BookTag) bool { return t.BookID == id })
+    return nil
+}
+
+func (r *MemoryBookRepository) PurgeTrash(ctx context.Context, before time.Time) (int64, error) {
+    r.mu.Lock()
+    defer r.mu.Unlock()
+
+    var count int64
+    for id, book := range r.books {
+        if book.DeletedAt.Valid && book.DeletedAt.Time.Before(before) {
+            delete(r.books, id)
+            count++
+        }
+    }
+    r.removeCredits(func(c *models.BookAuthor) bool {
+        _, ok := r.books[c.BookID]
+        return !ok
+    })
+    r.removeTags(func(t *models.BookTag) bool {
+        _, ok := r.books[t.BookID]
+        return !ok
+    })
+    return count, nil
+}
+
+func (r *MemoryBookRepository) Search(ctx context.Context, q string, limit int) ([]SearchHit, error) {
+    terms := parseSearchQuery(q)
+    if len(terms) == 0 {
+        return []SearchHit{}, nil
+    }
+
+    r.mu.RLock()
+    defer r.mu.RUnlock()
+
+    hits := []SearchHit{}
+    for _, book := range r.books {
+        if book.DeletedAt.Valid {
+            continue
+        }
+        if hit, ok := scoreBook(book, terms); ok {
+            hits = append(hits, hit)
+        }
+    }
+    sort.Slice(hits, func(i, j int) bool { return hits[i].Book.ID < hits[j].Book.ID })
+    return rankHits(hits, limit), nil
+}
+
+// Transaction runs fn on a copy of the repository, which replaces the
+// repository's records if fn succeeds. Other calls block until it is done.
+func (r *MemoryBookRepository) Transaction(ctx context.Context, fn func(tx BookRepository) error) error {
+    r.mu.Lock()
+    defer r.mu.Unlock()
+
+    tx := &MemoryBookRepository{
+        books:           make(map[uint]models.Book, len(r.books)),
+        nextID:          r.nextID,
+        authors:         make(map[uint]models.Author, len(r.authors)),
+        nextAuthorID:    r.nextAuthorID,
+        credits:         append([]models.BookAuthor(nil), r.credits...),
+        publishers:      make(map[uint]models.Publisher, len(r.publishers)),
+        nextPublisherID: r.nextPublisherID,
+        genres:          make(map[uint]models.Genre, len(r.genres)),
+        nextGenreID:     r.nextGenreID,
+        tags:            append([]models.BookTag(nil), r.tags...),
+        covers:          make(map[uint]models.BookCover, len(r.covers)),
+        users:           make(map[uint]models.User, len(r.users)),
+        nextUserID:      r.nextUserID,
+        sessions:        make(map[string]models.Session, len(r.sessions)),
+        apiKeys:         make(map[uint]models.APIKey, len(r.apiKeys)),
+        nextAPIKeyID:    r.nextAPIKeyID,
+        audit:           append([]models.AuditEntry(nil), r.audit...),
+    }
+    for id, book := range r.books {
+        tx.books[id] = book
+    }
+    for id, author := range r.authors {
+        tx.authors[id] = author
+    }
+    for id, publisher := range r.publishers {
+        tx.publishers[id] = publisher
+    }
+    for id, genre := range r.genres {
+        tx.genres[id] = genre
+    }
+    for id, cover := range r.covers {
+        tx.covers[id] = cover
+    }
+    for id, user := range r.users {
+        tx.users[id] = user
+    }
+    for id, session := range r.sessions {
+        tx.sessions[id] = session
+    }
+    for id, key := range r.apiKeys {
+        tx.apiKeys[id] = key
+    }
+    if err := fn(tx); err != nil {
+        return err
+    }
+    r.books, r.nextID = tx.books, tx.nextID
+    r.authors, r.nextAuthorID, r.credits = tx.authors, tx.nextAuthorID, tx.credits
+    r.publishers, r.nextPublisherID = tx.publishers, tx.nextPublisherID
+    r.genres, r.nextGenreID = tx.genres, tx.nextGenreID
+    r.tags, r.covers = tx.tags, tx.covers
+    r.users, r.nextUserID, r.sessions = tx.users, tx.nextUserID, tx.sessions
+    r.apiKeys, r.nextAPIKeyID, r.audit = tx.apiKeys, tx.nextAPIKeyID, tx.audit
+    return nil
+}
@@ -0,0 +1,104 @@
+package repository
+
+import (
+	"book-manager/models"
+	"context"
+	"sort"
+	"time"
+)
+
+func (r *MemoryBookRepository) CreateAPIKey(ctx context.Context, key *models.APIKey) error {
+    r.mu.Lock()
+    defer r.mu.Unlock()
+
+    key.ID = r.nextAPIKeyID
+    key.CreatedAt = time.Now()
+    r.nextAPIKeyID++
+    r.apiKeys[key.ID] = cloneAPIKey(*key)
+    return nil
+}
+
+func (r *MemoryBookRepository) ListAPIKeys(ctx context.Context) ([]models.APIKey, error) {
+    r.mu.RLock()
+    defer r.mu.RUnlock()
+
+    keys := []models.APIKey{}
+    for _, key := range r.apiKeys {
+        keys = append(keys, cloneAPIKey(key))
+    }
+    sort.Slice(keys, func(i, j int) bool { return keys[i].ID < keys[j].ID })
+    return keys, nil
+}
+
+func (r *MemoryBookRepository) GetAPIKey(ctx context.Context, id uint) (*models.APIKey, error) {
+    r.mu.RLock()
+    defer r.mu.RUnlock()
+
+    key, ok := r.apiKeys[id]
+    if !ok {
+        return nil, ErrNotFound
+    }
+    key = cloneAPIKey(key)
+    return &key, nil
+}
+
+func (r *MemoryBookRepository) GetAPIKeyByHash(ctx context.Context, hash string) (*models.APIKey, error) {
+    r.mu.RLock()
+    defer r.mu.RUnlock()
+
+    for _, key := range r.apiKeys {
+        if key.Hash == hash {
+            key = cloneAPIKey(key)
+            return &key, nil
+        }
+    }
+    return nil, ErrNotFound
+}
+
+func (r *MemoryBookRepository) RotateAPIKey(ctx context.Context, id uint, prefix, hash string) (*models.APIKey, error) {
+    r.mu.Lock()
+    defer r.mu.Unlock()
+
+    key, ok := r.apiKeys[id]
+    if !ok {
+        return nil, ErrNotFound
+    }
+    now := time.Now()
+    key.Prefix, key.Hash, key.RotatedAt = prefix, hash, &now
+    r.apiKeys[id] = key
+    key = cloneAPIKey(key)
+    return &key, nil
+}
+
+func (r *MemoryBookRepository) RevokeAPIKey(ctx context.Context, id uint) error {
+    r.mu.Lock()
+    defer r.mu.Unlock()
+
+    key, ok := r.apiKeys[id]
+    if !ok {
+        return ErrNotFound
+    }
+    if key.RevokedAt == nil {
+        now := time.Now()
+        key.RevokedAt = &now
+        r.apiKeys[id] = key
+    }
+    return nil
+}
+
+func (r *MemoryBookRepository) TouchAPIKey(ctx context.Context, id uint, usedAt time.Time) error {
+    r.mu.Lock()
+    defer r.mu.Unlock()
+
+    if key, ok := r.apiKeys[id]; ok {
+        key.LastUsedAt = &usedAt
+        r.apiKeys[id] = key
+    }
+    return nil
+}
+
+// cloneAPIKey copies the scopes of key, so that callers can't change the stored key.
+func cloneAPIKey(key models.APIKey) models.APIKey {
+    key.Scopes = append([]string(nil), key.Scopes...)
+    return key
+}
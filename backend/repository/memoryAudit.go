@@ -0,0 +1,41 @@
+package repository
+
+import (
+	"book-manager/models"
+	"context"
+	"time"
+)
+
+func (r *MemoryBookRepository) CreateAuditEntry(ctx context.Context, entry *models.AuditEntry) error {
+    r.mu.Lock()
+    defer r.mu.Unlock()
+
+    entry.ID = uint(len(r.audit)) + 1
+    entry.CreatedAt = time.Now()
+    r.audit = append(r.audit, *entry)
+    return nil
+}
+
+func (r *MemoryBookRepository) ListAuditEntries(ctx context.Context, q *AuditQuery) ([]models.AuditEntry, int64, error) {
+    r.mu.RLock()
+    defer r.mu.RUnlock()
+
+    entries := []models.AuditEntry{}
+    var total int64
+    // Entries are appended in ID order, so walking backwards returns the newest first.
+    for i := len(r.audit) - 1; i >= 0; i-- {
+        entry := r.audit[i]
+        if (q.BookID != 0 && entry.BookID != q.BookID) ||
+            (q.Version != 0 && entry.Version != q.Version) ||
+            (q.Actor != "" && entry.Actor != q.Actor) ||
+            (!q.Since.IsZero() && entry.CreatedAt.Before(q.Since)) ||
+            (!q.Until.IsZero() && !entry.CreatedAt.Before(q.Until)) {
+            continue
+        }
+        total++
+        if total > int64(q.Offset) && len(entries) < q.Limit {
+            entries = append(entries, entry)
+        }
+    }
+    return entries, total, nil
+}
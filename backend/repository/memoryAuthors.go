@@ -0,0 +1,270 @@
+package repository
+
+import (
+	"book-manager/models"
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+func (r *MemoryBookRepository) ListAuthors(ctx context.Context, name string, limit, offset int) ([]models.Author, int64, error) {
+    r.mu.RLock()
+    defer r.mu.RUnlock()
+
+    key := models.AuthorNameKey(name)
+    var matching []models.Author
+    for _, author := range r.authors {
+        if strings.Contains(author.NameKey, key) {
+            matching = append(matching, author)
+        }
+    }
+    sort.Slice(matching, func(i, j int) bool {
+        if matching[i].NameKey != matching[j].NameKey {
+            return matching[i].NameKey < matching[j].NameKey
+        }
+        return matching[i].ID < matching[j].ID
+    })
+
+    authors := []models.Author{}
+    for i := offset; i < len(matching) && len(authors) < limit; i++ {
+        authors = append(authors, matching[i])
+    }
+    return authors, int64(len(matching)), nil
+}
+
+func (r *MemoryBookRepository) GetAuthor(ctx context.Context, id uint) (*models.Author, error) {
+    r.mu.RLock()
+    defer r.mu.RUnlock()
+
+    author, ok := r.authors[id]
+    if !ok {
+        return nil, ErrNotFound
+    }
+    return &author, nil
+}
+
+func (r *MemoryBookRepository) CreateAuthor(ctx context.Context, author *models.Author) error {
+    r.mu.Lock()
+    defer r.mu.Unlock()
+
+    author.Normalize()
+    if err := r.duplicateAuthor(author); err != nil {
+        return err
+    }
+    now := time.Now()
+    author.ID = r.nextAuthorID
+    author.CreatedAt, author.UpdatedAt = now, now
+    r.nextAuthorID++
+    r.authors[author.ID] = *author
+    return nil
+}
+
+func (r *MemoryBookRepository) UpdateAuthor(ctx context.Context, author *models.Author) error {
+    r.mu.Lock()
+    defer r.mu.Unlock()
+
+    existing, ok := r.authors[author.ID]
+    if !ok {
+        return ErrNotFound
+    }
+    author.Normalize()
+    if err := r.duplicateAuthor(author); err != nil {
+        return err
+    }
+    author.CreatedAt, author.UpdatedAt = existing.CreatedAt, time.Now()
+    r.authors[author.ID] = *author
+
+    synced := map[uint]bool{}
+    for _, credit := range r.credits {
+        if credit.AuthorID == author.ID && credit.Role == models.RoleAuthor && !synced[credit.BookID] {
+            synced[credit.BookID] = true
+            r.syncAuthorString(credit.BookID)
+        }
+    }
+    return nil
+}
+
+// duplicateAuthor returns a *DuplicateAuthorError if another author has the
+// name of author. The caller must hold the lock.
+func (r *MemoryBookRepository) duplicateAuthor(author *models.Author) error {
+    if id, ok := r.authorByKey(author.NameKey); ok && id != author.ID {
+        return &DuplicateAuthorError{Name: author.Name, ExistingID: id}
+    }
+    return nil
+}
+
+// authorByKey returns the ID of the author with the given name key. The
+// caller must hold the lock.
+func (r *MemoryBookRepository) authorByKey(key string) (uint, bool) {
+    for id, author := range r.authors {
+        if author.NameKey == key {
+            return id, true
+        }
+    }
+    return 0, false
+}
+
+func (r *MemoryBookRepository) DeleteAuthor(ctx context.Context, id uint) error {
+    r.mu.Lock()
+    defer r.mu.Unlock()
+
+    if _, ok := r.authors[id]; !ok {
+        return ErrNotFound
+    }
+    for _, credit := range r.credits {
+        if credit.AuthorID == id {
+            return ErrInUse
+        }
+    }
+    delete(r.authors, id)
+    return nil
+}
+
+func (r *MemoryBookRepository) BookAuthors(ctx context.Context, bookID uint) ([]models.Contributor, error) {
+    r.mu.RLock()
+    defer r.mu.RUnlock()
+
+    if book, ok := r.books[bookID]; !ok || book.DeletedAt.Valid {
+        return nil, ErrNotFound
+    }
+    return r.contributors(bookID), nil
+}
+
+// contributors returns the credits of a book in order. The caller must hold the lock.
+func (r *MemoryBookRepository) contributors(bookID uint) []models.Contributor {
+    var credits []models.BookAuthor
+    for _, credit := range r.credits {
+        if credit.BookID == bookID {
+            credits = append(credits, credit)
+        }
+    }
+    sort.Slice(credits, func(i, j int) bool {
+        if credits[i].Position != credits[j].Position {
+            return credits[i].Position < credits[j].Position
+        }
+        return credits[i].AuthorID < credits[j].AuthorID
+    })
+
+    contributors := []models.Contributor{}
+    for _, credit := range credits {
+        contributors = append(contributors, models.Contributor{
+            AuthorID: credit.AuthorID,
+            Name:     r.authors[credit.AuthorID].Name,
+            Role:     credit.Role,
+        })
+    }
+    return contributors
+}
+
+func (r *MemoryBookRepository) SetBookAuthors(ctx context.Context, bookID uint, credits []models.BookAuthor) (*models.Book, error) {
+    r.mu.Lock()
+    defer r.mu.Unlock()
+
+    if book, ok := r.books[bookID]; !ok || book.DeletedAt.Valid {
+        return nil, ErrNotFound
+    }
+    for _, credit := range credits {
+        if _, ok := r.authors[credit.AuthorID]; !ok {
+            return nil, fmt.Errorf("%w: %d", ErrUnknownAuthor, credit.AuthorID)
+        }
+    }
+
+    r.removeCredits(func(c *models.BookAuthor) bool { return c.BookID == bookID })
+    for i, credit := range credits {
+        credit.BookID, credit.Position = bookID, i
+        r.addCredit(credit)
+    }
+    r.syncAuthorString(bookID)
+
+    book := r.books[bookID]
+    return &book, nil
+}
+
+func (r *MemoryBookRepository) AuthorBooks(ctx context.Context, authorID uint) ([]AuthorBook, error) {
+    r.mu.RLock()
+    defer r.mu.RUnlock()
+
+    if _, ok := r.authors[authorID]; !ok {
+        return nil, ErrNotFound
+    }
+    books := []AuthorBook{}
+    for _, credit := range r.credits {
+        if book, ok := r.books[credit.BookID]; ok && credit.AuthorID == authorID && !book.DeletedAt.Valid {
+            books = append(books, AuthorBook{Role: credit.Role, Book: book})
+        }
+    }
+    sort.Slice(books, func(i, j int) bool {
+        a, b := &books[i], &books[j]
+        if a.Book.Year != b.Book.Year {
+            return a.Book.Year < b.Book.Year
+        }
+        if a.Book.ID != b.Book.ID {
+            return a.Book.ID < b.Book.ID
+        }
+        return a.Role < b.Role
+    })
+    return books, nil
+}
+
+// linkAuthorNames credits the names in the author string of a book in the
+// author role, like the GORM version. The caller must hold the lock.
+func (r *MemoryBookRepository) linkAuthorNames(bookID uint, authors string) {
+    r.removeCredits(func(c *models.BookAuthor) bool { return c.BookID == bookID && c.Role == models.RoleAuthor })
+    for position, name := range models.SplitAuthorNames(authors) {
+        author := models.Author{Name: name}
+        author.Normalize()
+        if id, ok := r.authorByKey(author.NameKey); ok {
+            author.ID = id
+        } else {
+            now := time.Now()
+            author.ID = r.nextAuthorID
+            author.CreatedAt, author.UpdatedAt = now, now
+            r.nextAuthorID++
+            r.authors[author.ID] = author
+        }
+        r.addCredit(models.BookAuthor{BookID: bookID, AuthorID: author.ID, Role: models.RoleAuthor, Position: position})
+    }
+}
+
+// syncAuthorString sets the Author string of a book to the names of the
+// authors credited in the author role. The caller must hold the lock.
+func (r *MemoryBookRepository) syncAuthorString(bookID uint) {
+    var names []string
+    for _, contributor := range r.contributors(bookID) {
+        if contributor.Role == models.RoleAuthor {
+            names = append(names, contributor.Name)
+        }
+    }
+    book, ok := r.books[bookID]
+    if !ok || len(names) == 0 || book.Author == models.JoinAuthorNames(names) {
+        return
+    }
+    book.Author = models.JoinAuthorNames(names)
+    book.Version++
+    book.UpdatedAt = time.Now()
+    r.books[bookID] = book
+}
+
+// addCredit adds a credit unless it exists. The caller must hold the lock.
+func (r *MemoryBookRepository) addCredit(credit models.BookAuthor) {
+    for _, c := range r.credits {
+        if c.BookID == credit.BookID && c.AuthorID == credit.AuthorID && c.Role == credit.Role {
+            return
+        }
+    }
+    r.credits = append(r.credits, credit)
+}
+
+// removeCredits removes the credits for which remove returns true. The caller
+// must hold the lock.
+func (r *MemoryBookRepository) removeCredits(remove func(c *models.BookAuthor) bool) {
+    kept := r.credits[:0]
+    for i := range r.credits {
+        if !remove(&r.credits[i]) {
+            kept = append(kept, r.credits[i])
+        }
+    }
+    r.credits = kept
+}
@@ -0,0 +1,75 @@
+package repository
+
+import (
+	"book-manager/models"
+	"context"
+	"time"
+)
+
+// liveBook returns ErrNotFound unless the book exists and isn't in the trash.
+// The caller must hold the lock.
+func (r *MemoryBookRepository) liveBook(bookID uint) error {
+    if book, ok := r.books[bookID]; !ok || book.DeletedAt.Valid {
+        return ErrNotFound
+    }
+    return nil
+}
+
+func (r *MemoryBookRepository) GetCover(ctx context.Context, bookID uint) (*models.BookCover, error) {
+    r.mu.RLock()
+    defer r.mu.RUnlock()
+
+    if err := r.liveBook(bookID); err != nil {
+        return nil, err
+    }
+    cover, ok := r.covers[bookID]
+    if !ok {
+        return nil, ErrNotFound
+    }
+    return &cover, nil
+}
+
+func (r *MemoryBookRepository) SetCover(ctx context.Context, cover *models.BookCover) (*models.BookCover, error) {
+    r.mu.Lock()
+    defer r.mu.Unlock()
+
+    if err := r.liveBook(cover.BookID); err != nil {
+        return nil, err
+    }
+    var replaced *models.BookCover
+    if previous, ok := r.covers[cover.BookID]; ok {
+        replaced = &previous
+    }
+    cover.UpdatedAt = time.Now()
+    r.covers[cover.BookID] = *cover
+    return replaced, nil
+}
+
+func (r *MemoryBookRepository) DeleteCover(ctx context.Context, bookID uint) (*models.BookCover, error) {
+    r.mu.Lock()
+    defer r.mu.Unlock()
+
+    if err := r.liveBook(bookID); err != nil {
+        return nil, err
+    }
+    cover, ok := r.covers[bookID]
+    if !ok {
+        return nil, ErrNotFound
+    }
+    delete(r.covers, bookID)
+    return &cover, nil
+}
+
+func (r *MemoryBookRepository) PurgeCovers(ctx context.Context) ([]models.BookCover, error) {
+    r.mu.Lock()
+    defer r.mu.Unlock()
+
+    covers := []models.BookCover{}
+    for bookID, cover := range r.covers {
+        if _, ok := r.books[bookID]; !ok {
+            covers = append(covers, cover)
+            delete(r.covers, bookID)
+        }
+    }
+    return covers, nil
+}
@@ -0,0 +1,112 @@
+package repository
+
+import (
+	"book-manager/models"
+	"context"
+	"sort"
+	"strings"
+)
+
+// tagSets returns the tags of every book. The caller must hold the lock.
+func (r *MemoryBookRepository) tagSets() map[uint]map[string]bool {
+    sets := map[uint]map[string]bool{}
+    for _, tag := range r.tags {
+        if sets[tag.BookID] == nil {
+            sets[tag.BookID] = map[string]bool{}
+        }
+        sets[tag.BookID][tag.Tag] = true
+    }
+    return sets
+}
+
+// bookTags returns the tags of a book in alphabetical order. The caller must hold the lock.
+func (r *MemoryBookRepository) bookTags(bookID uint) []string {
+    tags := []string{}
+    for _, tag := range r.tags {
+        if tag.BookID == bookID {
+            tags = append(tags, tag.Tag)
+        }
+    }
+    sort.Strings(tags)
+    return tags
+}
+
+// removeTags removes the tags for which remove returns true. The caller must hold the lock.
+func (r *MemoryBookRepository) removeTags(remove func(t *models.BookTag) bool) {
+    kept := r.tags[:0]
+    for i := range r.tags {
+        if !remove(&r.tags[i]) {
+            kept = append(kept, r.tags[i])
+        }
+    }
+    r.tags = kept
+}
+
+func (r *MemoryBookRepository) BookTags(ctx context.Context, bookID uint) ([]string, error) {
+    r.mu.RLock()
+    defer r.mu.RUnlock()
+
+    if book, ok := r.books[bookID]; !ok || book.DeletedAt.Valid {
+        return nil, ErrNotFound
+    }
+    return r.bookTags(bookID), nil
+}
+
+func (r *MemoryBookRepository) AddTags(ctx context.Context, bookID uint, tags []string) ([]string, error) {
+    r.mu.Lock()
+    defer r.mu.Unlock()
+
+    if book, ok := r.books[bookID]; !ok || book.DeletedAt.Valid {
+        return nil, ErrNotFound
+    }
+    existing := map[string]bool{}
+    for _, tag := range r.bookTags(bookID) {
+        existing[tag] = true
+    }
+    for _, tag := range tags {
+        if !existing[tag] {
+            existing[tag] = true
+            r.tags = append(r.tags, models.BookTag{BookID: bookID, Tag: tag})
+        }
+    }
+    return r.bookTags(bookID), nil
+}
+
+func (r *MemoryBookRepository) RemoveTags(ctx context.Context, bookID uint, tags []string) ([]string, error) {
+    r.mu.Lock()
+    defer r.mu.Unlock()
+
+    if book, ok := r.books[bookID]; !ok || book.DeletedAt.Valid {
+        return nil, ErrNotFound
+    }
+    removed := map[string]bool{}
+    for _, tag := range tags {
+        removed[tag] = true
+    }
+    r.removeTags(func(t *models.BookTag) bool { return t.BookID == bookID && removed[t.Tag] })
+    return r.bookTags(bookID), nil
+}
+
+func (r *MemoryBookRepository) ListTags(ctx context.Context, prefix string) ([]TagCount, error) {
+    r.mu.RLock()
+    defer r.mu.RUnlock()
+
+    books := map[string]int64{}
+    for _, tag := range r.tags {
+        if book := r.books[tag.BookID]; !book.DeletedAt.Valid && strings.HasPrefix(tag.Tag, prefix) {
+            books[tag.Tag]++
+        }
+    }
+
+    counts := []TagCount{}
+    for tag, n := range books {
+        counts = append(counts, TagCount{Tag: tag, Books: n})
+    }
+    sort.Slice(counts, func(i, j int) bool {
+        if counts[i].Books != counts[j].Books {
+            return counts[i].Books > counts[j].Books
+        }
+        return counts[i].Tag < counts[j].Tag
+    })
+    return counts, nil
+}
@@ -0,0 +1,358 @@
+package repository
+
+import (
+	"book-manager/models"
+	"context"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// linkTaxonomies sets the publisher and genre of book like the GORM version.
+// The IDs are checked before anything is created. The caller must hold the lock.
+func (r *MemoryBookRepository) linkTaxonomies(book, previous *models.Book) error {
+    publisherChanged := book.PublisherID != nil && !sameID(book.PublisherID, previous.PublisherID)
+    genreChanged := book.GenreID != nil && !sameID(book.GenreID, previous.GenreID)
+    if _, ok := r.publishers[derefID(book.PublisherID)]; publisherChanged && !ok {
+        return fmt.Errorf("%w: %d", ErrUnknownPublisher, *book.PublisherID)
+    }
+    if _, ok := r.genres[derefID(book.GenreID)]; genreChanged && !ok {
+        return fmt.Errorf("%w: %d", ErrUnknownGenre, *book.GenreID)
+    }
+
+    if publisherChanged {
+        book.Publisher = r.publishers[*book.PublisherID].Name
+    } else {
+        publisher := models.Publisher{Name: book.Publisher}
+        if publisher.Normalize(); publisher.NameKey == "" {
+            book.Publisher, book.PublisherID = "", nil
+        } else {
+            publisher = r.findOrCreatePublisher(publisher)
+            book.Publisher, book.PublisherID = publisher.Name, &publisher.ID
+        }
+    }
+
+    if genreChanged {
+        book.Genre = r.genres[*book.GenreID].Name
+        return nil
+    }
+    names := models.SplitGenrePath(book.Genre)
+    book.Genre, book.GenreID = "", nil
+    var parentID *uint
+    for _, name := range names {
+        genre := r.findOrCreateGenre(models.Genre{Name: name, ParentID: parentID})
+        parentID = &genre.ID
+        book.Genre, book.GenreID = genre.Name, &genre.ID
+    }
+    return nil
+}
+
+func derefID(id *uint) uint {
+    if id == nil {
+        return 0
+    }
+    return *id
+}
+
+// findOrCreatePublisher returns the publisher with the name of publisher,
+// creating it if needed. The caller must hold the lock.
+func (r *MemoryBookRepository) findOrCreatePublisher(publisher models.Publisher) models.Publisher {
+    publisher.Normalize()
+    for _, existing := range r.publishers {
+        if existing.NameKey == publisher.NameKey {
+            return existing
+        }
+    }
+    now := time.Now()
+    publisher.ID, publisher.CreatedAt, publisher.UpdatedAt = r.nextPublisherID, now, now
+    r.nextPublisherID++
+    r.publishers[publisher.ID] = publisher
+    return publisher
+}
+
+// findOrCreateGenre returns the genre with the name of genre, creating it if
+// needed. The caller must hold the lock.
+func (r *MemoryBookRepository) findOrCreateGenre(genre models.Genre) models.Genre {
+    genre.Normalize()
+    for _, existing := range r.genres {
+        if existing.NameKey == genre.NameKey {
+            return existing
+        }
+    }
+    now := time.Now()
+    genre.ID, genre.CreatedAt, genre.UpdatedAt = r.nextGenreID, now, now
+    r.nextGenreID++
+    r.genres[genre.ID] = genre
+    return genre
+}
+
+// bookCounts returns the number of live books per ID returned by id. The
+// caller must hold the lock.
+func (r *MemoryBookRepository) bookCounts(id func(book *models.Book) *uint) map[uint]int64 {
+    counts := map[uint]int64{}
+    for _, book := range r.books {
+        if ref := id(&book); ref != nil && !book.DeletedAt.Valid {
+            counts[*ref]++
+        }
+    }
+    return counts
+}
+
+// updateBooks applies update to the books, trashed or not, that refer to id,
+// bumping their versions if update changed them, and returns how many books
+// refer to id. The caller must hold the lock.
+func (r *MemoryBookRepository) updateBooks(ref func(book *models.Book) *uint, id uint, update func(book *models.Book)) int64 {
+    var count int64
+    for bookID, book := range r.books {
+        if !sameID(ref(&book), &id) {
+            continue
+        }
+        count++
+        updated := book
+        update(&updated)
+        if updated != book {
+            updated.Version++
+            updated.UpdatedAt = time.Now()
+            r.books[bookID] = updated
+        }
+    }
+    return count
+}
+
+func bookPublisherID(book *models.Book) *uint { return book.PublisherID }
+func bookGenreID(book *models.Book) *uint     { return book.GenreID }
+
+func (r *MemoryBookRepository) ListPublishers(ctx context.Context) ([]PublisherCount, error) {
+    r.mu.RLock()
+    defer r.mu.RUnlock()
+
+    books := r.bookCounts(bookPublisherID)
+    counts := []PublisherCount{}
+    for _, publisher := range r.publishers {
+        counts = append(counts, PublisherCount{Publisher: publisher, Books: books[publisher.ID]})
+    }
+    sort.Slice(counts, func(i, j int) bool {
+        a, b := &counts[i].Publisher, &counts[j].Publisher
+        if a.NameKey != b.NameKey {
+            return a.NameKey < b.NameKey
+        }
+        return a.ID < b.ID
+    })
+    return counts, nil
+}
+
+func (r *MemoryBookRepository) GetPublisher(ctx context.Context, id uint) (*models.Publisher, error) {
+    r.mu.RLock()
+    defer r.mu.RUnlock()
+
+    publisher, ok := r.publishers[id]
+    if !ok {
+        return nil, ErrNotFound
+    }
+    return &publisher, nil
+}
+
+func (r *MemoryBookRepository) CreatePublisher(ctx context.Context, publisher *models.Publisher) error {
+    r.mu.Lock()
+    defer r.mu.Unlock()
+
+    publisher.Normalize()
+    if err := r.duplicatePublisher(publisher); err != nil {
+        return err
+    }
+    *publisher = r.findOrCreatePublisher(*publisher)
+    return nil
+}
+
+func (r *MemoryBookRepository) UpdatePublisher(ctx context.Context, publisher *models.Publisher) error {
+    r.mu.Lock()
+    defer r.mu.Unlock()
+
+    existing, ok := r.publishers[publisher.ID]
+    if !ok {
+        return ErrNotFound
+    }
+    publisher.Normalize()
+    if err := r.duplicatePublisher(publisher); err != nil {
+        return err
+    }
+    publisher.CreatedAt, publisher.UpdatedAt = existing.CreatedAt, time.Now()
+    r.publishers[publisher.ID] = *publisher
+    r.updateBooks(bookPublisherID, publisher.ID, func(book *models.Book) { book.Publisher = publisher.Name })
+    return nil
+}
+
+// duplicatePublisher returns a *DuplicateNameError if another publisher has
+// the name of publisher. The caller must hold the lock.
+func (r *MemoryBookRepository) duplicatePublisher(publisher *models.Publisher) error {
+    for id, other := range r.publishers {
+        if id != publisher.ID && other.NameKey == publisher.NameKey {
+            return &DuplicateNameError{Kind: "publisher", Name: publisher.Name, ExistingID: id}
+        }
+    }
+    return nil
+}
+
+func (r *MemoryBookRepository) DeletePublisher(ctx context.Context, id uint) error {
+    r.mu.Lock()
+    defer r.mu.Unlock()
+
+    if _, ok := r.publishers[id]; !ok {
+        return ErrNotFound
+    }
+    if r.updateBooks(bookPublisherID, id, func(book *models.Book) {}) > 0 {
+        return ErrInUse
+    }
+    delete(r.publishers, id)
+    return nil
+}
+
+func (r *MemoryBookRepository) MergePublishers(ctx context.Context, sourceID, targetID uint) (int64, error) {
+    r.mu.Lock()
+    defer r.mu.Unlock()
+
+    target, ok := r.publishers[targetID]
+    if !ok {
+        return 0, fmt.Errorf("%w: %d", ErrUnknownPublisher, targetID)
+    }
+    if _, ok := r.publishers[sourceID]; !ok {
+        return 0, ErrNotFound
+    }
+    moved := r.updateBooks(bookPublisherID, sourceID, func(book *models.Book) {
+        book.PublisherID, book.Publisher = &target.ID, target.Name
+    })
+    delete(r.publishers, sourceID)
+    return moved, nil
+}
+
+func (r *MemoryBookRepository) ListGenres(ctx context.Context) ([]GenreCount, error) {
+    r.mu.RLock()
+    defer r.mu.RUnlock()
+
+    genres := make([]models.Genre, 0, len(r.genres))
+    for _, genre := range r.genres {
+        genres = append(genres, genre)
+    }
+    return countGenres(genres, r.bookCounts(bookGenreID)), nil
+}
+
+func (r *MemoryBookRepository) GetGenre(ctx context.Context, id uint) (*models.Genre, error) {
+    r.mu.RLock()
+    defer r.mu.RUnlock()
+
+    genre, ok := r.genres[id]
+    if !ok {
+        return nil, ErrNotFound
+    }
+    return &genre, nil
+}
+
+// checkGenreParent checks the parent of genre like the GORM version. The
+// caller must hold the lock.
+func (r *MemoryBookRepository) checkGenreParent(genre *models.Genre) error {
+    for parentID := genre.ParentID; parentID != nil; {
+        if *parentID == genre.ID {
+            return ErrGenreCycle
+        }
+        parent, ok := r.genres[*parentID]
+        if !ok {
+            return fmt.Errorf("%w: %d", ErrUnknownGenre, *parentID)
+        }
+        parentID = parent.ParentID
+    }
+    return nil
+}
+
+// duplicateGenre returns a *DuplicateNameError if another genre has the name
+// of genre. The caller must hold the lock.
+func (r *MemoryBookRepository) duplicateGenre(genre *models.Genre) error {
+    for id, other := range r.genres {
+        if id != genre.ID && other.NameKey == genre.NameKey {
+            return &DuplicateNameError{Kind: "genre", Name: genre.Name, ExistingID: id}
+        }
+    }
+    return nil
+}
+
+func (r *MemoryBookRepository) CreateGenre(ctx context.Context, genre *models.Genre) error {
+    r.mu.Lock()
+    defer r.mu.Unlock()
+
+    genre.Normalize()
+    if err := r.checkGenreParent(genre); err != nil {
+        return err
+    }
+    if err := r.duplicateGenre(genre); err != nil {
+        return err
+    }
+    *genre = r.findOrCreateGenre(*genre)
+    return nil
+}
+
+func (r *MemoryBookRepository) UpdateGenre(ctx context.Context, genre *models.Genre) error {
+    r.mu.Lock()
+    defer r.mu.Unlock()
+
+    existing, ok := r.genres[genre.ID]
+    if !ok {
+        return ErrNotFound
+    }
+    genre.Normalize()
+    if err := r.checkGenreParent(genre); err != nil {
+        return err
+    }
+    if err := r.duplicateGenre(genre); err != nil {
+        return err
+    }
+    genre.CreatedAt, genre.UpdatedAt = existing.CreatedAt, time.Now()
+    r.genres[genre.ID] = *genre
+    r.updateBooks(bookGenreID, genre.ID, func(book *models.Book) { book.Genre = genre.Name })
+    return nil
+}
+
+func (r *MemoryBookRepository) DeleteGenre(ctx context.Context, id uint) error {
+    r.mu.Lock()
+    defer r.mu.Unlock()
+
+    if _, ok := r.genres[id]; !ok {
+        return ErrNotFound
+    }
+    if r.updateBooks(bookGenreID, id, func(book *models.Book) {}) > 0 {
+        return ErrInUse
+    }
+    for _, genre := range r.genres {
+        if sameID(genre.ParentID, &id) {
+            return ErrInUse
+        }
+    }
+    delete(r.genres, id)
+    return nil
+}
+
+func (r *MemoryBookRepository) MergeGenres(ctx context.Context, sourceID, targetID uint) (int64, error) {
+    r.mu.Lock()
+    defer r.mu.Unlock()
+
+    target, ok := r.genres[targetID]
+    if !ok {
+        return 0, fmt.Errorf("%w: %d", ErrUnknownGenre, targetID)
+    }
+    if _, ok := r.genres[sourceID]; !ok {
+        return 0, ErrNotFound
+    }
+    if err := r.checkGenreParent(&models.Genre{ID: sourceID, ParentID: &targetID}); err != nil {
+        return 0, err
+    }
+
+    for id, genre := range r.genres {
+        if sameID(genre.ParentID, &sourceID) {
+            genre.ParentID = &target.ID
+            r.genres[id] = genre
+        }
+    }
+    moved := r.updateBooks(bookGenreID, sourceID, func(book *models.Book) {
+        book.GenreID, book.Genre = &target.ID, target.Name
+    })
+    delete(r.genres, sourceID)
+    return moved, nil
+}
@@ -0,0 +1,140 @@
+package repository
+
+import (
+	"book-manager/models"
+	"context"
+	"sort"
+	"time"
+)
+
+func (r *MemoryBookRepository) CreateUser(ctx context.Context, user *models.User) error {
+    r.mu.Lock()
+    defer r.mu.Unlock()
+
+    for _, other := range r.users {
+        if other.Username == user.Username {
+            return ErrUsernameTaken
+        }
+    }
+    if user.Role == "" {
+        user.Role = models.UserViewer
+    }
+    now := time.Now()
+    user.ID = r.nextUserID
+    user.CreatedAt, user.UpdatedAt = now, now
+    r.nextUserID++
+    r.users[user.ID] = *user
+    return nil
+}
+
+func (r *MemoryBookRepository) ListUsers(ctx context.Context) ([]models.User, error) {
+    r.mu.RLock()
+    defer r.mu.RUnlock()
+
+    users := []models.User{}
+    for _, user := range r.users {
+        users = append(users, user)
+    }
+    sort.Slice(users, func(i, j int) bool { return users[i].Username < users[j].Username })
+    return users, nil
+}
+
+func (r *MemoryBookRepository) SetUserRole(ctx context.Context, id uint, role string) (*models.User, error) {
+    r.mu.Lock()
+    defer r.mu.Unlock()
+
+    user, ok := r.users[id]
+    if !ok {
+        return nil, ErrNotFound
+    }
+    if user.Role == models.UserAdmin && role != models.UserAdmin {
+        admins := 0
+        for _, other := range r.users {
+            if other.Role == models.UserAdmin {
+                admins++
+            }
+        }
+        if admins == 1 {
+            return nil, ErrLastAdmin
+        }
+    }
+    user.Role, user.UpdatedAt = role, time.Now()
+    r.users[id] = user
+    return &user, nil
+}
+
+func (r *MemoryBookRepository) GetUser(ctx context.Context, id uint) (*models.User, error) {
+    r.mu.RLock()
+    defer r.mu.RUnlock()
+
+    user, ok := r.users[id]
+    if !ok {
+        return nil, ErrNotFound
+    }
+    return &user, nil
+}
+
+func (r *MemoryBookRepository) GetUserByName(ctx context.Context, username string) (*models.User, error) {
+    r.mu.RLock()
+    defer r.mu.RUnlock()
+
+    for _, user := range r.users {
+        if user.Username == username {
+            return &user, nil
+        }
+    }
+    return nil, ErrNotFound
+}
+
+func (r *MemoryBookRepository) CreateSession(ctx context.Context, session *models.Session) error {
+    r.mu.Lock()
+    defer r.mu.Unlock()
+
+    session.CreatedAt = time.Now()
+    r.sessions[session.ID] = *session
+    return nil
+}
+
+func (r *MemoryBookRepository) GetSession(ctx context.Context, id string) (*models.Session, error) {
+    r.mu.RLock()
+    defer r.mu.RUnlock()
+
+    session, ok := r.sessions[id]
+    if !ok {
+        return nil, ErrNotFound
+    }
+    return &session, nil
+}
+
+func (r *MemoryBookRepository) RotateSession(ctx context.Context, id, refreshID, newRefreshID string) error {
+    r.mu.Lock()
+    defer r.mu.Unlock()
+
+    session, ok := r.sessions[id]
+    if !ok {
+        return ErrInvalidSession
+    }
+    now := time.Now()
+    if !session.Active(now) || session.RefreshID != refreshID {
+        if session.RevokedAt == nil {
+            session.RevokedAt = &now
+            r.sessions[id] = session
+        }
+        return ErrInvalidSession
+    }
+    session.RefreshID = newRefreshID
+    r.sessions[id] = session
+    return nil
+}
+
+func (r *MemoryBookRepository) RevokeSession(ctx context.Context, id string) error {
+    r.mu.Lock()
+    defer r.mu.Unlock()
+
+    if session, ok := r.sessions[id]; ok && session.RevokedAt == nil {
+        now := time.Now()
+        session.RevokedAt = &now
+        r.sessions[id] = session
+    }
+    return nil
+}
@@ -0,0 +1,365 @@
+package repository
+
+import (
+	"book-manager/models"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+    DefaultPageSize = 50
+    MaxPageSize     = 500
+)
+
+// bookColumn describes a Book field that can be used for sorting and filtering.
+type bookColumn struct {
+    name   string // database column name
+    kind   string // "int", "string" or "time"
+    ranged bool   // whether range operators (gt, gte, lt, lte) are allowed
+}
+
+// bookColumns maps the JSON field names of models.Book to their database columns.
+var bookColumns = map[string]bookColumn{
+    "id":        {name: "id", kind: "int", ranged: true},
+    "title":     {name: "title", kind: "string"},
+    "author":    {name: "author", kind: "string"},
+    "year":      {name: "year", kind: "int", ranged: true},
+    "genre":     {name: "genre", kind: "string"},
+    "isbn":      {name: "isbn", kind: "string"},
+    "publisher": {name: "publisher", kind: "string"},
+    "createdAt": {name: "created_at", kind: "time", ranged: true},
+    "updatedAt": {name: "updated_at", kind: "time", ranged: true},
+    "deletedAt": {name: "deleted_at", kind: "time", ranged: true},
+}
+
+var rangeOperators = map[string]string{
+    "gt":  ">",
+    "gte": ">=",
+    "lt":  "<",
+    "lte": "<=",
+}
+
+type bookFilter struct {
+    field    string
+    operator string
+    value    interface{}
+}
+
+// BookQuery holds the pagination, sorting and filtering options of a book listing.
+type BookQuery struct {
+    Limit   int
+    Offset  int
+    Sort    string
+    Desc    bool
+    Cursor  *bookCursor
+    Trashed bool // list trashed books instead of live ones
+    filters []bookFilter
+    tags    []string // normalized tags the books must have
+    anyTag  bool     // whether one of tags is enough
+}
+
+// BookPage is one page of a book listing.
+type BookPage struct {
+    Books      []models.Book
+    Total      int64  // number of books matching the filters
+    NextCursor string // empty on the last page
+}
+
+// bookCursor is the position after which the next page starts. It is handed
+// to clients as an opaque base64 string.
+type bookCursor struct {
+    Sort  string      `json:"s"`
+    Desc  bool        `json:"d"`
+    Value interface{} `json:"v"`
+    ID    uint        `json:"i"`
+}
+
+// ParseBookQuery reads the listing options from the query string.
+//
+// Supported parameters:
+//   limit, offset            page size and number of rows to skip
+//   cursor                   opaque cursor returned in X-Next-Cursor
+//   sort, order              sort field (e.g. title, year, createdAt) and asc/desc
+//   <field>=value            exact match, e.g. genre=Fantasy
+//   <field>[op]=value        range match on id, year, createdAt and updatedAt
+//                            where op is one of gt, gte, lt, lte
+//   tag=a,b or tag=a&tag=b   books with the given tags
+//   tagMatch                 all (default) or any of the tags
+func ParseBookQuery(values url.Values) (*BookQuery, error) {
+    query := &BookQuery{Limit: DefaultPageSize, Sort: "id"}
+
+    if raw := values.Get("limit"); raw != "" {
+        limit, err := strconv.Atoi(raw)
+        if err != nil || limit < 1 {
+            return nil, fmt.Errorf("limit must be a positive integer")
+        }
+        if limit > MaxPageSize {
+            limit = MaxPageSize
+        }
+        query.Limit = limit
+    }
+
+    if raw := values.Get("offset"); raw != "" {
+        offset, err := strconv.Atoi(raw)
+        if err != nil || offset < 0 {
+            return nil, fmt.Errorf("offset must be a non-negative integer")
+        }
+        query.Offset = offset
+    }
+
+    if sort := values.Get("sort"); sort != "" {
+        if _, ok := bookColumns[sort]; !ok {
+            return nil, fmt.Errorf("cannot sort by %s", sort)
+        }
+        query.Sort = sort
+    }
+
+    switch strings.ToLower(values.Get("order")) {
+    case "", "asc":
+    case "desc":
+        query.Desc = true
+    default:
+        return nil, fmt.Errorf("order must be asc or desc")
+    }
+
+    if raw := values.Get("cursor"); raw != "" {
+        cursor, err := decodeCursor(raw)
+        if err != nil {
+            return nil, fmt.Errorf("invalid cursor")
+        }
+        if cursor.Sort != query.Sort || cursor.Desc != query.Desc {
+            return nil, fmt.Errorf("cursor does not match the requested sort order")
+        }
+        if query.Offset != 0 {
+            return nil, fmt.Errorf("cursor and offset cannot be combined")
+        }
+        if cursor.Value, err = cursorValue(bookColumns[cursor.Sort], cursor.Value); err != nil {
+            return nil, fmt.Errorf("invalid cursor")
+        }
+        query.Cursor = cursor
+    }
+
+    seen := map[string]bool{}
+    for _, raw := range values["tag"] {
+        for _, tag := range strings.Split(raw, ",") {
+            normalized, err := models.NormalizeTag(tag)
+            if err != nil {
+                return nil, fmt.Errorf("invalid tag %q: %v", tag, err)
+            }
+            if !seen[normalized] {
+                seen[normalized] = true
+                query.tags = append(query.tags, normalized)
+            }
+        }
+    }
+
+    switch strings.ToLower(values.Get("tagMatch")) {
+    case "", "all":
+    case "any":
+        query.anyTag = true
+    default:
+        return nil, fmt.Errorf("tagMatch must be all or any")
+    }
+
+    for key, vals := range values {
+        field, op := key, ""
+        if idx := strings.Index(key, "["); idx != -1 && strings.HasSuffix(key, "]") {
+            field, op = key[:idx], key[idx+1:len(key)-1]
+        }
+
+        column, ok := bookColumns[field]
+        if !ok {
+            continue
+        }
+
+        operator := "="
+        if op != "" {
+            if operator, ok = rangeOperators[op]; !ok || !column.ranged {
+                return nil, fmt.Errorf("unsupported filter %s", key)
+            }
+        }
+
+        for _, raw := range vals {
+            value, err := parseColumnValue(column, raw)
+            if err != nil {
+                return nil, fmt.Errorf("invalid value for %s: %v", key, err)
+            }
+            query.filters = append(query.filters, bookFilter{field: field, operator: operator, value: value})
+        }
+    }
+
+    return query, nil
+}
+
+func parseColumnValue(column bookColumn, raw string) (interface{}, error) {
+    switch column.kind {
+    case "int":
+        return strconv.Atoi(raw)
+    case "time":
+        if t, err := time.Parse(time.RFC3339, raw); err == nil {
+            return t, nil
+        }
+        return time.Parse("2006-01-02", raw)
+    default:
+        return raw, nil
+    }
+}
+
+// bookValue returns the value of a sortable field of book.
+func bookValue(book *models.Book, field string) interface{} {
+    switch field {
+    case "id":
+        return int(book.ID)
+    case "title":
+        return book.Title
+    case "author":
+        return book.Author
+    case "year":
+        return book.Year
+    case "genre":
+        return book.Genre
+    case "isbn":
+        return book.ISBN
+    case "publisher":
+        return book.Publisher
+    case "createdAt":
+        return book.CreatedAt
+    case "updatedAt":
+        return book.UpdatedAt
+    case "deletedAt":
+        return book.DeletedAt.Time
+    }
+    return nil
+}
+
+// compareValues orders two values of the same column kind.
+func compareValues(a, b interface{}) int {
+    switch a := a.(type) {
+    case int:
+        b := b.(int)
+        if a < b {
+            return -1
+        } else if a > b {
+            return 1
+        }
+    case string:
+        return strings.Compare(a, b.(string))
+    case time.Time:
+        return a.Compare(b.(time.Time))
+    }
+    return 0
+}
+
+// matches reports whether book passes the filters of q.
+func (q *BookQuery) matches(book *models.Book) bool {
+    for _, f := range q.filters {
+        cmp := compareValues(bookValue(book, f.field), f.value)
+        var ok bool
+        switch f.operator {
+        case "=":
+            ok = cmp == 0
+        case ">":
+            ok = cmp > 0
+        case ">=":
+            ok = cmp >= 0
+        case "<":
+            ok = cmp < 0
+        case "<=":
+            ok = cmp <= 0
+        }
+        if !ok {
+            return false
+        }
+    }
+    return true
+}
+
+// matchesTags reports whether a book with the given tags passes the tag filter of q.
+func (q *BookQuery) matchesTags(tags map[string]bool) bool {
+    if len(q.tags) == 0 {
+        return true
+    }
+    matched := 0
+    for _, tag := range q.tags {
+        if tags[tag] {
+            matched++
+        }
+    }
+    if q.anyTag {
+        return matched > 0
+    }
+    return matched == len(q.tags)
+}
+
+// less orders books by the sort field of q with the ID as tie-breaker.
+func (q *BookQuery) less(a, b *models.Book) bool {
+    cmp := compareValues(bookValue(a, q.Sort), bookValue(b, q.Sort))
+    if cmp == 0 {
+        cmp = compareValues(int(a.ID), int(b.ID))
+    }
+    if q.Desc {
+        return cmp > 0
+    }
+    return cmp < 0
+}
+
+// afterCursor reports whether book comes after the cursor of q.
+func (q *BookQuery) afterCursor(book *models.Book) bool {
+    if q.Cursor == nil {
+        return true
+    }
+    cmp := compareValues(bookValue(book, q.Sort), q.Cursor.Value)
+    if cmp == 0 {
+        cmp = compareValues(int(book.ID), int(q.Cursor.ID))
+    }
+    if q.Desc {
+        return cmp < 0
+    }
+    return cmp > 0
+}
+
+// nextCursor returns the cursor pointing after the given book.
+func (q *BookQuery) nextCursor(book *models.Book) string {
+    cursor := bookCursor{Sort: q.Sort, Desc: q.Desc, Value: bookValue(book, q.Sort), ID: book.ID}
+    data, _ := json.Marshal(cursor)
+    return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeCursor(raw string) (*bookCursor, error) {
+    data, err := base64.RawURLEncoding.DecodeString(raw)
+    if err != nil {
+        return nil, err
+    }
+    var cursor bookCursor
+    if err := json.Unmarshal(data, &cursor); err != nil {
+        return nil, err
+    }
+    if _, ok := bookColumns[cursor.Sort]; !ok {
+        return nil, fmt.Errorf("unknown sort field %s", cursor.Sort)
+    }
+    return &cursor, nil
+}
+
+// cursorValue converts a JSON-decoded cursor value back to the column type.
+func cursorValue(column bookColumn, value interface{}) (interface{}, error) {
+    switch column.kind {
+    case "int":
+        if n, ok := value.(float64); ok {
+            return int(n), nil
+        }
+    case "time":
+        if s, ok := value.(string); ok {
+            return time.Parse(time.RFC3339Nano, s)
+        }
+    default:
+        if s, ok := value.(string); ok {
+            return s, nil
+        }
+    }
+    return nil, fmt.Errorf("invalid cursor value for %s", column.name)
+}
@@ -0,0 +1,139 @@
+package repository
+
+import (
+	"book-manager/models"
+	"book-manager/storage"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+// ErrNotFound is returned when a book or another record does not exist, or is
+// not in the state the operation expects (e.g. restoring a book that is not in the trash).
+var ErrNotFound = errors.New("not found")
+
+// ErrInUse is returned when a record can't be deleted because books or other
+// records refer to it.
+var ErrInUse = errors.New("still in use")
+
+// ErrVersionConflict is returned by Update when the book was changed since
+// the version that was read.
+var ErrVersionConflict = errors.New("book was modified concurrently")
+
+// Records books refer to, see ReferencingBookIDs.
+const (
+    RefPublisher = "publisher"
+    RefGenre     = "genre"
+    RefAuthor    = "author"
+)
+
+// DuplicateISBNError is returned when a book is saved with the ISBN of another
+// book, which may be in the trash.
+type DuplicateISBNError struct {
+    ISBN13     string
+    ExistingID uint
+}
+
+func (e *DuplicateISBNError) Error() string {
+    return fmt.Sprintf("a book with ISBN %s already exists (ID %d)", e.ISBN13, e.ExistingID)
+}
+
+// BookRepository stores books, the records they refer to, the users and API
+// keys that change them and the audit log of their changes. Deleted books are
+// kept in a trash until they are restored or purged.
+type BookRepository interface {
+    AuthorRepository
+    TaxonomyRepository
+    TagRepository
+    CoverRepository
+    UserRepository
+    APIKeyRepository
+    AuditRepository
+
+    // List returns the page of live (or, with query.Trashed, trashed) books
+    // selected by query, including its tag filter.
+    List(ctx context.Context, query *BookQuery) (*BookPage, error)
+    // Export calls fn for every book selected by the filters, sort order and
+    // Trashed flag of query, without loading them all at once. Pagination is
+    // ignored. It stops at and returns the first error of fn.
+    Export(ctx context.Context, query *BookQuery, fn func(book *models.Book) error) error
+    // Get returns a live book by ID.
+    Get(ctx context.Context, id uint) (*models.Book, error)
+    // GetIncludingTrash returns a book by ID, whether it is live or in the trash.
+    GetIncludingTrash(ctx context.Context, id uint) (*models.Book, error)
+    // ReferencingBookIDs returns the IDs of the books, live or trashed, that
+    // refer to the record of kind RefPublisher, RefGenre or RefAuthor with the
+    // given ID, in order. These are the books that renaming or merging the
+    // record changes.
+    ReferencingBookIDs(ctx context.Context, kind string, id uint) ([]uint, error)
+    // Create stores a new book and sets its ID, timestamps, version and ISBN13. It
+    // returns a *DuplicateISBNError if another book has the same ISBN. The
+    // names in the Author string are credited as authors, see SplitAuthorNames.
+    // The publisher and genre are set from PublisherID and GenreID if given,
+    // or else found or created by the Publisher and Genre names.
+    Create(ctx context.Context, book *models.Book) error
+    // Update saves all fields of an existing live book, like Create, and
+    // credits the authors again if the Author string changed. A changed
+    // PublisherID or GenreID wins over the name. The save
+    // only succeeds if the stored book still has book.Version, which is then
+    // incremented; otherwise ErrVersionConflict is returned.
+    Update(ctx context.Context, book *models.Book) error
+    // Delete moves a live book to the trash. If version isn't 0, the book
+    // must still have it, otherwise ErrVersionConflict is returned.
+    Delete(ctx context.Context, id, version uint) error
+    // Restore moves a book out of the trash and returns it.
+    Restore(ctx context.Context, id uint) (*models.Book, error)
+    // Purge permanently deletes a book with its credits and tags, whether it
+    // is in the trash or not. Its cover is left for PurgeCovers. If version
+    // isn't 0, the book must be live and still have it, since a trashed book
+    // has no current version; otherwise ErrVersionConflict is returned.
+    Purge(ctx context.Context, id, version uint) error
+    // PurgeTrash permanently deletes books trashed before the given time and
+    // returns how many were removed.
+    PurgeTrash(ctx context.Context, before time.Time) (int64, error)
+    // Search returns up to limit live books matching q, best matches first.
+    Search(ctx context.Context, q string, limit int) ([]SearchHit, error)
+    // Transaction calls fn with a repository whose changes are committed if
+    // fn returns nil and rolled back otherwise. Transactions can be nested,
+    // in which case only the inner changes are rolled back.
+    Transaction(ctx context.Context, fn func(tx BookRepository) error) error
+}
+
+// StartTrashPurger purges books that have been in the trash for longer than
+// retention every interval, until ctx is cancelled, and deletes their covers
+// from covers. A non-positive retention disables purging.
+func StartTrashPurger(ctx context.Context, books BookRepository, covers storage.BlobStore, retention, interval time.Duration) {
+    if retention <= 0 {
+        slog.Info("Trash purging disabled")
+        return
+    }
+
+    purge := func() {
+        count, err := books.PurgeTrash(ctx, time.Now().Add(-retention))
+        if err != nil {
+            slog.Error("Error purging trash", "error", err)
+        } else if count > 0 {
+            slog.Info("Purged books from the trash", "count", count)
+        }
+        if err := DeletePurgedCovers(ctx, books, covers); err != nil {
+            slog.Error("Error deleting covers of purged books", "error", err)
+        }
+    }
+
+    go func() {
+        ticker := time.NewTicker(interval)
+        defer ticker.Stop()
+
+        purge()
+        for {
+            select {
+            case <-ctx.Done():
+                return
+            case <-ticker.C:
+                purge()
+            }
+        }
+    }()
+}
@@ -0,0 +1,149 @@
+package repository
+
+import (
+	"book-manager/models"
+	"html"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// searchColumns are the indexed book columns, in FTS table order, with their relevance weights.
+var searchColumns = []struct {
+    name   string
+    weight float64
+}{
+    {"title", 10},
+    {"author", 5},
+    {"description", 1},
+    {"publisher", 2},
+    {"genre", 2},
+}
+
+// SearchHit is a book matching a full-text query.
+type SearchHit struct {
+    Book       models.Book
+    Score      float64           // relevance, higher is better
+    Highlights map[string]string // HTML-escaped matching fields with matches wrapped in <mark> tags
+}
+
+// Databases that highlight matches themselves wrap them in these markers
+// rather than in <mark> tags, so that the text can be escaped before the tags
+// are put in, see markHighlights.
+const (
+    markStart = "\x02"
+    markEnd   = "\x03"
+)
+
+var markReplacer = strings.NewReplacer(markStart, "<mark>", markEnd, "</mark>")
+
+// markHighlights HTML-escapes a field highlighted with markStart and markEnd
+// and turns the markers into <mark> tags.
+func markHighlights(value string) string {
+    return markReplacer.Replace(html.EscapeString(value))
+}
+
+var searchTermPattern = regexp.MustCompile(`"[^"]*"\*?|[^\s"]+`)
+
+// searchTerm is a word or phrase of a user query. Prefix terms end in '*'.
+type searchTerm struct {
+    text   string
+    prefix bool
+}
+
+// parseSearchQuery splits a query into words and "quoted phrases". A trailing
+// '*' turns a word or phrase into a prefix query.
+func parseSearchQuery(q string) []searchTerm {
+    var terms []searchTerm
+    for _, token := range searchTermPattern.FindAllString(q, -1) {
+        prefix := strings.HasSuffix(token, "*")
+        text := strings.Trim(strings.TrimRight(token, "*"), `"`)
+        text = strings.TrimSpace(text)
+        if text == "" {
+            continue
+        }
+        terms = append(terms, searchTerm{text: text, prefix: prefix})
+    }
+    return terms
+}
+
+// ftsQuery quotes every term so that user input can't inject FTS5 syntax.
+func ftsQuery(terms []searchTerm) string {
+    parts := make([]string, len(terms))
+    for i, term := range terms {
+        parts[i] = `"` + strings.ReplaceAll(term.text, `"`, `""`) + `"`
+        if term.prefix {
+            parts[i] += "*"
+        }
+    }
+    return strings.Join(parts, " ")
+}
+
+// searchValues returns the indexed fields of book by column name.
+func searchValues(book *models.Book) map[string]string {
+    return map[string]string{
+        "title":       book.Title,
+        "author":      book.Author,
+        "description": book.Description,
+        "publisher":   book.Publisher,
+        "genre":       book.Genre,
+    }
+}
+
+// scoreBook matches book against the terms without a full-text index. Every
+// term must occur in one of the indexed fields; the score is the weighted
+// number of matches.
+func scoreBook(book models.Book, terms []searchTerm) (SearchHit, bool) {
+    values := searchValues(&book)
+    for _, term := range terms {
+        found := false
+        for _, value := range values {
+            found = found || strings.Contains(strings.ToLower(value), strings.ToLower(term.text))
+        }
+        if !found {
+            return SearchHit{}, false
+        }
+    }
+
+    hit := SearchHit{Book: book, Highlights: map[string]string{}}
+    for _, column := range searchColumns {
+        highlighted, matches := highlightTerms(values[column.name], terms)
+        if matches > 0 {
+            hit.Score += column.weight * float64(matches)
+            hit.Highlights[column.name] = highlighted
+        }
+    }
+    return hit, true
+}
+
+// rankHits sorts hits by descending score and keeps the best limit.
+func rankHits(hits []SearchHit, limit int) []SearchHit {
+    sort.SliceStable(hits, func(i, j int) bool { return hits[i].Score > hits[j].Score })
+    if len(hits) > limit {
+        hits = hits[:limit]
+    }
+    return hits
+}
+
+// highlightTerms HTML-escapes value, wraps case-insensitive occurrences of
+// terms in <mark> tags and returns the number of matches.
+func highlightTerms(value string, terms []searchTerm) (string, int) {
+    if value == "" {
+        return value, 0
+    }
+    patterns := make([]string, len(terms))
+    for i, term := range terms {
+        patterns[i] = regexp.QuoteMeta(term.text)
+    }
+    pattern := regexp.MustCompile("(?i)" + strings.Join(patterns, "|"))
+    var highlighted strings.Builder
+    end := 0
+    matches := pattern.FindAllStringIndex(value, -1)
+    for _, match := range matches {
+        highlighted.WriteString(html.EscapeString(value[end:match[0]]))
+        highlighted.WriteString("<mark>" + html.EscapeString(value[match[0]:match[1]]) + "</mark>")
+        end = match[1]
+    }
+    highlighted.WriteString(html.EscapeString(value[end:]))
+    return highlighted.String(), len(matches)
+}
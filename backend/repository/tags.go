@@ -0,0 +1,27 @@
+package repository
+
+import (
+	"context"
+)
+
+// TagCount is a tag and the number of live books that have it.
+type TagCount struct {
+    Tag   string
+    Books int64
+}
+
+// TagRepository stores the tags of books. The caller normalizes tags with
+// models.NormalizeTag.
+type TagRepository interface {
+    // BookTags returns the tags of a live book in alphabetical order.
+    BookTags(ctx context.Context, bookID uint) ([]string, error)
+    // AddTags adds tags to a live book, ignoring tags it already has, and
+    // returns all its tags.
+    AddTags(ctx context.Context, bookID uint, tags []string) ([]string, error)
+    // RemoveTags removes tags from a live book, ignoring tags it doesn't
+    // have, and returns the remaining tags.
+    RemoveTags(ctx context.Context, bookID uint, tags []string) ([]string, error)
+    // ListTags returns the tags of live books that start with prefix, most
+    // used first, with ties sorted alphabetically.
+    ListTags(ctx context.Context, prefix string) ([]TagCount, error)
+}
@@ -0,0 +1,118 @@
+package repository
+
+import (
+	"book-manager/models"
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+var (
+    // ErrUnknownPublisher is returned when a book refers to a publisher ID that doesn't exist.
+    ErrUnknownPublisher = errors.New("unknown publisher")
+    // ErrUnknownGenre is returned when a book or genre refers to a genre ID that doesn't exist.
+    ErrUnknownGenre = errors.New("unknown genre")
+    // ErrGenreCycle is returned when a genre would become its own ancestor.
+    ErrGenreCycle = errors.New("a genre can't be placed below itself")
+)
+
+// DuplicateNameError is returned when a publisher or genre is saved with the
+// name of another one, as compared by models.TermKey.
+type DuplicateNameError struct {
+    Kind       string // "publisher" or "genre"
+    Name       string
+    ExistingID uint
+}
+
+func (e *DuplicateNameError) Error() string {
+    return fmt.Sprintf("a %s named %q already exists (ID %d)", e.Kind, e.Name, e.ExistingID)
+}
+
+// PublisherCount is a publisher and the number of live books it published.
+type PublisherCount struct {
+    Publisher models.Publisher
+    Books     int64
+}
+
+// GenreCount is a genre, the names on its path from the root and the number
+// of live books in it, directly and including its subgenres.
+type GenreCount struct {
+    Genre      models.Genre
+    Path       []string
+    Books      int64
+    TotalBooks int64
+}
+
+// TaxonomyRepository stores the publishers and genres books refer to. Books
+// keep the name of their publisher and genre in Publisher and Genre, which
+// are updated when the publisher or genre is renamed or merged. Each book
+// changed this way, see ReferencingBookIDs, gets a new version.
+type TaxonomyRepository interface {
+    // ListPublishers returns all publishers with their book counts, sorted by name.
+    ListPublishers(ctx context.Context) ([]PublisherCount, error)
+    // GetPublisher returns a publisher by ID.
+    GetPublisher(ctx context.Context, id uint) (*models.Publisher, error)
+    // CreatePublisher stores a new publisher. It returns a *DuplicateNameError
+    // if a publisher with the same name exists.
+    CreatePublisher(ctx context.Context, publisher *models.Publisher) error
+    // UpdatePublisher renames a publisher, like CreatePublisher, together with its books.
+    UpdatePublisher(ctx context.Context, publisher *models.Publisher) error
+    // DeletePublisher deletes a publisher, or returns ErrInUse if a book,
+    // including books in the trash, refers to it.
+    DeletePublisher(ctx context.Context, id uint) error
+    // MergePublishers moves the books of the source publisher to the target
+    // and deletes the source. It returns the number of books moved.
+    MergePublishers(ctx context.Context, sourceID, targetID uint) (int64, error)
+
+    // ListGenres returns all genres with their book counts, sorted by path.
+    ListGenres(ctx context.Context) ([]GenreCount, error)
+    // GetGenre returns a genre by ID.
+    GetGenre(ctx context.Context, id uint) (*models.Genre, error)
+    // CreateGenre stores a new genre below its parent, if any. It returns a
+    // *DuplicateNameError if a genre with the same name exists anywhere in the
+    // tree, and ErrUnknownGenre if the parent doesn't exist.
+    CreateGenre(ctx context.Context, genre *models.Genre) error
+    // UpdateGenre renames or moves a genre, like CreateGenre, and renames its
+    // books. Moving a genre below one of its subgenres returns ErrGenreCycle.
+    UpdateGenre(ctx context.Context, genre *models.Genre) error
+    // DeleteGenre deletes a genre, or returns ErrInUse if it has subgenres
+    // or a book, including books in the trash, refers to it.
+    DeleteGenre(ctx context.Context, id uint) error
+    // MergeGenres moves the books and subgenres of the source genre to the
+    // target and deletes the source. The target can't be below the source.
+    // It returns the number of books moved.
+    MergeGenres(ctx context.Context, sourceID, targetID uint) (int64, error)
+}
+
+// countGenres adds the paths and the totals of subgenres to the genres, given
+// the number of books directly in each genre.
+func countGenres(genres []models.Genre, books map[uint]int64) []GenreCount {
+    index := make(map[uint]int, len(genres))
+    counts := make([]GenreCount, len(genres))
+    for i, genre := range genres {
+        index[genre.ID] = i
+        counts[i] = GenreCount{Genre: genre, Books: books[genre.ID]}
+    }
+    for i := range counts {
+        // Walk up to the root, adding the books of this genre to every ancestor.
+        seen := map[uint]bool{}
+        for j, ok := i, true; ok && !seen[counts[j].Genre.ID]; {
+            seen[counts[j].Genre.ID] = true
+            counts[i].Path = append([]string{counts[j].Genre.Name}, counts[i].Path...)
+            counts[j].TotalBooks += counts[i].Books
+            if counts[j].Genre.ParentID == nil {
+                break
+            }
+            j, ok = index[*counts[j].Genre.ParentID]
+        }
+    }
+
+    sort.Slice(counts, func(i, j int) bool {
+        a := strings.ToLower(strings.Join(counts[i].Path, "\x00"))
+        b := strings.ToLower(strings.Join(counts[j].Path, "\x00"))
+        return a < b
+    })
+    return counts
+}
@@ -0,0 +1,47 @@
+package repository
+
+import (
+	"book-manager/models"
+	"context"
+	"errors"
+)
+
+var (
+    // ErrUsernameTaken is returned when a user is created with the username of another user.
+    ErrUsernameTaken = errors.New("username is already taken")
+    // ErrInvalidSession is returned by RotateSession when the session is
+    // revoked or expired, or the refresh token was already used.
+    ErrInvalidSession = errors.New("session expired or revoked")
+    // ErrLastAdmin is returned when the role of the only admin would be lowered.
+    ErrLastAdmin = errors.New("the last admin can't lose the admin role")
+)
+
+// UserRepository stores user accounts and their sessions. The caller
+// normalizes usernames with models.NormalizeUsername.
+type UserRepository interface {
+    // CreateUser stores a new user. It returns ErrUsernameTaken if another
+    // user has the same username. Users get the role of user, or are viewers
+    // if it is empty; the first admin is created with the create-admin
+    // command.
+    CreateUser(ctx context.Context, user *models.User) error
+    // ListUsers returns all users sorted by username.
+    ListUsers(ctx context.Context) ([]models.User, error)
+    // SetUserRole changes the role of a user and returns the user. It returns
+    // ErrLastAdmin if the user is the only admin and the role isn't admin.
+    SetUserRole(ctx context.Context, id uint, role string) (*models.User, error)
+    // GetUser returns a user by ID.
+    GetUser(ctx context.Context, id uint) (*models.User, error)
+    // GetUserByName returns a user by username.
+    GetUserByName(ctx context.Context, username string) (*models.User, error)
+    // CreateSession stores a new session and sets its CreatedAt.
+    CreateSession(ctx context.Context, session *models.Session) error
+    // GetSession returns a session by ID, whether it is active or not.
+    GetSession(ctx context.Context, id string) (*models.Session, error)
+    // RotateSession replaces the refresh ID of an active session, if it is
+    // still refreshID. Otherwise the refresh token was used twice, which
+    // means it was probably stolen, so the session is revoked and
+    // ErrInvalidSession is returned.
+    RotateSession(ctx context.Context, id, refreshID, newRefreshID string) error
+    // RevokeSession ends a session. Revoking it again is not an error.
+    RevokeSession(ctx context.Context, id string) error
+}
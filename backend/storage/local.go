@@ -0,0 +1,93 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// LocalStore is a BlobStore keeping every object in a file below a directory.
+type LocalStore struct {
+    dir string
+}
+
+// NewLocalStore returns a store writing below dir, which is created if needed.
+func NewLocalStore(dir string) (*LocalStore, error) {
+    if err := os.MkdirAll(dir, 0o755); err != nil {
+        return nil, err
+    }
+    return &LocalStore{dir: dir}, nil
+}
+
+func (s *LocalStore) path(key string) (string, error) {
+    if err := checkKey(key); err != nil {
+        return "", err
+    }
+    return filepath.Join(s.dir, filepath.FromSlash(key)), nil
+}
+
+func (s *LocalStore) Put(ctx context.Context, key string, r io.Reader) error {
+    name, err := s.path(key)
+    if err != nil {
+        return err
+    }
+    if err := os.MkdirAll(filepath.Dir(name), 0o755); err != nil {
+        return err
+    }
+
+    // The object is written to a temporary file that replaces the old one
+    // when it is complete.
+    file, err := os.CreateTemp(filepath.Dir(name), ".upload-*")
+    if err != nil {
+        return err
+    }
+    defer os.Remove(file.Name())
+
+    if _, err := io.Copy(file, r); err != nil {
+        file.Close()
+        return err
+    }
+    if err := file.Close(); err != nil {
+        return err
+    }
+    if err := ctx.Err(); err != nil {
+        return err
+    }
+    return os.Rename(file.Name(), name)
+}
+
+func (s *LocalStore) Open(ctx context.Context, key string) (io.ReadCloser, error) {
+    name, err := s.path(key)
+    if err != nil {
+        return nil, err
+    }
+    file, err := os.Open(name)
+    if errors.Is(err, fs.ErrNotExist) {
+        return nil, ErrNotFound
+    }
+    if err != nil {
+        return nil, err
+    }
+    return file, nil
+}
+
+func (s *LocalStore) Delete(ctx context.Context, key string) error {
+    name, err := s.path(key)
+    if err != nil {
+        return err
+    }
+    if err := os.Remove(name); err != nil && !errors.Is(err, fs.ErrNotExist) {
+        return err
+    }
+
+    // Directories left empty are removed as well, up to the root of the store.
+    for dir := filepath.Dir(name); dir != filepath.Clean(s.dir); dir = filepath.Dir(dir) {
+        if os.Remove(dir) != nil {
+            break
+        }
+    }
+    return nil
+}
@@ -0,0 +1,62 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"sync"
+)
+
+// MemoryStore is a BlobStore that keeps objects in memory. It is meant for
+// tests and local experiments.
+type MemoryStore struct {
+    mu      sync.RWMutex
+    objects map[string][]byte
+}
+
+// NewMemoryStore returns an empty in-memory store.
+func NewMemoryStore() *MemoryStore {
+    return &MemoryStore{objects: map[string][]byte{}}
+}
+
+func (s *MemoryStore) Put(ctx context.Context, key string, r io.Reader) error {
+    if err := checkKey(key); err != nil {
+        return err
+    }
+    data, err := io.ReadAll(r)
+    if err != nil {
+        return err
+    }
+
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    s.objects[key] = data
+    return nil
+}
+
+func (s *MemoryStore) Open(ctx context.Context, key string) (io.ReadCloser, error) {
+    s.mu.RLock()
+    defer s.mu.RUnlock()
+
+    data, ok := s.objects[key]
+    if !ok {
+        return nil, ErrNotFound
+    }
+    return io.NopCloser(bytes.NewReader(data)), nil
+}
+
+func (s *MemoryStore) Delete(ctx context.Context, key string) error {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    delete(s.objects, key)
+    return nil
+}
+
+// Len returns the number of stored objects.
+func (s *MemoryStore) Len() int {
+    s.mu.RLock()
+    defer s.mu.RUnlock()
+
+    return len(s.objects)
+}
@@ -0,0 +1,40 @@
+// Package storage keeps binary objects such as cover images outside the
+// database.
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"path"
+	"strings"
+)
+
+// ErrNotFound is returned when no object is stored under a key.
+var ErrNotFound = errors.New("blob not found")
+
+// ErrInvalidKey is returned for keys that are empty, absolute or leave the
+// store with "..".
+var ErrInvalidKey = errors.New("invalid blob key")
+
+// BlobStore stores objects under slash separated keys like
+// "covers/12/original".
+type BlobStore interface {
+    // Put stores the content of r under key, replacing an existing object.
+    // Readers never see a partially written object.
+    Put(ctx context.Context, key string, r io.Reader) error
+    // Open returns the object stored under key, or ErrNotFound. The caller
+    // must close it.
+    Open(ctx context.Context, key string) (io.ReadCloser, error)
+    // Delete removes the object stored under key. Deleting a missing object
+    // is not an error.
+    Delete(ctx context.Context, key string) error
+}
+
+// checkKey returns ErrInvalidKey unless key is a clean relative path.
+func checkKey(key string) error {
+    if key == "" || strings.HasPrefix(key, "/") || path.Clean(key) != key || key == ".." || strings.HasPrefix(key, "../") {
+        return ErrInvalidKey
+    }
+    return nil
+}
@@ -2,36 +2,30 @@ package tests
 
 import (
 	"book-manager/handlers"
+	"book-manager/models"
+	"book-manager/repository"
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"strconv"
+	"strings"
 	"testing"
 
 	"github.com/gorilla/mux"
 )
 
-func setupRouter() *mux.Router {
-    r := mux.NewRouter()
-    r.HandleFunc("/books", handlers.GetBooks).Methods("GET")
-    r.HandleFunc("/books", handlers.AddBook).Methods("POST")
-    r.HandleFunc("/books/{id}", handlers.GetBook).Methods("GET")
-    r.HandleFunc("/books/{id}", handlers.UpdateBook).Methods("PUT")
-    r.HandleFunc("/books/{id}", handlers.DeleteBook).Methods("DELETE")
-    return r
-}
-
-
-
-func createBookForTesting(t *testing.T) string {
+func createBookForTesting(t *testing.T, router *mux.Router) string {
     var jsonStr = []byte(`{"title":"Test Book","author":"Test Author", "year":2021}`)
     request, _ := http.NewRequest("POST", "/books", bytes.NewBuffer(jsonStr))
     request.Header.Set("Content-Type", "application/json")
 
     response := httptest.NewRecorder()
-    router := setupRouter()
     router.ServeHTTP(response, request)
 
 
@@ -57,70 +51,588 @@ func createBookForTesting(t *testing.T) string {
 }
 
 func TestGetBooks(t *testing.T) {
-    request, _ := http.NewRequest("GET", "/books", nil)
-    response := httptest.NewRecorder()
-    router := setupRouter()
-    router.ServeHTTP(response, request)
+    forEachRepository(t, func(t *testing.T, router *mux.Router) {
+        request, _ := http.NewRequest("GET", "/books", nil)
+        response := httptest.NewRecorder()
+        router.ServeHTTP(response, request)
 
-    if status := response.Code; status != http.StatusOK {
-        t.Errorf("Status code differs. Expected %d. Got %d instead", http.StatusOK, status)
-    }
-    log.Printf("TestGetBooks: Received status code %d", response.Code)
+        if status := response.Code; status != http.StatusOK {
+            t.Errorf("Status code differs. Expected %d. Got %d instead", http.StatusOK, status)
+        }
+        log.Printf("TestGetBooks: Received status code %d", response.Code)
+    })
 }
 
 func TestPostBook(t *testing.T) {
-    var jsonStr = []byte(`{"title":"Test Book","author":"Test Author", "year":2021}`)
-    request, _ := http.NewRequest("POST", "/books", bytes.NewBuffer(jsonStr))
-    request.Header.Set("Content-Type", "application/json")
+    forEachRepository(t, func(t *testing.T, router *mux.Router) {
+        var jsonStr = []byte(`{"title":"Test Book","author":"Test Author", "year":2021}`)
+        request, _ := http.NewRequest("POST", "/books", bytes.NewBuffer(jsonStr))
+        request.Header.Set("Content-Type", "application/json")
 
-    response := httptest.NewRecorder()
-    router := setupRouter()
-    router.ServeHTTP(response, request)
+        response := httptest.NewRecorder()
+        router.ServeHTTP(response, request)
 
-    if status := response.Code; status != http.StatusCreated {
-        t.Errorf("Status code differs. Expected %d. Got %d instead", http.StatusCreated, status)
-    }
-    log.Printf("TestPostBook: Received status code %d", response.Code)
+        if status := response.Code; status != http.StatusCreated {
+            t.Errorf("Status code differs. Expected %d. Got %d instead", http.StatusCreated, status)
+        }
+        log.Printf("TestPostBook: Received status code %d", response.Code)
+    })
 }
 
 func TestGetBook(t *testing.T) {
-    bookID := createBookForTesting(t)
-    request, _ := http.NewRequest("GET", "/books/"+bookID, nil)
-    response := httptest.NewRecorder()
-    router := setupRouter()
-    router.ServeHTTP(response, request)
+    forEachRepository(t, func(t *testing.T, router *mux.Router) {
+        bookID := createBookForTesting(t, router)
+        request, _ := http.NewRequest("GET", "/books/"+bookID, nil)
+        response := httptest.NewRecorder()
+        router.ServeHTTP(response, request)
 
-    if status := response.Code; status != http.StatusOK {
-        t.Errorf("Status code differs. Expected %d. Got %d instead", http.StatusOK, status)
-    }
-    log.Printf("TestGetBook: Received status code %d for book ID %s", response.Code, bookID)
+        if status := response.Code; status != http.StatusOK {
+            t.Errorf("Status code differs. Expected %d. Got %d instead", http.StatusOK, status)
+        }
+        log.Printf("TestGetBook: Received status code %d for book ID %s", response.Code, bookID)
+    })
 }
 
 func TestUpdateBook(t *testing.T) {
-    bookID := createBookForTesting(t)
-    var jsonStr = []byte(`{"title":"Updated Test Book","author":"Updated Test Author", "year":2022}`)
-    request, _ := http.NewRequest("PUT", "/books/"+bookID, bytes.NewBuffer(jsonStr))
-    request.Header.Set("Content-Type", "application/json")
+    forEachRepository(t, func(t *testing.T, router *mux.Router) {
+        bookID := createBookForTesting(t, router)
+        var jsonStr = []byte(`{"title":"Updated Test Book","author":"Updated Test Author", "year":2022}`)
+        request, _ := http.NewRequest("PUT", "/books/"+bookID, bytes.NewBuffer(jsonStr))
+        request.Header.Set("Content-Type", "application/json")
 
-    response := httptest.NewRecorder()
-    router := setupRouter()
-    router.ServeHTTP(response, request)
+        response := httptest.NewRecorder()
+        router.ServeHTTP(response, request)
 
-    if status := response.Code; status != http.StatusOK {
-        t.Errorf("Status code differs. Expected %d. Got %d instead", http.StatusOK, status)
-    }
-    log.Printf("TestUpdateBook: Received status code %d for book ID %s", response.Code, bookID)
+        if status := response.Code; status != http.StatusOK {
+            t.Errorf("Status code differs. Expected %d. Got %d instead", http.StatusOK, status)
+        }
+        log.Printf("TestUpdateBook: Received status code %d for book ID %s", response.Code, bookID)
+    })
 }
 
 func TestDeleteBook(t *testing.T) {
-    bookID := createBookForTesting(t)
-    request, _ := http.NewRequest("DELETE", "/books/"+bookID, nil)
-    response := httptest.NewRecorder()
-    router := setupRouter()
-    router.ServeHTTP(response, request)
+    forEachRepository(t, func(t *testing.T, router *mux.Router) {
+        bookID := createBookForTesting(t, router)
+        request, _ := http.NewRequest("DELETE", "/books/"+bookID, nil)
+        response := httptest.NewRecorder()
+        router.ServeHTTP(response, request)
+
+        if status := response.Code; status != http.StatusNoContent {
+            t.Errorf("Status code differs. Expected %d. Got %d instead", http.StatusNoContent, status)
+        }
+        log.Printf("TestDeleteBook: Received status code %d for book ID %s", response.Code, bookID)
+    })
+}
+
+func TestGetBooksPagination(t *testing.T) {
+    forEachRepository(t, func(t *testing.T, router *mux.Router) {
+        for year := 2000; year <= 2003; year++ {
+            genre := "Fantasy"
+            if year == 2000 {
+                genre = "Horror"
+            }
+            jsonStr := []byte(`{"title":"Paged Book","author":"Test Author","year":` + strconv.Itoa(year) + `,"genre":"` + genre + `"}`)
+            request, _ := http.NewRequest("POST", "/books", bytes.NewBuffer(jsonStr))
+            router.ServeHTTP(httptest.NewRecorder(), request)
+        }
+
+        query := url.Values{"genre": {"Fantasy"}, "sort": {"year"}, "order": {"desc"}, "limit": {"2"}}
+        request, _ := http.NewRequest("GET", "/books?"+query.Encode(), nil)
+        response := httptest.NewRecorder()
+        router.ServeHTTP(response, request)
+
+        if status := response.Code; status != http.StatusOK {
+            t.Fatalf("Status code differs. Expected %d. Got %d instead", http.StatusOK, status)
+        }
+        if total := response.Header().Get("X-Total-Count"); total != "3" {
+            t.Errorf("X-Total-Count differs. Expected 3. Got %s instead", total)
+        }
+
+        var books []models.Book
+        json.Unmarshal(response.Body.Bytes(), &books)
+        if len(books) != 2 || books[0].Year != 2003 || books[1].Year != 2002 {
+            t.Fatalf("Unexpected first page: %+v", books)
+        }
+
+        cursor := response.Header().Get("X-Next-Cursor")
+        if cursor == "" {
+            t.Fatalf("X-Next-Cursor is missing")
+        }
+
+        query.Set("cursor", cursor)
+        request, _ = http.NewRequest("GET", "/books?"+query.Encode(), nil)
+        response = httptest.NewRecorder()
+        router.ServeHTTP(response, request)
+
+        books = nil
+        json.Unmarshal(response.Body.Bytes(), &books)
+        if len(books) != 1 || books[0].Year != 2001 {
+            t.Fatalf("Unexpected second page: %+v", books)
+        }
+        if cursor := response.Header().Get("X-Next-Cursor"); cursor != "" {
+            t.Errorf("X-Next-Cursor should be empty on the last page. Got %s", cursor)
+        }
+
+        // Live books have no deletedAt, so sorting by it pages by ID.
+        query = url.Values{"sort": {"deletedAt"}, "order": {"desc"}, "limit": {"3"}}
+        var ids []uint
+        for page := 0; page < 3; page++ {
+            request, _ = http.NewRequest("GET", "/books?"+query.Encode(), nil)
+            response = httptest.NewRecorder()
+            router.ServeHTTP(response, request)
+            books = nil
+            json.Unmarshal(response.Body.Bytes(), &books)
+            for _, book := range books {
+                ids = append(ids, book.ID)
+            }
+            cursor := response.Header().Get("X-Next-Cursor")
+            if cursor == "" {
+                break
+            }
+            query.Set("cursor", cursor)
+        }
+        if len(ids) != 4 || ids[0] != 4 || ids[3] != 1 {
+            t.Errorf("Expected the pages sorted by deletedAt to hold all books by descending ID. Got %v", ids)
+        }
+    })
+}
+
+func TestGetBooksYearRange(t *testing.T) {
+    forEachRepository(t, func(t *testing.T, router *mux.Router) {
+        for _, year := range []string{"1985", "1995", "2000", "2010"} {
+            jsonStr := []byte(`{"title":"Test Book","author":"Test Author","year":` + year + `}`)
+            request, _ := http.NewRequest("POST", "/books", bytes.NewBuffer(jsonStr))
+            router.ServeHTTP(httptest.NewRecorder(), request)
+        }
+
+        request, _ := http.NewRequest("GET", "/books?year[gte]=1990&year[lte]=2000", nil)
+        response := httptest.NewRecorder()
+        router.ServeHTTP(response, request)
+
+        if status := response.Code; status != http.StatusOK {
+            t.Fatalf("Status code differs. Expected %d. Got %d instead", http.StatusOK, status)
+        }
+
+        var books []models.Book
+        json.Unmarshal(response.Body.Bytes(), &books)
+        if len(books) != 2 {
+            t.Errorf("Expected 2 books between 1990 and 2000. Got %d instead", len(books))
+        }
+        for _, book := range books {
+            if book.Year < 1990 || book.Year > 2000 {
+                t.Errorf("Book %d with year %d is outside the requested range", book.ID, book.Year)
+            }
+        }
+    })
+}
+
+func TestGetBooksInvalidQuery(t *testing.T) {
+    forEachRepository(t, func(t *testing.T, router *mux.Router) {
+        for _, query := range []string{"limit=0", "sort=password", "order=up", "title[gt]=a", "cursor=garbage"} {
+            request, _ := http.NewRequest("GET", "/books?"+query, nil)
+            response := httptest.NewRecorder()
+            router.ServeHTTP(response, request)
+
+            if status := response.Code; status != http.StatusBadRequest {
+                t.Errorf("%s: Status code differs. Expected %d. Got %d instead", query, http.StatusBadRequest, status)
+            }
+        }
+    })
+}
+
+func TestSearchBooks(t *testing.T) {
+    forEachRepository(t, func(t *testing.T, router *mux.Router) {
+        word := "Zyxomancy"
+        jsonStr := []byte(`{"title":"The ` + word + ` Chronicles","author":"Test Author","year":2020,"description":"A tale about ` + word + `"}`)
+        request, _ := http.NewRequest("POST", "/books", bytes.NewBuffer(jsonStr))
+        router.ServeHTTP(httptest.NewRecorder(), request)
+
+        for _, q := range []string{word, "zyxo*", `"the ` + word + `"`} {
+            request, _ = http.NewRequest("GET", "/books/search?q="+url.QueryEscape(q), nil)
+            response := httptest.NewRecorder()
+            router.ServeHTTP(response, request)
+
+            if status := response.Code; status != http.StatusOK {
+                t.Fatalf("%s: Status code differs. Expected %d. Got %d instead", q, http.StatusOK, status)
+            }
+
+            var results []handlers.BookSearchResult
+            json.Unmarshal(response.Body.Bytes(), &results)
+            if len(results) != 1 {
+                t.Fatalf("%s: Expected 1 result. Got %d instead", q, len(results))
+            }
+            if !strings.Contains(results[0].Highlights["title"], "<mark>") {
+                t.Errorf("%s: Title is not highlighted: %+v", q, results[0].Highlights)
+            }
+        }
+
+        request, _ = http.NewRequest("GET", "/books/search", nil)
+        response := httptest.NewRecorder()
+        router.ServeHTTP(response, request)
+        if status := response.Code; status != http.StatusBadRequest {
+            t.Errorf("Status code differs. Expected %d. Got %d instead", http.StatusBadRequest, status)
+        }
+    })
+}
+
+func TestSearchHighlightsEscaped(t *testing.T) {
+    forEachRepository(t, func(t *testing.T, router *mux.Router) {
+        jsonStr := []byte(`{"title":"<script>alert('Quillwort')</script>","author":"Test Author","year":2020,"description":"<b>Quillwort</b> & friends"}`)
+        request, _ := http.NewRequest("POST", "/books", bytes.NewBuffer(jsonStr))
+        router.ServeHTTP(httptest.NewRecorder(), request)
+
+        request, _ = http.NewRequest("GET", "/books/search?q=quillwort", nil)
+        response := httptest.NewRecorder()
+        router.ServeHTTP(response, request)
+
+        var results []handlers.BookSearchResult
+        json.Unmarshal(response.Body.Bytes(), &results)
+        if len(results) != 1 {
+            t.Fatalf("Expected 1 result. Got %d instead", len(results))
+        }
+        expected := "&lt;script&gt;alert(&#39;<mark>Quillwort</mark>&#39;)&lt;/script&gt;"
+        if title := results[0].Highlights["title"]; title != expected {
+            t.Errorf("Title is not escaped. Expected %s. Got %s", expected, title)
+        }
+        if description := results[0].Highlights["description"]; !strings.Contains(description, "&lt;b&gt;<mark>Quillwort</mark>&lt;/b&gt; &amp; friends") {
+            t.Errorf("Description is not escaped: %s", description)
+        }
+    })
+}
+
+func TestTrashAndRestoreBook(t *testing.T) {
+    forEachRepository(t, func(t *testing.T, router *mux.Router) {
+        bookID := createBookForTesting(t, router)
+
+        steps := []struct {
+            method       string
+            path         string
+            expectedCode int
+        }{
+            {"DELETE", "/books/" + bookID, http.StatusNoContent},
+            {"GET", "/books/" + bookID, http.StatusNotFound},
+            {"GET", "/books/trash?id=" + bookID, http.StatusOK},
+            {"POST", "/books/" + bookID + "/restore", http.StatusOK},
+            {"GET", "/books/" + bookID, http.StatusOK},
+            {"POST", "/books/" + bookID + "/restore", http.StatusNotFound},
+            {"DELETE", "/books/" + bookID + "?purge=true", http.StatusNoContent},
+            {"POST", "/books/" + bookID + "/restore", http.StatusNotFound},
+        }
+
+        for _, step := range steps {
+            request, _ := http.NewRequest(step.method, step.path, nil)
+            response := httptest.NewRecorder()
+            router.ServeHTTP(response, request)
+
+            if status := response.Code; status != step.expectedCode {
+                t.Fatalf("%s %s: Status code differs. Expected %d. Got %d instead", step.method, step.path, step.expectedCode, status)
+            }
+
+            if step.path == "/books/trash?id="+bookID {
+                var books []models.Book
+                json.Unmarshal(response.Body.Bytes(), &books)
+                if len(books) != 1 || !books[0].DeletedAt.Valid {
+                    t.Fatalf("Expected the deleted book in the trash. Got %+v", books)
+                }
+            }
+        }
+    })
+}
+
+func TestBookISBN(t *testing.T) {
+    forEachRepository(t, func(t *testing.T, router *mux.Router) {
+        post := func(isbn string) *httptest.ResponseRecorder {
+            jsonStr := []byte(`{"title":"Test Book","author":"Test Author","year":2021,"isbn":"` + isbn + `"}`)
+            request, _ := http.NewRequest("POST", "/books", bytes.NewBuffer(jsonStr))
+            response := httptest.NewRecorder()
+            router.ServeHTTP(response, request)
+            return response
+        }
+
+        response := post("0-306-40615-2")
+        if status := response.Code; status != http.StatusCreated {
+            t.Fatalf("Status code differs. Expected %d. Got %d instead: %s", http.StatusCreated, status, response.Body.String())
+        }
+        var book models.Book
+        json.Unmarshal(response.Body.Bytes(), &book)
+        if book.ISBN != "0-306-40615-2" || book.ISBN13 == nil || *book.ISBN13 != "9780306406157" {
+            t.Errorf("Expected the ISBN to be kept and normalized to ISBN-13. Got %q, %v", book.ISBN, book.ISBN13)
+        }
+
+        for _, isbn := range []string{"0-306-40615-3", "978-0-306-40615-8", "12345", "977-0-306-40615-7"} {
+            if status := post(isbn).Code; status != http.StatusBadRequest {
+                t.Errorf("%s: Status code differs. Expected %d. Got %d instead", isbn, http.StatusBadRequest, status)
+            }
+        }
+
+        // The same edition as ISBN-13 conflicts with the ISBN-10 above, also when the first book is in the trash.
+        request, _ := http.NewRequest("DELETE", "/books/"+strconv.Itoa(int(book.ID)), nil)
+        router.ServeHTTP(httptest.NewRecorder(), request)
+
+        response = post("978-0306406157")
+        if status := response.Code; status != http.StatusConflict {
+            t.Fatalf("Status code differs. Expected %d. Got %d instead", http.StatusConflict, status)
+        }
+        var conflict handlers.ErrorResponse
+        json.Unmarshal(response.Body.Bytes(), &conflict)
+        if conflict.ExistingID != book.ID {
+            t.Errorf("Expected the conflict to point at book %d. Got %+v", book.ID, conflict)
+        }
+
+        // Books without an ISBN never conflict.
+        for i := 0; i < 2; i++ {
+            if status := post("").Code; status != http.StatusCreated {
+                t.Errorf("Status code differs. Expected %d. Got %d instead", http.StatusCreated, status)
+            }
+        }
+    })
+}
+
+func TestPatchBook(t *testing.T) {
+    forEachRepository(t, func(t *testing.T, router *mux.Router) {
+        bookID := createBookForTesting(t, router)
+
+        patch := func(contentType, body string) *httptest.ResponseRecorder {
+            request, _ := http.NewRequest("PATCH", "/books/"+bookID, strings.NewReader(body))
+            request.Header.Set("Content-Type", contentType)
+            response := httptest.NewRecorder()
+            router.ServeHTTP(response, request)
+            return response
+        }
+
+        response := patch("application/merge-patch+json", `{"genre":"Fantasy","year":1990}`)
+        if status := response.Code; status != http.StatusOK {
+            t.Fatalf("Status code differs. Expected %d. Got %d instead: %s", http.StatusOK, status, response.Body.String())
+        }
+        var book models.Book
+        json.Unmarshal(response.Body.Bytes(), &book)
+        if book.Genre != "Fantasy" || book.Year != 1990 || book.Title != "Test Book" {
+            t.Errorf("Unexpected book after merge patch: %+v", book)
+        }
+
+        response = patch("application/json-patch+json", `[
+            {"op":"test","path":"/genre","value":"Fantasy"},
+            {"op":"replace","path":"/publisher","value":"Test Publisher"},
+            {"op":"remove","path":"/genre"}
+        ]`)
+        if status := response.Code; status != http.StatusOK {
+            t.Fatalf("Status code differs. Expected %d. Got %d instead: %s", http.StatusOK, status, response.Body.String())
+        }
+        book = models.Book{}
+        json.Unmarshal(response.Body.Bytes(), &book)
+        if book.Genre != "" || book.Publisher != "Test Publisher" || book.Year != 1990 {
+            t.Errorf("Unexpected book after JSON patch: %+v", book)
+        }
+
+        tests := []struct {
+            contentType  string
+            body         string
+            expectedCode int
+        }{
+            {"application/merge-patch+json", `{"id":12345}`, http.StatusBadRequest},
+            {"application/merge-patch+json", `{"createdAt":"2000-01-01T00:00:00Z"}`, http.StatusBadRequest},
+            {"application/json-patch+json", `[{"op":"remove","path":"/createdAt"}]`, http.StatusBadRequest},
+            {"application/merge-patch+json", `{"title":null}`, http.StatusBadRequest},
+            {"application/merge-patch+json", `{"pages":300}`, http.StatusBadRequest},
+            {"application/json-patch+json", `[{"op":"test","path":"/genre","value":"Horror"}]`, http.StatusBadRequest},
+            {"application/json-patch+json", `{"op":"replace"}`, http.StatusBadRequest},
+            {"text/plain", `{"genre":"Horror"}`, http.StatusUnsupportedMediaType},
+        }
+        for _, test := range tests {
+            if status := patch(test.contentType, test.body).Code; status != test.expectedCode {
+                t.Errorf("%s %s: Status code differs. Expected %d. Got %d instead", test.contentType, test.body, test.expectedCode, status)
+            }
+        }
+
+        request, _ := http.NewRequest("GET", "/books/"+bookID, nil)
+        response = httptest.NewRecorder()
+        router.ServeHTTP(response, request)
+        var unchanged models.Book
+        json.Unmarshal(response.Body.Bytes(), &unchanged)
+        if unchanged.ID != book.ID || !unchanged.CreatedAt.Equal(book.CreatedAt) || unchanged.Title != "Test Book" {
+            t.Errorf("Rejected patches must not change the book: %+v", unchanged)
+        }
+    })
+}
+
+func TestBookETags(t *testing.T) {
+    forEachRepository(t, func(t *testing.T, router *mux.Router) {
+        bookID := createBookForTesting(t, router)
+
+        send := func(method, body string, headers map[string]string) *httptest.ResponseRecorder {
+            request, _ := http.NewRequest(method, "/books/"+bookID, strings.NewReader(body))
+            request.Header.Set("Content-Type", "application/merge-patch+json")
+            for name, value := range headers {
+                request.Header.Set(name, value)
+            }
+            response := httptest.NewRecorder()
+            router.ServeHTTP(response, request)
+            return response
+        }
+
+        response := send("GET", "", nil)
+        etag := response.Header().Get("ETag")
+        if etag == "" {
+            t.Fatalf("ETag is missing")
+        }
+
+        if status := send("GET", "", map[string]string{"If-None-Match": etag}).Code; status != http.StatusNotModified {
+            t.Errorf("Status code differs. Expected %d. Got %d instead", http.StatusNotModified, status)
+        }
 
-    if status := response.Code; status != http.StatusNoContent {
-        t.Errorf("Status code differs. Expected %d. Got %d instead", http.StatusNoContent, status)
+        response = send("PATCH", `{"genre":"Fantasy"}`, map[string]string{"If-Match": etag})
+        if status := response.Code; status != http.StatusOK {
+            t.Fatalf("Status code differs. Expected %d. Got %d instead: %s", http.StatusOK, status, response.Body.String())
+        }
+        newETag := response.Header().Get("ETag")
+        if newETag == "" || newETag == etag {
+            t.Errorf("Expected a new ETag after the update. Got %q", newETag)
+        }
+
+        // A second editor still holding the old ETag must not overwrite the change.
+        stale := map[string]string{"If-Match": etag}
+        if status := send("PUT", `{"title":"Other Title","author":"Test Author","year":2021}`, stale).Code; status != http.StatusPreconditionFailed {
+            t.Errorf("PUT: Status code differs. Expected %d. Got %d instead", http.StatusPreconditionFailed, status)
+        }
+        if status := send("PATCH", `{"genre":"Horror"}`, stale).Code; status != http.StatusPreconditionFailed {
+            t.Errorf("PATCH: Status code differs. Expected %d. Got %d instead", http.StatusPreconditionFailed, status)
+        }
+        if status := send("DELETE", "", stale).Code; status != http.StatusPreconditionFailed {
+            t.Errorf("DELETE: Status code differs. Expected %d. Got %d instead", http.StatusPreconditionFailed, status)
+        }
+        if status := send("GET", "", map[string]string{"If-None-Match": etag}).Code; status != http.StatusOK {
+            t.Errorf("Status code differs. Expected %d. Got %d instead", http.StatusOK, status)
+        }
+
+        if status := send("DELETE", "", map[string]string{"If-Match": newETag}).Code; status != http.StatusNoContent {
+            t.Errorf("DELETE: Status code differs. Expected %d. Got %d instead", http.StatusNoContent, status)
+        }
+    })
+}
+
+func TestUpdateVersionConflict(t *testing.T) {
+    t.Parallel()
+    for name, newRepository := range repositories {
+        newRepository := newRepository
+        t.Run(name, func(t *testing.T) {
+            t.Parallel()
+            books := newRepository(t)
+            ctx := context.Background()
+
+            book := models.Book{Title: "Test Book", Author: "Test Author", Year: 2021}
+            if err := books.Create(ctx, &book); err != nil {
+                t.Fatalf("Failed to create book: %v", err)
+            }
+            first, _ := books.Get(ctx, book.ID)
+            second, _ := books.Get(ctx, book.ID)
+
+            first.Genre = "Fantasy"
+            if err := books.Update(ctx, first); err != nil {
+                t.Fatalf("Failed to update book: %v", err)
+            }
+            if first.Version != book.Version+1 {
+                t.Errorf("Expected version %d after the update. Got %d", book.Version+1, first.Version)
+            }
+
+            second.Genre = "Horror"
+            if err := books.Update(ctx, second); !errors.Is(err, repository.ErrVersionConflict) {
+                t.Errorf("Expected ErrVersionConflict. Got %v", err)
+            }
+        })
+    }
+}
+
+func TestDeleteVersionConflict(t *testing.T) {
+    t.Parallel()
+    for name, newRepository := range repositories {
+        newRepository := newRepository
+        t.Run(name, func(t *testing.T) {
+            t.Parallel()
+            books := newRepository(t)
+            ctx := context.Background()
+
+            book := models.Book{Title: "Test Book", Author: "Test Author", Year: 2021}
+            if err := books.Create(ctx, &book); err != nil {
+                t.Fatalf("Failed to create book: %v", err)
+            }
+            read := book.Version
+            book.Genre = "Fantasy"
+            if err := books.Update(ctx, &book); err != nil {
+                t.Fatalf("Failed to update book: %v", err)
+            }
+
+            if err := books.Delete(ctx, book.ID, read); !errors.Is(err, repository.ErrVersionConflict) {
+                t.Errorf("Delete: Expected ErrVersionConflict. Got %v", err)
+            }
+            if err := books.Purge(ctx, book.ID, read); !errors.Is(err, repository.ErrVersionConflict) {
+                t.Errorf("Purge: Expected ErrVersionConflict. Got %v", err)
+            }
+            if _, err := books.Get(ctx, book.ID); err != nil {
+                t.Fatalf("Expected the book to be kept. Got %v", err)
+            }
+            if err := books.Delete(ctx, book.ID+1, read); !errors.Is(err, repository.ErrNotFound) {
+                t.Errorf("Expected ErrNotFound for a missing book. Got %v", err)
+            }
+
+            if err := books.Delete(ctx, book.ID, book.Version); err != nil {
+                t.Fatalf("Failed to delete the current version: %v", err)
+            }
+            // A trashed book has no current version to match.
+            if err := books.Purge(ctx, book.ID, book.Version); !errors.Is(err, repository.ErrVersionConflict) {
+                t.Errorf("Purge of a trashed book: Expected ErrVersionConflict. Got %v", err)
+            }
+            if err := books.Purge(ctx, book.ID, 0); err != nil {
+                t.Errorf("Failed to purge the trashed book: %v", err)
+            }
+        })
     }
-    log.Printf("TestDeleteBook: Received status code %d for book ID %s", response.Code, bookID)
-}
\ No newline at end of file
+}
+
+// racingRepository updates a book right after it was read, as a concurrent
+// request could.
+type racingRepository struct {
+    repository.BookRepository
+}
+
+func (r racingRepository) Get(ctx context.Context, id uint) (*models.Book, error) {
+    book, err := r.BookRepository.Get(ctx, id)
+    if err != nil {
+        return nil, err
+    }
+    concurrent := *book
+    concurrent.Genre = "Changed concurrently"
+    if err := r.BookRepository.Update(ctx, &concurrent); err != nil {
+        return nil, err
+    }
+    return book, nil
+}
+
+func TestDeleteRacingUpdate(t *testing.T) {
+    t.Parallel()
+    for name, newRepository := range repositories {
+        newRepository := newRepository
+        t.Run(name, func(t *testing.T) {
+            t.Parallel()
+            books := newRepository(t)
+            book := models.Book{Title: "Test Book", Author: "Test Author", Year: 2021}
+            if err := books.Create(context.Background(), &book); err != nil {
+                t.Fatalf("Failed to create book: %v", err)
+            }
+            router := signedIn(t, handlers.NewServer(racingRepository{books}))
+
+            for _, path := range []string{"/books/1", "/books/1?purge=true"} {
+                request, _ := http.NewRequest("DELETE", path, nil)
+                request.Header.Set("If-Match", fmt.Sprintf(`"%d-%d"`, book.ID, book.Version))
+                response := httptest.NewRecorder()
+                router.ServeHTTP(response, request)
+                if response.Code != http.StatusPreconditionFailed {
+                    t.Errorf("%s: Expected %d when the book changed after If-Match was checked. Got %d", path, http.StatusPreconditionFailed, response.Code)
+                }
+                book.Version++
+            }
+            if current, err := books.Get(context.Background(), book.ID); err != nil || current.Genre != "Changed concurrently" {
+                t.Errorf("Expected the concurrently updated book to be kept. Got %+v (%v)", current, err)
+            }
+        })
+    }
+}
@@ -0,0 +1,155 @@
+package tests
+
+import (
+	"book-manager/handlers"
+	"book-manager/models"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+func serveWithAPIKey(router *mux.Router, method, path, key, body string) *httptest.ResponseRecorder {
+    request, _ := http.NewRequest(method, path, strings.NewReader(body))
+    request.Header.Set("Content-Type", "application/json")
+    request.Header.Set("X-API-Key", key)
+    response := httptest.NewRecorder()
+    router.ServeHTTP(response, request)
+    return response
+}
+
+// createAPIKey creates an API key with the access token of an admin.
+func createAPIKey(t *testing.T, router *mux.Router, token, body string) handlers.NewAPIKeyResponse {
+    response := serveWithToken(router, "POST", "/api-keys", token, body)
+    if response.Code != http.StatusCreated {
+        t.Fatalf("Failed to create API key: %d %s", response.Code, response.Body.String())
+    }
+    var created handlers.NewAPIKeyResponse
+    json.Unmarshal(response.Body.Bytes(), &created)
+    return created
+}
+
+func TestAPIKeys(t *testing.T) {
+    t.Parallel()
+    for name, newRepository := range repositories {
+        newRepository := newRepository
+        t.Run(name, func(t *testing.T) {
+            t.Parallel()
+            server := handlers.NewServer(newRepository(t))
+            router := server.Routes()
+            book := `{"title":"Dune","author":"Frank Herbert","year":1965}`
+
+            registerAdmin(t, server, router, "admin")
+            register(t, router, "viewer")
+            admin := signIn(t, router, "admin", "secret password").AccessToken
+            viewer := signIn(t, router, "viewer", "secret password").AccessToken
+
+            if response := serveWithToken(router, "POST", "/api-keys", viewer, `{"name":"ingest","scopes":["books:write"]}`); response.Code != http.StatusForbidden {
+                t.Errorf("Expected only admins to create API keys. Got %d", response.Code)
+            }
+            for _, body := range []string{
+                `{"name":"","scopes":["books:write"]}`,
+                `{"name":"ingest","scopes":[]}`,
+                `{"name":"ingest","scopes":["books:delete"]}`,
+                `{"name":"ingest","scopes":["books:write"],"expiresAt":"2001-01-01T00:00:00Z"}`,
+            } {
+                if response := serveWithToken(router, "POST", "/api-keys", admin, body); response.Code != http.StatusBadRequest {
+                    t.Errorf("%s: Expected 400. Got %d", body, response.Code)
+                }
+            }
+
+            writer := createAPIKey(t, router, admin, `{"name":"ingest","scopes":["books:write","books:read","books:write"]}`)
+            if !strings.HasPrefix(writer.Key, writer.APIKey.Prefix) || len(writer.APIKey.Scopes) != 2 {
+                t.Errorf("Unexpected API key: %+v", writer)
+            }
+            reader := createAPIKey(t, router, admin, `{"name":"report","scopes":["books:read"]}`)
+
+            response := serveWithAPIKey(router, "POST", "/books", writer.Key, book)
+            var created models.Book
+            json.Unmarshal(response.Body.Bytes(), &created)
+            if response.Code != http.StatusCreated {
+                t.Fatalf("Expected an API key with books:write to add books. Got %d %s", response.Code, response.Body.String())
+            }
+            bookPath := fmt.Sprintf("/books/%d", created.ID)
+            if response := serveWithAPIKey(router, "GET", bookPath, reader.Key, ""); response.Code != http.StatusOK {
+                t.Errorf("Expected an API key with books:read to read books. Got %d", response.Code)
+            }
+            if response := serveWithAPIKey(router, "PATCH", bookPath, reader.Key, `{"year":1966}`); response.Code != http.StatusForbidden {
+                t.Errorf("Expected an API key without books:write not to change books. Got %d", response.Code)
+            }
+            if response := serveWithAPIKey(router, "POST", "/process-url", writer.Key, `{"url":"https://example.com","operation":"all"}`); response.Code != http.StatusForbidden {
+                t.Errorf("Expected an API key without urls:process not to process URLs. Got %d", response.Code)
+            }
+            for _, request := range [][2]string{{"DELETE", bookPath}, {"GET", "/users"}, {"GET", "/api-keys"}, {"POST", "/auth/logout"}} {
+                if response := serveWithAPIKey(router, request[0], request[1], writer.Key, ""); response.Code != http.StatusForbidden {
+                    t.Errorf("%s %s: Expected API keys to be rejected. Got %d", request[0], request[1], response.Code)
+                }
+            }
+            batch := fmt.Sprintf(`{"operations":[{"op":"delete","id":%d}]}`, created.ID)
+            if response := serveWithAPIKey(router, "POST", "/books/batch", writer.Key, batch); response.Code != http.StatusForbidden {
+                t.Errorf("Expected API keys not to delete books in a batch. Got %d", response.Code)
+            }
+
+            if response := serveWithAPIKey(router, "GET", "/books", "bm_0123456789abcdef0123456789abcdef", ""); response.Code != http.StatusUnauthorized {
+                t.Errorf("Expected unknown API keys to be rejected. Got %d", response.Code)
+            }
+            request, _ := http.NewRequest("GET", "/books", nil)
+            request.Header.Set("X-API-Key", reader.Key)
+            request.Header.Set("Authorization", "Bearer "+admin)
+            both := httptest.NewRecorder()
+            router.ServeHTTP(both, request)
+            if both.Code != http.StatusUnauthorized {
+                t.Errorf("Expected requests with both an access token and an API key to be rejected. Got %d", both.Code)
+            }
+
+            response = serveWithToken(router, "GET", "/api-keys", admin, "")
+            var keys []models.APIKey
+            json.Unmarshal(response.Body.Bytes(), &keys)
+            if response.Code != http.StatusOK || len(keys) != 2 || keys[0].LastUsedAt == nil || strings.Contains(response.Body.String(), writer.Key) {
+                t.Errorf("Unexpected API keys: %d %s", response.Code, response.Body.String())
+            }
+
+            keyPath := fmt.Sprintf("/api-keys/%d", writer.APIKey.ID)
+            response = serveWithToken(router, "POST", keyPath+"/rotate", admin, "")
+            var rotated handlers.NewAPIKeyResponse
+            json.Unmarshal(response.Body.Bytes(), &rotated)
+            if response.Code != http.StatusOK || rotated.Key == writer.Key || rotated.APIKey.RotatedAt == nil {
+                t.Fatalf("Failed to rotate API key: %d %s", response.Code, response.Body.String())
+            }
+            if response := serveWithAPIKey(router, "GET", "/books", writer.Key, ""); response.Code != http.StatusUnauthorized {
+                t.Errorf("Expected the rotated key to stop working. Got %d", response.Code)
+            }
+            if response := serveWithAPIKey(router, "PUT", bookPath, rotated.Key, book); response.Code != http.StatusOK {
+                t.Errorf("Expected the new key to work. Got %d %s", response.Code, response.Body.String())
+            }
+
+            if response := serveWithToken(router, "DELETE", keyPath, admin, ""); response.Code != http.StatusNoContent {
+                t.Errorf("Failed to revoke API key: %d", response.Code)
+            }
+            if response := serveWithAPIKey(router, "GET", "/books", rotated.Key, ""); response.Code != http.StatusUnauthorized {
+                t.Errorf("Expected the revoked key to stop working. Got %d", response.Code)
+            }
+            if response := serveWithToken(router, "POST", keyPath+"/rotate", admin, ""); response.Code != http.StatusConflict {
+                t.Errorf("Expected revoked keys not to be rotated. Got %d", response.Code)
+            }
+            if response := serveWithToken(router, "DELETE", "/api-keys/999", admin, ""); response.Code != http.StatusNotFound {
+                t.Errorf("Expected 404 for an unknown API key. Got %d", response.Code)
+            }
+
+            expiring := createAPIKey(t, router, admin, fmt.Sprintf(`{"name":"soon","scopes":["books:read"],"expiresAt":%q}`,
+                time.Now().Add(time.Second).Format(time.RFC3339Nano)))
+            if response := serveWithAPIKey(router, "GET", "/books", expiring.Key, ""); response.Code != http.StatusOK {
+                t.Errorf("Expected the key to work until it expires. Got %d", response.Code)
+            }
+            time.Sleep(time.Until(*expiring.APIKey.ExpiresAt))
+            if response := serveWithAPIKey(router, "GET", "/books", expiring.Key, ""); response.Code != http.StatusUnauthorized {
+                t.Errorf("Expected expired keys to be rejected. Got %d", response.Code)
+            }
+        })
+    }
+}
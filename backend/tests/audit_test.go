@@ -0,0 +1,276 @@
+package tests
+
+import (
+	"book-manager/handlers"
+	"book-manager/models"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+func auditEntries(t *testing.T, router *mux.Router, path string) []models.AuditEntry {
+    response := serve(router, "GET", path, "")
+    if response.Code != http.StatusOK {
+        t.Fatalf("%s: %d %s", path, response.Code, response.Body.String())
+    }
+    var entries []models.AuditEntry
+    json.Unmarshal(response.Body.Bytes(), &entries)
+    return entries
+}
+
+func TestAuditLog(t *testing.T) {
+    forEachRepository(t, func(t *testing.T, router *mux.Router) {
+        response := serve(router, "POST", "/books", `{"title":"Dune","author":"Frank Herbert","year":1965}`)
+        var book models.Book
+        json.Unmarshal(response.Body.Bytes(), &book)
+        bookPath := fmt.Sprintf("/books/%d", book.ID)
+        serve(router, "POST", "/books", `{"title":"Emma","author":"Jane Austen","year":1815,"isbn":"9780141439587"}`)
+
+        response = serve(router, "PATCH", bookPath, `{"year":1966}`)
+        requestID := response.Header().Get("X-Request-ID")
+        if response.Code != http.StatusOK {
+            t.Fatalf("Failed to patch book: %d %s", response.Code, response.Body.String())
+        }
+        // Failed changes are rolled back without an audit entry.
+        if response := serve(router, "PUT", bookPath, `{"title":"Dune","author":"Frank Herbert","year":1966,"isbn":"9780141439587"}`); response.Code != http.StatusConflict {
+            t.Errorf("Expected a duplicate ISBN. Got %d", response.Code)
+        }
+        serve(router, "PUT", bookPath, `{"title":"Dune","author":"Frank Herbert","year":1966,"isbn":"9780441172719"}`)
+        serve(router, "DELETE", bookPath, "")
+        serve(router, "POST", bookPath+"/restore", "")
+        serve(router, "DELETE", bookPath+"?purge=true", "")
+
+        history := auditEntries(t, router, bookPath+"/history")
+        var actions []string
+        for _, entry := range history {
+            actions = append(actions, entry.Action)
+        }
+        if strings.Join(actions, ",") != "purge,restore,delete,update,update,create" {
+            t.Fatalf("Unexpected history of a purged book: %v", actions)
+        }
+        if created := history[5]; created.Before != nil || created.After == nil || created.After.Title != "Dune" || created.Version != 1 {
+            t.Errorf("Unexpected create entry: %+v", created)
+        }
+        patched := history[4]
+        if patched.Actor != "user:1" || patched.ActorName != "tester" || patched.RequestID != requestID || patched.Version != 2 {
+            t.Errorf("Unexpected actor or request of the patch: %+v", patched)
+        }
+        if len(patched.Changes) != 1 || patched.Changes[0].Field != "year" || patched.Changes[0].Before != 1965.0 || patched.Changes[0].After != 1966.0 {
+            t.Errorf("Expected only the year to change. Got %+v", patched.Changes)
+        }
+        changed := map[string]bool{}
+        for _, change := range history[3].Changes {
+            changed[change.Field] = true
+        }
+        if len(changed) != 2 || !changed["isbn"] || !changed["isbn13"] || history[3].Changes[0].Before != nil {
+            t.Errorf("Expected the ISBN to be set. Got %+v", history[3].Changes)
+        }
+        if trashed := history[2]; trashed.After == nil || !trashed.After.DeletedAt.Valid || trashed.Changes[0].Field != "deletedAt" {
+            t.Errorf("Unexpected delete entry: %+v", trashed)
+        }
+        if purged := history[0]; purged.After != nil || purged.Before == nil || purged.Before.ISBN != "9780441172719" {
+            t.Errorf("Unexpected purge entry: %+v", purged)
+        }
+
+        if entries := auditEntries(t, router, bookPath+"/history?limit=2&offset=1"); len(entries) != 2 || entries[0].Action != "restore" {
+            t.Errorf("Unexpected page of history: %+v", entries)
+        }
+        if response := serve(router, "GET", "/books/999/history", ""); response.Code != http.StatusNotFound {
+            t.Errorf("Expected 404 for the history of an unknown book. Got %d", response.Code)
+        }
+
+        response = serve(router, "GET", "/audit?actor=user:1", "")
+        if response.Code != http.StatusOK || response.Header().Get("X-Total-Count") != "7" {
+            t.Errorf("Expected 7 changes by the user. Got %d %s", response.Code, response.Header().Get("X-Total-Count"))
+        }
+        if entries := auditEntries(t, router, "/audit?actor=api-key:1"); len(entries) != 0 {
+            t.Errorf("Expected no changes by an API key. Got %d", len(entries))
+        }
+        future := time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+        if entries := auditEntries(t, router, "/audit?since="+future); len(entries) != 0 {
+            t.Errorf("Expected no changes in the future. Got %d", len(entries))
+        }
+        if entries := auditEntries(t, router, "/audit?until="+future+"&limit=3"); len(entries) != 3 || entries[0].Action != "purge" {
+            t.Errorf("Expected the newest changes first. Got %+v", entries)
+        }
+        for _, query := range []string{"actor=tester", "since=yesterday", "limit=0"} {
+            if response := serve(router, "GET", "/audit?"+query, ""); response.Code != http.StatusBadRequest {
+                t.Errorf("%s: Expected 400. Got %d", query, response.Code)
+            }
+        }
+    })
+}
+
+func TestAuditLogOfBatches(t *testing.T) {
+    forEachRepository(t, func(t *testing.T, router *mux.Router) {
+        bookID := createBookForTesting(t, router)
+        status, _ := batchBooks(t, router, `{"operations":[
+            {"op":"create","book":{"title":"Dune","author":"Frank Herbert","year":1965}},
+            {"op":"delete","id":`+bookID+`}
+        ]}`)
+        if status != http.StatusOK {
+            t.Fatalf("Batch failed: %d", status)
+        }
+        // A rolled back batch leaves no entries.
+        batchBooks(t, router, `{"operations":[
+            {"op":"create","book":{"title":"Emma","author":"Jane Austen","year":1815}},
+            {"op":"update","id":999,"book":{"title":"Missing","author":"Nobody","year":2000}}
+        ]}`)
+
+        entries := auditEntries(t, router, "/audit")
+        if len(entries) != 3 || entries[0].Action != "delete" || entries[1].Action != "create" || entries[1].After.Title != "Dune" {
+            t.Errorf("Unexpected audit log: %+v", entries)
+        }
+    })
+}
+
+func revert(router *mux.Router, path, etag string) *httptest.ResponseRecorder {
+    request, _ := http.NewRequest("POST", path, nil)
+    if etag != "" {
+        request.Header.Set("If-Match", etag)
+    }
+    response := httptest.NewRecorder()
+    router.ServeHTTP(response, request)
+    return response
+}
+
+func TestRevertBook(t *testing.T) {
+    forEachRepository(t, func(t *testing.T, router *mux.Router) {
+        response := serve(router, "POST", "/books", `{"title":"Dune","author":"Frank Herbert","year":1965,"publisher":"Chilton"}`)
+        var book models.Book
+        json.Unmarshal(response.Body.Bytes(), &book)
+        bookPath := fmt.Sprintf("/books/%d", book.ID)
+        serve(router, "PUT", bookPath, `{"title":"Dune","author":"Frank Herbert","year":1966,"isbn":"9780441172719","publisher":"Ace"}`)
+        response = serve(router, "PATCH", bookPath, `{"title":"Dune Messiah"}`)
+        current := response.Header().Get("ETag")
+
+        if response := revert(router, bookPath+"/revisions/1/revert", ""); response.Code != http.StatusPreconditionRequired {
+            t.Errorf("Expected If-Match to be required. Got %d", response.Code)
+        }
+        stale := fmt.Sprintf(`"%d-2"`, book.ID)
+        if response := revert(router, bookPath+"/revisions/1/revert", stale); response.Code != http.StatusPreconditionFailed {
+            t.Errorf("Expected a stale ETag to be rejected. Got %d", response.Code)
+        }
+        for _, rev := range []string{"0", "3", "99", "abc"} {
+            if response := revert(router, bookPath+"/revisions/"+rev+"/revert", current); response.Code != http.StatusBadRequest {
+                t.Errorf("Revision %s: Expected 400. Got %d", rev, response.Code)
+            }
+        }
+        if response := revert(router, "/books/999/revisions/1/revert", current); response.Code != http.StatusNotFound {
+            t.Errorf("Expected 404 for an unknown book. Got %d", response.Code)
+        }
+
+        response = revert(router, bookPath+"/revisions/1/revert", current)
+        var reverted models.Book
+        json.Unmarshal(response.Body.Bytes(), &reverted)
+        if response.Code != http.StatusOK || reverted.Version != 4 || reverted.Title != "Dune" || reverted.Year != 1965 ||
+            reverted.ISBN != "" || reverted.ISBN13 != nil || reverted.Publisher != "Chilton" {
+            t.Fatalf("Failed to revert to revision 1: %d %s", response.Code, response.Body.String())
+        }
+        if etag := response.Header().Get("ETag"); etag != fmt.Sprintf(`"%d-4"`, book.ID) {
+            t.Errorf("Unexpected ETag %s", etag)
+        }
+
+        history := auditEntries(t, router, bookPath+"/history")
+        if latest := history[0]; latest.Action != "revert" || latest.Version != 4 || latest.Before.Title != "Dune Messiah" {
+            t.Errorf("Expected the revert to be recorded as a new revision. Got %+v", latest)
+        }
+
+        response = revert(router, bookPath+"/revisions/2/revert", response.Header().Get("ETag"))
+        json.Unmarshal(response.Body.Bytes(), &reverted)
+        if response.Code != http.StatusOK || reverted.Year != 1966 || reverted.Title != "Dune" || reverted.Publisher != "Ace" || reverted.Version != 5 {
+            t.Errorf("Failed to revert to revision 2: %d %s", response.Code, response.Body.String())
+        }
+    })
+}
+
+func TestAuditLogOfRenamesAndMerges(t *testing.T) {
+    forEachRepository(t, func(t *testing.T, router *mux.Router) {
+        response := serve(router, "POST", "/books", `{"title":"Dune","author":"Frank Herbert","year":1965,"publisher":"Chilton","genre":"Scifi"}`)
+        var book models.Book
+        json.Unmarshal(response.Body.Bytes(), &book)
+        bookPath := fmt.Sprintf("/books/%d", book.ID)
+        response = serve(router, "POST", "/books", `{"title":"Emma","author":"Jane Austen","year":1815,"publisher":"Chilton Books","genre":"Novels"}`)
+        var other models.Book
+        json.Unmarshal(response.Body.Bytes(), &other)
+
+        changes := []struct {
+            method, path, body string
+            field, after       string
+        }{
+            {"PUT", fmt.Sprintf("/publishers/%d", *book.PublisherID), `{"name":"Chilton Company"}`, "publisher", "Chilton Company"},
+            {"POST", fmt.Sprintf("/publishers/%d/merge", *book.PublisherID), fmt.Sprintf(`{"targetId":%d}`, *other.PublisherID), "publisher", "Chilton Books"},
+            {"POST", fmt.Sprintf("/genres/%d/merge", *book.GenreID), fmt.Sprintf(`{"targetId":%d}`, *other.GenreID), "genre", "Novels"},
+            {"PUT", fmt.Sprintf("/authors/%d", findAuthor(t, router, "herbert").ID), `{"name":"Frank P. Herbert"}`, "author", "Frank P. Herbert"},
+            {"PUT", bookPath + "/authors", fmt.Sprintf(`[{"authorId":%d,"role":"author"}]`, findAuthor(t, router, "austen").ID), "author", "Jane Austen"},
+        }
+        for i, change := range changes {
+            if response := serve(router, change.method, change.path, change.body); response.Code != http.StatusOK {
+                t.Fatalf("%s %s: %d %s", change.method, change.path, response.Code, response.Body.String())
+            }
+            history := auditEntries(t, router, bookPath+"/history")
+            latest := history[0]
+            changed := false
+            for _, fieldChange := range latest.Changes {
+                changed = changed || fieldChange.Field == change.field && fieldChange.After == change.after
+            }
+            if len(history) != i+2 || latest.Action != "update" || latest.Version != uint(i+2) || latest.Actor == "" || !changed {
+                t.Errorf("%s %s: Expected an update of the %s to %s. Got %+v", change.method, change.path, change.field, change.after, latest)
+            }
+        }
+
+        // Merging into the publisher and genre of the other book didn't change it.
+        if history := auditEntries(t, router, fmt.Sprintf("/books/%d/history", other.ID)); len(history) != 1 {
+            t.Errorf("Expected only the creation of the other book to be recorded. Got %+v", history)
+        }
+    })
+}
+
+func TestRevertAcrossGenreRename(t *testing.T) {
+    forEachRepository(t, func(t *testing.T, router *mux.Router) {
+        response := serve(router, "POST", "/books", `{"title":"Dune","author":"Frank Herbert","year":1965,"genre":"Scifi","publisher":"Chilton"}`)
+        var book models.Book
+        json.Unmarshal(response.Body.Bytes(), &book)
+        bookPath := fmt.Sprintf("/books/%d", book.ID)
+
+        if response := serve(router, "PUT", fmt.Sprintf("/genres/%d", *book.GenreID), `{"name":"Science Fiction"}`); response.Code != http.StatusOK {
+            t.Fatalf("Failed to rename the genre: %d %s", response.Code, response.Body.String())
+        }
+        response = serve(router, "PATCH", bookPath, `{"title":"Dune Messiah","publisher":"Putnam"}`)
+        if etag := response.Header().Get("ETag"); etag != fmt.Sprintf(`"%d-3"`, book.ID) {
+            t.Fatalf("Expected the rename to be version 2 and the patch version 3. Got %s", etag)
+        }
+        etag := response.Header().Get("ETag")
+        if response := serve(router, "DELETE", fmt.Sprintf("/publishers/%d", *book.PublisherID), ""); response.Code != http.StatusNoContent {
+            t.Fatalf("Failed to delete the publisher: %d %s", response.Code, response.Body.String())
+        }
+
+        // The genre still exists and is linked again; the deleted publisher is created again.
+        response = revert(router, bookPath+"/revisions/2/revert", etag)
+        var reverted models.Book
+        json.Unmarshal(response.Body.Bytes(), &reverted)
+        if response.Code != http.StatusOK || reverted.Title != "Dune" || reverted.Genre != "Science Fiction" || reverted.Version != 4 {
+            t.Fatalf("Failed to revert to the revision of the rename: %d %s", response.Code, response.Body.String())
+        }
+        if reverted.Publisher != "Chilton" || reverted.PublisherID == nil || *reverted.PublisherID == *book.PublisherID {
+            t.Errorf("Expected the deleted publisher to be created again. Got %+v", reverted)
+        }
+
+        response = revert(router, bookPath+"/revisions/1/revert", response.Header().Get("ETag"))
+        json.Unmarshal(response.Body.Bytes(), &reverted)
+        if response.Code != http.StatusOK || reverted.Genre != "Science Fiction" || *reverted.GenreID != *book.GenreID || reverted.Version != 5 {
+            t.Errorf("Expected the renamed genre to be linked again: %d %s", response.Code, response.Body.String())
+        }
+        var genres []handlers.GenreResult
+        json.Unmarshal(serve(router, "GET", "/genres", "").Body.Bytes(), &genres)
+        if len(genres) != 1 {
+            t.Errorf("Expected the revert not to create a genre. Got %+v", genres)
+        }
+    })
+}
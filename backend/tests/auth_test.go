@@ -0,0 +1,119 @@
+package tests
+
+import (
+	"book-manager/handlers"
+	"book-manager/models"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+func serveWithToken(router *mux.Router, method, path, token, body string) *httptest.ResponseRecorder {
+    request, _ := http.NewRequest(method, path, strings.NewReader(body))
+    request.Header.Set("Content-Type", "application/json")
+    if token != "" {
+        request.Header.Set("Authorization", "Bearer "+token)
+    }
+    response := httptest.NewRecorder()
+    router.ServeHTTP(response, request)
+    return response
+}
+
+func signIn(t *testing.T, router *mux.Router, username, password string) handlers.TokenResponse {
+    response := serve(router, "POST", "/auth/login", `{"username":"`+username+`","password":"`+password+`"}`)
+    if response.Code != http.StatusOK {
+        t.Fatalf("Failed to sign in: %d %s", response.Code, response.Body.String())
+    }
+    var tokens handlers.TokenResponse
+    json.Unmarshal(response.Body.Bytes(), &tokens)
+    return tokens
+}
+
+func TestAuthentication(t *testing.T) {
+    t.Parallel()
+    for name, newRepository := range repositories {
+        newRepository := newRepository
+        t.Run(name, func(t *testing.T) {
+            t.Parallel()
+            server := handlers.NewServer(newRepository(t))
+            router := server.Routes()
+            book := `{"title":"Dune","author":"Frank Herbert","year":1965}`
+
+            response := serve(router, "POST", "/books", book)
+            if response.Code != http.StatusUnauthorized || !strings.HasPrefix(response.Header().Get("WWW-Authenticate"), "Bearer") {
+                t.Errorf("Expected writes without a token to be rejected. Got %d %v", response.Code, response.Header())
+            }
+            if response := serve(router, "GET", "/books", ""); response.Code != http.StatusOK {
+                t.Errorf("Expected reads to be open. Got %d", response.Code)
+            }
+
+            response = serve(router, "POST", "/auth/register", `{"username":" Ada.Lovelace ","password":"analytical engine"}`)
+            var user models.User
+            json.Unmarshal(response.Body.Bytes(), &user)
+            if response.Code != http.StatusCreated || user.Username != "ada.lovelace" || strings.Contains(response.Body.String(), "$2a$") {
+                t.Fatalf("Failed to register: %d %s", response.Code, response.Body.String())
+            }
+            if _, err := server.Books.SetUserRole(context.Background(), user.ID, models.UserEditor); err != nil {
+                t.Fatal(err)
+            }
+            if response := serve(router, "POST", "/auth/register", `{"username":"ADA.LOVELACE","password":"difference engine"}`); response.Code != http.StatusConflict {
+                t.Errorf("Expected usernames to be unique regardless of case. Got %d", response.Code)
+            }
+            if response := serve(router, "POST", "/auth/register", `{"username":"a","password":"short"}`); response.Code != http.StatusBadRequest {
+                t.Errorf("Expected invalid credentials to be rejected. Got %d", response.Code)
+            }
+
+            for _, credentials := range []string{
+                `{"username":"ada.lovelace","password":"wrong password"}`,
+                `{"username":"nobody","password":"analytical engine"}`,
+            } {
+                if response := serve(router, "POST", "/auth/login", credentials); response.Code != http.StatusUnauthorized {
+                    t.Errorf("%s: Expected 401. Got %d", credentials, response.Code)
+                }
+            }
+
+            tokens := signIn(t, router, "Ada.Lovelace", "analytical engine")
+            if response := serveWithToken(router, "POST", "/books", tokens.AccessToken, book); response.Code != http.StatusCreated {
+                t.Errorf("Expected a signed in user to add books. Got %d %s", response.Code, response.Body.String())
+            }
+            if response := serveWithToken(router, "POST", "/books", tokens.RefreshToken, book); response.Code != http.StatusUnauthorized {
+                t.Errorf("Expected refresh tokens not to authenticate requests. Got %d", response.Code)
+            }
+            response = serveWithToken(router, "GET", "/auth/me", tokens.AccessToken, "")
+            if response.Code != http.StatusOK || !strings.Contains(response.Body.String(), `"username":"ada.lovelace"`) {
+                t.Errorf("Failed to get the current user: %d %s", response.Code, response.Body.String())
+            }
+
+            // Refresh tokens can be used once. Using one again revokes the session.
+            response = serve(router, "POST", "/auth/refresh", `{"refreshToken":"`+tokens.RefreshToken+`"}`)
+            var refreshed handlers.TokenResponse
+            json.Unmarshal(response.Body.Bytes(), &refreshed)
+            if response.Code != http.StatusOK || refreshed.AccessToken == "" || refreshed.RefreshToken == tokens.RefreshToken {
+                t.Fatalf("Failed to refresh tokens: %d %s", response.Code, response.Body.String())
+            }
+            if response := serve(router, "POST", "/auth/refresh", `{"refreshToken":"`+tokens.RefreshToken+`"}`); response.Code != http.StatusUnauthorized {
+                t.Errorf("Expected a used refresh token to be rejected. Got %d", response.Code)
+            }
+            if response := serveWithToken(router, "POST", "/books", refreshed.AccessToken, book); response.Code != http.StatusUnauthorized {
+                t.Errorf("Expected reusing a refresh token to revoke the session. Got %d", response.Code)
+            }
+
+            // Signing out revokes the tokens of the session.
+            tokens = signIn(t, router, "ada.lovelace", "analytical engine")
+            if response := serveWithToken(router, "POST", "/auth/logout", tokens.AccessToken, ""); response.Code != http.StatusNoContent {
+                t.Fatalf("Failed to sign out: %d %s", response.Code, response.Body.String())
+            }
+            if response := serveWithToken(router, "GET", "/books", tokens.AccessToken, ""); response.Code != http.StatusUnauthorized {
+                t.Errorf("Expected the access token to be revoked. Got %d", response.Code)
+            }
+            if response := serve(router, "POST", "/auth/refresh", `{"refreshToken":"`+tokens.RefreshToken+`"}`); response.Code != http.StatusUnauthorized {
+                t.Errorf("Expected the refresh token to be revoked. Got %d", response.Code)
+            }
+        })
+    }
+}
@@ -0,0 +1,133 @@
+package tests
+
+import (
+	"book-manager/handlers"
+	"book-manager/models"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+func serve(router *mux.Router, method, path, body string) *httptest.ResponseRecorder {
+    request, _ := http.NewRequest(method, path, strings.NewReader(body))
+    request.Header.Set("Content-Type", "application/json")
+    response := httptest.NewRecorder()
+    router.ServeHTTP(response, request)
+    return response
+}
+
+func findAuthor(t *testing.T, router *mux.Router, name string) models.Author {
+    response := serve(router, "GET", "/authors?name="+name, "")
+    var authors []models.Author
+    json.Unmarshal(response.Body.Bytes(), &authors)
+    if len(authors) != 1 {
+        t.Fatalf("Expected one author named %s. Got %s", name, response.Body.String())
+    }
+    return authors[0]
+}
+
+func TestAuthorsFromBooks(t *testing.T) {
+    forEachRepository(t, func(t *testing.T, router *mux.Router) {
+        response := serve(router, "POST", "/books", `{"title":"Good Omens","author":"Terry Pratchett & Neil Gaiman","year":1990}`)
+        var omens models.Book
+        json.Unmarshal(response.Body.Bytes(), &omens)
+        serve(router, "POST", "/books", `{"title":"Mort","author":"terry  pratchett","year":1987}`)
+
+        response = serve(router, "GET", "/authors", "")
+        if total := response.Header().Get("X-Total-Count"); total != "2" {
+            t.Fatalf("Expected co-authors to be split and deduplicated into 2 authors. Got %s: %s", total, response.Body.String())
+        }
+
+        pratchett := findAuthor(t, router, "pratchett")
+        response = serve(router, "GET", fmt.Sprintf("/authors/%d/books", pratchett.ID), "")
+        var books []handlers.AuthorBookResult
+        json.Unmarshal(response.Body.Bytes(), &books)
+        if len(books) != 2 || books[0].Book.Title != "Mort" || books[1].Book.Title != "Good Omens" || books[0].Role != models.RoleAuthor {
+            t.Errorf("Expected both books of the author, oldest first. Got %s", response.Body.String())
+        }
+
+        // Renaming an author updates the author string of their books.
+        response = serve(router, "PUT", fmt.Sprintf("/authors/%d", pratchett.ID), `{"name":"Sir Terry Pratchett"}`)
+        if response.Code != http.StatusOK {
+            t.Fatalf("Failed to rename the author: %d %s", response.Code, response.Body.String())
+        }
+        response = serve(router, "GET", fmt.Sprintf("/books/%d", omens.ID), "")
+        var renamed models.Book
+        json.Unmarshal(response.Body.Bytes(), &renamed)
+        if renamed.Author != "Sir Terry Pratchett & Neil Gaiman" || renamed.Version != omens.Version+1 {
+            t.Errorf("Expected the rename to update the book. Got %+v", renamed)
+        }
+
+        response = serve(router, "POST", "/authors", `{"name":"neil gaiman"}`)
+        var conflict handlers.ErrorResponse
+        json.Unmarshal(response.Body.Bytes(), &conflict)
+        if response.Code != http.StatusConflict || conflict.Code != handlers.CodeDuplicateAuthor || conflict.ExistingID == 0 {
+            t.Errorf("Expected a duplicate author error. Got %d %s", response.Code, response.Body.String())
+        }
+
+        response = serve(router, "DELETE", fmt.Sprintf("/authors/%d", pratchett.ID), "")
+        if response.Code != http.StatusConflict {
+            t.Errorf("Expected an author with books not to be deleted. Got %d", response.Code)
+        }
+    })
+}
+
+func TestBookAuthorRoles(t *testing.T) {
+    forEachRepository(t, func(t *testing.T, router *mux.Router) {
+        response := serve(router, "POST", "/books", `{"title":"The Name of the Rose","author":"Umberto Eco","year":1983}`)
+        var book models.Book
+        json.Unmarshal(response.Body.Bytes(), &book)
+        eco := findAuthor(t, router, "eco")
+
+        response = serve(router, "POST", "/authors", `{"name":"William Weaver","bio":"Translator from Italian"}`)
+        if response.Code != http.StatusCreated {
+            t.Fatalf("Failed to create an author: %d %s", response.Code, response.Body.String())
+        }
+        var weaver models.Author
+        json.Unmarshal(response.Body.Bytes(), &weaver)
+
+        path := fmt.Sprintf("/books/%d/authors", book.ID)
+        tests := []struct {
+            body         string
+            expectedCode int
+        }{
+            {`[{"authorId":1,"role":"illustrator"}]`, http.StatusBadRequest},
+            {`[{"authorId":999,"role":"author"}]`, http.StatusBadRequest},
+            {`{"authorId":1}`, http.StatusBadRequest},
+        }
+        for _, test := range tests {
+            if response := serve(router, "PUT", path, test.body); response.Code != test.expectedCode {
+                t.Errorf("%s: Status code differs. Expected %d. Got %d instead", test.body, test.expectedCode, response.Code)
+            }
+        }
+
+        response = serve(router, "PUT", path, fmt.Sprintf(`[{"authorId":%d,"role":"author"},{"authorId":%d,"role":"translator"}]`, eco.ID, weaver.ID))
+        var contributors []models.Contributor
+        json.Unmarshal(response.Body.Bytes(), &contributors)
+        if response.Code != http.StatusOK || len(contributors) != 2 || contributors[1].Name != "William Weaver" || contributors[1].Role != models.RoleTranslator {
+            t.Fatalf("Unexpected credits: %d %s", response.Code, response.Body.String())
+        }
+
+        // Credits in other roles don't change the author string.
+        response = serve(router, "GET", fmt.Sprintf("/books/%d", book.ID), "")
+        var updated models.Book
+        json.Unmarshal(response.Body.Bytes(), &updated)
+        if updated.Author != "Umberto Eco" {
+            t.Errorf("Expected the author string to be kept. Got %q", updated.Author)
+        }
+
+        // Purging the book removes its credits, so the translator can be deleted.
+        serve(router, "DELETE", fmt.Sprintf("/books/%d?purge=true", book.ID), "")
+        if response := serve(router, "DELETE", fmt.Sprintf("/authors/%d", weaver.ID), ""); response.Code != http.StatusNoContent {
+            t.Errorf("Expected the author to be deleted. Got %d %s", response.Code, response.Body.String())
+        }
+        if response := serve(router, "GET", fmt.Sprintf("/authors/%d", weaver.ID), ""); response.Code != http.StatusNotFound {
+            t.Errorf("Expected the deleted author to be gone. Got %d", response.Code)
+        }
+    })
+}
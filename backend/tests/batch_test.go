@@ -0,0 +1,95 @@
+package tests
+
+import (
+	"book-manager/handlers"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+func batchBooks(t *testing.T, router *mux.Router, body string) (int, handlers.BatchResponse) {
+    request, _ := http.NewRequest("POST", "/books/batch", strings.NewReader(body))
+    response := httptest.NewRecorder()
+    router.ServeHTTP(response, request)
+
+    var batch handlers.BatchResponse
+    json.Unmarshal(response.Body.Bytes(), &batch)
+    return response.Code, batch
+}
+
+func TestBatchBooksAtomic(t *testing.T) {
+    forEachRepository(t, func(t *testing.T, router *mux.Router) {
+        bookID := createBookForTesting(t, router)
+
+        status, batch := batchBooks(t, router, `{"operations":[
+            {"op":"create","book":{"title":"Dune","author":"Frank Herbert","year":1965}},
+            {"op":"update","id":`+bookID+`,"book":{"title":"Updated Book","author":"Test Author","year":2022}},
+            {"op":"delete","id":999}
+        ]}`)
+        if status != http.StatusNotFound || batch.Committed || len(batch.Results) != 3 || batch.Results[2].Status != http.StatusNotFound {
+            t.Fatalf("Expected the batch to be rolled back because of the missing book. Got %d: %+v", status, batch)
+        }
+        if total := countBooks(t, router); total != "1" {
+            t.Errorf("A rolled back batch must not create books. Got %s", total)
+        }
+
+        status, batch = batchBooks(t, router, `{"mode":"atomic","operations":[
+            {"op":"create","book":{"title":"Dune","author":"Frank Herbert","year":1965}},
+            {"op":"update","id":`+bookID+`,"version":1,"book":{"title":"Updated Book","author":"Test Author","year":2022}}
+        ]}`)
+        if status != http.StatusOK || !batch.Committed {
+            t.Fatalf("Expected the batch to be committed. Got %d: %+v", status, batch)
+        }
+        if batch.Results[0].Status != http.StatusCreated || batch.Results[1].Status != http.StatusOK || batch.Results[1].Book.Title != "Updated Book" {
+            t.Errorf("Unexpected results: %+v", batch.Results)
+        }
+        if total := countBooks(t, router); total != "2" {
+            t.Errorf("Expected 2 books after the batch. Got %s", total)
+        }
+    })
+}
+
+func TestBatchBooksBestEffort(t *testing.T) {
+    forEachRepository(t, func(t *testing.T, router *mux.Router) {
+        bookID := createBookForTesting(t, router)
+
+        status, batch := batchBooks(t, router, `{"mode":"bestEffort","operations":[
+            {"op":"create","book":{"title":"Dune","author":"Frank Herbert","year":1965,"isbn":"0441172717"}},
+            {"op":"create","book":{"title":"Dune","author":"Frank Herbert","year":1965,"isbn":"9780441172719"}},
+            {"op":"create","book":{"title":"D","author":"Frank Herbert","year":1965}},
+            {"op":"update","id":`+bookID+`,"version":7,"book":{"title":"Updated Book","author":"Test Author","year":2022}},
+            {"op":"delete","id":`+bookID+`}
+        ]}`)
+        if status != http.StatusOK || !batch.Committed {
+            t.Fatalf("Expected a best-effort batch to be committed. Got %d: %+v", status, batch)
+        }
+        expected := []int{http.StatusCreated, http.StatusConflict, http.StatusBadRequest, http.StatusPreconditionFailed, http.StatusNoContent}
+        for i, result := range batch.Results {
+            if result.Status != expected[i] {
+                t.Errorf("Operation %d: Expected status %d. Got %+v", i, expected[i], result)
+            }
+        }
+        if batch.Results[1].Error == nil || batch.Results[1].Error.Code != handlers.CodeDuplicateISBN {
+            t.Errorf("Expected a duplicate ISBN error. Got %+v", batch.Results[1].Error)
+        }
+        if total := countBooks(t, router); total != "1" {
+            t.Errorf("Expected 1 live book after the batch. Got %s", total)
+        }
+
+        for _, body := range []string{
+            `{"operations":[]}`,
+            `{"mode":"sometimes","operations":[{"op":"delete","id":1}]}`,
+            `{"operations":[{"op":"upsert","id":1}]}`,
+            `{"operations":[{"op":"update","id":1}]}`,
+            `{"operations":[{"op":"create","book":{"title":"Dune","pages":412}}]}`,
+        } {
+            if status, _ := batchBooks(t, router, body); status != http.StatusBadRequest {
+                t.Errorf("%s: Status code differs. Expected %d. Got %d instead", body, http.StatusBadRequest, status)
+            }
+        }
+    })
+}
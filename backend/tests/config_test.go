@@ -0,0 +1,86 @@
+package tests
+
+import (
+	"book-manager/config"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestConfigPrecedence(t *testing.T) {
+    dir := t.TempDir()
+    yamlFile := filepath.Join(dir, "config.yaml")
+    os.WriteFile(yamlFile, []byte("addr: \":9000\"\nlog_level: debug\nread_timeout: 5s\nrate_limit_read: 100/1s\nallowed_origins: [\"https://books.example.com\"]\n"), 0o600)
+    tomlFile := filepath.Join(dir, "config.toml")
+    os.WriteFile(tomlFile, []byte("addr = \":9001\"\nidle_timeout = \"2m\"\nrate_limit_write = \"off\"\n"), 0o600)
+
+    t.Setenv("BOOK_MANAGER_LOG_LEVEL", "warn")
+
+    cfg, err := config.Load([]string{"-config", yamlFile, "-read-timeout", "7s"})
+    if err != nil {
+        t.Fatalf("Failed to load config: %v", err)
+    }
+    if cfg.Addr != ":9000" {
+        t.Errorf("Addr should come from the config file. Got %s", cfg.Addr)
+    }
+    if cfg.LogLevel != "warn" || cfg.SlogLevel() != slog.LevelWarn {
+        t.Errorf("LogLevel should come from the environment. Got %s", cfg.LogLevel)
+    }
+    if cfg.ReadTimeout != 7*time.Second {
+        t.Errorf("ReadTimeout should come from the flags. Got %s", cfg.ReadTimeout)
+    }
+    if len(cfg.AllowedOrigins) != 1 || cfg.AllowedOrigins[0] != "https://books.example.com" {
+        t.Errorf("AllowedOrigins should come from the config file. Got %v", cfg.AllowedOrigins)
+    }
+    if cfg.WriteTimeout != config.Default().WriteTimeout {
+        t.Errorf("WriteTimeout should keep its default. Got %s", cfg.WriteTimeout)
+    }
+
+    if cfg.RateLimitRead.Requests != 100 || cfg.RateLimitRead.Period != time.Second {
+        t.Errorf("RateLimitRead should come from the config file. Got %s", cfg.RateLimitRead)
+    }
+
+    t.Setenv("BOOK_MANAGER_TRUSTED_PROXIES", "10.0.0.0/8, ::1")
+    cfg, err = config.Load(nil)
+    if err != nil {
+        t.Fatalf("Failed to load config: %v", err)
+    }
+    if prefixes := cfg.TrustedProxyPrefixes(); len(prefixes) != 2 || prefixes[0].String() != "10.0.0.0/8" || prefixes[1].String() != "::1/128" {
+        t.Errorf("TrustedProxies should come from the environment. Got %v", prefixes)
+    }
+
+    cfg, err = config.Load([]string{"-config", tomlFile})
+    if err != nil {
+        t.Fatalf("Failed to load TOML config: %v", err)
+    }
+    if cfg.Addr != ":9001" || cfg.IdleTimeout != 2*time.Minute || cfg.RateLimitWrite.Enabled() {
+        t.Errorf("Unexpected TOML config: %+v", cfg)
+    }
+}
+
+func TestConfigValidation(t *testing.T) {
+    tests := [][]string{
+        {"-addr", "8000"},
+        {"-db", ""},
+        {"-cors-origins", "localhost:3000"},
+        {"-log-level", "verbose"},
+        {"-write-timeout", "0s"},
+        {"-read-timeout", "soon"},
+        {"-max-cover-size", "0"},
+        {"-jwt-secret", "too short"},
+        {"-access-token-ttl", "2h", "-refresh-token-ttl", "1h"},
+        {"-rate-limit-write", "lots"},
+        {"-rate-limit-urls", "10/soon"},
+        {"-trusted-proxies", "10.0.0.0/8,proxy.local"},
+        {"-trusted-proxies", "10.0.0.0/33"},
+        {"-config", "config.ini"},
+    }
+
+    for _, args := range tests {
+        if _, err := config.Load(args); err == nil {
+            t.Errorf("%v: expected a validation error", args)
+        }
+    }
+}
@@ -0,0 +1,166 @@
+package tests
+
+import (
+	"book-manager/handlers"
+	"book-manager/storage"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+func pngImage(t *testing.T, width, height int, fill color.Color) []byte {
+    img := image.NewNRGBA(image.Rect(0, 0, width, height))
+    for y := 0; y < height; y++ {
+        for x := 0; x < width; x++ {
+            img.Set(x, y, fill)
+        }
+    }
+    var data bytes.Buffer
+    if err := png.Encode(&data, img); err != nil {
+        t.Fatalf("Failed to encode image: %v", err)
+    }
+    return data.Bytes()
+}
+
+// pngClaiming returns a small PNG whose header claims the given size, like an
+// image that would take a lot of memory to decode.
+func pngClaiming(t *testing.T, width, height int) []byte {
+    data := pngImage(t, 1, 1, color.White)
+    binary.BigEndian.PutUint32(data[16:], uint32(width))
+    binary.BigEndian.PutUint32(data[20:], uint32(height))
+    binary.BigEndian.PutUint32(data[29:], crc32.ChecksumIEEE(data[12:29]))
+    return data
+}
+
+func uploadCover(router *mux.Router, bookID, contentType string, data []byte) *httptest.ResponseRecorder {
+    request, _ := http.NewRequest("POST", "/books/"+bookID+"/cover", bytes.NewReader(data))
+    request.Header.Set("Content-Type", contentType)
+    response := httptest.NewRecorder()
+    router.ServeHTTP(response, request)
+    return response
+}
+
+// countFiles returns the number of files below dir.
+func countFiles(dir string) int {
+    count := 0
+    filepath.WalkDir(dir, func(path string, entry os.DirEntry, err error) error {
+        if err == nil && !entry.IsDir() {
+            count++
+        }
+        return err
+    })
+    return count
+}
+
+func TestBookCovers(t *testing.T) {
+    t.Parallel()
+    for name, newRepository := range repositories {
+        newRepository := newRepository
+        t.Run(name, func(t *testing.T) {
+            t.Parallel()
+            dir := t.TempDir()
+            covers, err := storage.NewLocalStore(dir)
+            if err != nil {
+                t.Fatalf("Failed to open cover store: %v", err)
+            }
+            server := handlers.NewServer(newRepository(t))
+            server.Covers, server.MaxCoverSize = covers, 64<<10
+            router := signedIn(t, server)
+            bookID := createBookForTesting(t, router)
+
+            response := uploadCover(router, bookID, "image/png", pngImage(t, 600, 900, color.NRGBA{R: 200, A: 128}))
+            if response.Code != http.StatusCreated {
+                t.Fatalf("Failed to upload cover: %d %s", response.Code, response.Body.String())
+            }
+            var cover handlers.CoverResult
+            json.Unmarshal(response.Body.Bytes(), &cover)
+            if cover.ContentType != "image/png" || cover.Width != 600 || cover.Height != 900 || len(cover.URLs) != 3 {
+                t.Errorf("Unexpected cover: %s", response.Body.String())
+            }
+            if files := countFiles(dir); files != 3 {
+                t.Errorf("Expected the original and 2 thumbnails to be stored. Got %d files", files)
+            }
+
+            response = serve(router, "GET", cover.URLs["thumb"], "")
+            if response.Code != http.StatusOK || response.Header().Get("Content-Type") != "image/jpeg" {
+                t.Fatalf("Failed to get the thumbnail: %d %v", response.Code, response.Header())
+            }
+            if cacheControl := response.Header().Get("Cache-Control"); cacheControl != "public, max-age=31536000, immutable" {
+                t.Errorf("Versioned cover URLs should be cached indefinitely. Got %q", cacheControl)
+            }
+            thumb, err := jpeg.Decode(response.Body)
+            if err != nil || thumb.Bounds().Dx() != 160 || thumb.Bounds().Dy() != 240 {
+                t.Errorf("Expected a 160x240 JPEG thumbnail. Got %v (%v)", thumb.Bounds(), err)
+            }
+
+            etag := response.Header().Get("ETag")
+            request, _ := http.NewRequest("GET", "/books/"+bookID+"/cover?size=thumb", nil)
+            request.Header.Set("If-None-Match", etag)
+            response = httptest.NewRecorder()
+            router.ServeHTTP(response, request)
+            if response.Code != http.StatusNotModified || response.Header().Get("Cache-Control") != "public, no-cache" {
+                t.Errorf("Expected a revalidated 304 response. Got %d %v", response.Code, response.Header())
+            }
+
+            // The original is served as uploaded.
+            response = serve(router, "GET", "/books/"+bookID+"/cover", "")
+            if response.Code != http.StatusOK || response.Header().Get("Content-Type") != "image/png" || int64(response.Body.Len()) != cover.Size {
+                t.Errorf("Failed to get the original: %d %v", response.Code, response.Header())
+            }
+
+            // A new cover replaces the images of the old one.
+            response = uploadCover(router, bookID, "application/octet-stream", pngImage(t, 100, 80, color.White))
+            if response.Code != http.StatusOK {
+                t.Fatalf("Failed to replace cover: %d %s", response.Code, response.Body.String())
+            }
+            if files := countFiles(dir); files != 3 {
+                t.Errorf("Expected the old images to be deleted. Got %d files", files)
+            }
+            response = serve(router, "GET", "/books/"+bookID+"/cover?size=medium", "")
+            if medium, err := jpeg.Decode(response.Body); err != nil || medium.Bounds().Dx() != 100 {
+                t.Errorf("Small covers must not be enlarged: %v", err)
+            }
+
+            failures := []struct {
+                contentType string
+                data        []byte
+                status      int
+            }{
+                {"text/plain", []byte("not an image"), http.StatusUnsupportedMediaType},
+                {"image/jpeg", pngImage(t, 10, 10, color.White), http.StatusUnsupportedMediaType},
+                {"image/png", append([]byte("\x89PNG\r\n\x1a\n"), make([]byte, 64)...), http.StatusBadRequest},
+                {"image/png", make([]byte, 65<<10), http.StatusRequestEntityTooLarge},
+                {"image/png", pngClaiming(t, 4097, 4096), http.StatusRequestEntityTooLarge},
+            }
+            for _, failure := range failures {
+                if response := uploadCover(router, bookID, failure.contentType, failure.data); response.Code != failure.status {
+                    t.Errorf("%s upload: Expected %d. Got %d %s", failure.contentType, failure.status, response.Code, response.Body.String())
+                }
+            }
+            if response := serve(router, "GET", "/books/"+bookID+"/cover?size=huge", ""); response.Code != http.StatusBadRequest {
+                t.Errorf("Expected unknown sizes to be rejected. Got %d", response.Code)
+            }
+
+            // Purging the book deletes its cover images.
+            serve(router, "DELETE", "/books/"+bookID+"?purge=true", "")
+            if files := countFiles(dir); files != 0 {
+                t.Errorf("Expected the images of purged books to be deleted. Got %d files", files)
+            }
+            if response := serve(router, "GET", "/books/"+bookID+"/cover", ""); response.Code != http.StatusNotFound {
+                t.Errorf("Expected 404 for the cover of a purged book. Got %d", response.Code)
+            }
+        })
+    }
+}
@@ -0,0 +1,115 @@
+package tests
+
+import (
+	"book-manager/handlers"
+	"book-manager/repository"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+func TestErrorResponses(t *testing.T) {
+    forEachRepository(t, func(t *testing.T, router *mux.Router) {
+        tests := []struct {
+            method       string
+            path         string
+            body         string
+            expectedCode int
+            expectedErr  string
+        }{
+            {"GET", "/books/abc", "", http.StatusBadRequest, handlers.CodeInvalidRequest},
+            {"GET", "/books/999", "", http.StatusNotFound, handlers.CodeNotFound},
+            {"GET", "/books?limit=-1", "", http.StatusBadRequest, handlers.CodeInvalidRequest},
+            {"POST", "/books", "{", http.StatusBadRequest, handlers.CodeInvalidRequest},
+            {"POST", "/books", `{"title":"A","author":"Test Author","year":2021,"isbn":"123"}`, http.StatusBadRequest, handlers.CodeValidationFailed},
+            {"POST", "/books", `{"title":1,"author":"Test Author"}`, http.StatusBadRequest, handlers.CodeValidationFailed},
+            {"PATCH", "/books", "", http.StatusMethodNotAllowed, handlers.CodeMethodNotAllowed},
+            {"GET", "/nowhere", "", http.StatusNotFound, handlers.CodeNotFound},
+        }
+
+        for _, test := range tests {
+            request, _ := http.NewRequest(test.method, test.path, strings.NewReader(test.body))
+            response := httptest.NewRecorder()
+            router.ServeHTTP(response, request)
+
+            if status := response.Code; status != test.expectedCode {
+                t.Errorf("%s %s: Status code differs. Expected %d. Got %d instead", test.method, test.path, test.expectedCode, status)
+            }
+            if contentType := response.Header().Get("Content-Type"); contentType != "application/json" {
+                t.Errorf("%s %s: Expected a JSON error. Got %s", test.method, test.path, contentType)
+            }
+
+            var body handlers.ErrorResponse
+            if err := json.Unmarshal(response.Body.Bytes(), &body); err != nil {
+                t.Fatalf("%s %s: Failed to unmarshal error: %v", test.method, test.path, err)
+            }
+            if body.Code != test.expectedErr || body.Status != test.expectedCode || body.Message == "" {
+                t.Errorf("%s %s: Unexpected error body: %+v", test.method, test.path, body)
+            }
+            if body.RequestID == "" || body.RequestID != response.Header().Get(handlers.RequestIDHeader) {
+                t.Errorf("%s %s: Expected the request ID in the body and the header. Got %q and %q",
+                    test.method, test.path, body.RequestID, response.Header().Get(handlers.RequestIDHeader))
+            }
+        }
+    })
+}
+
+func TestValidationErrorDetails(t *testing.T) {
+    forEachRepository(t, func(t *testing.T, router *mux.Router) {
+        jsonStr := []byte(`{"title":"A","author":"Test Author","year":0,"isbn":"0-306-40615-3"}`)
+        request, _ := http.NewRequest("POST", "/books", bytes.NewBuffer(jsonStr))
+        request.Header.Set(handlers.RequestIDHeader, "client-id-42")
+        response := httptest.NewRecorder()
+        router.ServeHTTP(response, request)
+
+        var body handlers.ErrorResponse
+        json.Unmarshal(response.Body.Bytes(), &body)
+        if body.RequestID != "client-id-42" {
+            t.Errorf("Expected the client's request ID to be kept. Got %q", body.RequestID)
+        }
+
+        rules := map[string]string{}
+        for _, detail := range body.Details {
+            rules[detail.Field] = detail.Rule
+        }
+        expected := map[string]string{"title": "min", "year": "required", "isbn": "isbn"}
+        for field, rule := range expected {
+            if rules[field] != rule {
+                t.Errorf("Expected %s to fail %s. Got details %+v", field, rule, body.Details)
+            }
+        }
+        if len(rules) != len(expected) {
+            t.Errorf("Unexpected details: %+v", body.Details)
+        }
+    })
+}
+
+// failingRepository fails every call, to check that database errors aren't leaked.
+type failingRepository struct {
+    repository.BookRepository
+}
+
+func (failingRepository) List(ctx context.Context, q *repository.BookQuery) (*repository.BookPage, error) {
+    return nil, errors.New(`pq: relation "books" does not exist`)
+}
+
+func TestInternalErrorsAreNotLeaked(t *testing.T) {
+    router := handlers.NewServer(failingRepository{}).Routes()
+    request, _ := http.NewRequest("GET", "/books", nil)
+    response := httptest.NewRecorder()
+    router.ServeHTTP(response, request)
+
+    if status := response.Code; status != http.StatusInternalServerError {
+        t.Errorf("Status code differs. Expected %d. Got %d instead", http.StatusInternalServerError, status)
+    }
+    if strings.Contains(response.Body.String(), "relation") {
+        t.Errorf("The database error was leaked: %s", response.Body.String())
+    }
+}
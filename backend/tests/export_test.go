@@ -0,0 +1,81 @@
+package tests
+
+import (
+	"book-manager/models"
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+func exportBooks(t *testing.T, router *mux.Router, query string) *httptest.ResponseRecorder {
+    request, _ := http.NewRequest("GET", "/books/export?"+query, nil)
+    response := httptest.NewRecorder()
+    router.ServeHTTP(response, request)
+    return response
+}
+
+func TestExportBooks(t *testing.T) {
+    forEachRepository(t, func(t *testing.T, router *mux.Router) {
+        importBooks(t, router, "", "application/x-ndjson", `{"title":"Dune","author":"Frank Herbert","year":1965,"genre":"Science Fiction"}
+{"title":"Hyperion","author":"Dan Simmons","year":1989,"genre":"Science Fiction","description":"Seven pilgrims, one \"Shrike\""}
+{"title":"It","author":"Stephen King","year":1986,"genre":"Horror"}
+`)
+
+        response := exportBooks(t, router, "genre=Science+Fiction&sort=year&order=desc")
+        if status := response.Code; status != http.StatusOK {
+            t.Fatalf("Status code differs. Expected %d. Got %d instead", http.StatusOK, status)
+        }
+        if disposition := response.Header().Get("Content-Disposition"); !strings.HasPrefix(disposition, "attachment; filename=") || !strings.HasSuffix(disposition, `.csv"`) {
+            t.Errorf("Unexpected Content-Disposition: %s", disposition)
+        }
+        records, err := csv.NewReader(response.Body).ReadAll()
+        if err != nil {
+            t.Fatalf("Failed to parse CSV: %v", err)
+        }
+        if len(records) != 3 || records[0][1] != "title" || records[1][1] != "Hyperion" || records[2][1] != "Dune" {
+            t.Errorf("Unexpected CSV export: %v", records)
+        }
+        if records[1][8] != `Seven pilgrims, one "Shrike"` {
+            t.Errorf("Description was not quoted properly: %q", records[1][8])
+        }
+
+        response = exportBooks(t, router, "format=ndjson&sort=title")
+        if contentType := response.Header().Get("Content-Type"); contentType != "application/x-ndjson" {
+            t.Errorf("Unexpected Content-Type: %s", contentType)
+        }
+        var titles []string
+        scanner := bufio.NewScanner(response.Body)
+        for scanner.Scan() {
+            var book models.Book
+            if err := json.Unmarshal(scanner.Bytes(), &book); err != nil {
+                t.Fatalf("Failed to parse NDJSON line %q: %v", scanner.Text(), err)
+            }
+            titles = append(titles, book.Title)
+        }
+        if strings.Join(titles, ",") != "Dune,Hyperion,It" {
+            t.Errorf("Unexpected NDJSON export: %v", titles)
+        }
+
+        for query, expected := range map[string]int{"format=json": 3, "format=json&genre=Romance": 0} {
+            var books []models.Book
+            if err := json.Unmarshal(exportBooks(t, router, query).Body.Bytes(), &books); err != nil {
+                t.Fatalf("%s: Failed to parse JSON: %v", query, err)
+            }
+            if len(books) != expected {
+                t.Errorf("%s: Expected %d books. Got %d", query, expected, len(books))
+            }
+        }
+
+        for _, query := range []string{"format=marc", "sort=password"} {
+            if status := exportBooks(t, router, query).Code; status != http.StatusBadRequest {
+                t.Errorf("%s: Status code differs. Expected %d. Got %d instead", query, http.StatusBadRequest, status)
+            }
+        }
+    })
+}
@@ -0,0 +1,7 @@
+//go:build sqlite_fts5
+
+package tests
+
+// fts5Expected is set when the tests are built with -tags sqlite_fts5, which
+// links SQLite with FTS5, see database/search.go.
+const fts5Expected = true
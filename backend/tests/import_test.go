@@ -0,0 +1,141 @@
+package tests
+
+import (
+	"book-manager/handlers"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+func importBooks(t *testing.T, router *mux.Router, query, contentType, body string) handlers.ImportReport {
+    request, _ := http.NewRequest("POST", "/books/import"+query, strings.NewReader(body))
+    request.Header.Set("Content-Type", contentType)
+    response := httptest.NewRecorder()
+    router.ServeHTTP(response, request)
+
+    if status := response.Code; status != http.StatusOK {
+        t.Fatalf("Status code differs. Expected %d. Got %d instead: %s", http.StatusOK, status, response.Body.String())
+    }
+    var report handlers.ImportReport
+    if err := json.Unmarshal(response.Body.Bytes(), &report); err != nil {
+        t.Fatalf("Failed to unmarshal report: %v", err)
+    }
+    return report
+}
+
+func countBooks(t *testing.T, router *mux.Router) string {
+    request, _ := http.NewRequest("GET", "/books", nil)
+    response := httptest.NewRecorder()
+    router.ServeHTTP(response, request)
+    return response.Header().Get("X-Total-Count")
+}
+
+func TestImportBooksCSV(t *testing.T) {
+    forEachRepository(t, func(t *testing.T, router *mux.Router) {
+        csv := "Title,Author,Year,ISBN\n" +
+            "Dune,Frank Herbert,1965,0-441-17271-7\n" +
+            "\"Dune, again\",Frank Herbert,1965,978-0441172719\n" +
+            "X,Nobody,1999,\n" +
+            "Neuromancer,William Gibson,nineteen,\n" +
+            "Hyperion,Dan Simmons,1989,\n"
+
+        report := importBooks(t, router, "?batchSize=2", "text/csv", csv)
+        if report.Created != 2 || report.Duplicates != 1 || report.Failed != 2 {
+            t.Fatalf("Unexpected report: %+v", report)
+        }
+
+        expected := []struct {
+            line   int
+            status string
+        }{
+            {2, handlers.ImportCreated},
+            {3, handlers.ImportDuplicate},
+            {4, handlers.ImportFailed},
+            {5, handlers.ImportFailed},
+            {6, handlers.ImportCreated},
+        }
+        for i, row := range report.Rows {
+            if row.Line != expected[i].line || row.Status != expected[i].status {
+                t.Errorf("Row %d: Expected line %d to be %s. Got %+v", i, expected[i].line, expected[i].status, row)
+            }
+        }
+        if report.Rows[1].ExistingID != report.Rows[0].ID || report.Rows[0].ID == 0 {
+            t.Errorf("The duplicate should point at the first book: %+v", report.Rows[:2])
+        }
+        if len(report.Rows[2].Details) != 1 || report.Rows[2].Details[0].Field != "title" {
+            t.Errorf("Expected a validation error for the title: %+v", report.Rows[2])
+        }
+
+        if total := countBooks(t, router); total != "2" {
+            t.Errorf("Expected 2 books after the import. Got %s", total)
+        }
+
+        request, _ := http.NewRequest("POST", "/books/import", strings.NewReader("title,pages\nDune,412\n"))
+        request.Header.Set("Content-Type", "text/csv")
+        response := httptest.NewRecorder()
+        router.ServeHTTP(response, request)
+        if status := response.Code; status != http.StatusBadRequest {
+            t.Errorf("Unknown columns: Status code differs. Expected %d. Got %d instead", http.StatusBadRequest, status)
+        }
+    })
+}
+
+func TestImportBooksNDJSONDryRun(t *testing.T) {
+    forEachRepository(t, func(t *testing.T, router *mux.Router) {
+        ndjson := `{"title":"Dune","author":"Frank Herbert","year":1965,"isbn":"0441172717"}
+
+{"title":"Dune","author":"Frank Herbert","year":1965,"isbn":"9780441172719"}
+{"title":"Hyperion","author":"Dan Simmons","year":1989,"id":7}
+not json
+`
+        report := importBooks(t, router, "?dryRun=true", "application/x-ndjson", ndjson)
+        if !report.DryRun || report.Created != 1 || report.Duplicates != 1 || report.Failed != 2 {
+            t.Fatalf("Unexpected report: %+v", report)
+        }
+        if report.Rows[1].Line != 3 || report.Rows[0].ID != 0 {
+            t.Errorf("Expected line numbers and no IDs in a dry run: %+v", report.Rows)
+        }
+        if total := countBooks(t, router); total != "0" {
+            t.Errorf("A dry run must not create books. Got %s", total)
+        }
+
+        report = importBooks(t, router, "?format=ndjson", "text/plain", ndjson)
+        if report.DryRun || report.Created != 1 {
+            t.Errorf("Unexpected report: %+v", report)
+        }
+        if total := countBooks(t, router); total != "1" {
+            t.Errorf("Expected 1 book after the import. Got %s", total)
+        }
+    })
+}
+
+func TestImportBooksDryRunAcrossBatches(t *testing.T) {
+    forEachRepository(t, func(t *testing.T, router *mux.Router) {
+        csv := "title,author,year,isbn\n" +
+            "Dune,Frank Herbert,1965,0-441-17271-7\n" +
+            "Hyperion,Dan Simmons,1989,\n" +
+            "\"Dune, again\",Frank Herbert,1965,978-0441172719\n"
+
+        dryRun := importBooks(t, router, "?batchSize=1&dryRun=true", "text/csv", csv)
+        if total := countBooks(t, router); total != "0" {
+            t.Fatalf("A dry run must not create books. Got %s", total)
+        }
+        imported := importBooks(t, router, "?batchSize=1", "text/csv", csv)
+
+        if dryRun.Created != imported.Created || dryRun.Duplicates != imported.Duplicates || dryRun.Failed != imported.Failed {
+            t.Fatalf("The dry run should report the same as the import. Got %+v and %+v", dryRun, imported)
+        }
+        for i, row := range dryRun.Rows {
+            if row.Status != imported.Rows[i].Status {
+                t.Errorf("Line %d: Dry run reports %s, the import %s", row.Line, row.Status, imported.Rows[i].Status)
+            }
+        }
+        if dryRun.Rows[2].Status != handlers.ImportDuplicate || !strings.Contains(dryRun.Rows[2].Message, "line 2") {
+            t.Errorf("Expected line 4 to duplicate line 2: %+v", dryRun.Rows[2])
+        }
+    })
+}
@@ -0,0 +1,92 @@
+package tests
+
+import (
+	"book-manager/handlers"
+	"book-manager/repository"
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// logRecords parses the JSON records written to buf.
+func logRecords(t *testing.T, buf *bytes.Buffer) []map[string]interface{} {
+    var records []map[string]interface{}
+    for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+        if line == "" {
+            continue
+        }
+        var record map[string]interface{}
+        if err := json.Unmarshal([]byte(line), &record); err != nil {
+            t.Fatalf("Log line isn't JSON: %s", line)
+        }
+        records = append(records, record)
+    }
+    return records
+}
+
+func TestRequestLogging(t *testing.T) {
+    t.Parallel()
+    var buf bytes.Buffer
+    server := handlers.NewServer(repository.NewMemoryBookRepository())
+    server.Logger = slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelInfo}))
+    router := signedIn(t, server)
+
+    id := createBookForTesting(t, router)
+    buf.Reset()
+
+    request, _ := http.NewRequest("DELETE", "/books/"+id, nil)
+    request.Header.Set(handlers.RequestIDHeader, "delete-1")
+    response := httptest.NewRecorder()
+    router.ServeHTTP(response, request)
+    if response.Code != http.StatusNoContent || response.Header().Get(handlers.RequestIDHeader) != "delete-1" {
+        t.Fatalf("Expected 204 with the request ID echoed. Got %d %v", response.Code, response.Header())
+    }
+
+    records := logRecords(t, &buf)
+    if len(records) != 2 {
+        t.Fatalf("Expected the handler and the request to be logged. Got %v", records)
+    }
+    for _, record := range records {
+        if record["request_id"] != "delete-1" {
+            t.Errorf("Expected every record to have the request ID. Got %v", record)
+        }
+    }
+    if records[0]["msg"] != "Book moved to trash" || records[0]["book_id"] != float64(1) {
+        t.Errorf("Unexpected handler record: %v", records[0])
+    }
+    access := records[1]
+    if access["msg"] != "Request" || access["level"] != "INFO" || access["method"] != "DELETE" || access["path"] != "/books/"+id ||
+        access["route"] != "DELETE /books/{id}" || access["status"] != float64(204) || access["bytes"] != float64(0) {
+        t.Errorf("Unexpected request record: %v", access)
+    }
+    if _, ok := access["latency_ms"].(float64); !ok {
+        t.Errorf("Expected the latency to be logged. Got %v", access)
+    }
+
+    // Unknown routes are logged too, with a generated request ID.
+    buf.Reset()
+    response = serve(router, "GET", "/nowhere", "")
+    records = logRecords(t, &buf)
+    if len(records) != 1 || records[0]["status"] != float64(404) || records[0]["request_id"] != response.Header().Get(handlers.RequestIDHeader) ||
+        records[0]["bytes"] != float64(response.Body.Len()) {
+        t.Errorf("Unexpected record of an unknown route: %v", records)
+    }
+}
+
+func TestLogLevel(t *testing.T) {
+    t.Parallel()
+    var buf bytes.Buffer
+    server := handlers.NewServer(repository.NewMemoryBookRepository())
+    server.Logger = slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelWarn}))
+    router := signedIn(t, server)
+
+    createBookForTesting(t, router)
+    serve(router, "GET", "/books", "")
+    if buf.Len() != 0 {
+        t.Errorf("Expected successful requests not to be logged at warn level. Got %s", buf.String())
+    }
+}
@@ -0,0 +1,73 @@
+package tests
+
+import (
+	"book-manager/auth"
+	"book-manager/database"
+	"book-manager/handlers"
+	"book-manager/models"
+	"book-manager/repository"
+	"context"
+	"net/http"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// repositories are the BookRepository implementations the API tests run against.
+// Every test gets its own empty store, so tests can run in parallel. See
+// integration_test.go for running them against PostgreSQL and MySQL as well.
+var repositories = map[string]func(t *testing.T) repository.BookRepository{
+    "memory": func(t *testing.T) repository.BookRepository {
+        return repository.NewMemoryBookRepository()
+    },
+    "gorm": func(t *testing.T) repository.BookRepository {
+        db, err := database.Open(filepath.Join(t.TempDir(), "books.db"), "error")
+        if err != nil {
+            t.Fatalf("Failed to open database: %v", err)
+        }
+        closeOnCleanup(t, db)
+        return repository.NewGormBookRepository(db)
+    },
+}
+
+// forEachRepository runs test in parallel against a router backed by each repository implementation.
+func forEachRepository(t *testing.T, test func(t *testing.T, router *mux.Router)) {
+    t.Parallel()
+    for name, newRepository := range repositories {
+        newRepository := newRepository
+        t.Run(name, func(t *testing.T) {
+            t.Parallel()
+            test(t, signedIn(t, handlers.NewServer(newRepository(t))))
+        })
+    }
+}
+
+// signedIn returns the routes of server, sending the access token of a test
+// user with every request that has no Authorization header of its own.
+func signedIn(t *testing.T, server *handlers.Server) *mux.Router {
+    ctx := context.Background()
+    user := models.User{Username: "tester", PasswordHash: "-", Role: models.UserAdmin}
+    if err := server.Books.CreateUser(ctx, &user); err != nil {
+        t.Fatalf("Failed to create test user: %v", err)
+    }
+    session := models.Session{ID: auth.NewID(), UserID: user.ID, RefreshID: auth.NewID(), ExpiresAt: time.Now().Add(time.Hour)}
+    if err := server.Books.CreateSession(ctx, &session); err != nil {
+        t.Fatalf("Failed to create test session: %v", err)
+    }
+    token, _, err := server.Tokens.Issue(auth.AccessToken, user.ID, session.ID, auth.NewID())
+    if err != nil {
+        t.Fatalf("Failed to issue test token: %v", err)
+    }
+
+    routes := server.Routes()
+    router := mux.NewRouter()
+    router.PathPrefix("/").HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        if r.Header.Get("Authorization") == "" {
+            r.Header.Set("Authorization", "Bearer "+token)
+        }
+        routes.ServeHTTP(w, r)
+    })
+    return router
+}
@@ -0,0 +1,117 @@
+package tests
+
+import (
+	"book-manager/database"
+	"book-manager/migrations"
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestMigrationsUpAndDown(t *testing.T) {
+    db := openUnmigrated(t, filepath.Join(t.TempDir(), "books.db"))
+
+    applied, err := migrations.Up(db)
+    if err != nil {
+        t.Fatalf("Failed to migrate up: %v", err)
+    }
+    if len(applied) != len(migrations.All()) {
+        t.Errorf("Expected %d migrations to be applied. Got %d", len(migrations.All()), len(applied))
+    }
+    if !db.Migrator().HasTable("books") {
+        t.Fatal("Expected the books table to exist")
+    }
+
+    if applied, err := migrations.Up(db); err != nil || len(applied) != 0 {
+        t.Errorf("Expected no pending migrations. Got %v, %v", applied, err)
+    }
+
+    for range migrations.All() {
+        if m, err := migrations.Down(db); err != nil || m == nil {
+            t.Fatalf("Failed to migrate down: %v, %v", m, err)
+        }
+    }
+    if db.Migrator().HasTable("books") {
+        t.Error("Expected the books table to be dropped")
+    }
+    if m, err := migrations.Down(db); err != nil || m != nil {
+        t.Errorf("Expected nothing to roll back. Got %v, %v", m, err)
+    }
+
+    statuses, err := migrations.List(db)
+    if err != nil {
+        t.Fatalf("Failed to list migrations: %v", err)
+    }
+    for _, s := range statuses {
+        if s.Applied {
+            t.Errorf("Expected migration %d to be pending", s.Version)
+        }
+    }
+}
+
+func TestMigrationsRefuseNewerSchema(t *testing.T) {
+    dsn := filepath.Join(t.TempDir(), "books.db")
+    db := openUnmigrated(t, dsn)
+    if _, err := migrations.Up(db); err != nil {
+        t.Fatalf("Failed to migrate up: %v", err)
+    }
+
+    future := migrations.Latest() + 1
+    if err := db.Exec("INSERT INTO schema_migrations (version, name, applied_at) VALUES (?, ?, ?)", future, "future", time.Now()).Error; err != nil {
+        t.Fatalf("Failed to record migration: %v", err)
+    }
+
+    if _, err := database.Open(dsn, "error"); !errors.Is(err, migrations.ErrSchemaAhead) {
+        t.Errorf("Expected ErrSchemaAhead when opening the database. Got %v", err)
+    }
+    if _, err := migrations.Down(db); !errors.Is(err, migrations.ErrSchemaAhead) {
+        t.Errorf("Expected ErrSchemaAhead when migrating down. Got %v", err)
+    }
+}
+
+// Databases created by AutoMigrate before versioned migrations existed must be
+// adopted without losing data.
+func TestMigrationsAdoptExistingDatabase(t *testing.T) {
+    dsn := filepath.Join(t.TempDir(), "books.db")
+    db := openUnmigrated(t, dsn)
+    if err := db.Exec(`CREATE TABLE books (id integer PRIMARY KEY AUTOINCREMENT, created_at datetime, updated_at datetime,
+        deleted_at datetime, title text, author text, year integer, genre text, isbn text, publisher text, description text)`).Error; err != nil {
+        t.Fatalf("Failed to create the books table: %v", err)
+    }
+    if err := db.Exec(`INSERT INTO books (title, author, year, isbn) VALUES
+        ('Dune', 'Frank Herbert', 1965, '0-441-17271-7'),
+        ('Dune (again)', 'frank  herbert', 1965, '9780441172719'),
+        ('Children of Dune', 'Frank Herbert & Brian Herbert', 1976, 'not an isbn')`).Error; err != nil {
+        t.Fatalf("Failed to insert books: %v", err)
+    }
+
+    db, err := database.Open(dsn, "error")
+    if err != nil {
+        t.Fatalf("Failed to open the existing database: %v", err)
+    }
+    closeOnCleanup(t, db)
+
+    var isbns []sql.NullString
+    db.Table("books").Order("id").Pluck("isbn13", &isbns)
+    if len(isbns) != 3 {
+        t.Fatalf("Expected the existing books to be kept. Got %d books", len(isbns))
+    }
+    // Only the first of two books with the same ISBN gets the normalized ISBN.
+    if isbns[0].String != "9780441172719" || isbns[1].Valid || isbns[2].Valid {
+        t.Errorf("Unexpected ISBN-13 backfill: %v", isbns)
+    }
+
+    // Author names are deduplicated ignoring case and whitespace.
+    var authors []string
+    db.Table("authors").Order("id").Pluck("name", &authors)
+    if len(authors) != 2 || authors[0] != "Frank Herbert" || authors[1] != "Brian Herbert" {
+        t.Errorf("Unexpected authors: %v", authors)
+    }
+    var credits int64
+    db.Table("book_authors").Where("role = ?", "author").Count(&credits)
+    if credits != 4 {
+        t.Errorf("Expected 4 author credits. Got %d", credits)
+    }
+}
@@ -0,0 +1,287 @@
+package tests
+
+import (
+	"book-manager/handlers"
+	"book-manager/ratelimit"
+	"book-manager/repository"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+func TestParseLimit(t *testing.T) {
+    tests := map[string]ratelimit.Limit{
+        "60/1m":  {Requests: 60, Period: time.Minute},
+        " 5 ":    {Requests: 5, Period: time.Second},
+        "100/1h": {Requests: 100, Period: time.Hour},
+        "off":    {},
+        "0":      {},
+    }
+    for input, expected := range tests {
+        limit, err := ratelimit.ParseLimit(input)
+        if err != nil || limit != expected {
+            t.Errorf("%q: expected %v, got %v (%v)", input, expected, limit, err)
+        }
+        if parsed, _ := ratelimit.ParseLimit(limit.String()); parsed != limit {
+            t.Errorf("%q: %s doesn't parse back", input, limit)
+        }
+    }
+
+    for _, input := range []string{"lots", "-1/1m", "10/soon", "10/0s", "60/1m/1h"} {
+        if _, err := ratelimit.ParseLimit(input); err == nil {
+            t.Errorf("%q: expected an error", input)
+        }
+    }
+}
+
+func TestMemoryRateLimitStore(t *testing.T) {
+    ctx := context.Background()
+    store := ratelimit.NewMemoryStore()
+    limit := ratelimit.Limit{Requests: 3, Period: time.Minute}
+    now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+    for i := 2; i >= 0; i-- {
+        result, _ := store.Take(ctx, "user:1", limit, now)
+        if !result.Allowed || result.Remaining != i {
+            t.Fatalf("Expected request %d to be allowed with %d remaining. Got %+v", 3-i, i, result)
+        }
+    }
+    result, _ := store.Take(ctx, "user:1", limit, now)
+    if result.Allowed || result.RetryAfter != 20*time.Second || result.Reset != time.Minute {
+        t.Errorf("Expected an empty bucket to refill a token in 20s. Got %+v", result)
+    }
+    if result, _ := store.Take(ctx, "user:2", limit, now); !result.Allowed {
+        t.Errorf("Expected another client to have its own bucket. Got %+v", result)
+    }
+
+    now = now.Add(20 * time.Second)
+    if result, _ := store.Peek(ctx, "user:1", limit, now); !result.Allowed || result.Remaining != 1 {
+        t.Errorf("Expected a token to peek at after 20s. Got %+v", result)
+    }
+    if result, _ := store.Take(ctx, "user:1", limit, now); !result.Allowed || result.Remaining != 0 {
+        t.Errorf("Expected a token after 20s. Got %+v", result)
+    }
+    if result, _ := store.Take(ctx, "user:1", limit, now); result.Allowed {
+        t.Errorf("Expected only one token after 20s. Got %+v", result)
+    }
+    if result, _ := store.Peek(ctx, "user:4", limit, now); !result.Allowed || store.Len() != 2 {
+        t.Errorf("Expected peeking not to create a bucket. Got %+v and %d buckets", result, store.Len())
+    }
+
+    // Full buckets are dropped.
+    now = now.Add(2 * time.Minute)
+    store.Take(ctx, "user:3", limit, now)
+    if store.Len() != 1 {
+        t.Errorf("Expected only the bucket of user:3 to be left. Got %d buckets", store.Len())
+    }
+}
+
+func TestRateLimiting(t *testing.T) {
+    t.Parallel()
+    server := handlers.NewServer(repository.NewMemoryBookRepository())
+    server.RateLimits = map[string]ratelimit.Limit{
+        handlers.RateLimitWrite: {Requests: 2, Period: time.Minute},
+        handlers.RateLimitAuth:  {Requests: 4, Period: time.Minute},
+    }
+    router := server.Routes()
+    book := `{"title":"Dune","author":"Frank Herbert","year":1965}`
+
+    registerAdmin(t, server, router, "admin")
+    register(t, router, "editor")
+    admin := signIn(t, router, "admin", "secret password").AccessToken
+    serveWithToken(router, "PUT", "/users/2/role", admin, `{"role":"editor"}`)
+    editor := signIn(t, router, "editor", "secret password").AccessToken
+
+    // Signing in is limited by IP, whoever signs in.
+    response := serve(router, "POST", "/auth/login", `{"username":"admin","password":"secret password"}`)
+    if response.Code != http.StatusTooManyRequests {
+        t.Errorf("Expected the fifth sign in to be limited. Got %d", response.Code)
+    }
+
+    // The role change was the first write of the admin.
+    key := createAPIKey(t, router, admin, `{"name":"ingest","scopes":["books:write"]}`).Key
+    response = serveWithToken(router, "POST", "/books", admin, book)
+    if response.Code != http.StatusTooManyRequests {
+        t.Fatalf("Expected the third write to be limited. Got %d %s", response.Code, response.Body.String())
+    }
+    // Password hashing is slow, so some time has passed since the first write.
+    retryAfter, _ := strconv.Atoi(response.Header().Get("Retry-After"))
+    if retryAfter < 1 || retryAfter > 30 || response.Header().Get("RateLimit-Limit") != "2" ||
+        response.Header().Get("RateLimit-Remaining") != "0" || response.Header().Get("RateLimit-Policy") != "2;w=60" {
+        t.Errorf("Unexpected rate limit headers: %v", response.Header())
+    }
+    var errorResponse handlers.ErrorResponse
+    json.Unmarshal(response.Body.Bytes(), &errorResponse)
+    if errorResponse.Code != handlers.CodeRateLimited {
+        t.Errorf("Expected code %s. Got %+v", handlers.CodeRateLimited, errorResponse)
+    }
+
+    // Other users and API keys have buckets of their own.
+    response = serveWithToken(router, "POST", "/books", editor, book)
+    if response.Code != http.StatusCreated || response.Header().Get("RateLimit-Remaining") != "1" {
+        t.Errorf("Expected the editor to have a bucket of their own. Got %d %v", response.Code, response.Header())
+    }
+    if response := serveWithAPIKey(router, "POST", "/books", key, `{"title":"Emma","author":"Jane Austen","year":1815}`); response.Code != http.StatusCreated {
+        t.Errorf("Expected the API key to have a bucket of its own. Got %d %s", response.Code, response.Body.String())
+    }
+
+    // Reading isn't limited.
+    response = serveWithToken(router, "GET", "/books", admin, "")
+    if response.Code != http.StatusOK || response.Header().Get("RateLimit-Limit") != "" {
+        t.Errorf("Expected reading not to be limited. Got %d %v", response.Code, response.Header())
+    }
+}
+
+func TestRateLimitingFailedAuthentication(t *testing.T) {
+    t.Parallel()
+    server := handlers.NewServer(repository.NewMemoryBookRepository())
+    server.RateLimits = map[string]ratelimit.Limit{
+        handlers.RateLimitAuth: {Requests: 3, Period: time.Minute},
+    }
+    router := server.Routes()
+
+    registerAdmin(t, server, router, "admin")
+    admin := signIn(t, router, "admin", "secret password").AccessToken
+    key := createAPIKey(t, router, admin, `{"name":"ingest","scopes":["books:read"]}`).Key
+
+    // Valid credentials aren't counted.
+    for i := 0; i < 5; i++ {
+        if response := serveWithAPIKey(router, "GET", "/books", key, ""); response.Code != http.StatusOK {
+            t.Fatalf("Expected a valid API key to be accepted. Got %d %s", response.Code, response.Body.String())
+        }
+    }
+
+    for i := 0; i < 3; i++ {
+        if response := serveWithAPIKey(router, "GET", "/books", "bm_guess"+strconv.Itoa(i), ""); response.Code != http.StatusUnauthorized {
+            t.Fatalf("Expected guess %d to be rejected with %d. Got %d", i+1, http.StatusUnauthorized, response.Code)
+        }
+    }
+    response := serveWithAPIKey(router, "GET", "/books", "bm_guess3", "")
+    if response.Code != http.StatusTooManyRequests || response.Header().Get("Retry-After") == "" {
+        t.Fatalf("Expected repeated bad keys to be limited. Got %d %v", response.Code, response.Header())
+    }
+
+    // Once limited, not even the right key or a valid access token is checked.
+    if response := serveWithAPIKey(router, "GET", "/books", key, ""); response.Code != http.StatusTooManyRequests {
+        t.Errorf("Expected the right key to be limited as well. Got %d", response.Code)
+    }
+    if response := serveWithToken(router, "GET", "/books", admin, ""); response.Code != http.StatusTooManyRequests {
+        t.Errorf("Expected access tokens from the same IP to be limited. Got %d", response.Code)
+    }
+    // Anonymous reads don't send credentials.
+    if response := serve(router, "GET", "/books", ""); response.Code != http.StatusOK {
+        t.Errorf("Expected anonymous reads not to be limited. Got %d", response.Code)
+    }
+}
+
+// serveFrom serves a request from the client at remoteAddr.
+func serveFrom(router *mux.Router, remoteAddr, method, path, body string) *httptest.ResponseRecorder {
+    request, _ := http.NewRequest(method, path, strings.NewReader(body))
+    request.Header.Set("Content-Type", "application/json")
+    request.RemoteAddr = remoteAddr
+    response := httptest.NewRecorder()
+    router.ServeHTTP(response, request)
+    return response
+}
+
+func TestRateLimitingFailedSignIn(t *testing.T) {
+    t.Parallel()
+    server := handlers.NewServer(repository.NewMemoryBookRepository())
+    server.RateLimits = map[string]ratelimit.Limit{
+        handlers.RateLimitAuth: {Requests: 3, Period: time.Minute},
+    }
+    router := server.Routes()
+
+    registerAdmin(t, server, router, "admin")
+    admin := signIn(t, router, "admin", "secret password").AccessToken
+    key := createAPIKey(t, router, admin, `{"name":"ingest","scopes":["books:read"]}`).Key
+
+    const guesser = "203.0.113.7:4321"
+    for i := 0; i < 3; i++ {
+        response := serveFrom(router, guesser, "POST", "/auth/login", `{"username":"admin","password":"guess number `+strconv.Itoa(i)+`"}`)
+        if response.Code != http.StatusUnauthorized {
+            t.Fatalf("Expected guess %d to be rejected with %d. Got %d", i+1, http.StatusUnauthorized, response.Code)
+        }
+    }
+    if response := serveFrom(router, guesser, "POST", "/auth/login", `{"username":"admin","password":"secret password"}`); response.Code != http.StatusTooManyRequests {
+        t.Errorf("Expected repeated wrong passwords to be limited. Got %d", response.Code)
+    }
+    // The failed sign-ins count against the IP, whatever the credentials.
+    request, _ := http.NewRequest("GET", "/books", nil)
+    request.Header.Set("X-API-Key", key)
+    request.RemoteAddr = guesser
+    response := httptest.NewRecorder()
+    router.ServeHTTP(response, request)
+    if response.Code != http.StatusTooManyRequests {
+        t.Errorf("Expected the API key to be limited from the same IP. Got %d", response.Code)
+    }
+    if response := serveWithAPIKey(router, "GET", "/books", key, ""); response.Code != http.StatusOK {
+        t.Errorf("Expected other IPs not to be limited. Got %d", response.Code)
+    }
+
+    const stealer = "203.0.113.8:4321"
+    for i := 0; i < 3; i++ {
+        if response := serveFrom(router, stealer, "POST", "/auth/refresh", `{"refreshToken":"stolen"}`); response.Code != http.StatusUnauthorized {
+            t.Fatalf("Expected refresh %d to be rejected with %d. Got %d", i+1, http.StatusUnauthorized, response.Code)
+        }
+    }
+    if response := serveFrom(router, stealer, "GET", "/books", ""); response.Code != http.StatusOK {
+        t.Errorf("Expected anonymous reads not to be limited. Got %d", response.Code)
+    }
+    request, _ = http.NewRequest("GET", "/books", nil)
+    request.Header.Set("Authorization", "Bearer "+admin)
+    request.RemoteAddr = stealer
+    response = httptest.NewRecorder()
+    router.ServeHTTP(response, request)
+    if response.Code != http.StatusTooManyRequests {
+        t.Errorf("Expected repeated bad refresh tokens to be limited. Got %d", response.Code)
+    }
+}
+
+func TestRateLimitingBehindProxies(t *testing.T) {
+    t.Parallel()
+    server := handlers.NewServer(repository.NewMemoryBookRepository())
+    server.RateLimits = map[string]ratelimit.Limit{
+        handlers.RateLimitRead: {Requests: 1, Period: time.Minute},
+    }
+    server.TrustedProxies = []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")}
+    router := server.Routes()
+
+    tests := []struct {
+        name       string
+        remoteAddr string
+        headers    map[string]string
+        expected   int
+    }{
+        {"client behind proxy", "10.0.0.1:5000", map[string]string{"X-Forwarded-For": "198.51.100.1"}, http.StatusOK},
+        {"same client again", "10.0.0.2:5000", map[string]string{"X-Forwarded-For": "198.51.100.1"}, http.StatusTooManyRequests},
+        {"other client", "10.0.0.1:5000", map[string]string{"X-Forwarded-For": "198.51.100.2"}, http.StatusOK},
+        {"spoofed first hop", "10.0.0.1:5000", map[string]string{"X-Forwarded-For": "198.51.100.2, 198.51.100.3"}, http.StatusOK},
+        {"chain of proxies", "10.0.0.1:5000", map[string]string{"X-Forwarded-For": "198.51.100.3, 10.0.0.9"}, http.StatusTooManyRequests},
+        {"forwarded", "10.0.0.1:5000", map[string]string{"Forwarded": `for="[2001:db8::1]:4711";proto=https, for=10.0.0.9`}, http.StatusOK},
+        {"forwarded over x-forwarded-for", "10.0.0.1:5000", map[string]string{"Forwarded": "for=2001:db8::1", "X-Forwarded-For": "198.51.100.6"}, http.StatusTooManyRequests},
+        {"untrusted peer", "203.0.113.1:5000", map[string]string{"X-Forwarded-For": "198.51.100.4"}, http.StatusOK},
+        {"untrusted peer spoofing", "203.0.113.1:5000", map[string]string{"X-Forwarded-For": "198.51.100.5"}, http.StatusTooManyRequests},
+    }
+
+    for _, test := range tests {
+        request, _ := http.NewRequest("GET", "/books", nil)
+        for name, value := range test.headers {
+            request.Header.Set(name, value)
+        }
+        request.RemoteAddr = test.remoteAddr
+        response := httptest.NewRecorder()
+        router.ServeHTTP(response, request)
+        if response.Code != test.expected {
+            t.Errorf("%s: expected %d. Got %d", test.name, test.expected, response.Code)
+        }
+    }
+}
@@ -0,0 +1,164 @@
+package tests
+
+import (
+	"book-manager/handlers"
+	"book-manager/models"
+	"book-manager/repository"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+// register creates a user through the API and returns its ID.
+func register(t *testing.T, router *mux.Router, username string) uint {
+    response := serve(router, "POST", "/auth/register", `{"username":"`+username+`","password":"secret password"}`)
+    if response.Code != http.StatusCreated {
+        t.Fatalf("Failed to register %s: %d %s", username, response.Code, response.Body.String())
+    }
+    var user models.User
+    json.Unmarshal(response.Body.Bytes(), &user)
+    return user.ID
+}
+
+// registerAdmin registers a user and makes them an admin, like the
+// create-admin command does for the first admin.
+func registerAdmin(t *testing.T, server *handlers.Server, router *mux.Router, username string) uint {
+    id := register(t, router, username)
+    if _, err := server.Books.SetUserRole(context.Background(), id, models.UserAdmin); err != nil {
+        t.Fatalf("Failed to make %s an admin: %v", username, err)
+    }
+    return id
+}
+
+func TestRoles(t *testing.T) {
+    t.Parallel()
+    for name, newRepository := range repositories {
+        newRepository := newRepository
+        t.Run(name, func(t *testing.T) {
+            t.Parallel()
+            server := handlers.NewServer(newRepository(t))
+            router := server.Routes()
+            book := `{"title":"Dune","author":"Frank Herbert","year":1965}`
+
+            // Registering never makes an admin, not even the first user.
+            adminID := register(t, router, "admin")
+            if user, _ := server.Books.GetUser(context.Background(), adminID); user.Role != models.UserViewer {
+                t.Errorf("Expected the first user to be a viewer. Got %s", user.Role)
+            }
+            if _, err := server.Books.SetUserRole(context.Background(), adminID, models.UserAdmin); err != nil {
+                t.Fatal(err)
+            }
+            editorID := register(t, router, "editor")
+            viewerID := register(t, router, "viewer")
+            admin := signIn(t, router, "admin", "secret password").AccessToken
+            editor := signIn(t, router, "editor", "secret password").AccessToken
+            viewer := signIn(t, router, "viewer", "secret password").AccessToken
+
+            response := serveWithToken(router, "GET", "/auth/me", viewer, "")
+            if response.Code != http.StatusOK || !strings.Contains(response.Body.String(), `"role":"viewer"`) {
+                t.Errorf("Expected new users to be viewers. Got %d %s", response.Code, response.Body.String())
+            }
+            response = serveWithToken(router, "POST", "/books", viewer, book)
+            var errorResponse handlers.ErrorResponse
+            json.Unmarshal(response.Body.Bytes(), &errorResponse)
+            if response.Code != http.StatusForbidden || errorResponse.Code != handlers.CodeForbidden {
+                t.Errorf("Expected viewers not to add books. Got %d %s", response.Code, response.Body.String())
+            }
+            if response := serveWithToken(router, "GET", "/users", editor, ""); response.Code != http.StatusForbidden {
+                t.Errorf("Expected only admins to list users. Got %d", response.Code)
+            }
+            if response := serve(router, "GET", "/books/trash", ""); response.Code != http.StatusUnauthorized {
+                t.Errorf("Expected anonymous users not to list the trash. Got %d", response.Code)
+            }
+            if response := serveWithToken(router, "GET", "/books/trash", viewer, ""); response.Code != http.StatusForbidden {
+                t.Errorf("Expected viewers not to list the trash. Got %d", response.Code)
+            }
+
+            response = serveWithToken(router, "PUT", fmt.Sprintf("/users/%d/role", editorID), admin, `{"role":"editor"}`)
+            if response.Code != http.StatusOK || !strings.Contains(response.Body.String(), `"role":"editor"`) {
+                t.Fatalf("Failed to make a user an editor: %d %s", response.Code, response.Body.String())
+            }
+            if response := serveWithToken(router, "PUT", fmt.Sprintf("/users/%d/role", viewerID), admin, `{"role":"owner"}`); response.Code != http.StatusBadRequest {
+                t.Errorf("Expected unknown roles to be rejected. Got %d", response.Code)
+            }
+            if response := serveWithToken(router, "PUT", "/users/999/role", admin, `{"role":"editor"}`); response.Code != http.StatusNotFound {
+                t.Errorf("Expected 404 for an unknown user. Got %d", response.Code)
+            }
+            if response := serveWithToken(router, "PUT", fmt.Sprintf("/users/%d/role", viewerID), editor, `{"role":"admin"}`); response.Code != http.StatusForbidden {
+                t.Errorf("Expected editors not to change roles. Got %d", response.Code)
+            }
+
+            // The role is checked on every request, so it applies to tokens issued before it changed.
+            response = serveWithToken(router, "POST", "/books", editor, book)
+            var created models.Book
+            json.Unmarshal(response.Body.Bytes(), &created)
+            if response.Code != http.StatusCreated {
+                t.Fatalf("Expected editors to add books. Got %d %s", response.Code, response.Body.String())
+            }
+            bookPath := fmt.Sprintf("/books/%d", created.ID)
+            if response := serveWithToken(router, "GET", "/books/trash", editor, ""); response.Code != http.StatusOK {
+                t.Errorf("Expected editors to list the trash. Got %d", response.Code)
+            }
+            if response := serveWithToken(router, "DELETE", bookPath, editor, ""); response.Code != http.StatusForbidden {
+                t.Errorf("Expected editors not to delete books. Got %d", response.Code)
+            }
+            batch := fmt.Sprintf(`{"operations":[{"op":"delete","id":%d}]}`, created.ID)
+            if response := serveWithToken(router, "POST", "/books/batch", editor, batch); response.Code != http.StatusForbidden {
+                t.Errorf("Expected editors not to delete books in a batch. Got %d", response.Code)
+            }
+            if response := serveWithToken(router, "DELETE", bookPath, admin, ""); response.Code != http.StatusNoContent {
+                t.Errorf("Expected admins to delete books. Got %d %s", response.Code, response.Body.String())
+            }
+
+            response = serveWithToken(router, "PUT", fmt.Sprintf("/users/%d/role", adminID), admin, `{"role":"viewer"}`)
+            json.Unmarshal(response.Body.Bytes(), &errorResponse)
+            if response.Code != http.StatusConflict || errorResponse.Code != handlers.CodeLastAdmin {
+                t.Errorf("Expected the last admin to keep the role. Got %d %s", response.Code, response.Body.String())
+            }
+            serveWithToken(router, "PUT", fmt.Sprintf("/users/%d/role", editorID), admin, `{"role":"admin"}`)
+            if response := serveWithToken(router, "PUT", fmt.Sprintf("/users/%d/role", adminID), admin, `{"role":"viewer"}`); response.Code != http.StatusOK {
+                t.Errorf("Expected an admin to step down once there is another. Got %d %s", response.Code, response.Body.String())
+            }
+
+            response = serveWithToken(router, "GET", "/users", editor, "")
+            var users []models.User
+            json.Unmarshal(response.Body.Bytes(), &users)
+            if response.Code != http.StatusOK || len(users) != 3 || users[0].Username != "admin" || users[0].Role != models.UserViewer {
+                t.Errorf("Unexpected users: %d %+v", response.Code, users)
+            }
+        })
+    }
+}
+
+// TestPermissionsCoverRoutes makes sure that every route that changes
+// anything has an entry in the permission table, and that API keys are only
+// allowed on existing routes an editor can call.
+func TestPermissionsCoverRoutes(t *testing.T) {
+    t.Parallel()
+    router := handlers.NewServer(repository.NewMemoryBookRepository()).Routes()
+    routes := map[string]bool{}
+    router.Walk(func(route *mux.Route, router *mux.Router, ancestors []*mux.Route) error {
+        template, _ := route.GetPathTemplate()
+        methods, _ := route.GetMethods()
+        for _, method := range methods {
+            routes[method+" "+template] = true
+            if _, ok := handlers.Permissions[method+" "+template]; !ok && method != "GET" {
+                t.Errorf("%s %s has no permission", method, template)
+            }
+        }
+        return nil
+    })
+    for route, scope := range handlers.APIKeyScopes {
+        if !routes[route] || !models.ValidScope(scope) {
+            t.Errorf("%s: unknown route or scope %s", route, scope)
+        }
+        if role, ok := handlers.Permissions[route]; ok && !models.RoleAllows(models.UserEditor, role) {
+            t.Errorf("%s needs the %s role, but API keys act as editors", route, role)
+        }
+    }
+}
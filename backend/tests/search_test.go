@@ -0,0 +1,43 @@
+package tests
+
+import (
+	"book-manager/database"
+	"book-manager/handlers"
+	"book-manager/repository"
+	"context"
+	"path/filepath"
+	"testing"
+)
+
+// TestSQLiteSearchMethod fails if SQLite doesn't use the search method the
+// build was meant to use, so that a build without FTS5 can't pass for one
+// with it. See fts5Expected.
+func TestSQLiteSearchMethod(t *testing.T) {
+    t.Parallel()
+    db, err := database.Open(filepath.Join(t.TempDir(), "books.db"), "error")
+    if err != nil {
+        t.Fatalf("Failed to open database: %v", err)
+    }
+    closeOnCleanup(t, db)
+    books := repository.NewGormBookRepository(db)
+
+    expected := "like"
+    if fts5Expected {
+        expected = "fts5"
+    }
+    if method := books.SearchMethod(); method != expected {
+        t.Fatalf("Expected SQLite to search with %s. Got %s", expected, method)
+    }
+
+    // Title matches weigh more than description matches, whichever is ranked by.
+    router := signedIn(t, handlers.NewServer(books))
+    serve(router, "POST", "/books", `{"title":"Gardens","author":"Ann Author","year":2001,"description":"About orchids"}`)
+    serve(router, "POST", "/books", `{"title":"Orchids","author":"Bob Author","year":2002}`)
+    hits, err := books.Search(context.Background(), "orchid*", 10)
+    if err != nil {
+        t.Fatalf("Failed to search: %v", err)
+    }
+    if len(hits) != 2 || hits[0].Book.Title != "Orchids" {
+        t.Errorf("Expected the title match first. Got %+v", hits)
+    }
+}
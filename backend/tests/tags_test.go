@@ -0,0 +1,83 @@
+package tests
+
+import (
+	"book-manager/handlers"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+func TestBookTags(t *testing.T) {
+    forEachRepository(t, func(t *testing.T, router *mux.Router) {
+        first := createBookForTesting(t, router)
+        second := createBookForTesting(t, router)
+        createBookForTesting(t, router)
+
+        tag := func(method, path, body string) []string {
+            response := serve(router, method, path, body)
+            if response.Code != http.StatusOK {
+                t.Fatalf("%s %s: Expected status 200. Got %d: %s", method, path, response.Code, response.Body.String())
+            }
+            var tags []string
+            json.Unmarshal(response.Body.Bytes(), &tags)
+            return tags
+        }
+
+        tags := tag("POST", "/books/"+first+"/tags", `{"tags":["To Read","signed-copy","to-read"]}`)
+        if len(tags) != 2 || tags[0] != "signed-copy" || tags[1] != "to-read" {
+            t.Errorf("Expected tags to be normalized and deduplicated. Got %v", tags)
+        }
+        tag("POST", "/books/"+second+"/tags", `{"tags":["to-read","favourite"]}`)
+        if tags := tag("DELETE", "/books/"+second+"/tags?tag=favourite,unknown", ""); len(tags) != 1 || tags[0] != "to-read" {
+            t.Errorf("Expected one tag to remain. Got %v", tags)
+        }
+
+        tests := []struct {
+            query    string
+            expected string
+        }{
+            {"?tag=to-read", "2"},
+            {"?tag=to-read&tag=signed-copy", "1"},
+            {"?tag=signed-copy,to-read&tagMatch=all", "1"},
+            {"?tag=signed-copy,favourite&tagMatch=any", "1"},
+            {"?tag=favourite", "0"},
+        }
+        for _, test := range tests {
+            response := serve(router, "GET", "/books"+test.query, "")
+            if total := response.Header().Get("X-Total-Count"); total != test.expected {
+                t.Errorf("%s: Expected %s books. Got %s", test.query, test.expected, total)
+            }
+        }
+
+        response := serve(router, "GET", "/tags", "")
+        var counts []handlers.TagResult
+        json.Unmarshal(response.Body.Bytes(), &counts)
+        if len(counts) != 2 || counts[0].Tag != "to-read" || counts[0].BookCount != 2 || counts[1].BookCount != 1 {
+            t.Errorf("Unexpected tag counts: %s", response.Body.String())
+        }
+
+        // Tags of trashed books are not counted.
+        serve(router, "DELETE", "/books/"+first, "")
+        response = serve(router, "GET", "/tags?prefix=TO", "")
+        json.Unmarshal(response.Body.Bytes(), &counts)
+        if len(counts) != 1 || counts[0].BookCount != 1 {
+            t.Errorf("Unexpected tag counts after trashing a book: %s", response.Body.String())
+        }
+
+        for _, request := range []struct{ method, path, body string }{
+            {"POST", "/books/" + second + "/tags", `{"tags":["no spaces allowed!"]}`},
+            {"DELETE", "/books/" + second + "/tags", ""},
+            {"GET", "/books?tag=-invalid", ""},
+            {"GET", "/books?tag=to-read&tagMatch=some", ""},
+        } {
+            if response := serve(router, request.method, request.path, request.body); response.Code != http.StatusBadRequest {
+                t.Errorf("%s %s: Expected status 400. Got %d", request.method, request.path, response.Code)
+            }
+        }
+        if response := serve(router, "GET", "/books/999/tags", ""); response.Code != http.StatusNotFound {
+            t.Errorf("Expected status 404 for a missing book. Got %d", response.Code)
+        }
+    })
+}
@@ -0,0 +1,136 @@
+package tests
+
+import (
+	"book-manager/handlers"
+	"book-manager/models"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+func TestPublishers(t *testing.T) {
+    forEachRepository(t, func(t *testing.T, router *mux.Router) {
+        response := serve(router, "POST", "/books", `{"title":"Dune","author":"Frank Herbert","year":1965,"publisher":"Penguin"}`)
+        var dune models.Book
+        json.Unmarshal(response.Body.Bytes(), &dune)
+        response = serve(router, "POST", "/books", `{"title":"Emma","author":"Jane Austen","year":1815,"publisher":" penguin "}`)
+        var emma models.Book
+        json.Unmarshal(response.Body.Bytes(), &emma)
+        if dune.PublisherID == nil || emma.PublisherID == nil || *dune.PublisherID != *emma.PublisherID || emma.Publisher != "Penguin" {
+            t.Fatalf("Expected both books to refer to the same publisher. Got %+v and %+v", dune, emma)
+        }
+
+        response = serve(router, "POST", "/publishers", `{"name":"Penguin Books"}`)
+        var penguinBooks models.Publisher
+        json.Unmarshal(response.Body.Bytes(), &penguinBooks)
+        if response.Code != http.StatusCreated {
+            t.Fatalf("Failed to create a publisher: %d %s", response.Code, response.Body.String())
+        }
+        if response := serve(router, "POST", "/publishers", `{"name":"PENGUIN"}`); response.Code != http.StatusConflict {
+            t.Errorf("Expected a duplicate publisher to be rejected. Got %d", response.Code)
+        }
+
+        // A changed publisherId wins over the unchanged name.
+        response = serve(router, "PATCH", fmt.Sprintf("/books/%d", emma.ID), fmt.Sprintf(`{"publisherId":%d}`, penguinBooks.ID))
+        json.Unmarshal(response.Body.Bytes(), &emma)
+        if emma.Publisher != "Penguin Books" {
+            t.Errorf("Expected the book to move to Penguin Books. Got %+v", emma)
+        }
+        if response := serve(router, "PATCH", fmt.Sprintf("/books/%d", emma.ID), `{"publisherId":999}`); response.Code != http.StatusBadRequest {
+            t.Errorf("Expected an unknown publisher to be rejected. Got %d", response.Code)
+        }
+
+        response = serve(router, "POST", fmt.Sprintf("/publishers/%d/merge", *dune.PublisherID), fmt.Sprintf(`{"targetId":%d}`, penguinBooks.ID))
+        var merge handlers.MergeResult
+        json.Unmarshal(response.Body.Bytes(), &merge)
+        if response.Code != http.StatusOK || merge.MovedBooks != 1 {
+            t.Fatalf("Unexpected merge result: %d %s", response.Code, response.Body.String())
+        }
+        if response := serve(router, "GET", fmt.Sprintf("/publishers/%d", *dune.PublisherID), ""); response.Code != http.StatusNotFound {
+            t.Errorf("Expected the merged publisher to be deleted. Got %d", response.Code)
+        }
+
+        serve(router, "PUT", fmt.Sprintf("/publishers/%d", penguinBooks.ID), `{"name":"Penguin Random House"}`)
+        response = serve(router, "GET", "/publishers", "")
+        var publishers []handlers.PublisherResult
+        json.Unmarshal(response.Body.Bytes(), &publishers)
+        if len(publishers) != 1 || publishers[0].Name != "Penguin Random House" || publishers[0].BookCount != 2 {
+            t.Errorf("Unexpected publishers: %s", response.Body.String())
+        }
+        response = serve(router, "GET", fmt.Sprintf("/books/%d", dune.ID), "")
+        var renamed models.Book
+        json.Unmarshal(response.Body.Bytes(), &renamed)
+        if renamed.Publisher != "Penguin Random House" {
+            t.Errorf("Expected the rename to update the book. Got %q", renamed.Publisher)
+        }
+        if response := serve(router, "DELETE", fmt.Sprintf("/publishers/%d", penguinBooks.ID), ""); response.Code != http.StatusConflict {
+            t.Errorf("Expected a publisher with books not to be deleted. Got %d", response.Code)
+        }
+    })
+}
+
+func TestGenreHierarchy(t *testing.T) {
+    forEachRepository(t, func(t *testing.T, router *mux.Router) {
+        response := serve(router, "POST", "/books", `{"title":"The Lord of the Rings","author":"J. R. R. Tolkien","year":1954,"genre":"Fiction > Fantasy > Epic"}`)
+        var lotr models.Book
+        json.Unmarshal(response.Body.Bytes(), &lotr)
+        if lotr.Genre != "Epic" || lotr.GenreID == nil {
+            t.Fatalf("Expected the book to be in the leaf genre. Got %+v", lotr)
+        }
+        serve(router, "POST", "/books", `{"title":"The Hobbit","author":"J. R. R. Tolkien","year":1937,"genre":"fantasy"}`)
+
+        genres := func() map[string]handlers.GenreResult {
+            response := serve(router, "GET", "/genres", "")
+            var results []handlers.GenreResult
+            json.Unmarshal(response.Body.Bytes(), &results)
+            byName := map[string]handlers.GenreResult{}
+            for _, genre := range results {
+                byName[genre.Name] = genre
+            }
+            return byName
+        }
+        tree := genres()
+        if len(tree) != 3 || tree["Epic"].Path != "Fiction > Fantasy > Epic" {
+            t.Fatalf("Unexpected genres: %+v", tree)
+        }
+        if fiction := tree["Fiction"]; fiction.BookCount != 0 || fiction.TotalBookCount != 2 {
+            t.Errorf("Expected Fiction to count the books of its subgenres. Got %+v", fiction)
+        }
+        if fantasy := tree["Fantasy"]; fantasy.BookCount != 1 || fantasy.TotalBookCount != 2 {
+            t.Errorf("Unexpected counts for Fantasy: %+v", fantasy)
+        }
+
+        fiction, fantasy, epic := tree["Fiction"].ID, tree["Fantasy"].ID, tree["Epic"].ID
+        tests := []struct {
+            method       string
+            path         string
+            body         string
+            expectedCode int
+        }{
+            {"PUT", fmt.Sprintf("/genres/%d", fiction), fmt.Sprintf(`{"name":"Fiction","parentId":%d}`, epic), http.StatusBadRequest},
+            {"POST", fmt.Sprintf("/genres/%d/merge", fiction), fmt.Sprintf(`{"targetId":%d}`, fantasy), http.StatusBadRequest},
+            {"POST", "/genres", `{"name":"Grimdark","parentId":999}`, http.StatusBadRequest},
+            {"POST", "/genres", `{"name":"Fantasy > Dark"}`, http.StatusBadRequest},
+            {"POST", "/genres", `{"name":"EPIC"}`, http.StatusConflict},
+            {"DELETE", fmt.Sprintf("/genres/%d", fantasy), "", http.StatusConflict},
+        }
+        for _, test := range tests {
+            if response := serve(router, test.method, test.path, test.body); response.Code != test.expectedCode {
+                t.Errorf("%s %s %s: Status code differs. Expected %d. Got %d instead: %s", test.method, test.path, test.body, test.expectedCode, response.Code, response.Body.String())
+            }
+        }
+
+        // Merging Fantasy into Fiction moves its book and its subgenre Epic.
+        response = serve(router, "POST", fmt.Sprintf("/genres/%d/merge", fantasy), fmt.Sprintf(`{"targetId":%d}`, fiction))
+        if response.Code != http.StatusOK {
+            t.Fatalf("Failed to merge genres: %d %s", response.Code, response.Body.String())
+        }
+        tree = genres()
+        if len(tree) != 2 || tree["Epic"].Path != "Fiction > Epic" || tree["Fiction"].BookCount != 1 || tree["Fiction"].TotalBookCount != 2 {
+            t.Errorf("Unexpected genres after the merge: %+v", tree)
+        }
+    })
+}
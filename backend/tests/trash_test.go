@@ -0,0 +1,84 @@
+package tests
+
+import (
+	"book-manager/database"
+	"book-manager/handlers"
+	"book-manager/models"
+	"book-manager/repository"
+	"book-manager/storage"
+	"context"
+	"image/color"
+	"net/http"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestPurgeTrashByAge(t *testing.T) {
+    t.Parallel()
+    ctx := context.Background()
+    db, err := database.Open(filepath.Join(t.TempDir(), "books.db"), "error")
+    if err != nil {
+        t.Fatalf("Failed to open database: %v", err)
+    }
+    closeOnCleanup(t, db)
+    books := repository.NewGormBookRepository(db)
+
+    dir := t.TempDir()
+    covers, err := storage.NewLocalStore(dir)
+    if err != nil {
+        t.Fatalf("Failed to open cover store: %v", err)
+    }
+    server := handlers.NewServer(books)
+    server.Covers = covers
+    router := signedIn(t, server)
+
+    // An expired and a recently trashed book, and one that isn't trashed.
+    expired, recent, kept := createBookForTesting(t, router), createBookForTesting(t, router), createBookForTesting(t, router)
+    for _, id := range []string{expired, recent, kept} {
+        if response := uploadCover(router, id, "image/png", pngImage(t, 40, 60, color.White)); response.Code != http.StatusCreated {
+            t.Fatalf("Failed to upload cover: %d %s", response.Code, response.Body.String())
+        }
+    }
+    for _, id := range []string{expired, recent} {
+        if response := serve(router, "DELETE", "/books/"+id, ""); response.Code != http.StatusNoContent {
+            t.Fatalf("Failed to trash book %s: %d", id, response.Code)
+        }
+    }
+    retention := 30 * 24 * time.Hour
+    backdated := time.Now().Add(-retention - time.Hour)
+    if err := db.Unscoped().Model(&models.Book{}).Where("id = ?", expired).Update("deleted_at", backdated).Error; err != nil {
+        t.Fatalf("Failed to backdate book: %v", err)
+    }
+
+    purged, err := books.PurgeTrash(ctx, time.Now().Add(-retention))
+    if err != nil || purged != 1 {
+        t.Fatalf("Expected 1 book to be purged. Got %d (%v)", purged, err)
+    }
+    if err := repository.DeletePurgedCovers(ctx, books, covers); err != nil {
+        t.Fatalf("Failed to delete covers of purged books: %v", err)
+    }
+
+    if response := serve(router, "POST", "/books/"+expired+"/restore", ""); response.Code != http.StatusNotFound {
+        t.Errorf("Expected the expired book to be purged. Got %d", response.Code)
+    }
+    if files := countFiles(filepath.Join(dir, "covers", expired)); files != 0 {
+        t.Errorf("Expected the cover images of the expired book to be deleted. Got %d files", files)
+    }
+    for _, id := range []string{recent, kept} {
+        if files := countFiles(filepath.Join(dir, "covers", id)); files != len(models.CoverSizes) {
+            t.Errorf("Expected the cover images of book %s to be kept. Got %d files", id, files)
+        }
+    }
+    if response := serve(router, "POST", "/books/"+recent+"/restore", ""); response.Code != http.StatusOK {
+        t.Errorf("Expected the recently trashed book to be kept. Got %d", response.Code)
+    }
+    if response := serve(router, "GET", "/books/"+kept+"/cover", ""); response.Code != http.StatusOK {
+        t.Errorf("Expected the cover of the book that wasn't trashed to be kept. Got %d", response.Code)
+    }
+
+    // A second run finds nothing left to purge.
+    if purged, err := books.PurgeTrash(ctx, time.Now().Add(-retention)); err != nil || purged != 0 {
+        t.Errorf("Expected nothing left to purge. Got %d (%v)", purged, err)
+    }
+}
@@ -2,6 +2,7 @@ import type { Metadata } from "next";
 import { Inter } from "next/font/google";
 import "./globals.css";
 
+import { AuthProvider } from "../context/AuthContext";
 import { BookProvider } from "../context/BookContext";
 
 const inter = Inter({ subsets: ["latin"] });
@@ -19,7 +20,9 @@ export default function RootLayout({
   return (
     <html lang="en">
       <body className={inter.className}>
-        <BookProvider>{children}</BookProvider>
+        <AuthProvider>
+          <BookProvider>{children}</BookProvider>
+        </AuthProvider>
       </body>
     </html>
   );
@@ -0,0 +1,87 @@
+"use client";
+
+import React, { useContext, useState } from "react";
+import { useRouter } from "next/navigation";
+import { AuthContext } from "../../context/AuthContext";
+
+const Login = () => {
+  const [username, setUsername] = useState("");
+  const [password, setPassword] = useState("");
+  const [error, setError] = useState<string | null>(null);
+  const [submitting, setSubmitting] = useState(false);
+  const router = useRouter();
+
+  const context = useContext(AuthContext);
+
+  if (!context) {
+    return <div>Context not available</div>;
+  }
+
+  const { login } = context;
+
+  const handleSubmit = async (e: React.FormEvent) => {
+    e.preventDefault();
+    setSubmitting(true);
+    try {
+      await login(username, password);
+      router.push("/");
+    } catch (error) {
+      setError(error instanceof Error ? error.message : "Failed to sign in");
+    } finally {
+      setSubmitting(false);
+    }
+  };
+
+  return (
+    <form
+      onSubmit={handleSubmit}
+      className="max-w-sm mx-auto mt-12 p-6 bg-white shadow-md rounded-lg"
+    >
+      <h1 className="text-2xl font-bold mb-4">Sign In</h1>
+      <div className="mb-4">
+        <label
+          className="block text-gray-700 text-sm font-bold mb-2"
+          htmlFor="username"
+        >
+          Username
+        </label>
+        <input
+          type="text"
+          id="username"
+          autoComplete="username"
+          value={username}
+          onChange={(e) => setUsername(e.target.value)}
+          required
+          className="shadow appearance-none border rounded w-full py-2 px-3 text-gray-700 leading-tight focus:outline-none focus:shadow-outline"
+        />
+      </div>
+      <div className="mb-4">
+        <label
+          className="block text-gray-700 text-sm font-bold mb-2"
+          htmlFor="password"
+        >
+          Password
+        </label>
+        <input
+          type="password"
+          id="password"
+          autoComplete="current-password"
+          value={password}
+          onChange={(e) => setPassword(e.target.value)}
+          required
+          className="shadow appearance-none border rounded w-full py-2 px-3 text-gray-700 leading-tight focus:outline-none focus:shadow-outline"
+        />
+      </div>
+      {error && <p className="text-red-700 mb-4">{error}</p>}
+      <button
+        type="submit"
+        disabled={submitting}
+        className="bg-blue-500 hover:bg-blue-700 text-white font-bold py-2 px-4 rounded disabled:opacity-50"
+      >
+        Sign In
+      </button>
+    </form>
+  );
+};
+
+export default Login;
@@ -1,6 +1,7 @@
 "use client";
 
 import React, { useContext, useState } from "react";
+import { AuthContext } from "../context/AuthContext";
 import { BookContext } from "../context/BookContext";
 import BookForm from "@/components/BookForm";
 import Modal from "@/components/Modal";
@@ -13,12 +14,14 @@ const Dashboard = () => {
   const [currentBook, setCurrentBook] = useState<Book | undefined>(undefined);
 
   const context = useContext(BookContext);
+  const auth = useContext(AuthContext);
 
-  if (!context) {
+  if (!context || !auth) {
     return <div>Context not available</div>;
   }
 
   const { books, deleteBook } = context;
+  const { user, ready, logout } = auth;
 
   const handleEdit = (book: Book) => {
     setCurrentBook(book);
@@ -27,7 +30,29 @@ const Dashboard = () => {
 
   return (
     <div className="container mx-auto p-6">
-      <h1 className="text-3xl font-bold mb-6">Book Dashboard</h1>
+      <div className="flex justify-between items-center mb-6">
+        <h1 className="text-3xl font-bold">Book Dashboard</h1>
+        {ready &&
+          (user ? (
+            <div className="space-x-2">
+              <span>
+                Signed in as <span className="font-semibold">{user.username}</span>
+              </span>
+              <button
+                onClick={logout}
+                className="bg-gray-500 hover:bg-gray-700 text-white font-bold py-1 px-3 rounded"
+              >
+                Sign Out
+              </button>
+            </div>
+          ) : (
+            <Link href="/login">
+              <button className="bg-blue-500 hover:bg-blue-700 text-white font-bold py-1 px-3 rounded">
+                Sign In
+              </button>
+            </Link>
+          ))}
+      </div>
       <button
         onClick={() => {
           setCurrentBook(undefined);
@@ -0,0 +1,118 @@
+"use client";
+
+import React, {
+  createContext,
+  useState,
+  useEffect,
+  useCallback,
+  useRef,
+  ReactNode,
+} from "react";
+
+import {
+  Tokens,
+  login as loginOnServer,
+  logout as logoutOnServer,
+  refresh,
+  currentUser,
+  setAccessToken as setServiceAccessToken,
+  storedRefreshToken,
+} from "@/services/authService";
+
+// Access tokens are refreshed this long before they expire.
+const REFRESH_MARGIN_SECONDS = 30;
+
+interface User {
+  username: string;
+  role: string;
+}
+
+interface AuthContextType {
+  accessToken: string | null;
+  user: User | null;
+  ready: boolean; // false until a stored session was restored or found missing
+  login: (username: string, password: string) => Promise<void>;
+  logout: () => Promise<void>;
+}
+
+const AuthContext = createContext<AuthContextType | undefined>(undefined);
+
+const AuthProvider = ({ children }: { children: ReactNode }) => {
+  const [accessToken, setAccessToken] = useState<string | null>(null);
+  const [expiresIn, setExpiresIn] = useState(0);
+  const [user, setUser] = useState<User | null>(null);
+  const [ready, setReady] = useState(false);
+  const restoring = useRef(false);
+
+  const signOut = useCallback(() => {
+    setServiceAccessToken(null);
+    setAccessToken(null);
+    setUser(null);
+  }, []);
+
+  const applyTokens = useCallback(async (tokens: Tokens) => {
+    setServiceAccessToken(tokens.accessToken);
+    setAccessToken(tokens.accessToken);
+    setExpiresIn(tokens.expiresIn);
+    try {
+      setUser(await currentUser());
+    } catch (error) {
+      console.error(error);
+    }
+  }, []);
+
+  // Restore the session of the stored refresh token after a reload. Refresh
+  // tokens only work once, so this must not run twice.
+  useEffect(() => {
+    if (restoring.current) {
+      return;
+    }
+    restoring.current = true;
+    if (!storedRefreshToken()) {
+      setReady(true);
+      return;
+    }
+    refresh()
+      .then(applyTokens)
+      .catch(signOut)
+      .finally(() => setReady(true));
+  }, [applyTokens, signOut]);
+
+  // Refresh the access token shortly before it expires.
+  useEffect(() => {
+    if (!accessToken) {
+      return;
+    }
+    const delay = Math.max(expiresIn - REFRESH_MARGIN_SECONDS, 1) * 1000;
+    const timer = setTimeout(() => {
+      refresh()
+        .then(applyTokens)
+        .catch((error) => {
+          console.error(error);
+          signOut();
+        });
+    }, delay);
+    return () => clearTimeout(timer);
+  }, [accessToken, expiresIn, applyTokens, signOut]);
+
+  const login = async (username: string, password: string) => {
+    await applyTokens(await loginOnServer(username, password));
+  };
+
+  const logout = async () => {
+    try {
+      await logoutOnServer();
+    } catch (error) {
+      console.error(error);
+    }
+    signOut();
+  };
+
+  return (
+    <AuthContext.Provider value={{ accessToken, user, ready, login, logout }}>
+      {children}
+    </AuthContext.Provider>
+  );
+};
+
+export { AuthContext, AuthProvider };
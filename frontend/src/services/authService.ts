@@ -0,0 +1,92 @@
+const BASE_URL = "http://localhost:8000";
+const REFRESH_TOKEN_KEY = "refreshToken";
+
+export interface Tokens {
+    accessToken: string;
+    refreshToken: string;
+    expiresIn: number; // seconds until the access token expires
+}
+
+// The access token is only kept in memory; AuthContext sets it. The refresh
+// token is stored, so that a reload can get a new access token.
+let accessToken: string | null = null;
+
+export function setAccessToken(token: string | null) {
+    accessToken = token;
+}
+
+export function authHeaders(): Record<string, string> {
+    return accessToken ? { Authorization: `Bearer ${accessToken}` } : {};
+}
+
+export function storedRefreshToken(): string | null {
+    return typeof window === "undefined" ? null : localStorage.getItem(REFRESH_TOKEN_KEY);
+}
+
+async function saveTokens(response: Response): Promise<Tokens> {
+    const tokens: Tokens = await response.json();
+    localStorage.setItem(REFRESH_TOKEN_KEY, tokens.refreshToken);
+    return tokens;
+}
+
+export async function login(username: string, password: string): Promise<Tokens> {
+    const response = await fetch(`${BASE_URL}/auth/login`, {
+        method: "POST",
+        headers: {
+            "Content-Type": "application/json",
+        },
+        body: JSON.stringify({ username, password }),
+    });
+
+    if (response.status === 429) {
+        throw new Error("Too many attempts, please wait a moment");
+    }
+    if (!response.ok) {
+        throw new Error("Wrong username or password");
+    }
+    return saveTokens(response);
+}
+
+// refresh exchanges the stored refresh token for new tokens. Every refresh
+// token can only be used once.
+export async function refresh(): Promise<Tokens> {
+    const refreshToken = storedRefreshToken();
+    if (!refreshToken) {
+        throw new Error("Not signed in");
+    }
+    const response = await fetch(`${BASE_URL}/auth/refresh`, {
+        method: "POST",
+        headers: {
+            "Content-Type": "application/json",
+        },
+        body: JSON.stringify({ refreshToken }),
+    });
+
+    if (!response.ok) {
+        localStorage.removeItem(REFRESH_TOKEN_KEY);
+        throw new Error("Session expired");
+    }
+    return saveTokens(response);
+}
+
+export async function logout() {
+    try {
+        await fetch(`${BASE_URL}/auth/logout`, {
+            method: "POST",
+            headers: authHeaders(),
+        });
+    } finally {
+        accessToken = null;
+        localStorage.removeItem(REFRESH_TOKEN_KEY);
+    }
+}
+
+export async function currentUser(): Promise<{ username: string; role: string }> {
+    const response = await fetch(`${BASE_URL}/auth/me`, {
+        headers: authHeaders(),
+    });
+    if (!response.ok) {
+        throw new Error("Failed to fetch user");
+    }
+    return response.json();
+}
@@ -1,4 +1,5 @@
 import { Book } from "@/types/Book";
+import { authHeaders } from "@/services/authService";
 
 const BASE_URL = "http://localhost:8000";
 
@@ -16,6 +17,7 @@ export async function postBook(book: Book) {
         method: "POST",
         headers: {
             "Content-Type": "application/json",
+            ...authHeaders(),
         },
         body: JSON.stringify(book),
     });
@@ -33,6 +35,7 @@ export async function editBook(updatedBook: Book) {
             method: "PUT",
             headers: {
                 "Content-Type": "application/json",
+                ...authHeaders(),
             },
             body: JSON.stringify(updatedBook),
         }
@@ -50,6 +53,7 @@ export async function editBook(updatedBook: Book) {
 export async function deleteBook(id: number) {
     const response = await fetch(`${BASE_URL}/books/${id}`, {
         method: "DELETE",
+        headers: authHeaders(),
     });
 
     if (!response.ok) {
@@ -6,8 +6,12 @@ export interface Book {
     createdAt: string;
     updatedAt: string;
     deletedAt?: string;
+    version?: number;
     genre?: string;
+    genreId?: number;
     isbn?: string;
+    isbn13?: string;
     publisher?: string;
+    publisherId?: number;
     description?: string;
 }